@@ -6,13 +6,49 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/openapi"
 )
 
+type weightFlags map[string]int
+
+func (w weightFlags) String() string {
+	return fmt.Sprintf("%v", map[string]int(w))
+}
+
+func (w weightFlags) Set(value string) error {
+	idx := strings.LastIndex(value, "=")
+	if idx <= 0 {
+		return fmt.Errorf("expected operation=weight, got %q", value)
+	}
+
+	n, err := strconv.Atoi(value[idx+1:])
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid weight in %q", value)
+	}
+
+	w[value[:idx]] = n
+	return nil
+}
+
 func main() {
 	output := flag.String("output", "test_logs.json", "Output file path")
 	count := flag.Int("count", 100, "Number of log entries to generate")
+	spec := flag.String("openapi", "", "Generate traffic from an OpenAPI 3 document (YAML or JSON)")
+	seed := flag.Int64("seed", 0, "Random seed for reproducible output (0 = random)")
+	weights := weightFlags{}
+	flag.Var(weights, "weight", "Operation weight as 'operationId=N' or 'METHOD /path=N' (can be repeated)")
 	flag.Parse()
 
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	rng := rand.New(rand.NewSource(*seed)) // #nosec G404
+
 	file, err := os.Create(*output)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create file: %v\n", err)
@@ -26,9 +62,19 @@ func main() {
 		}
 	}()
 
+	if *spec != "" {
+		if err := generateFromOpenAPI(file, *spec, *count, *seed, weights); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to generate from OpenAPI: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Generated %d log entries from %s to %s (seed %d)\n", *count, *spec, *output, *seed)
+		return
+	}
+
 	requestTypes := []struct {
 		weight int
-		gen    func() map[string]any
+		gen    func(*rand.Rand) map[string]any
 	}{
 		{40, generateGetUser},
 		{20, generateCheckout},
@@ -42,14 +88,14 @@ func main() {
 	}
 
 	for i := 0; i < *count; i++ {
-		roll := rand.Intn(totalWeight) // #nosec G404
+		roll := rng.Intn(totalWeight)
 		cumulative := 0
 		var entry map[string]any
 
 		for _, rt := range requestTypes {
 			cumulative += rt.weight
 			if roll < cumulative {
-				entry = rt.gen()
+				entry = rt.gen(rng)
 				break
 			}
 		}
@@ -89,11 +135,37 @@ func main() {
 		}
 	}
 
-	fmt.Printf("Generated %d log entries to %s\n", *count, *output)
+	fmt.Printf("Generated %d log entries to %s (seed %d)\n", *count, *output, *seed)
+}
+
+func generateFromOpenAPI(file *os.File, path string, count int, seed int64, weights map[string]int) error {
+	doc, err := openapi.Load(path)
+	if err != nil {
+		return err
+	}
+
+	gen, err := openapi.NewGenerator(doc, seed, weights)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	for i := 0; i < count; i++ {
+		entry, err := gen.Next()
+		if err != nil {
+			return err
+		}
+
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to write entry: %w", err)
+		}
+	}
+
+	return nil
 }
 
-func generateGetUser() map[string]any {
-	userID := rand.Intn(1000) + 1 // #nosec G404
+func generateGetUser(rng *rand.Rand) map[string]any {
+	userID := rng.Intn(1000) + 1
 	return map[string]any{
 		"method": "GET",
 		"path":   fmt.Sprintf("/users/%d", userID),
@@ -104,11 +176,11 @@ func generateGetUser() map[string]any {
 	}
 }
 
-func generateCheckout() map[string]any {
-	numItems := rand.Intn(5) + 1 // #nosec G404
+func generateCheckout(rng *rand.Rand) map[string]any {
+	numItems := rng.Intn(5) + 1
 	items := make([]int, numItems)
 	for i := 0; i < numItems; i++ {
-		items[i] = rand.Intn(1000) + 1 // #nosec G404
+		items[i] = rng.Intn(1000) + 1
 	}
 
 	return map[string]any{
@@ -119,13 +191,13 @@ func generateCheckout() map[string]any {
 			"Accept":       "application/json",
 		},
 		"body": map[string]any{
-			"user_id": rand.Intn(1000) + 1, // #nosec G404
+			"user_id": rng.Intn(1000) + 1,
 			"items":   items,
 		},
 	}
 }
 
-func generateStatus() map[string]any {
+func generateStatus(_ *rand.Rand) map[string]any {
 	return map[string]any{
 		"method": "GET",
 		"path":   "/status",
@@ -136,7 +208,7 @@ func generateStatus() map[string]any {
 	}
 }
 
-func generateSlow() map[string]any {
+func generateSlow(_ *rand.Rand) map[string]any {
 	return map[string]any{
 		"method": "GET",
 		"path":   "/slow",
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kx0101/replayer/internal/grpc/grpctest"
+)
+
+func main() {
+	port := flag.Int("port", 50051, "Port to run the mock gRPC server on")
+	greeting := flag.String("greeting", "Hello", "Greeting returned by SayHello")
+	descriptorOut := flag.String("descriptor-out", "", "Write the service descriptor set to this path and exit")
+	flag.Parse()
+
+	if *descriptorOut != "" {
+		if err := grpctest.WriteDescriptorSet(*descriptorOut); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Descriptor set written to %s\n", *descriptorOut)
+		return
+	}
+
+	addr := fmt.Sprintf("127.0.0.1:%d", *port)
+	fmt.Printf("gRPC mock server running on %s (%s)\n", addr, grpctest.SayHelloPath)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           grpctest.Handler(*greeting),
+		ReadTimeout:       5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
@@ -1,18 +1,27 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/kx0101/replayer/internal/cli"
 	"github.com/kx0101/replayer/internal/cloud"
+	"github.com/kx0101/replayer/internal/filter"
+	"github.com/kx0101/replayer/internal/importer"
 	"github.com/kx0101/replayer/internal/input"
 	"github.com/kx0101/replayer/internal/models"
 	"github.com/kx0101/replayer/internal/output"
 	"github.com/kx0101/replayer/internal/proxy"
+	"github.com/kx0101/replayer/internal/redact"
 	"github.com/kx0101/replayer/internal/replay"
+	"github.com/kx0101/replayer/internal/route"
 	"github.com/kx0101/replayer/internal/rules"
+	"github.com/kx0101/replayer/internal/toolkit"
 )
 
 var (
@@ -21,12 +30,18 @@ var (
 	startReverseProxyFn = proxy.StartReverseProxy
 	readEntriesFn       = input.ReadEntries
 	runReplayFn         = replay.Run
+	followFn            = input.Follow
+	runStreamFn         = replay.RunStream
 	generateHTMLFn      = output.GenerateHTML
 	printSummaryFn      = output.PrintSummary
 	printJSONOutputFn   = output.PrintJSONOutput
 	applyFn             = input.Apply
 	aggregateResultsFn  = output.AggregateResults
 	convertToSummaryFn  = output.ConvertToSummary
+	exportHARFn         = output.ExportHAR
+	exportCurlFn        = output.ExportCurl
+	importFn            = importer.Import
+	toolFn              = toolkit.Run
 )
 
 func main() {
@@ -34,6 +49,24 @@ func main() {
 }
 
 func run() cli.ExitCode {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		importArgs, code := cli.ParseImportArgs(os.Args[2:])
+		if code != cli.ExitOK {
+			return code
+		}
+
+		return runImport(importArgs)
+	}
+
+	if len(os.Args) > 1 && cli.IsToolCommand(os.Args[1]) {
+		toolArgs, code := cli.ParseToolArgs(os.Args[1:])
+		if code != cli.ExitOK {
+			return code
+		}
+
+		return runTool(toolArgs)
+	}
+
 	args, code := cli.ParseArgs()
 	if code != cli.ExitOK {
 		return code
@@ -46,6 +79,8 @@ func execute(args *cli.CliArgs) cli.ExitCode {
 	switch {
 	case args.ParseNginx != "":
 		return runParseNginx(args)
+	case args.ExportHAR != "":
+		return runExportHAR(args)
 	case args.DryRun:
 		return runDryRun(args)
 	case args.CaptureMode:
@@ -64,6 +99,36 @@ func runParseNginx(args *cli.CliArgs) cli.ExitCode {
 	return cli.ExitOK
 }
 
+func runExportHAR(args *cli.CliArgs) cli.ExitCode {
+	fmt.Printf("Exporting %s to HAR %s...\n", args.InputFile, args.ExportHAR)
+	if err := exportHARFn(args.InputFile, args.ExportHAR); err != nil {
+		return handleError("Failed to export HAR", err)
+	}
+
+	return cli.ExitOK
+}
+
+func runImport(args *cli.ImportArgs) cli.ExitCode {
+	if err := importFn(args); err != nil {
+		return handleError("Failed to import "+args.Source, err)
+	}
+
+	return cli.ExitOK
+}
+
+func runTool(args *cli.ToolArgs) cli.ExitCode {
+	err := toolFn(args)
+	if errors.Is(err, toolkit.ErrInvalidEntries) {
+		return cli.ExitInvalid
+	}
+
+	if err != nil {
+		return handleError("Failed to run "+args.Command, err)
+	}
+
+	return cli.ExitOK
+}
+
 func runDryRun(args *cli.CliArgs) cli.ExitCode {
 	if err := dryRunFn(args.InputFile); err != nil {
 		return handleError("Dry run failed", err)
@@ -73,14 +138,81 @@ func runDryRun(args *cli.CliArgs) cli.ExitCode {
 }
 
 func runCapture(args *cli.CliArgs) cli.ExitCode {
-	fmt.Printf("Starting reverse proxy on %s, forwarding to %s...\n", args.ListenAddr, args.Upstream)
+	captureFilter, err := filter.NewSet(args.Filters, args.Excludes)
+	if err != nil {
+		return handleError("Invalid capture filter", err)
+	}
+
+	var redactor *redact.Redactor
+	if args.Redact {
+		redactor, err = redact.Load(args.RedactConfig)
+		if err != nil {
+			return handleError("Invalid redaction config", err)
+		}
+	}
+
+	routes, err := route.New(args.Routes)
+	if err != nil {
+		return handleError("Invalid route pattern", err)
+	}
+
+	var upstreams []proxy.UpstreamRoute
+	if args.UpstreamConfig != "" {
+		upstreams, err = proxy.LoadUpstreams(args.UpstreamConfig)
+		if err != nil {
+			return handleError("Invalid upstream config", err)
+		}
+	}
+
+	var faults []proxy.FaultRule
+	if args.Faults != "" {
+		faults, err = proxy.LoadFaults(args.Faults)
+		if err != nil {
+			return handleError("Invalid fault config", err)
+		}
+	}
+
+	var ca *proxy.CertAuthority
+	if args.Forward {
+		ca, err = proxy.LoadOrCreateCA(args.CACert, args.CAKey)
+		if err != nil {
+			return handleError("Failed to load the CA", err)
+		}
+
+		fmt.Printf("Intercepting HTTPS with the CA in %s, trust it in clients\n", args.CACert)
+	}
+
+	target := args.Upstream
+	switch {
+	case len(upstreams) > 0:
+		target = "the upstreams in " + args.UpstreamConfig
+	case args.Forward:
+		target = "the hosts clients request"
+	}
+
+	fmt.Printf("Starting reverse proxy on %s, forwarding to %s...\n", args.ListenAddr, target)
 	config := &proxy.CaptureConfig{
-		ListenAddr: args.ListenAddr,
-		Upstream:   args.Upstream,
-		OutputFile: args.CaptureOut,
-		Stream:     args.CaptureStream,
-		TLSCert:    args.TLSCert,
-		TLSKey:     args.TLSKey,
+		ListenAddr:     args.ListenAddr,
+		Upstream:       args.Upstream,
+		Upstreams:      upstreams,
+		Forward:        args.Forward,
+		CA:             ca,
+		OutputFile:     args.CaptureOut,
+		Stream:         args.CaptureStream,
+		TLSCert:        args.TLSCert,
+		TLSKey:         args.TLSKey,
+		Filter:         captureFilter,
+		Redactor:       redactor,
+		SampleRate:     args.SampleRate,
+		SamplePerRoute: args.SamplePerRoute,
+		Routes:         routes,
+		MaxBodySize:    args.MaxBodySize,
+		MaxStreamSize:  args.MaxStreamSize,
+		RotateSize:     args.RotateSize,
+		RotateInterval: args.RotateInterval,
+		RotateGzip:     args.RotateGzip,
+		AdminAddr:      args.AdminAddr,
+		Faults:         faults,
 	}
 
 	if err := startReverseProxyFn(config); err != nil {
@@ -90,13 +222,23 @@ func runCapture(args *cli.CliArgs) cli.ExitCode {
 }
 
 func runReplayMode(args *cli.CliArgs) cli.ExitCode {
-	entries, err := readEntriesFn(args)
-	if err != nil {
-		return handleError("failed to read input file", err)
-	}
+	var results []models.MultiEnvResult
+	if args.Follow {
+		var err error
+		if results, err = runFollow(args); err != nil {
+			return handleError("failed to follow input file", err)
+		}
+	} else {
+		entries, err := readEntriesFn(args)
+		if err != nil {
+			return handleError("failed to read input file", err)
+		}
 
-	filtered := applyFn(entries, args)
-	results := runReplayFn(filtered, args)
+		filtered := applyFn(entries, args)
+		if results, err = runReplayFn(filtered, args); err != nil {
+			return handleError("failed to replay", err)
+		}
+	}
 
 	out := &rules.ReplayRunData{
 		Results: results,
@@ -109,6 +251,12 @@ func runReplayMode(args *cli.CliArgs) cli.ExitCode {
 		}
 	}
 
+	if args.ExportCurl != "" {
+		if err := exportCurlFn(out.Results, args, args.ExportCurl); err != nil {
+			return handleError("Failed to export curl commands", err)
+		}
+	}
+
 	if args.CloudUpload {
 		if err := uploadToCloud(args, out); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: cloud upload failed: %v\n", err)
@@ -122,6 +270,34 @@ func runReplayMode(args *cli.CliArgs) cli.ExitCode {
 	return outputResults(args, out)
 }
 
+// runFollow replays entries as they are appended to the input until it is
+// interrupted, printing each result as it completes.
+func runFollow(args *cli.CliArgs) ([]models.MultiEnvResult, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "Following %s, press Ctrl+C to stop...\n", args.InputFile)
+
+	entries := make(chan models.LogEntry)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- followFn(ctx, args, entries)
+	}()
+
+	results, err := runStreamFn(entries, args, func(result models.MultiEnvResult) {
+		if !args.OutputJSON {
+			output.PrintResult(result, args.Compare)
+		}
+	})
+	if err != nil {
+		stop()
+		<-errCh
+		return nil, err
+	}
+
+	return results, <-errCh
+}
+
 func uploadToCloud(args *cli.CliArgs, data *rules.ReplayRunData) error {
 	if args.CloudAPIKey == "" {
 		return fmt.Errorf("REPLAYER_API_KEY not set (use --cloud-api-key or set env var)")
@@ -132,11 +308,25 @@ func uploadToCloud(args *cli.CliArgs, data *rules.ReplayRunData) error {
 		return fmt.Errorf("creating cloud client: %w", err)
 	}
 
+	results := data.Results
+	if args.Redact {
+		redactor, err := redact.Load(args.RedactConfig)
+		if err != nil {
+			return fmt.Errorf("loading redaction config: %w", err)
+		}
+
+		results = make([]models.MultiEnvResult, len(data.Results))
+		copy(results, data.Results)
+		for i := range results {
+			redactor.Result(&results[i])
+		}
+	}
+
 	req := &cloud.UploadRequest{
 		Environment: args.CloudEnv,
 		Targets:     args.Targets,
 		Summary:     data.Summary,
-		Results:     data.Results,
+		Results:     results,
 		Labels:      args.CloudLabels,
 	}
 
@@ -155,7 +345,12 @@ func runRules(args *cli.CliArgs, current *rules.ReplayRunData) cli.ExitCode {
 		return handleError("Failed to load rules", err)
 	}
 
-	baseline := loadBaseline(args.BaselineFile)
+	routes, err := route.New(args.Routes)
+	if err != nil {
+		return handleError("Invalid route pattern", err)
+	}
+
+	baseline := loadBaseline(args.BaselineFile, routes)
 	evalResult := rules.EvaluateRules(rulesConfig, current, baseline)
 
 	if args.OutputJSON {
@@ -166,13 +361,18 @@ func runRules(args *cli.CliArgs, current *rules.ReplayRunData) cli.ExitCode {
 	return rules.GetExitCode(evalResult)
 }
 
-func loadBaseline(baselineFile string) *rules.ReplayRunData {
+func loadBaseline(baselineFile string, routes *route.Templater) *rules.ReplayRunData {
 	if baselineFile == "" {
 		return nil
 	}
 
 	baseline, err := rules.LoadBaselineFile(baselineFile)
 	if err != nil {
+		// A capture file holds the latencies recorded in production.
+		if entries, readErr := readEntriesFn(&cli.CliArgs{InputFile: baselineFile, InputFormat: "auto"}); readErr == nil && len(entries) > 0 {
+			return rules.BaselineFromEntries(entries, routes)
+		}
+
 		fmt.Fprintf(os.Stderr, "Warning: failed to load baseline: %v\n", err)
 		fmt.Fprintf(os.Stderr, "Latency rules will be skipped\n")
 		return nil
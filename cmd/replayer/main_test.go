@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"testing"
 
 	"github.com/kx0101/replayer/internal/cli"
 	"github.com/kx0101/replayer/internal/models"
 	"github.com/kx0101/replayer/internal/proxy"
+	"github.com/kx0101/replayer/internal/redact"
+	"github.com/kx0101/replayer/internal/toolkit"
 )
 
 func TestExecute_ParseNginx(t *testing.T) {
@@ -36,6 +39,72 @@ func TestExecute_ParseNginx(t *testing.T) {
 	}
 }
 
+func TestExecute_ExportHAR(t *testing.T) {
+	called := false
+	exportHARFn = func(input, output string) error {
+		called = true
+		if input != "results.json" || output != "out.har" {
+			t.Errorf("unexpected args: %s %s", input, output)
+		}
+
+		return nil
+	}
+
+	args := &cli.CliArgs{
+		ExportHAR: "out.har",
+		InputFile: "results.json",
+	}
+
+	code := execute(args)
+	if code != cli.ExitOK {
+		t.Errorf("expected ExitOK, got %v", code)
+	}
+
+	if !called {
+		t.Errorf("exportHARFn was not called")
+	}
+}
+
+func TestRunImport(t *testing.T) {
+	importFn = func(args *cli.ImportArgs) error {
+		if args.Source != "postman" || args.InputFile != "collection.json" {
+			t.Errorf("unexpected args: %+v", args)
+		}
+
+		return errors.New("bad collection")
+	}
+
+	code := runImport(&cli.ImportArgs{Source: "postman", InputFile: "collection.json"})
+	if code != cli.ExitRuntime {
+		t.Errorf("expected ExitRuntime, got %v", code)
+	}
+}
+
+func TestRunTool(t *testing.T) {
+	toolFn = func(args *cli.ToolArgs) error {
+		switch args.Command {
+		case "validate":
+			return toolkit.ErrInvalidEntries
+		case "merge":
+			return errors.New("disk full")
+		default:
+			return nil
+		}
+	}
+
+	tests := map[string]cli.ExitCode{
+		"stats":    cli.ExitOK,
+		"validate": cli.ExitInvalid,
+		"merge":    cli.ExitRuntime,
+	}
+
+	for command, want := range tests {
+		if code := runTool(&cli.ToolArgs{Command: command}); code != want {
+			t.Errorf("%s: expected %v, got %v", command, want, code)
+		}
+	}
+}
+
 func TestExecute_DryRun(t *testing.T) {
 	called := false
 	dryRunFn = func(file string) error {
@@ -63,6 +132,8 @@ func TestExecute_DryRun(t *testing.T) {
 }
 
 func TestExecute_Capture(t *testing.T) {
+	t.Setenv(redact.SecretEnv, "test-secret")
+
 	called := false
 	startReverseProxyFn = func(cfg *proxy.CaptureConfig) error {
 		called = true
@@ -70,6 +141,14 @@ func TestExecute_Capture(t *testing.T) {
 			t.Errorf("unexpected config: %+v", cfg)
 		}
 
+		if cfg.Filter.Match(&models.LogEntry{Path: "/health"}) || !cfg.Filter.Match(&models.LogEntry{Path: "/users"}) {
+			t.Errorf("expected capture filter to exclude health checks")
+		}
+
+		if cfg.Redactor == nil {
+			t.Errorf("expected a redactor when --redact is set")
+		}
+
 		return nil
 	}
 
@@ -79,6 +158,8 @@ func TestExecute_Capture(t *testing.T) {
 		Upstream:      "upstream:80",
 		CaptureOut:    "capture.mp4",
 		CaptureStream: true,
+		Excludes:      []string{`path == "/health"`},
+		Redact:        true,
 	}
 
 	code := execute(args)
@@ -89,6 +170,11 @@ func TestExecute_Capture(t *testing.T) {
 	if !called {
 		t.Errorf("startReverseProxyFn was not called")
 	}
+
+	args.Excludes = []string{`path ==`}
+	if code := execute(args); code != cli.ExitRuntime {
+		t.Errorf("expected ExitRuntime for an invalid filter, got %v", code)
+	}
 }
 
 func TestExecute_ReplayMode_RunError(t *testing.T) {
@@ -103,6 +189,48 @@ func TestExecute_ReplayMode_RunError(t *testing.T) {
 	}
 }
 
+func TestExecute_ReplayMode_Follow(t *testing.T) {
+	followFn = func(_ context.Context, args *cli.CliArgs, out chan<- models.LogEntry) error {
+		defer close(out)
+		out <- models.LogEntry{Method: "GET", Path: "/tail"}
+		return nil
+	}
+
+	var streamed []models.LogEntry
+	runStreamFn = func(entries <-chan models.LogEntry, _ *cli.CliArgs, onResult func(models.MultiEnvResult)) ([]models.MultiEnvResult, error) {
+		var results []models.MultiEnvResult
+		for entry := range entries {
+			streamed = append(streamed, entry)
+			results = append(results, models.MultiEnvResult{Index: len(results), Request: entry})
+		}
+
+		return results, nil
+	}
+
+	var printed []models.MultiEnvResult
+	printJSONOutputFn = func(results []models.MultiEnvResult) {
+		printed = results
+	}
+
+	code := execute(&cli.CliArgs{InputFile: "access.log", Follow: true, OutputJSON: true})
+	if code != cli.ExitOK {
+		t.Errorf("expected ExitOK, got %v", code)
+	}
+
+	if len(streamed) != 1 || len(printed) != 1 || printed[0].Request.Path != "/tail" {
+		t.Errorf("expected followed entry to be replayed and reported, got %v", printed)
+	}
+
+	followFn = func(_ context.Context, _ *cli.CliArgs, out chan<- models.LogEntry) error {
+		close(out)
+		return errors.New("follow error")
+	}
+
+	if code := execute(&cli.CliArgs{InputFile: "access.log", Follow: true}); code != cli.ExitRuntime {
+		t.Errorf("expected ExitRuntime, got %v", code)
+	}
+}
+
 func TestHandleError(t *testing.T) {
 	code := handleError("some error", errors.New("oops"))
 	if code != cli.ExitRuntime {
@@ -5,3 +5,12 @@ go 1.23.0
 require github.com/google/uuid v1.6.0
 
 require gopkg.in/yaml.v3 v3.0.1
+
+require (
+	github.com/andybalholm/brotli v1.1.1
+	github.com/klauspost/compress v1.17.11
+	golang.org/x/net v0.38.0
+	google.golang.org/protobuf v1.36.5
+)
+
+require golang.org/x/text v0.23.0 // indirect
@@ -4,6 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/filter"
+	"github.com/kx0101/replayer/internal/route"
 )
 
 type ExitCode int
@@ -18,6 +25,9 @@ const (
 
 type CliArgs struct {
 	InputFile    string
+	InputFormat  string
+	JSONMapping  string
+	Follow       bool
 	Targets      []string
 	Concurrency  int
 	Timeout      int64
@@ -25,6 +35,9 @@ type CliArgs struct {
 	Limit        int
 	FilterMethod string
 	FilterPath   string
+	Filters      []string
+	Excludes     []string
+	Routes       []string
 	DryRun       bool
 	SummaryOnly  bool
 	OutputJSON   bool
@@ -36,21 +49,44 @@ type CliArgs struct {
 	HTMLReport   string
 	ParseNginx   string
 	NginxFormat  string
+	ApacheFormat string
+	ExportHAR    string
+	ExportCurl   string
+	PreserveHost bool
 
 	IgnoreVolatile    bool
 	IgnoreFields      []string
 	IgnorePatterns    []string
 	ShowVolatileDiffs bool
 
-	ListenAddr    string
-	Upstream      string
-	CaptureOut    string
-	CaptureMode   bool
-	CaptureStream bool
+	ListenAddr     string
+	Upstream       string
+	UpstreamConfig string
+	Faults         string
+	Forward        bool
+	CACert         string
+	CAKey          string
+	CaptureOut     string
+	CaptureMode    bool
+	CaptureStream  bool
+
+	SampleRate     float64
+	SamplePerRoute int
+	MaxBodySize    int64
+	MaxStreamSize  int64
+	RotateSize     int64
+	RotateInterval time.Duration
+	RotateGzip     bool
+	AdminAddr      string
 
 	TLSCert string
 	TLSKey  string
 
+	ProtoDescriptor string
+
+	Redact       bool
+	RedactConfig string
+
 	RulesFile    string
 	BaselineFile string
 
@@ -64,13 +100,24 @@ type CliArgs struct {
 func ParseArgs() (*CliArgs, ExitCode) {
 	args := &CliArgs{}
 
-	flag.StringVar(&args.InputFile, "input-file", "", "Path to the input log file")
+	flag.StringVar(&args.InputFile, "input-file", "", "Input file, glob, directory or - for stdin (gzip and zstd are decompressed)")
+	flag.BoolVar(&args.Follow, "follow", false, "Tail the input file and replay new entries as they arrive")
+	flag.StringVar(&args.InputFormat, "input-format", "auto", "Input file format (auto, jsonl, har, pcap, nginx, apache, alb, cloudfront, envoy)")
+	flag.StringVar(&args.JSONMapping, "json-mapping", "", "Path to a YAML mapping for structured JSON logs")
 	flag.IntVar(&args.Concurrency, "concurrency", 1, "Number of concurrent requests")
 	flag.Int64Var(&args.Timeout, "timeout", 5000, "Timeout for request (ms)")
 	flag.Int64Var(&args.Delay, "delay", 0, "Delay per request (ms)")
 	flag.IntVar(&args.Limit, "limit", 0, "Limit the number of requests to replay")
 	flag.StringVar(&args.FilterMethod, "filter-method", "", "Filter method (e.g., GET, POST)")
 	flag.StringVar(&args.FilterPath, "filter-path", "", "Filter path (e.g., /api/resource)")
+
+	var filterFlags, excludeFlags stringSlice
+	flag.Var(&filterFlags, "filter", "Only keep entries matching a filter expression (can be repeated)")
+	flag.Var(&excludeFlags, "exclude", "Drop entries matching a filter expression (can be repeated)")
+
+	var routeFlags stringSlice
+	flag.Var(&routeFlags, "route", "Route pattern for grouping results, e.g. '/users/{id}/posts/{slug}' (can be repeated)")
+
 	flag.BoolVar(&args.DryRun, "dry-run", false, "Enable dry run mode")
 	flag.BoolVar(&args.SummaryOnly, "summary-only", false, "Output summary only")
 	flag.BoolVar(&args.OutputJSON, "output-json", false, "Output results as JSON")
@@ -86,7 +133,13 @@ func ParseArgs() (*CliArgs, ExitCode) {
 	flag.StringVar(&args.HTMLReport, "html-report", "", "Generate HTML report at specified path")
 
 	flag.StringVar(&args.ParseNginx, "parse-nginx", "", "Convert nginx log to json format (output path)")
-	flag.StringVar(&args.NginxFormat, "nginx-format", "combined", "Nginx log format (combined or common)")
+	flag.StringVar(&args.NginxFormat, "nginx-format", "combined", "Nginx log format (combined, common or a log_format definition)")
+	flag.StringVar(&args.ApacheFormat, "apache-format", "combined", "Apache log format (combined, common or a LogFormat definition)")
+
+	flag.StringVar(&args.ExportHAR, "export-har", "", "Export a capture or results file to HAR (output path)")
+	flag.StringVar(&args.ExportCurl, "export-curl", "", "Write a curl command per target for every diffed request (output path)")
+
+	flag.BoolVar(&args.PreserveHost, "preserve-host", false, "Send the recorded Host header instead of the target's")
 
 	flag.BoolVar(&args.IgnoreVolatile, "ignore-volatile", true, "Ignore common volatile fields (timestamps, IDs)")
 	flag.BoolVar(&args.ShowVolatileDiffs, "show-volatile-diffs", false, "Show diffs even if only volatile fields differ")
@@ -99,12 +152,31 @@ func ParseArgs() (*CliArgs, ExitCode) {
 	flag.BoolVar(&args.CaptureMode, "capture", false, "Enable reverse proxy capture mode")
 	flag.StringVar(&args.ListenAddr, "listen", ":8080", "Reverse proxy listen address")
 	flag.StringVar(&args.Upstream, "upstream", "", "Upstream server to proxy to (e.g. production.api.com)")
+	flag.BoolVar(&args.Forward, "forward", false, "Run the capture as a forward proxy that intercepts HTTPS through CONNECT")
+	flag.StringVar(&args.CACert, "ca-cert", "replayer-ca.pem", "CA certificate for --forward, generated with --ca-key when missing")
+	flag.StringVar(&args.CAKey, "ca-key", "replayer-ca-key.pem", "CA private key for --forward")
+	flag.StringVar(&args.UpstreamConfig, "upstream-config", "", "YAML routing table of upstreams by path prefix or Host in capture mode")
+	flag.StringVar(&args.Faults, "faults", "", "YAML fault rules to inject latency, errors, resets and truncated bodies in capture mode")
 	flag.StringVar(&args.CaptureOut, "output", "captured.json", "Output JSON file path")
 	flag.BoolVar(&args.CaptureStream, "stream", false, "Also stream capture records to stdout")
+	flag.Float64Var(&args.SampleRate, "sample", 1, "Fraction of exchanges to record in capture mode (0-1]")
+	flag.IntVar(&args.SamplePerRoute, "sample-per-route", 0, "Record at most N exchanges per route per second (0 = unlimited)")
+	flag.Var((*byteSize)(&args.MaxBodySize), "max-body-size", "Truncate recorded bodies beyond this size, e.g. 64KB (0 = unlimited)")
+	args.MaxStreamSize = 1 << 20
+	flag.Var((*byteSize)(&args.MaxStreamSize), "max-stream-size", "Truncate recorded event streams and bodies of unknown length beyond this size (0 = as --max-body-size)")
+	flag.Var((*byteSize)(&args.RotateSize), "rotate-size", "Start a new capture file beyond this size, e.g. 100MB (0 = never)")
+	flag.DurationVar(&args.RotateInterval, "rotate-interval", 0, "Start a new capture file after this long, e.g. 1h (0 = never)")
+	flag.BoolVar(&args.RotateGzip, "rotate-gzip", false, "Gzip rotated capture files")
+	flag.StringVar(&args.AdminAddr, "admin-listen", "", "Admin API listen address in capture mode, e.g. 127.0.0.1:9090 (empty = disabled)")
 
 	flag.StringVar(&args.TLSCert, "tls-cert", "", "TLS certification")
 	flag.StringVar(&args.TLSKey, "tls-key", "", "TLS key")
 
+	flag.StringVar(&args.ProtoDescriptor, "proto-descriptor", "", "Protobuf descriptor set used to decode gRPC messages as JSON")
+
+	flag.BoolVar(&args.Redact, "redact", false, "Redact credentials and PII from captured traffic and cloud uploads")
+	flag.StringVar(&args.RedactConfig, "redact-config", "", "Path to a YAML redaction config (implies --redact)")
+
 	flag.StringVar(&args.RulesFile, "rules", "", "Path to rules.yaml file for regression testing")
 	flag.StringVar(&args.BaselineFile, "baseline", "", "Path to baseline results JSON for comparison")
 
@@ -126,11 +198,25 @@ func ParseArgs() (*CliArgs, ExitCode) {
 	}
 
 	args.Headers = headerFlags
+	args.Filters = filterFlags
+	args.Excludes = excludeFlags
+	args.Routes = routeFlags
+	args.Redact = args.Redact || args.RedactConfig != ""
 	args.IgnoreFields = ignoreFieldsFlag
 	args.IgnorePatterns = ignorePatternsFlag
 	args.Targets = flag.Args()
 
-	if args.ParseNginx != "" {
+	if _, err := filter.NewSet(args.Filters, args.Excludes); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil, ExitInvalid
+	}
+
+	if _, err := route.New(args.Routes); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil, ExitInvalid
+	}
+
+	if args.ParseNginx != "" || args.ExportHAR != "" {
 		if args.InputFile == "" {
 			fmt.Fprintln(os.Stderr, "Error: --input-file is required")
 			flag.Usage()
@@ -141,12 +227,27 @@ func ParseArgs() (*CliArgs, ExitCode) {
 	}
 
 	if args.CaptureMode {
-		if args.Upstream == "" {
-			fmt.Fprintln(os.Stderr, "Error: --upstream is required in capture mode")
+		if args.Upstream == "" && args.UpstreamConfig == "" && !args.Forward {
+			fmt.Fprintln(os.Stderr, "Error: --upstream, --upstream-config or --forward is required in capture mode")
 			flag.Usage()
 			return nil, ExitInvalid
 		}
 
+		if args.Forward && args.Upstream != "" {
+			fmt.Fprintln(os.Stderr, "Error: --upstream cannot be used with --forward, requests go to the host they name")
+			return nil, ExitInvalid
+		}
+
+		if args.SampleRate <= 0 || args.SampleRate > 1 {
+			fmt.Fprintln(os.Stderr, "Error: --sample must be greater than 0 and at most 1")
+			return nil, ExitInvalid
+		}
+
+		if args.SamplePerRoute < 0 || args.RotateInterval < 0 {
+			fmt.Fprintln(os.Stderr, "Error: --sample-per-route and --rotate-interval cannot be negative")
+			return nil, ExitInvalid
+		}
+
 		return args, ExitOK
 	}
 
@@ -165,6 +266,148 @@ func ParseArgs() (*CliArgs, ExitCode) {
 	return args, ExitOK
 }
 
+type ImportArgs struct {
+	Source      string
+	InputFile   string
+	OutputFile  string
+	Environment string
+	Vars        map[string]string
+
+	Redact       bool
+	RedactConfig string
+}
+
+// ParseImportArgs parses `replayer import <curl|postman|pcap> [flags] [file]`.
+func ParseImportArgs(argv []string) (*ImportArgs, ExitCode) {
+	usage := "Usage: replayer import <curl|postman|pcap> [--output file] [--var key=value] [--environment env.json] [--redact] [file]"
+	if len(argv) == 0 || (argv[0] != "curl" && argv[0] != "postman" && argv[0] != "pcap") {
+		fmt.Fprintln(os.Stderr, usage)
+		return nil, ExitInvalid
+	}
+
+	args := &ImportArgs{Source: argv[0]}
+
+	fs := flag.NewFlagSet("import "+args.Source, flag.ContinueOnError)
+	fs.StringVar(&args.OutputFile, "output", "", "Output JSON Lines file (default stdout)")
+	fs.StringVar(&args.Environment, "environment", "", "Postman environment file")
+	fs.BoolVar(&args.Redact, "redact", false, "Redact credentials and PII from imported entries")
+	fs.StringVar(&args.RedactConfig, "redact-config", "", "Path to a YAML redaction config (implies --redact)")
+
+	var varFlags stringSlice
+	fs.Var(&varFlags, "var", "Variable in format 'key=value' (can be repeated)")
+
+	if err := fs.Parse(argv[1:]); err != nil {
+		return nil, ExitInvalid
+	}
+
+	args.Vars = make(map[string]string)
+	for _, v := range varFlags {
+		idx := indexOf(v, '=')
+		if idx <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid --var %q, expected key=value\n", v)
+			return nil, ExitInvalid
+		}
+
+		args.Vars[v[:idx]] = v[idx+1:]
+	}
+
+	args.Redact = args.Redact || args.RedactConfig != ""
+
+	switch fs.NArg() {
+	case 0:
+		args.InputFile = "-"
+	case 1:
+		args.InputFile = fs.Arg(0)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return nil, ExitInvalid
+	}
+
+	return args, ExitOK
+}
+
+// ToolCommands are the traffic file subcommands handled by ParseToolArgs.
+var ToolCommands = []string{"stats", "dedupe", "split", "merge", "slice", "validate"}
+
+type ToolArgs struct {
+	Command    string
+	Inputs     []string
+	OutputFile string
+	OutputDir  string
+	By         string
+	Interval   time.Duration
+	From       string
+	To         string
+	Routes     []string
+	JSON       bool
+}
+
+// IsToolCommand reports whether name is one of ToolCommands.
+func IsToolCommand(name string) bool {
+	return slices.Contains(ToolCommands, name)
+}
+
+// ParseToolArgs parses `replayer <stats|dedupe|split|merge|slice|validate>
+// [flags] [file...]`. Without files stdin is read.
+func ParseToolArgs(argv []string) (*ToolArgs, ExitCode) {
+	usage := "Usage: replayer <stats|dedupe|split|merge|slice|validate> [flags] [file...]"
+	if len(argv) == 0 || !IsToolCommand(argv[0]) {
+		fmt.Fprintln(os.Stderr, usage)
+		return nil, ExitInvalid
+	}
+
+	args := &ToolArgs{Command: argv[0]}
+
+	fs := flag.NewFlagSet(args.Command, flag.ContinueOnError)
+
+	var routeFlags stringSlice
+	switch args.Command {
+	case "stats":
+		fs.BoolVar(&args.JSON, "json", false, "Print statistics as JSON")
+		fs.Var(&routeFlags, "route", "Route pattern for grouping paths (can be repeated)")
+	case "dedupe", "merge":
+		fs.StringVar(&args.OutputFile, "output", "", "Output JSON Lines file (default stdout)")
+	case "slice":
+		fs.StringVar(&args.OutputFile, "output", "", "Output JSON Lines file (default stdout)")
+		fs.StringVar(&args.From, "from", "", "Keep entries at or after this time (RFC3339, date or relative like -1h)")
+		fs.StringVar(&args.To, "to", "", "Keep entries before this time (RFC3339, date or relative like -1h)")
+	case "split":
+		fs.StringVar(&args.OutputDir, "output-dir", ".", "Directory for the split files")
+		fs.StringVar(&args.By, "by", "route", "Split by route or time")
+		fs.DurationVar(&args.Interval, "interval", time.Hour, "Window size when splitting by time")
+		fs.Var(&routeFlags, "route", "Route pattern for grouping paths (can be repeated)")
+	}
+
+	if err := fs.Parse(argv[1:]); err != nil {
+		return nil, ExitInvalid
+	}
+
+	args.Routes = routeFlags
+	args.Inputs = fs.Args()
+	if len(args.Inputs) == 0 {
+		args.Inputs = []string{"-"}
+	}
+
+	if _, err := route.New(args.Routes); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil, ExitInvalid
+	}
+
+	switch {
+	case args.Command == "split" && args.By != "route" && args.By != "time":
+		fmt.Fprintf(os.Stderr, "Error: invalid --by %q, expected route or time\n", args.By)
+		return nil, ExitInvalid
+	case args.Command == "split" && args.Interval <= 0:
+		fmt.Fprintln(os.Stderr, "Error: --interval must be positive")
+		return nil, ExitInvalid
+	case args.Command == "slice" && args.From == "" && args.To == "":
+		fmt.Fprintln(os.Stderr, "Error: slice needs --from and/or --to")
+		return nil, ExitInvalid
+	}
+
+	return args, ExitOK
+}
+
 type stringSlice []string
 
 func (s *stringSlice) String() string {
@@ -176,6 +419,34 @@ func (s *stringSlice) Set(value string) error {
 	return nil
 }
 
+// byteSize is a size flag in bytes that accepts KB, MB and GB suffixes
+// (powers of 1024).
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(raw string) error {
+	value := strings.ToUpper(strings.TrimSpace(raw))
+	multiplier := int64(1)
+
+	for suffix, m := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(value, suffix) {
+			value, multiplier = strings.TrimSpace(strings.TrimSuffix(value, suffix)), m
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSuffix(value, "B"), 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", raw)
+	}
+
+	*b = byteSize(n * multiplier)
+	return nil
+}
+
 func getEnvOrDefault(key, defaultVal string) string {
 	if val := os.Getenv(key); val != "" {
 		return val
@@ -0,0 +1,294 @@
+// Package filter implements the expression language used by --filter and
+// --exclude to select log entries, for example
+//
+//	method in (POST, PUT) && path ~ "^/api/v2" && !header("X-Internal")
+package filter
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// Expr is a compiled filter expression.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse compiles a filter expression.
+func Parse(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", src, err)
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = p.errorf("unexpected %s", p.peek())
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", src, err)
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+// Match reports whether entry satisfies the expression.
+func (e *Expr) Match(entry *models.LogEntry) bool {
+	return e.root.eval(entry)
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Set combines include and exclude expressions: an entry matches when it
+// satisfies every include and none of the excludes. A nil Set matches
+// everything.
+type Set struct {
+	include []*Expr
+	exclude []*Expr
+}
+
+// NewSet compiles include and exclude expressions. It returns nil when both
+// are empty.
+func NewSet(include, exclude []string) (*Set, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+
+	set := &Set{}
+	for _, src := range include {
+		expr, err := Parse(src)
+		if err != nil {
+			return nil, err
+		}
+
+		set.include = append(set.include, expr)
+	}
+
+	for _, src := range exclude {
+		expr, err := Parse(src)
+		if err != nil {
+			return nil, err
+		}
+
+		set.exclude = append(set.exclude, expr)
+	}
+
+	return set, nil
+}
+
+// Match reports whether entry passes the set.
+func (s *Set) Match(entry *models.LogEntry) bool {
+	if s == nil {
+		return true
+	}
+
+	for _, expr := range s.include {
+		if !expr.Match(entry) {
+			return false
+		}
+	}
+
+	for _, expr := range s.exclude {
+		if expr.Match(entry) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type node interface {
+	eval(entry *models.LogEntry) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(entry *models.LogEntry) bool { return n.left.eval(entry) && n.right.eval(entry) }
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(entry *models.LogEntry) bool { return n.left.eval(entry) || n.right.eval(entry) }
+
+type notNode struct{ node node }
+
+func (n notNode) eval(entry *models.LogEntry) bool { return !n.node.eval(entry) }
+
+// stringNode compares a string field. Fields with several values, such as
+// repeated headers, match when any value does; negated operators match when
+// none does.
+type stringNode struct {
+	values func(entry *models.LogEntry) []string
+	op     string
+	negate bool
+	fold   bool
+	want   []string
+	re     *regexp.Regexp
+}
+
+func (n stringNode) eval(entry *models.LogEntry) bool {
+	for _, value := range n.values(entry) {
+		if n.matchOne(value) {
+			return !n.negate
+		}
+	}
+
+	return n.negate
+}
+
+func (n stringNode) matchOne(value string) bool {
+	switch n.op {
+	case "~":
+		return n.re.MatchString(value)
+	case "contains":
+		if n.fold {
+			return strings.Contains(strings.ToLower(value), strings.ToLower(n.want[0]))
+		}
+
+		return strings.Contains(value, n.want[0])
+	default:
+		for _, want := range n.want {
+			if value == want || (n.fold && strings.EqualFold(value, want)) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// numberRange is an inclusive range; plain numbers have lo == hi and status
+// classes such as 5xx span 500-599.
+type numberRange struct{ lo, hi int64 }
+
+type numberNode struct {
+	value func(entry *models.LogEntry) int64
+	op    string
+	want  []numberRange
+}
+
+func (n numberNode) eval(entry *models.LogEntry) bool {
+	v := n.value(entry)
+	switch n.op {
+	case "<":
+		return v < n.want[0].lo
+	case "<=":
+		return v <= n.want[0].hi
+	case ">":
+		return v > n.want[0].hi
+	case ">=":
+		return v >= n.want[0].lo
+	}
+
+	in := false
+	for _, r := range n.want {
+		if v >= r.lo && v <= r.hi {
+			in = true
+			break
+		}
+	}
+
+	return in == (n.op != "!=")
+}
+
+type timeNode struct {
+	op   string
+	want time.Time
+}
+
+func (n timeNode) eval(entry *models.LogEntry) bool {
+	ts := entry.Timestamp
+	switch n.op {
+	case "<":
+		return ts.Before(n.want)
+	case "<=":
+		return !ts.After(n.want)
+	case ">":
+		return ts.After(n.want)
+	case ">=":
+		return !ts.Before(n.want)
+	case "!=":
+		return !ts.Equal(n.want)
+	default:
+		return ts.Equal(n.want)
+	}
+}
+
+type headerPresentNode struct {
+	name     string
+	response bool
+}
+
+func (n headerPresentNode) eval(entry *models.LogEntry) bool {
+	return len(headerValues(entry, n.name, n.response)) > 0
+}
+
+func headerValues(entry *models.LogEntry, name string, response bool) []string {
+	headers := entry.Headers
+	if response {
+		headers = entry.ResponseHeaders
+	}
+
+	if values, ok := headers[http.CanonicalHeaderKey(name)]; ok {
+		return values
+	}
+
+	for key, values := range headers {
+		if strings.EqualFold(key, name) {
+			return values
+		}
+	}
+
+	return nil
+}
+
+// parseNumber reads an integer, a duration such as 250ms or 2s (in
+// milliseconds) or, when classes is set, a status class such as 5xx.
+func parseNumber(text string, classes bool) (numberRange, error) {
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return numberRange{n, n}, nil
+	}
+
+	lower := strings.ToLower(text)
+	if classes && len(lower) == 3 && lower[0] >= '1' && lower[0] <= '5' && lower[1:] == "xx" {
+		lo := int64(lower[0]-'0') * 100
+		return numberRange{lo, lo + 99}, nil
+	}
+
+	if d, err := time.ParseDuration(text); err == nil {
+		ms := d.Milliseconds()
+		return numberRange{ms, ms}, nil
+	}
+
+	return numberRange{}, fmt.Errorf("invalid number %q", text)
+}
+
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// parseTime reads an absolute time or a negative duration such as -1h,
+// relative to when the filter is compiled.
+func parseTime(text string) (time.Time, error) {
+	if strings.HasPrefix(text, "-") {
+		if d, err := time.ParseDuration(text); err == nil {
+			return time.Now().Add(d), nil
+		}
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q (use RFC 3339, YYYY-MM-DD or a duration such as -1h)", text)
+}
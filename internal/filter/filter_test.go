@@ -0,0 +1,173 @@
+package filter
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+func TestParseAndMatch(t *testing.T) {
+	entry := &models.LogEntry{
+		Method:          "POST",
+		Path:            "/api/v2/orders?dry_run=1",
+		Headers:         map[string][]string{"content-type": {"application/json"}, "X-Tenant": {"a", "b"}},
+		Body:            base64.StdEncoding.EncodeToString([]byte(`{"sku":"abc-1"}`)),
+		Status:          503,
+		ResponseHeaders: map[string][]string{"Retry-After": {"5"}},
+		ResponseBody:    base64.StdEncoding.EncodeToString([]byte(`upstream timeout`)),
+		Timestamp:       time.Date(2024, 12, 10, 14, 23, 45, 0, time.UTC),
+		LatencyMs:       320,
+		Error:           "upstream: unexpected EOF",
+		Upstream:        "http://orders.internal:8080",
+		Tag:             "orders",
+		Fault:           &models.Fault{Rule: "slow", DelayMs: 200, Type: "error", Status: 503},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`method in (POST,PUT) && path ~ "^/api/v2" && !header("X-Internal")`, true},
+		{`method == post`, true},
+		{`method not in (GET, HEAD)`, true},
+		{`method = GET or path contains orders`, true},
+		{`path ~ '^/api/v1'`, false},
+		{`path !~ "\d{4}"`, true},
+		{`header("Content-Type") == "application/json"`, true},
+		{`header(content-type) ~ "json$" and header("X-Tenant") == b`, true},
+		{`header("X-Tenant") != a`, false},
+		{`response_header("Retry-After")`, true},
+		{`status == 5xx && status != 500`, true},
+		{`status in (200, 201, 204)`, false},
+		{`status >= 500 && status < 600`, true},
+		{`status > 4xx`, true},
+		{`latency > 250ms && latency <= 1s`, true},
+		{`latency < 100`, false},
+		{`time >= "2024-12-10T14:00:00Z" && time < 2024-12-11`, true},
+		{`time > -1h`, false},
+		{`body contains "abc-1" && response_body ~ timeout`, true},
+		{`error != "" && error contains EOF`, true},
+		{`error == ""`, false},
+		{`tag == orders && upstream ~ "^http://orders\."`, true},
+		{`tag in (users, admin)`, false},
+		{`fault == error && fault != ""`, true},
+		{`fault in (reset, truncate, latency)`, false},
+		{`!(method == POST || status == 200)`, false},
+		{`not method == GET and (status == 200 or latency > 300)`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := expr.Match(entry); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	invalid := []string{
+		``,
+		`method`,
+		`unknown == 1`,
+		`method == GET &&`,
+		`(method == GET`,
+		`path ~ "("`,
+		`status ~ "5.."`,
+		`status == abc`,
+		`latency in (1, `,
+		`time contains 2024`,
+		`time > yesterday`,
+		`path == "unterminated`,
+		`method == GET $`,
+		`header("X") <`,
+	}
+
+	for _, src := range invalid {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("expected error for %q", src)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	set, err := NewSet([]string{`method == GET`}, []string{`path ~ "^/health"`, `status == 404`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries := map[string]bool{
+		"GET /users 200":   true,
+		"GET /healthz 200": false,
+		"GET /missing 404": false,
+		"POST /users 200":  false,
+	}
+
+	for desc, want := range entries {
+		var entry models.LogEntry
+		var status int
+		if _, err := fmt.Sscan(desc, &entry.Method, &entry.Path, &status); err != nil {
+			t.Fatal(err)
+		}
+
+		entry.Status = status
+		if got := set.Match(&entry); got != want {
+			t.Errorf("%s: expected %v, got %v", desc, want, got)
+		}
+	}
+
+	empty, err := NewSet(nil, nil)
+	if err != nil || empty != nil || !empty.Match(&models.LogEntry{}) {
+		t.Errorf("expected empty set to match everything")
+	}
+
+	if _, err := NewSet(nil, []string{`status ==`}); err == nil {
+		t.Error("expected error for invalid exclude")
+	}
+}
+
+func TestGraphQLFields(t *testing.T) {
+	entry := &models.LogEntry{
+		Method: "POST",
+		Path:   "/graphql",
+		Body:   base64.StdEncoding.EncodeToString([]byte(`{"query":"mutation CreateUser { createUser { id } }","operationName":"CreateUser"}`)),
+	}
+	rest := &models.LogEntry{Method: "POST", Path: "/users", Body: base64.StdEncoding.EncodeToString([]byte(`{"name":"a"}`))}
+
+	tests := []struct {
+		expr       string
+		graphql    bool
+		notGraphQL bool
+	}{
+		{`operation == CreateUser`, true, false},
+		{`operation_type == MUTATION`, true, false},
+		{`operation_type in (query, subscription)`, false, false},
+		{`operation != CreateUser`, false, true},
+		{`operation ~ "^Create"`, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := expr.Match(entry); got != tt.graphql {
+				t.Errorf("GraphQL request: expected %v, got %v", tt.graphql, got)
+			}
+
+			if got := expr.Match(rest); got != tt.notGraphQL {
+				t.Errorf("REST request: expected %v, got %v", tt.notGraphQL, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kx0101/replayer/internal/graphql"
+	"github.com/kx0101/replayer/internal/models"
+)
+
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindNumber
+	kindTime
+)
+
+type field struct {
+	kind fieldKind
+	// fold makes string comparisons case-insensitive.
+	fold    bool
+	strings func(entry *models.LogEntry) []string
+	number  func(entry *models.LogEntry) int64
+	// classes allows status classes such as 5xx.
+	classes bool
+}
+
+var fields = map[string]field{
+	"method": {kind: kindString, fold: true, strings: func(e *models.LogEntry) []string { return []string{e.Method} }},
+	"path":   {kind: kindString, strings: func(e *models.LogEntry) []string { return []string{e.Path} }},
+	"body": {kind: kindString, strings: func(e *models.LogEntry) []string {
+		return []string{string(e.DecodedBody())}
+	}},
+	"response_body": {kind: kindString, strings: func(e *models.LogEntry) []string {
+		return []string{string(e.DecodedResponseBody())}
+	}},
+	"status":   {kind: kindNumber, classes: true, number: func(e *models.LogEntry) int64 { return int64(e.Status) }},
+	"latency":  {kind: kindNumber, number: func(e *models.LogEntry) int64 { return e.LatencyMs }},
+	"time":     {kind: kindTime},
+	"error":    {kind: kindString, strings: func(e *models.LogEntry) []string { return []string{e.Error} }},
+	"upstream": {kind: kindString, strings: func(e *models.LogEntry) []string { return []string{e.Upstream} }},
+	"tag":      {kind: kindString, strings: func(e *models.LogEntry) []string { return []string{e.Tag} }},
+	"fault": {kind: kindString, strings: func(e *models.LogEntry) []string {
+		if e.Fault == nil {
+			return []string{""}
+		}
+
+		if e.Fault.Type == "" {
+			return []string{"latency"}
+		}
+
+		return []string{e.Fault.Type}
+	}},
+	"operation": {kind: kindString, strings: func(e *models.LogEntry) []string {
+		op, ok := graphql.FromEntry(*e)
+		if !ok {
+			return nil
+		}
+
+		if op.Name == "" {
+			return []string{graphql.Anonymous}
+		}
+
+		return []string{op.Name}
+	}},
+	"operation_type": {kind: kindString, fold: true, strings: func(e *models.LogEntry) []string {
+		op, ok := graphql.FromEntry(*e)
+		if !ok || op.Type == "" {
+			return nil
+		}
+
+		return []string{op.Type}
+	}},
+}
+
+var comparisons = map[string]bool{"==": true, "=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "~": true, "!~": true}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), p.peek().pos)
+}
+
+func (p *parser) isWord(word string) bool {
+	t := p.peek()
+	return t.kind == tokWord && strings.EqualFold(t.text, word)
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("||") || p.isWord("or") {
+		p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = orNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("&&") || p.isWord("and") {
+		p.next()
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = andNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOp("!") || p.isWord("not") {
+		p.next()
+
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return notNode{inner}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+	if t.kind == tokLParen {
+		p.next()
+
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek().kind != tokRParen {
+			return nil, p.errorf("expected ) but found %s", p.peek())
+		}
+
+		p.next()
+		return inner, nil
+	}
+
+	if t.kind != tokWord {
+		return nil, p.errorf("expected a field but found %s", t)
+	}
+
+	p.next()
+	name := strings.ToLower(t.text)
+
+	if name == "header" || name == "response_header" {
+		return p.parseHeader(name == "response_header")
+	}
+
+	f, ok := fields[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q at position %d", t.text, t.pos)
+	}
+
+	return p.parseComparison(t.text, f)
+}
+
+// parseHeader parses header("Name") on its own, a presence test, or
+// followed by a comparison of its values.
+func (p *parser) parseHeader(response bool) (node, error) {
+	if p.peek().kind != tokLParen {
+		return nil, p.errorf("expected ( after header")
+	}
+
+	p.next()
+	nameTok := p.next()
+	if nameTok.kind != tokString && nameTok.kind != tokWord {
+		return nil, p.errorf("expected a header name but found %s", nameTok)
+	}
+
+	if p.peek().kind != tokRParen {
+		return nil, p.errorf("expected ) but found %s", p.peek())
+	}
+
+	p.next()
+
+	name := nameTok.text
+	if !p.atComparison() {
+		return headerPresentNode{name: name, response: response}, nil
+	}
+
+	f := field{kind: kindString, strings: func(e *models.LogEntry) []string {
+		return headerValues(e, name, response)
+	}}
+
+	return p.parseComparison("header("+name+")", f)
+}
+
+func (p *parser) atComparison() bool {
+	t := p.peek()
+	if t.kind == tokOp {
+		return comparisons[t.text]
+	}
+
+	if p.isWord("in") || p.isWord("contains") {
+		return true
+	}
+
+	return p.isWord("not") && p.pos+1 < len(p.tokens) &&
+		p.tokens[p.pos+1].kind == tokWord && strings.EqualFold(p.tokens[p.pos+1].text, "in")
+}
+
+func (p *parser) parseComparison(name string, f field) (node, error) {
+	if !p.atComparison() {
+		return nil, p.errorf("expected an operator after %s but found %s", name, p.peek())
+	}
+
+	opTok := p.next()
+	op := strings.ToLower(opTok.text)
+	negate := false
+
+	switch op {
+	case "=":
+		op = "=="
+	case "not":
+		p.next()
+		op, negate = "in", true
+	}
+
+	var values []string
+	if op == "in" {
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+
+		values = list
+	} else {
+		v := p.next()
+		if v.kind != tokString && v.kind != tokWord {
+			return nil, fmt.Errorf("expected a value after %s but found %s at position %d", opTok.text, v, v.pos)
+		}
+
+		values = []string{v.text}
+	}
+
+	switch f.kind {
+	case kindNumber:
+		return numberComparison(name, f, op, negate, values)
+	case kindTime:
+		return timeComparison(name, op, values)
+	default:
+		return stringComparison(name, f, op, negate, values)
+	}
+}
+
+func (p *parser) parseList() ([]string, error) {
+	if p.peek().kind != tokLParen {
+		return nil, p.errorf("expected ( after in")
+	}
+
+	p.next()
+
+	var values []string
+	for {
+		v := p.next()
+		if v.kind != tokString && v.kind != tokWord {
+			return nil, fmt.Errorf("expected a value but found %s at position %d", v, v.pos)
+		}
+
+		values = append(values, v.text)
+
+		sep := p.next()
+		if sep.kind == tokRParen {
+			return values, nil
+		}
+
+		if sep.kind != tokComma {
+			return nil, fmt.Errorf("expected , or ) but found %s at position %d", sep, sep.pos)
+		}
+	}
+}
+
+func stringComparison(name string, f field, op string, negate bool, values []string) (node, error) {
+	n := stringNode{values: f.strings, fold: f.fold, want: values}
+
+	switch op {
+	case "==", "in", "contains":
+		n.op = op
+	case "!=":
+		n.op, negate = "==", true
+	case "~", "!~":
+		pattern := values[0]
+		if f.fold {
+			pattern = "(?i)" + pattern
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression for %s: %w", name, err)
+		}
+
+		n.op, n.re, negate = "~", re, op == "!~"
+	default:
+		return nil, fmt.Errorf("operator %s is not supported for %s", op, name)
+	}
+
+	if n.op == "in" {
+		n.op = "=="
+	}
+
+	n.negate = negate
+	return n, nil
+}
+
+func numberComparison(name string, f field, op string, negate bool, values []string) (node, error) {
+	switch op {
+	case "~", "!~", "contains":
+		return nil, fmt.Errorf("operator %s is not supported for %s", op, name)
+	}
+
+	want := make([]numberRange, 0, len(values))
+	for _, value := range values {
+		r, err := parseNumber(value, f.classes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		want = append(want, r)
+	}
+
+	var n node = numberNode{value: f.number, op: op, want: want}
+	if op == "in" {
+		n = numberNode{value: f.number, op: "==", want: want}
+	}
+
+	if negate {
+		n = notNode{n}
+	}
+
+	return n, nil
+}
+
+func timeComparison(name, op string, values []string) (node, error) {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("operator %s is not supported for %s", op, name)
+	}
+
+	want, err := parseTime(values[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return timeNode{op: op, want: want}, nil
+}
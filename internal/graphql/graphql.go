@@ -0,0 +1,151 @@
+// Package graphql recognizes GraphQL requests so traffic that all goes to
+// a single endpoint can be grouped and compared per operation.
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// Anonymous is the name used for operations without one.
+const Anonymous = "(anonymous)"
+
+// Operation is the operation a GraphQL request executes.
+type Operation struct {
+	// Type is query, mutation or subscription. It is empty for persisted
+	// queries sent without their document.
+	Type string
+	// Name is the operation name, empty for anonymous operations.
+	Name string
+
+	selections []selection
+	fragments  map[string][]selection
+}
+
+// Key identifies the operation in route keys, e.g. "query GetUser".
+func (o *Operation) Key() string {
+	name := o.Name
+	if name == "" {
+		name = Anonymous
+	}
+
+	if o.Type == "" {
+		return name
+	}
+
+	return o.Type + " " + name
+}
+
+// Parse selects the operation to execute from a document, as a server
+// would: the one named operationName, or the only operation.
+func Parse(query, operationName string) (*Operation, error) {
+	defs, err := parseDocument(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GraphQL document: %w", err)
+	}
+
+	fragments := map[string][]selection{}
+	var ops []definition
+	for _, def := range defs {
+		if def.kind == "fragment" {
+			fragments[def.name] = def.selections
+		} else {
+			ops = append(ops, def)
+		}
+	}
+
+	var op *definition
+	switch {
+	case operationName != "":
+		for i := range ops {
+			if ops[i].name == operationName {
+				op = &ops[i]
+				break
+			}
+		}
+	case len(ops) == 1:
+		op = &ops[0]
+	}
+
+	if op == nil {
+		if operationName == "" {
+			return nil, fmt.Errorf("document has %d operations and no operationName", len(ops))
+		}
+
+		return nil, fmt.Errorf("operation %q not found in document", operationName)
+	}
+
+	return &Operation{Type: op.kind, Name: op.name, selections: op.selections, fragments: fragments}, nil
+}
+
+// request is the body of a GraphQL POST.
+type request struct {
+	Query         string          `json:"query"`
+	OperationName string          `json:"operationName"`
+	Extensions    json.RawMessage `json:"extensions"`
+}
+
+// FromEntry returns the operation of a GraphQL request: a POST with a JSON
+// body holding a query (or a persisted query hash), a POST of
+// application/graphql, or a GET with query and operationName parameters.
+// Batched requests are not recognized.
+func FromEntry(entry models.LogEntry) (*Operation, bool) {
+	var req request
+
+	switch entry.Method {
+	case http.MethodGet:
+		u, err := url.Parse(entry.Path)
+		if err != nil || !u.Query().Has("query") {
+			return nil, false
+		}
+
+		req.Query = u.Query().Get("query")
+		req.OperationName = u.Query().Get("operationName")
+	case http.MethodPost:
+		body := bytes.TrimSpace(entry.DecodedBody())
+		if len(body) == 0 {
+			return nil, false
+		}
+
+		if mediaType(entry.Headers) == "application/graphql" {
+			req.Query = string(body)
+			break
+		}
+
+		if body[0] != '{' || json.Unmarshal(body, &req) != nil {
+			return nil, false
+		}
+
+		if req.Query == "" {
+			if req.OperationName == "" || !bytes.Contains(req.Extensions, []byte("persistedQuery")) {
+				return nil, false
+			}
+
+			return &Operation{Name: req.OperationName}, true
+		}
+	default:
+		return nil, false
+	}
+
+	op, err := Parse(req.Query, req.OperationName)
+	if err != nil {
+		return nil, false
+	}
+
+	return op, true
+}
+
+func mediaType(headers map[string][]string) string {
+	t, _, err := mime.ParseMediaType(http.Header(headers).Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	return t
+}
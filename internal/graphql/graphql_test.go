@@ -0,0 +1,168 @@
+package graphql
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name, query, operationName string
+		want                       string
+		wantErr                    bool
+	}{
+		{"named query", `query GetUser($id: ID!) { user(id: $id) { id name } }`, "", "query GetUser", false},
+		{"anonymous shorthand", `{ me { id } }`, "", "query " + Anonymous, false},
+		{"mutation with directives", `mutation CreateUser @audit(reason: "x") { createUser(input: {name: "a, b"}) { id } }`, "", "mutation CreateUser", false},
+		{"subscription", "# comment\nsubscription OnEvent { event { id } }", "", "subscription OnEvent", false},
+		{"selected by name", `query A { a } query B { b } fragment F on T { x }`, "B", "query B", false},
+		{"block string argument", `query Q { search(text: """say "hi" {""") { id } }`, "", "query Q", false},
+		{"several operations without a name", `query A { a } query B { b }`, "", "", true},
+		{"unknown operation name", `query A { a }`, "B", "", true},
+		{"unbalanced", `query A { a(id: 1 { b }`, "", "", true},
+		{"empty", ` `, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, err := Parse(tt.query, tt.operationName)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", op.Key())
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if op.Key() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, op.Key())
+			}
+		})
+	}
+}
+
+func TestFromEntry(t *testing.T) {
+	encode := func(body string) string {
+		return base64.StdEncoding.EncodeToString([]byte(body))
+	}
+
+	tests := []struct {
+		name  string
+		entry models.LogEntry
+		want  string
+	}{
+		{
+			name: "json post",
+			entry: models.LogEntry{Method: "POST", Path: "/graphql", Body: encode(
+				`{"query":"query GetUser { user { id } } query ListUsers { users { id } }","operationName":"ListUsers","variables":{}}`)},
+			want: "query ListUsers",
+		},
+		{
+			name: "application/graphql post",
+			entry: models.LogEntry{Method: "POST", Path: "/graphql", Headers: map[string][]string{"Content-Type": {"application/graphql; charset=utf-8"}},
+				Body: encode(`mutation Like { like(id: 1) { count } }`)},
+			want: "mutation Like",
+		},
+		{
+			name:  "get",
+			entry: models.LogEntry{Method: "GET", Path: "/graphql?query=%7B%20me%20%7B%20id%20%7D%20%7D"},
+			want:  "query " + Anonymous,
+		},
+		{
+			name: "persisted query",
+			entry: models.LogEntry{Method: "POST", Path: "/graphql", Body: encode(
+				`{"operationName":"GetUser","extensions":{"persistedQuery":{"version":1,"sha256Hash":"abc"}}}`)},
+			want: "GetUser",
+		},
+		{
+			name:  "not graphql",
+			entry: models.LogEntry{Method: "POST", Path: "/users", Body: encode(`{"name":"a"}`)},
+		},
+		{
+			name:  "invalid document",
+			entry: models.LogEntry{Method: "POST", Path: "/graphql", Body: encode(`{"query":"query {"}`)},
+		},
+		{
+			name:  "get without query",
+			entry: models.LogEntry{Method: "GET", Path: "/graphql?id=1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, ok := FromEntry(tt.entry)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("expected no operation, got %q", op.Key())
+				}
+
+				return
+			}
+
+			if !ok {
+				t.Fatal("expected an operation")
+			}
+
+			if op.Key() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, op.Key())
+			}
+		})
+	}
+}
+
+func TestNormalizeResponse(t *testing.T) {
+	op, err := Parse(`
+		query GetUser {
+			user(id: 1) {
+				name
+				...Contact
+				posts { title id }
+			}
+			viewer: me { id }
+		}
+		fragment Contact on User { email ... on Admin { role } }`, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("data follows the query order", func(t *testing.T) {
+		got, ok := op.NormalizeResponse(`{"data":{"viewer":{"id":"2"},"user":{"posts":[{"id":1,"title":"a"}],"role":"admin","email":"e","extra":true,"name":"n"}},"extensions":{"tracing":{}}}`)
+		if !ok {
+			t.Fatal("expected a GraphQL response")
+		}
+
+		want := `{"data":{"user":{"name":"n","email":"e","role":"admin","posts":[{"title":"a","id":1}],"extra":true},"viewer":{"id":"2"}}}`
+		if got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	})
+
+	t.Run("errors are reduced and sorted", func(t *testing.T) {
+		got, ok := op.NormalizeResponse(`{"errors":[
+			{"message":"b","locations":[{"line":3,"column":5}],"path":["user","name"]},
+			{"message":"a","extensions":{"code":"FORBIDDEN","traceId":"x"}}
+		],"data":null}`)
+		if !ok {
+			t.Fatal("expected a GraphQL response")
+		}
+
+		want := `{"data":null,"errors":[{"message":"a","code":"FORBIDDEN"},{"message":"b","path":["user","name"]}]}`
+		if got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	})
+
+	t.Run("other bodies are left alone", func(t *testing.T) {
+		for _, body := range []string{`{"user":{}}`, `not json`, `[1]`} {
+			if _, ok := op.NormalizeResponse(body); ok {
+				t.Errorf("expected %s not to be a GraphQL response", body)
+			}
+		}
+	})
+}
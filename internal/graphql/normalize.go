@@ -0,0 +1,187 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// responseError is the part of a GraphQL error compared between targets.
+// Locations and other extensions vary between server implementations and
+// deployments, so they are left out.
+type responseError struct {
+	Message any `json:"message"`
+	Path    any `json:"path,omitempty"`
+	Code    any `json:"code,omitempty"`
+}
+
+// NormalizeResponse rewrites a GraphQL response so equivalent responses
+// compare equal: fields in data follow the order of the query, errors are
+// reduced to their message, path and extensions.code and sorted, and the
+// top level extensions (tracing, cost) are dropped. It returns false when
+// body is not a GraphQL response.
+func (o *Operation) NormalizeResponse(body string) (string, bool) {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+
+	var resp map[string]any
+	if err := decoder.Decode(&resp); err != nil || decoder.More() {
+		return "", false
+	}
+
+	data, hasData := resp["data"]
+	rawErrors, hasErrors := resp["errors"]
+	if !hasData && !hasErrors {
+		return "", false
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	if hasData {
+		buf.WriteString(`"data":`)
+		o.writeValue(&buf, data, o.selections)
+	}
+
+	if hasErrors {
+		if hasData {
+			buf.WriteByte(',')
+		}
+
+		buf.WriteString(`"errors":`)
+		writeErrors(&buf, rawErrors)
+	}
+
+	buf.WriteByte('}')
+	return buf.String(), true
+}
+
+func (o *Operation) writeValue(buf *bytes.Buffer, value any, selections []selection) {
+	switch v := value.(type) {
+	case map[string]any:
+		buf.WriteByte('{')
+
+		written := make(map[string]bool, len(v))
+		for _, f := range o.fields(selections, nil) {
+			child, ok := v[f.key]
+			if !ok || written[f.key] {
+				continue
+			}
+
+			writeKey(buf, f.key, len(written) > 0)
+			o.writeValue(buf, child, f.children)
+			written[f.key] = true
+		}
+
+		rest := make([]string, 0, len(v)-len(written))
+		for key := range v {
+			if !written[key] {
+				rest = append(rest, key)
+			}
+		}
+
+		sort.Strings(rest)
+		for i, key := range rest {
+			writeKey(buf, key, len(written) > 0 || i > 0)
+			o.writeValue(buf, v[key], nil)
+		}
+
+		buf.WriteByte('}')
+	case []any:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			o.writeValue(buf, item, selections)
+		}
+
+		buf.WriteByte(']')
+	default:
+		out, _ := json.Marshal(v)
+		buf.Write(out)
+	}
+}
+
+func writeKey(buf *bytes.Buffer, key string, comma bool) {
+	if comma {
+		buf.WriteByte(',')
+	}
+
+	out, _ := json.Marshal(key)
+	buf.Write(out)
+	buf.WriteByte(':')
+}
+
+type field struct {
+	key      string
+	children []selection
+}
+
+// fields flattens a selection set into response keys in query order,
+// expanding fragments. Selections of a repeated key are merged.
+func (o *Operation) fields(selections []selection, visiting map[string]bool) []field {
+	var out []field
+	index := map[string]int{}
+
+	var walk func(selections []selection)
+	walk = func(selections []selection) {
+		for _, sel := range selections {
+			switch {
+			case sel.spread != "":
+				if visiting[sel.spread] {
+					continue
+				}
+
+				if visiting == nil {
+					visiting = map[string]bool{}
+				}
+
+				visiting[sel.spread] = true
+				walk(o.fragments[sel.spread])
+				delete(visiting, sel.spread)
+			case sel.inline != nil:
+				walk(sel.inline)
+			default:
+				if i, ok := index[sel.key]; ok {
+					out[i].children = append(out[i].children, sel.children...)
+					continue
+				}
+
+				index[sel.key] = len(out)
+				out = append(out, field{key: sel.key, children: sel.children})
+			}
+		}
+	}
+
+	walk(selections)
+	return out
+}
+
+func writeErrors(buf *bytes.Buffer, value any) {
+	list, ok := value.([]any)
+	if !ok {
+		out, _ := json.Marshal(value)
+		buf.Write(out)
+		return
+	}
+
+	encoded := make([]string, 0, len(list))
+	for _, item := range list {
+		e := responseError{Message: item}
+		if obj, ok := item.(map[string]any); ok {
+			e = responseError{Message: obj["message"], Path: obj["path"]}
+			if ext, ok := obj["extensions"].(map[string]any); ok {
+				e.Code = ext["code"]
+			}
+		}
+
+		out, _ := json.Marshal(e)
+		encoded = append(encoded, string(out))
+	}
+
+	sort.Strings(encoded)
+	buf.WriteString("[" + strings.Join(encoded, ",") + "]")
+}
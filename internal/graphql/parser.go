@@ -0,0 +1,377 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokName
+	tokPunct
+	tokValue
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of document"
+	}
+
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lex splits a GraphQL document into names, punctuators and values. Commas,
+// whitespace and comments are insignificant. String contents are not
+// unescaped since only their extent matters here.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case strings.HasPrefix(src[i:], "\uFEFF"):
+			i += len("\uFEFF")
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, token{kind: tokPunct, text: "...", pos: i})
+			i += 3
+		case strings.ContainsRune("!$&():=@[]{}|", rune(c)):
+			tokens = append(tokens, token{kind: tokPunct, text: string(c), pos: i})
+			i++
+		case c == '"':
+			end, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+
+			tokens = append(tokens, token{kind: tokValue, text: src[i:end], pos: i})
+			i = end
+		case isNameStart(c):
+			start := i
+			for i < len(src) && (isNameStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+
+			tokens = append(tokens, token{kind: tokName, text: src[start:i], pos: start})
+		case c == '-' || isDigit(c):
+			start := i
+			i++
+			for i < len(src) && (isDigit(src[i]) || strings.ContainsRune(".eE+-", rune(src[i]))) {
+				i++
+			}
+
+			tokens = append(tokens, token{kind: tokValue, text: src[start:i], pos: start})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// lexString returns the end of the string or block string starting at i.
+func lexString(src string, i int) (int, error) {
+	if strings.HasPrefix(src[i:], `"""`) {
+		for j := i + 3; j < len(src); j++ {
+			switch {
+			case strings.HasPrefix(src[j:], `\"""`):
+				j += 3
+			case strings.HasPrefix(src[j:], `"""`):
+				return j + 3, nil
+			}
+		}
+
+		return 0, fmt.Errorf("unterminated block string at position %d", i)
+	}
+
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, nil
+		case '\n', '\r':
+			return 0, fmt.Errorf("unterminated string at position %d", i)
+		}
+	}
+
+	return 0, fmt.Errorf("unterminated string at position %d", i)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// selection is a field, fragment spread or inline fragment of a selection
+// set. Only the response shape is kept: arguments, variables and
+// directives are skipped.
+type selection struct {
+	// key is the response key of a field, its alias or name.
+	key      string
+	children []selection
+	// spread names a fragment spread.
+	spread string
+	// inline holds the selections of an inline fragment.
+	inline []selection
+}
+
+type definition struct {
+	kind       string
+	name       string
+	selections []selection
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) is(kind tokenKind, text string) bool {
+	t := p.peek()
+	return t.kind == kind && t.text == text
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), p.peek().pos)
+}
+
+func (p *parser) expect(text string) error {
+	if !p.is(tokPunct, text) {
+		return p.errorf("expected %q but found %s", text, p.peek())
+	}
+
+	p.next()
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	t := p.peek()
+	if t.kind != tokName {
+		return "", p.errorf("expected a name but found %s", t)
+	}
+
+	p.next()
+	return t.text, nil
+}
+
+// parseDocument reads the executable definitions of a document.
+func parseDocument(src string) ([]definition, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	var defs []definition
+	for p.peek().kind != tokEOF {
+		def, err := p.parseDefinition()
+		if err != nil {
+			return nil, err
+		}
+
+		defs = append(defs, def)
+	}
+
+	if len(defs) == 0 {
+		return nil, fmt.Errorf("empty GraphQL document")
+	}
+
+	return defs, nil
+}
+
+func (p *parser) parseDefinition() (definition, error) {
+	if p.is(tokPunct, "{") {
+		selections, err := p.parseSelectionSet()
+		return definition{kind: "query", selections: selections}, err
+	}
+
+	kind, err := p.name()
+	if err != nil {
+		return definition{}, err
+	}
+
+	def := definition{kind: kind}
+	switch kind {
+	case "query", "mutation", "subscription":
+		if p.peek().kind == tokName {
+			def.name = p.next().text
+		}
+
+		if p.is(tokPunct, "(") {
+			if err := p.skipBalanced("(", ")"); err != nil {
+				return definition{}, err
+			}
+		}
+	case "fragment":
+		if def.name, err = p.name(); err != nil {
+			return definition{}, err
+		}
+
+		if on, err := p.name(); err != nil || on != "on" {
+			return definition{}, p.errorf("expected type condition of fragment %s", def.name)
+		}
+
+		if _, err := p.name(); err != nil {
+			return definition{}, err
+		}
+	default:
+		return definition{}, fmt.Errorf("unsupported definition %q", kind)
+	}
+
+	if err := p.skipDirectives(); err != nil {
+		return definition{}, err
+	}
+
+	def.selections, err = p.parseSelectionSet()
+	return def, err
+}
+
+func (p *parser) parseSelectionSet() ([]selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var selections []selection
+	for !p.is(tokPunct, "}") {
+		if p.peek().kind == tokEOF {
+			return nil, p.errorf("unterminated selection set")
+		}
+
+		sel, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+
+		selections = append(selections, sel)
+	}
+
+	p.next()
+	return selections, nil
+}
+
+func (p *parser) parseSelection() (selection, error) {
+	if p.is(tokPunct, "...") {
+		p.next()
+
+		if p.peek().kind == tokName && p.peek().text != "on" {
+			spread := p.next().text
+			return selection{spread: spread}, p.skipDirectives()
+		}
+
+		if p.peek().kind == tokName {
+			p.next()
+			if _, err := p.name(); err != nil {
+				return selection{}, err
+			}
+		}
+
+		if err := p.skipDirectives(); err != nil {
+			return selection{}, err
+		}
+
+		inline, err := p.parseSelectionSet()
+		if inline == nil {
+			inline = []selection{}
+		}
+
+		return selection{inline: inline}, err
+	}
+
+	key, err := p.name()
+	if err != nil {
+		return selection{}, err
+	}
+
+	if p.is(tokPunct, ":") {
+		p.next()
+		if _, err := p.name(); err != nil {
+			return selection{}, err
+		}
+	}
+
+	if p.is(tokPunct, "(") {
+		if err := p.skipBalanced("(", ")"); err != nil {
+			return selection{}, err
+		}
+	}
+
+	if err := p.skipDirectives(); err != nil {
+		return selection{}, err
+	}
+
+	sel := selection{key: key}
+	if p.is(tokPunct, "{") {
+		sel.children, err = p.parseSelectionSet()
+	}
+
+	return sel, err
+}
+
+func (p *parser) skipDirectives() error {
+	for p.is(tokPunct, "@") {
+		p.next()
+		if _, err := p.name(); err != nil {
+			return err
+		}
+
+		if p.is(tokPunct, "(") {
+			if err := p.skipBalanced("(", ")"); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// skipBalanced skips arguments or variable definitions. Strings are single
+// tokens, so brackets inside them don't count.
+func (p *parser) skipBalanced(open, closing string) error {
+	depth := 0
+	for {
+		t := p.next()
+		switch {
+		case t.kind == tokEOF:
+			return p.errorf("unbalanced %q", open)
+		case t.kind == tokPunct && t.text == open:
+			depth++
+		case t.kind == tokPunct && t.text == closing:
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package grpc
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Status codes defined by gRPC.
+const (
+	CodeOK                 = 0
+	CodeCanceled           = 1
+	CodeUnknown            = 2
+	CodeInvalidArgument    = 3
+	CodeDeadlineExceeded   = 4
+	CodeNotFound           = 5
+	CodeAlreadyExists      = 6
+	CodePermissionDenied   = 7
+	CodeResourceExhausted  = 8
+	CodeFailedPrecondition = 9
+	CodeAborted            = 10
+	CodeOutOfRange         = 11
+	CodeUnimplemented      = 12
+	CodeInternal           = 13
+	CodeUnavailable        = 14
+	CodeDataLoss           = 15
+	CodeUnauthenticated    = 16
+)
+
+var codeNames = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND",
+	"ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION",
+	"ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+// codeStatuses maps gRPC codes to the HTTP status used for them in results,
+// following the mapping used by gRPC-HTTP gateways.
+var codeStatuses = []int{
+	http.StatusOK,
+	499,
+	http.StatusInternalServerError,
+	http.StatusBadRequest,
+	http.StatusGatewayTimeout,
+	http.StatusNotFound,
+	http.StatusConflict,
+	http.StatusForbidden,
+	http.StatusTooManyRequests,
+	http.StatusBadRequest,
+	http.StatusConflict,
+	http.StatusBadRequest,
+	http.StatusNotImplemented,
+	http.StatusInternalServerError,
+	http.StatusServiceUnavailable,
+	http.StatusInternalServerError,
+	http.StatusUnauthorized,
+}
+
+// CodeName returns the canonical name of a code, such as NOT_FOUND.
+func CodeName(code int) string {
+	if code >= 0 && code < len(codeNames) {
+		return codeNames[code]
+	}
+
+	return "CODE(" + strconv.Itoa(code) + ")"
+}
+
+// HTTPStatus returns the HTTP status a gRPC code is reported as.
+func HTTPStatus(code int) int {
+	if code >= 0 && code < len(codeStatuses) {
+		return codeStatuses[code]
+	}
+
+	return http.StatusInternalServerError
+}
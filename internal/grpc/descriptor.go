@@ -0,0 +1,112 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Registry resolves gRPC methods and converts their messages between the
+// protobuf wire format and JSON using a descriptor set.
+type Registry struct {
+	files *protoregistry.Files
+	types *dynamicpb.Types
+}
+
+// NewRegistry builds a registry from a descriptor set. The set must
+// include every imported file (protoc --include_imports).
+func NewRegistry(set *descriptorpb.FileDescriptorSet) (*Registry, error) {
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+
+	return &Registry{files: files, types: dynamicpb.NewTypes(files)}, nil
+}
+
+// LoadDescriptorSet reads a binary FileDescriptorSet, as written by
+// protoc --descriptor_set_out or buf build -o.
+func LoadDescriptorSet(path string) (*Registry, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is a user supplied descriptor set
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set %s: %w", path, err)
+	}
+
+	return NewRegistry(&set)
+}
+
+// Method resolves a request path such as /helloworld.Greeter/SayHello.
+func (r *Registry) Method(path string) (protoreflect.MethodDescriptor, error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !ok || service == "" || method == "" {
+		return nil, fmt.Errorf("invalid gRPC method path %q", path)
+	}
+
+	desc, err := r.files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("unknown gRPC service %q", service)
+	}
+
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a service", service)
+	}
+
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("unknown method %q on gRPC service %q", method, service)
+	}
+
+	return md, nil
+}
+
+// ToJSON decodes a wire format message into compact JSON. protojson output
+// is not byte stable, so it is compacted to compare reliably.
+func (r *Registry) ToJSON(desc protoreflect.MessageDescriptor, wire []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(desc)
+	if err := (proto.UnmarshalOptions{Resolver: r.types}).Unmarshal(wire, msg); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", desc.FullName(), err)
+	}
+
+	out, err := (protojson.MarshalOptions{Resolver: r.types}).Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s as JSON: %w", desc.FullName(), err)
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, out); err != nil {
+		return nil, err
+	}
+
+	return compact.Bytes(), nil
+}
+
+// FromJSON encodes a JSON message into the wire format.
+func (r *Registry) FromJSON(desc protoreflect.MessageDescriptor, data []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(desc)
+	if err := (protojson.UnmarshalOptions{Resolver: r.types}).Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s from JSON: %w", desc.FullName(), err)
+	}
+
+	wire, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", desc.FullName(), err)
+	}
+
+	return wire, nil
+}
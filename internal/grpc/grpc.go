@@ -0,0 +1,148 @@
+// Package grpc implements the parts of the gRPC wire protocol needed to
+// capture and replay unary calls: message framing, status codes and an
+// HTTP/2 transport that also works without TLS.
+package grpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http2"
+)
+
+// ContentType is the content type of gRPC requests and responses.
+const ContentType = "application/grpc"
+
+// maxMessageSize bounds a single message so a corrupt length prefix can't
+// exhaust memory.
+const maxMessageSize = 64 << 20
+
+// IsGRPC reports whether the headers carry a gRPC content type, including
+// subtypes such as application/grpc+proto.
+func IsGRPC(headers http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(headers.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return mediaType == ContentType || strings.HasPrefix(mediaType, ContentType+"+")
+}
+
+// EncodeFrame prefixes an uncompressed message with its length.
+func EncodeFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg))) // #nosec G115 -- messages are bounded by maxMessageSize
+	return append(frame, msg...)
+}
+
+// DecodeFrames splits a body into messages. Compressed messages are
+// inflated with the grpc-encoding of the body; only gzip is supported.
+func DecodeFrames(body []byte, encoding string) ([][]byte, error) {
+	var messages [][]byte
+
+	for len(body) > 0 {
+		if len(body) < 5 {
+			return nil, fmt.Errorf("truncated gRPC frame header")
+		}
+
+		compressed := body[0]
+		length := binary.BigEndian.Uint32(body[1:5])
+		if compressed > 1 {
+			return nil, fmt.Errorf("invalid gRPC frame flag %d", compressed)
+		}
+
+		if length > maxMessageSize || int(length) > len(body)-5 {
+			return nil, fmt.Errorf("gRPC frame of %d bytes exceeds the body", length)
+		}
+
+		msg := body[5 : 5+length]
+		body = body[5+length:]
+
+		if compressed == 1 {
+			inflated, err := decompress(msg, encoding)
+			if err != nil {
+				return nil, err
+			}
+
+			msg = inflated
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+func decompress(msg []byte, encoding string) ([]byte, error) {
+	if encoding != "gzip" {
+		return nil, fmt.Errorf("unsupported grpc-encoding %q", encoding)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(msg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress gRPC message: %w", err)
+	}
+
+	out, err := io.ReadAll(io.LimitReader(r, maxMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress gRPC message: %w", err)
+	}
+
+	if len(out) > maxMessageSize {
+		return nil, fmt.Errorf("decompressed gRPC message exceeds %d bytes", maxMessageSize)
+	}
+
+	return out, nil
+}
+
+// Status returns the grpc-status and grpc-message of a response. They are
+// sent as trailers, or as headers in a trailers-only response.
+func Status(header, trailer http.Header) (int, string, bool) {
+	for _, h := range []http.Header{trailer, header} {
+		value := h.Get("Grpc-Status")
+		if value == "" {
+			continue
+		}
+
+		code, err := strconv.Atoi(value)
+		if err != nil {
+			return CodeUnknown, value, true
+		}
+
+		message, err := url.PathUnescape(h.Get("Grpc-Message"))
+		if err != nil {
+			message = h.Get("Grpc-Message")
+		}
+
+		return code, message, true
+	}
+
+	return 0, "", false
+}
+
+// NewTransport returns an HTTP/2 transport. Without TLS it speaks HTTP/2
+// over cleartext with prior knowledge, as gRPC servers expect.
+func NewTransport(useTLS bool, tlsConfig *tls.Config) http.RoundTripper {
+	if useTLS {
+		return &http2.Transport{TLSClientConfig: tlsConfig}
+	}
+
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
@@ -0,0 +1,117 @@
+package grpc_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/kx0101/replayer/internal/grpc"
+	"github.com/kx0101/replayer/internal/grpc/grpctest"
+)
+
+func TestFrames(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		body := append(grpc.EncodeFrame([]byte("one")), grpc.EncodeFrame(nil)...)
+
+		frames, err := grpc.DecodeFrames(body, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(frames) != 2 || string(frames[0]) != "one" || len(frames[1]) != 0 {
+			t.Errorf("unexpected frames: %q", frames)
+		}
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		_, _ = zw.Write([]byte("hello"))
+		_ = zw.Close()
+
+		frame := grpc.EncodeFrame(compressed.Bytes())
+		frame[0] = 1
+
+		frames, err := grpc.DecodeFrames(frame, "gzip")
+		if err != nil || string(frames[0]) != "hello" {
+			t.Errorf("unexpected result: %q %v", frames, err)
+		}
+
+		if _, err := grpc.DecodeFrames(frame, "snappy"); err == nil {
+			t.Error("expected error for an unsupported encoding")
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, body := range [][]byte{{0, 0, 0}, {0, 0, 0, 0, 9, 1}, {7, 0, 0, 0, 0}} {
+			if _, err := grpc.DecodeFrames(body, ""); err == nil {
+				t.Errorf("expected error for %v", body)
+			}
+		}
+	})
+}
+
+func TestStatus(t *testing.T) {
+	code, message, ok := grpc.Status(
+		http.Header{"Grpc-Status": {"0"}},
+		http.Header{"Grpc-Status": {"5"}, "Grpc-Message": {"user%20not%20found"}},
+	)
+	if !ok || code != grpc.CodeNotFound || message != "user not found" {
+		t.Errorf("expected the trailer to win, got %d %q %v", code, message, ok)
+	}
+
+	if _, _, ok := grpc.Status(http.Header{}, nil); ok {
+		t.Error("expected no status without grpc-status")
+	}
+
+	if grpc.CodeName(grpc.CodeInvalidArgument) != "INVALID_ARGUMENT" || grpc.CodeName(42) != "CODE(42)" {
+		t.Error("unexpected code names")
+	}
+
+	if grpc.HTTPStatus(grpc.CodeOK) != http.StatusOK || grpc.HTTPStatus(grpc.CodeUnavailable) != http.StatusServiceUnavailable {
+		t.Error("unexpected status mapping")
+	}
+
+	if !grpc.IsGRPC(http.Header{"Content-Type": {"application/grpc+proto"}}) || grpc.IsGRPC(http.Header{"Content-Type": {"application/grpc-web"}}) {
+		t.Error("unexpected content type detection")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "greeter.protoset")
+	if err := grpctest.WriteDescriptorSet(path); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := grpc.LoadDescriptorSet(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	method, err := registry.Method(grpctest.SayHelloPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wire, err := registry.FromJSON(method.Output(), []byte(`{"message": "hi", "timestamp": "42"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out, err := registry.ToJSON(method.Output(), wire)
+	if err != nil || string(out) != `{"message":"hi","timestamp":"42"}` {
+		t.Errorf("unexpected JSON: %s %v", out, err)
+	}
+
+	for _, bad := range []string{"/replayer.test.Greeter/Nope", "/replayer.test.Missing/SayHello", "/replayer.test.HelloRequest/X", "SayHello"} {
+		if _, err := registry.Method(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+
+	if _, err := grpc.LoadDescriptorSet(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
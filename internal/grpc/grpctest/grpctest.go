@@ -0,0 +1,159 @@
+// Package grpctest provides a small Greeter gRPC service, and the
+// descriptor set describing it, for tests and the mock gRPC server.
+package grpctest
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/kx0101/replayer/internal/grpc"
+)
+
+// SayHelloPath is the request path of the only method of the service.
+const SayHelloPath = "/replayer.test.Greeter/SayHello"
+
+// DescriptorSet describes the service:
+//
+//	package replayer.test;
+//
+//	message HelloRequest { string name = 1; }
+//	message HelloReply { string message = 1; int64 timestamp = 2; }
+//
+//	service Greeter {
+//	  rpc SayHello(HelloRequest) returns (HelloReply);
+//	}
+func DescriptorSet() *descriptorpb.FileDescriptorSet {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+	}
+
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("replayer/test/greeter.proto"),
+		Package: proto.String("replayer.test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name:  proto.String("HelloRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING)},
+			},
+			{
+				Name: proto.String("HelloReply"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("message", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+					field("timestamp", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Greeter"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("SayHello"),
+				InputType:  proto.String(".replayer.test.HelloRequest"),
+				OutputType: proto.String(".replayer.test.HelloReply"),
+			}},
+		}},
+	}}}
+}
+
+// WriteDescriptorSet writes the binary descriptor set to path.
+func WriteDescriptorSet(path string) error {
+	data, err := proto.Marshal(DescriptorSet())
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// Handler serves the Greeter over HTTP/2, with or without TLS. SayHello
+// replies "<greeting>, <name>" and fails with INVALID_ARGUMENT when the
+// name is empty.
+func Handler(greeting string) http.Handler {
+	registry, err := grpc.NewRegistry(DescriptorSet())
+	if err != nil {
+		panic(err)
+	}
+
+	method, err := registry.Method(SayHelloPath)
+	if err != nil {
+		panic(err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !grpc.IsGRPC(r.Header) {
+			http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		w.Header().Set("Content-Type", grpc.ContentType)
+
+		if r.URL.Path != SayHelloPath {
+			writeStatus(w, grpc.CodeUnimplemented, "unknown method "+r.URL.Path)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeStatus(w, grpc.CodeInternal, err.Error())
+			return
+		}
+
+		frames, err := grpc.DecodeFrames(body, r.Header.Get("Grpc-Encoding"))
+		if err != nil || len(frames) != 1 {
+			writeStatus(w, grpc.CodeInternal, "expected a single request message")
+			return
+		}
+
+		req := dynamicpb.NewMessage(method.Input())
+		if err := proto.Unmarshal(frames[0], req); err != nil {
+			writeStatus(w, grpc.CodeInternal, err.Error())
+			return
+		}
+
+		name := req.Get(method.Input().Fields().ByName("name")).String()
+		if name == "" {
+			writeStatus(w, grpc.CodeInvalidArgument, "name is required")
+			return
+		}
+
+		reply := dynamicpb.NewMessage(method.Output())
+		fields := method.Output().Fields()
+		reply.Set(fields.ByName("message"), protoreflect.ValueOfString(greeting+", "+name))
+		reply.Set(fields.ByName("timestamp"), protoreflect.ValueOfInt64(time.Now().UnixNano()))
+
+		out, err := proto.Marshal(reply)
+		if err != nil {
+			writeStatus(w, grpc.CodeInternal, err.Error())
+			return
+		}
+
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		_, _ = w.Write(grpc.EncodeFrame(out))
+		w.Header().Set("Grpc-Status", "0")
+	})
+
+	return h2c.NewHandler(handler, &http2.Server{})
+}
+
+// writeStatus sends a trailers-only error response.
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", message)
+	w.WriteHeader(http.StatusOK)
+}
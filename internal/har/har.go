@@ -0,0 +1,457 @@
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+const Version = "1.2"
+
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+	Comment string  `json:"comment,omitempty"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         Timings   `json:"timings"`
+	ServerIPAddress string    `json:"serverIPAddress,omitempty"`
+	Comment         string    `json:"comment,omitempty"`
+}
+
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+	Comment     string      `json:"comment,omitempty"`
+}
+
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+type PostData struct {
+	MimeType string  `json:"mimeType"`
+	Params   []Param `json:"params,omitempty"`
+	Text     string  `json:"text"`
+}
+
+type Param struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+type Content struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Timings follows the HAR convention of -1 for phases that do not apply.
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func Decode(r io.Reader) (*HAR, error) {
+	var doc HAR
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode HAR: %w", err)
+	}
+
+	return &doc, nil
+}
+
+func New() *HAR {
+	return &HAR{
+		Log: Log{
+			Version: Version,
+			Creator: Creator{Name: "replayer", Version: "1.0"},
+			Entries: []Entry{},
+		},
+	}
+}
+
+func (h *HAR) LogEntries(limit int) ([]models.LogEntry, error) {
+	var entries []models.LogEntry
+
+	for i, e := range h.Log.Entries {
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+
+		entry, err := e.LogEntry()
+		if err != nil {
+			return nil, fmt.Errorf("HAR entry %d: %w", i, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (e Entry) LogEntry() (models.LogEntry, error) {
+	u, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return models.LogEntry{}, fmt.Errorf("invalid request URL: %w", err)
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	query := u.RawQuery
+	if query == "" && len(e.Request.QueryString) > 0 {
+		values := url.Values{}
+		for _, q := range e.Request.QueryString {
+			values.Add(q.Name, q.Value)
+		}
+
+		query = values.Encode()
+	}
+
+	if query != "" {
+		path += "?" + query
+	}
+
+	headers := toHeaderMap(e.Request.Headers)
+	if _, ok := headers["Cookie"]; !ok && len(e.Request.Cookies) > 0 {
+		pairs := make([]string, 0, len(e.Request.Cookies))
+		for _, c := range e.Request.Cookies {
+			pairs = append(pairs, c.Name+"="+c.Value)
+		}
+
+		headers["Cookie"] = []string{strings.Join(pairs, "; ")}
+	}
+
+	responseHeaders := toHeaderMap(e.Response.Headers)
+	if _, ok := responseHeaders["Set-Cookie"]; !ok && len(e.Response.Cookies) > 0 {
+		for _, c := range e.Response.Cookies {
+			responseHeaders["Set-Cookie"] = append(responseHeaders["Set-Cookie"], c.Name+"="+c.Value)
+		}
+	}
+
+	latency := e.Time
+	if latency <= 0 {
+		latency = e.Timings.total()
+	}
+
+	return models.LogEntry{
+		BodyEncoding:    models.BodyEncodingBase64,
+		Method:          strings.ToUpper(e.Request.Method),
+		Path:            path,
+		Headers:         headers,
+		Body:            e.Request.PostData.encodedBody(),
+		Status:          e.Response.Status,
+		ResponseHeaders: responseHeaders,
+		ResponseBody:    e.Response.Content.encodedBody(),
+		Timestamp:       e.StartedDateTime,
+		LatencyMs:       int64(latency),
+	}, nil
+}
+
+func (p *PostData) encodedBody() string {
+	if p == nil {
+		return ""
+	}
+
+	text := p.Text
+	if text == "" && len(p.Params) > 0 {
+		values := url.Values{}
+		for _, param := range p.Params {
+			values.Add(param.Name, param.Value)
+		}
+
+		text = values.Encode()
+	}
+
+	if text == "" {
+		return ""
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(text))
+}
+
+func (c Content) encodedBody() string {
+	if c.Text == "" {
+		return ""
+	}
+
+	if c.Encoding == "base64" {
+		return c.Text
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(c.Text))
+}
+
+func (t Timings) total() float64 {
+	var sum float64
+	for _, v := range []float64{t.Blocked, t.DNS, t.Connect, t.Send, t.Wait, t.Receive} {
+		if v > 0 {
+			sum += v
+		}
+	}
+
+	return sum
+}
+
+func toHeaderMap(pairs []NameValue) map[string][]string {
+	headers := make(map[string][]string, len(pairs))
+	for _, h := range pairs {
+		// HTTP/2 pseudo-headers (:method, :path, ...) are not replayable
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+
+		key := textproto.CanonicalMIMEHeaderKey(h.Name)
+		headers[key] = append(headers[key], h.Value)
+	}
+
+	return headers
+}
+
+func toNameValues(headers map[string][]string) []NameValue {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := []NameValue{}
+	for _, k := range keys {
+		for _, v := range headers[k] {
+			pairs = append(pairs, NameValue{Name: k, Value: v})
+		}
+	}
+
+	return pairs
+}
+
+func FromEntries(entries []models.LogEntry) *HAR {
+	doc := New()
+
+	for _, e := range entries {
+		host := "localhost"
+		if h := firstHeader(e.Headers, "Host"); h != "" {
+			host = h
+		}
+
+		doc.Log.Entries = append(doc.Log.Entries, Entry{
+			StartedDateTime: e.Timestamp,
+			Time:            float64(e.LatencyMs),
+			Request:         buildRequest(e, "http://"+host),
+			Response:        buildResponse(e.Status, e.ResponseHeaders, e.DecodedResponseBody()),
+			Timings:         waitTimings(e.LatencyMs),
+		})
+	}
+
+	return doc
+}
+
+func FromResults(results []models.MultiEnvResult, scheme string, now time.Time) *HAR {
+	doc := New()
+
+	for _, r := range results {
+		targets := make([]string, 0, len(r.Responses))
+		for target := range r.Responses {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+
+		started := r.Request.Timestamp
+		if started.IsZero() {
+			started = now
+		}
+
+		for _, target := range targets {
+			res := r.Responses[target]
+
+			status := 0
+			if res.Status != nil {
+				status = *res.Status
+			}
+
+			var body []byte
+			if res.Body != nil {
+				body = []byte(*res.Body)
+			}
+
+			response := buildResponse(status, nil, body)
+			if res.Error != nil {
+				response.Comment = *res.Error
+			}
+
+			doc.Log.Entries = append(doc.Log.Entries, Entry{
+				StartedDateTime: started,
+				Time:            float64(res.LatencyMs),
+				Request:         buildRequest(r.Request, scheme+"://"+target),
+				Response:        response,
+				Timings:         waitTimings(res.LatencyMs),
+				Comment:         fmt.Sprintf("request %d (%s) against %s", r.Index, r.RequestID, target),
+			})
+		}
+	}
+
+	return doc
+}
+
+func buildRequest(e models.LogEntry, origin string) Request {
+	rawURL := origin + e.Path
+
+	query := []NameValue{}
+	if u, err := url.Parse(rawURL); err == nil {
+		for k, vs := range u.Query() {
+			for _, v := range vs {
+				query = append(query, NameValue{Name: k, Value: v})
+			}
+		}
+	}
+	sort.Slice(query, func(i, j int) bool { return query[i].Name < query[j].Name })
+
+	req := Request{
+		Method:      e.Method,
+		URL:         rawURL,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     parseCookies(firstHeader(e.Headers, "Cookie")),
+		Headers:     toNameValues(e.Headers),
+		QueryString: query,
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+
+	if body := e.DecodedBody(); len(body) > 0 {
+		req.PostData = &PostData{
+			MimeType: firstHeader(e.Headers, "Content-Type"),
+			Text:     string(body),
+		}
+		req.BodySize = int64(len(body))
+	}
+
+	return req
+}
+
+func buildResponse(status int, headers map[string][]string, body []byte) Response {
+	content := Content{
+		Size:     int64(len(body)),
+		MimeType: firstHeader(headers, "Content-Type"),
+	}
+
+	if utf8.Valid(body) {
+		content.Text = string(body)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(body)
+		content.Encoding = "base64"
+	}
+
+	return Response{
+		Status:      status,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []Cookie{},
+		Headers:     toNameValues(headers),
+		Content:     content,
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+}
+
+func waitTimings(latencyMs int64) Timings {
+	return Timings{
+		Blocked: -1,
+		DNS:     -1,
+		Connect: -1,
+		SSL:     -1,
+		Wait:    float64(latencyMs),
+	}
+}
+
+func parseCookies(header string) []Cookie {
+	cookies := []Cookie{}
+	if header == "" {
+		return cookies
+	}
+
+	for _, part := range strings.Split(header, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "" {
+			continue
+		}
+
+		cookies = append(cookies, Cookie{Name: name, Value: value})
+	}
+
+	return cookies
+}
+
+func firstHeader(headers map[string][]string, key string) string {
+	for k, vs := range headers {
+		if strings.EqualFold(k, key) && len(vs) > 0 {
+			return vs[0]
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,250 @@
+package har
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+const sampleHAR = `{
+  "log": {
+    "version": "1.2",
+    "creator": {"name": "WebInspector", "version": "537.36"},
+    "entries": [
+      {
+        "startedDateTime": "2024-12-10T14:23:45.123Z",
+        "time": 42.7,
+        "request": {
+          "method": "post",
+          "url": "https://api.example.com/api/users?page=2&sort=name",
+          "httpVersion": "HTTP/2.0",
+          "cookies": [{"name": "session", "value": "abc"}, {"name": "theme", "value": "dark"}],
+          "headers": [
+            {"name": ":authority", "value": "api.example.com"},
+            {"name": "content-type", "value": "application/json"}
+          ],
+          "queryString": [{"name": "page", "value": "2"}, {"name": "sort", "value": "name"}],
+          "postData": {"mimeType": "application/json", "text": "{\"name\":\"Liakos\"}"},
+          "headersSize": -1,
+          "bodySize": 17
+        },
+        "response": {
+          "status": 201,
+          "statusText": "Created",
+          "httpVersion": "HTTP/2.0",
+          "cookies": [],
+          "headers": [{"name": "content-type", "value": "application/json"}],
+          "content": {"size": 11, "mimeType": "application/json", "text": "eyJpZCI6MX0=", "encoding": "base64"},
+          "redirectURL": "",
+          "headersSize": -1,
+          "bodySize": 11
+        },
+        "cache": {},
+        "timings": {"blocked": -1, "dns": -1, "connect": -1, "ssl": -1, "send": 1, "wait": 40, "receive": 1.7}
+      },
+      {
+        "startedDateTime": "2024-12-10T14:23:46Z",
+        "time": 0,
+        "request": {
+          "method": "POST",
+          "url": "https://api.example.com/login",
+          "httpVersion": "HTTP/1.1",
+          "cookies": [],
+          "headers": [],
+          "queryString": [],
+          "postData": {"mimeType": "application/x-www-form-urlencoded", "params": [{"name": "user", "value": "liakos"}]},
+          "headersSize": -1,
+          "bodySize": 11
+        },
+        "response": {
+          "status": 302, "statusText": "Found", "httpVersion": "HTTP/1.1",
+          "cookies": [], "headers": [], "content": {"size": 0, "mimeType": ""},
+          "redirectURL": "/home", "headersSize": -1, "bodySize": 0
+        },
+        "cache": {},
+        "timings": {"blocked": 2, "dns": -1, "connect": 3, "send": 1, "wait": 10, "receive": 1}
+      }
+    ]
+  }
+}`
+
+func TestEntry_LogEntry(t *testing.T) {
+	doc, err := Decode(strings.NewReader(sampleHAR))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, err := doc.LogEntries(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	t.Run("request line and query string", func(t *testing.T) {
+		e := entries[0]
+		if e.Method != "POST" {
+			t.Errorf("expected method POST, got %s", e.Method)
+		}
+
+		if e.Path != "/api/users?page=2&sort=name" {
+			t.Errorf("expected query string to be kept, got %s", e.Path)
+		}
+	})
+
+	t.Run("headers and cookies", func(t *testing.T) {
+		e := entries[0]
+		if _, ok := e.Headers[":authority"]; ok {
+			t.Error("pseudo-headers should be dropped")
+		}
+
+		if got := e.Headers["Content-Type"]; len(got) != 1 || got[0] != "application/json" {
+			t.Errorf("unexpected Content-Type: %v", got)
+		}
+
+		if got := e.Headers["Cookie"]; len(got) != 1 || got[0] != "session=abc; theme=dark" {
+			t.Errorf("unexpected Cookie header: %v", got)
+		}
+	})
+
+	t.Run("bodies are base64 encoded", func(t *testing.T) {
+		e := entries[0]
+		if string(models.DecodeBody(e.Body)) != `{"name":"Liakos"}` {
+			t.Errorf("unexpected request body: %s", e.Body)
+		}
+
+		if e.ResponseBody != "eyJpZCI6MX0=" {
+			t.Errorf("expected base64 response body to be kept as is, got %s", e.ResponseBody)
+		}
+	})
+
+	t.Run("status, timestamp and latency", func(t *testing.T) {
+		e := entries[0]
+		if e.Status != 201 {
+			t.Errorf("expected status 201, got %d", e.Status)
+		}
+
+		if e.LatencyMs != 42 {
+			t.Errorf("expected latency 42, got %d", e.LatencyMs)
+		}
+
+		if !e.Timestamp.Equal(time.Date(2024, 12, 10, 14, 23, 45, 123000000, time.UTC)) {
+			t.Errorf("unexpected timestamp: %v", e.Timestamp)
+		}
+	})
+
+	t.Run("form params and timings fallback", func(t *testing.T) {
+		e := entries[1]
+		if string(models.DecodeBody(e.Body)) != "user=liakos" {
+			t.Errorf("expected form encoded params, got %s", models.DecodeBody(e.Body))
+		}
+
+		if e.LatencyMs != 17 {
+			t.Errorf("expected latency from timings 17, got %d", e.LatencyMs)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		limited, err := doc.LogEntries(1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(limited) != 1 {
+			t.Errorf("expected 1 entry, got %d", len(limited))
+		}
+	})
+}
+
+func TestFromEntries(t *testing.T) {
+	entries := []models.LogEntry{{
+		Method:          "POST",
+		Path:            "/api/users?page=2",
+		Headers:         map[string][]string{"Host": {"api.example.com"}, "Cookie": {"session=abc"}},
+		Body:            base64.StdEncoding.EncodeToString([]byte(`{"name":"Liakos"}`)),
+		Status:          200,
+		ResponseHeaders: map[string][]string{"Content-Type": {"application/json"}},
+		ResponseBody:    base64.StdEncoding.EncodeToString([]byte(`{"id":1}`)),
+		LatencyMs:       12,
+	}}
+
+	doc := FromEntries(entries)
+	if len(doc.Log.Entries) != 1 {
+		t.Fatalf("expected 1 HAR entry, got %d", len(doc.Log.Entries))
+	}
+
+	e := doc.Log.Entries[0]
+	if e.Request.URL != "http://api.example.com/api/users?page=2" {
+		t.Errorf("unexpected URL: %s", e.Request.URL)
+	}
+
+	if len(e.Request.QueryString) != 1 || e.Request.QueryString[0].Value != "2" {
+		t.Errorf("unexpected query string: %v", e.Request.QueryString)
+	}
+
+	if len(e.Request.Cookies) != 1 || e.Request.Cookies[0].Name != "session" {
+		t.Errorf("unexpected cookies: %v", e.Request.Cookies)
+	}
+
+	if e.Request.PostData == nil || e.Request.PostData.Text != `{"name":"Liakos"}` {
+		t.Errorf("unexpected post data: %+v", e.Request.PostData)
+	}
+
+	if e.Response.Content.Text != `{"id":1}` || e.Response.Content.MimeType != "application/json" {
+		t.Errorf("unexpected response content: %+v", e.Response.Content)
+	}
+
+	roundTrip, err := e.LogEntry()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if roundTrip.Path != entries[0].Path || roundTrip.Body != entries[0].Body || roundTrip.ResponseBody != entries[0].ResponseBody {
+		t.Errorf("round trip mismatch: %+v", roundTrip)
+	}
+}
+
+func TestFromResults(t *testing.T) {
+	status := 200
+	body := `{"ok":true}`
+	errMsg := "connection refused"
+
+	results := []models.MultiEnvResult{{
+		Index:     3,
+		RequestID: "abc123",
+		Request:   models.LogEntry{Method: "GET", Path: "/status"},
+		Responses: map[string]models.ReplayResult{
+			"staging:8080": {Status: &status, Body: &body, LatencyMs: 15},
+			"prod:8080":    {Error: &errMsg, LatencyMs: 5},
+		},
+	}}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	doc := FromResults(results, "https", now)
+
+	if len(doc.Log.Entries) != 2 {
+		t.Fatalf("expected one HAR entry per target, got %d", len(doc.Log.Entries))
+	}
+
+	first, second := doc.Log.Entries[0], doc.Log.Entries[1]
+	if first.Request.URL != "https://prod:8080/status" || second.Request.URL != "https://staging:8080/status" {
+		t.Errorf("expected entries sorted by target, got %s and %s", first.Request.URL, second.Request.URL)
+	}
+
+	if first.Response.Status != 0 || first.Response.Comment != errMsg {
+		t.Errorf("expected failed response to carry the error, got %+v", first.Response)
+	}
+
+	if second.Response.Content.Text != body || second.Time != 15 {
+		t.Errorf("unexpected response: %+v", second)
+	}
+
+	if !second.StartedDateTime.Equal(now) {
+		t.Errorf("expected zero timestamps to fall back to now, got %v", second.StartedDateTime)
+	}
+}
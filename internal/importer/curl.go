@@ -0,0 +1,638 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// curlShortOptions maps the short curl options we understand to their long
+// names. The value reports whether the option takes an argument.
+var curlShortOptions = map[byte]struct {
+	long   string
+	hasArg bool
+}{
+	'X': {"--request", true},
+	'H': {"--header", true},
+	'd': {"--data", true},
+	'u': {"--user", true},
+	'b': {"--cookie", true},
+	'A': {"--user-agent", true},
+	'e': {"--referer", true},
+	'F': {"--form", true},
+	'T': {"--upload-file", true},
+	'G': {"--get", false},
+	'I': {"--head", false},
+	'o': {"--output", true},
+	'm': {"--max-time", true},
+	'w': {"--write-out", true},
+	'x': {"--proxy", true},
+	'E': {"--cert", true},
+	'c': {"--cookie-jar", true},
+	'r': {"--range", true},
+	'K': {"--config", true},
+}
+
+var curlLongArgOptions = map[string]bool{
+	"--request": true, "--header": true, "--data": true, "--data-raw": true,
+	"--data-binary": true, "--data-ascii": true, "--data-urlencode": true,
+	"--json": true, "--user": true, "--cookie": true, "--user-agent": true,
+	"--referer": true, "--url": true, "--form": true, "--upload-file": true,
+	"--output": true, "--max-time": true, "--connect-timeout": true,
+	"--write-out": true, "--proxy": true, "--cacert": true, "--cert": true,
+	"--key": true, "--resolve": true, "--retry": true, "--cookie-jar": true,
+	"--range": true, "--config": true, "--oauth2-bearer": true,
+}
+
+type curlRequest struct {
+	method  string
+	rawURL  string
+	headers map[string][]string
+	data    []string
+	json    bool
+	get     bool
+	head    bool
+}
+
+// ParseCurl converts a single curl command line, as copied from a browser or
+// a bug report, into a LogEntry. Shell variables ($TOKEN) and {{name}}
+// placeholders are substituted from vars.
+func ParseCurl(command string, vars map[string]string) (models.LogEntry, error) {
+	lines, err := shellWords(command, vars)
+	if err != nil {
+		return models.LogEntry{}, err
+	}
+
+	var words []string
+	for _, line := range lines {
+		words = append(words, line...)
+	}
+
+	return parseCurlArgs(words)
+}
+
+// ParseCurlCommands reads one or more curl commands. Commands may span lines
+// with trailing backslashes; lines that are not curl commands are skipped.
+func ParseCurlCommands(r io.Reader, vars map[string]string) ([]models.LogEntry, error) {
+	data, err := io.ReadAll(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read curl commands: %w", err)
+	}
+
+	lines, err := shellWords(string(data), vars)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []models.LogEntry
+	for _, words := range lines {
+		if len(words) == 0 || !isCurl(words[0]) {
+			continue
+		}
+
+		entry, err := parseCurlArgs(words)
+		if err != nil {
+			return nil, fmt.Errorf("command %d: %w", len(entries)+1, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func isCurl(word string) bool {
+	return strings.TrimSuffix(filepath.Base(word), ".exe") == "curl"
+}
+
+func parseCurlArgs(words []string) (models.LogEntry, error) {
+	if len(words) == 0 || !isCurl(words[0]) {
+		return models.LogEntry{}, fmt.Errorf("not a curl command")
+	}
+
+	req := &curlRequest{headers: make(map[string][]string)}
+
+	for i := 1; i < len(words); i++ {
+		word := words[i]
+
+		next := func() (string, error) {
+			if i+1 >= len(words) {
+				return "", fmt.Errorf("option %s requires an argument", word)
+			}
+
+			i++
+			return words[i], nil
+		}
+
+		switch {
+		case word == "--":
+			if i+1 < len(words) {
+				req.rawURL = words[len(words)-1]
+			}
+			i = len(words)
+		case strings.HasPrefix(word, "--"):
+			value := ""
+			if curlLongArgOptions[word] {
+				v, err := next()
+				if err != nil {
+					return models.LogEntry{}, err
+				}
+
+				value = v
+			}
+
+			if err := req.apply(word, value); err != nil {
+				return models.LogEntry{}, err
+			}
+		case strings.HasPrefix(word, "-") && len(word) > 1:
+			for j := 1; j < len(word); j++ {
+				opt, ok := curlShortOptions[word[j]]
+				if !ok {
+					continue
+				}
+
+				value := ""
+				if opt.hasArg {
+					value = word[j+1:]
+					if value == "" {
+						v, err := next()
+						if err != nil {
+							return models.LogEntry{}, err
+						}
+
+						value = v
+					}
+				}
+
+				if err := req.apply(opt.long, value); err != nil {
+					return models.LogEntry{}, err
+				}
+
+				if opt.hasArg {
+					break
+				}
+			}
+		default:
+			req.rawURL = word
+		}
+	}
+
+	return req.logEntry()
+}
+
+func (c *curlRequest) apply(option, value string) error {
+	switch option {
+	case "--request":
+		c.method = strings.ToUpper(value)
+	case "--header":
+		name, v, ok := strings.Cut(value, ":")
+		if !ok {
+			return nil
+		}
+
+		if v = strings.TrimSpace(v); v != "" {
+			c.addHeader(name, v)
+		}
+	case "--data", "--data-ascii":
+		if strings.HasPrefix(value, "@") {
+			data, err := readDataFile(value[1:])
+			if err != nil {
+				return err
+			}
+
+			value = strings.NewReplacer("\r", "", "\n", "").Replace(data)
+		}
+
+		c.data = append(c.data, value)
+	case "--data-binary", "--json":
+		if strings.HasPrefix(value, "@") {
+			data, err := readDataFile(value[1:])
+			if err != nil {
+				return err
+			}
+
+			value = data
+		}
+
+		c.data = append(c.data, value)
+		c.json = c.json || option == "--json"
+	case "--data-raw":
+		c.data = append(c.data, value)
+	case "--data-urlencode":
+		if name, v, ok := strings.Cut(value, "="); ok {
+			c.data = append(c.data, name+"="+url.QueryEscape(v))
+		} else {
+			c.data = append(c.data, url.QueryEscape(value))
+		}
+	case "--user":
+		c.addHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(value)))
+	case "--oauth2-bearer":
+		c.addHeader("Authorization", "Bearer "+value)
+	case "--cookie":
+		if strings.Contains(value, "=") {
+			c.addHeader("Cookie", value)
+		}
+	case "--user-agent":
+		c.addHeader("User-Agent", value)
+	case "--referer":
+		c.addHeader("Referer", value)
+	case "--url":
+		c.rawURL = value
+	case "--get":
+		c.get = true
+	case "--head":
+		c.head = true
+	case "--form", "--upload-file":
+		return fmt.Errorf("%s is not supported, use --data-binary instead", option)
+	}
+
+	return nil
+}
+
+func (c *curlRequest) addHeader(name, value string) {
+	key := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+	c.headers[key] = append(c.headers[key], value)
+}
+
+func (c *curlRequest) logEntry() (models.LogEntry, error) {
+	if c.rawURL == "" {
+		return models.LogEntry{}, fmt.Errorf("curl command has no URL")
+	}
+
+	raw := c.rawURL
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return models.LogEntry{}, fmt.Errorf("invalid URL %q: %w", c.rawURL, err)
+	}
+
+	body := strings.Join(c.data, "&")
+	if c.get && body != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+
+		u.RawQuery += body
+		body = ""
+	}
+
+	method := c.method
+	switch {
+	case method != "":
+	case c.head:
+		method = http.MethodHead
+	case body != "":
+		method = http.MethodPost
+	default:
+		method = http.MethodGet
+	}
+
+	if c.json {
+		if _, ok := c.headers["Content-Type"]; !ok {
+			c.headers["Content-Type"] = []string{"application/json"}
+		}
+
+		if _, ok := c.headers["Accept"]; !ok {
+			c.headers["Accept"] = []string{"application/json"}
+		}
+	}
+
+	if _, ok := c.headers["Content-Type"]; !ok && body != "" {
+		c.headers["Content-Type"] = []string{"application/x-www-form-urlencoded"}
+	}
+
+	if _, ok := c.headers["Host"]; !ok && u.Host != "" {
+		c.headers["Host"] = []string{u.Host}
+	}
+
+	entry := models.LogEntry{
+		BodyEncoding: models.BodyEncodingBase64,
+		Method:       method,
+		Path:         requestPath(u),
+		Headers:      c.headers,
+	}
+
+	if body != "" {
+		entry.Body = base64.StdEncoding.EncodeToString([]byte(body))
+	}
+
+	return entry, nil
+}
+
+func requestPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	return path
+}
+
+func readDataFile(name string) (string, error) {
+	if name == "-" || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid data file: %s", name)
+	}
+
+	data, err := os.ReadFile(filepath.Clean(name)) // #nosec G304 -- path comes from the imported command
+	if err != nil {
+		return "", fmt.Errorf("failed to read data file: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// shellWords splits text into words the way a POSIX shell would, one slice
+// per logical line. It understands single, double and $'...' quoting,
+// backslash line continuations and # comments.
+func shellWords(s string, vars map[string]string) ([][]string, error) {
+	var lines [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	endWord := func() {
+		if inWord {
+			words = append(words, Expand(word.String(), vars))
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	endLine := func() {
+		endWord()
+		if len(words) > 0 {
+			lines = append(lines, words)
+			words = nil
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case c == '\\':
+			if i+1 < len(s) && s[i+1] == '\r' {
+				i++
+			}
+
+			if i+1 < len(s) && s[i+1] == '\n' {
+				i++
+				continue
+			}
+
+			if i+1 < len(s) {
+				i++
+				word.WriteByte(s[i])
+				inWord = true
+			}
+		case c == '\n' || c == ';' || c == '|' || c == '&':
+			endLine()
+		case c == ' ' || c == '\t' || c == '\r':
+			endWord()
+		case c == '#' && !inWord:
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			endLine()
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			n, err := ansiCQuote(s[i+2:], &word)
+			if err != nil {
+				return nil, err
+			}
+
+			i += n + 2
+			inWord = true
+		case c == '"':
+			n, err := doubleQuote(s[i+1:], &word, vars)
+			if err != nil {
+				return nil, err
+			}
+
+			i += n + 1
+			inWord = true
+		case c == '$':
+			i += expandShellVar(s[i:], &word, vars) - 1
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	endLine()
+	return lines, nil
+}
+
+// doubleQuote consumes a double quoted string (without the opening quote)
+// and returns the number of bytes read including the closing quote.
+func doubleQuote(s string, word *strings.Builder, vars map[string]string) (int, error) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return i + 1, nil
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+				i++
+				if s[i] != '\n' {
+					word.WriteByte(s[i])
+				}
+				continue
+			}
+
+			word.WriteByte('\\')
+		case '$':
+			i += expandShellVar(s[i:], word, vars) - 1
+		default:
+			word.WriteByte(s[i])
+		}
+	}
+
+	return 0, fmt.Errorf("unterminated double quote")
+}
+
+// ansiCQuote consumes a $'...' string body as emitted by browsers' "Copy as
+// cURL" for bodies with special characters.
+func ansiCQuote(s string, word *strings.Builder) (int, error) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\'' {
+			return i + 1, nil
+		}
+
+		if c != '\\' || i+1 >= len(s) {
+			word.WriteByte(c)
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n':
+			word.WriteByte('\n')
+		case 't':
+			word.WriteByte('\t')
+		case 'r':
+			word.WriteByte('\r')
+		case 'x':
+			end := i + 1
+			for end < len(s) && end < i+3 && isHex(s[end]) {
+				end++
+			}
+
+			if n, err := strconv.ParseUint(s[i+1:end], 16, 8); err == nil {
+				word.WriteByte(byte(n))
+				i = end - 1
+			} else {
+				word.WriteString(`\x`)
+			}
+		case 'u':
+			if i+5 <= len(s) {
+				if n, err := strconv.ParseUint(s[i+1:i+5], 16, 32); err == nil {
+					word.WriteRune(rune(n))
+					i += 4
+					continue
+				}
+			}
+
+			word.WriteString(`\u`)
+		default:
+			word.WriteByte(s[i])
+		}
+	}
+
+	return 0, fmt.Errorf("unterminated $' quote")
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// expandShellVar substitutes $NAME or ${NAME} when the variable is known and
+// keeps the text as is otherwise. It returns the number of bytes consumed.
+func expandShellVar(s string, word *strings.Builder, vars map[string]string) int {
+	var name string
+	consumed := 1
+
+	if strings.HasPrefix(s, "${") {
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			word.WriteByte('$')
+			return 1
+		}
+
+		name = s[2:end]
+		consumed = end + 1
+	} else {
+		for consumed < len(s) && isNameChar(s[consumed], consumed == 1) {
+			consumed++
+		}
+
+		name = s[1:consumed]
+	}
+
+	if v, ok := vars[name]; ok && name != "" {
+		word.WriteString(v)
+	} else {
+		word.WriteString(s[:consumed])
+	}
+
+	return consumed
+}
+
+func isNameChar(c byte, first bool) bool {
+	if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+
+	return !first && c >= '0' && c <= '9'
+}
+
+// CurlCommand renders req as a copy-pasteable curl command.
+func CurlCommand(req *http.Request, body []byte) string {
+	parts := []string{"curl"}
+	if req.Method != http.MethodGet || body != nil {
+		parts = append(parts, "-X "+req.Method)
+	}
+
+	parts = append(parts, shellQuote(req.URL.String()))
+
+	if req.Host != "" && req.Host != req.URL.Host {
+		parts = append(parts, "-H "+shellQuote("Host: "+req.Host))
+	}
+
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			parts = append(parts, "-H "+shellQuote(k+": "+v))
+		}
+	}
+
+	if body != nil {
+		parts = append(parts, "--data-binary "+shellQuote(string(body)))
+	}
+
+	return strings.Join(parts, " \\\n  ")
+}
+
+func shellQuote(s string) string {
+	printable := utf8.ValidString(s)
+	for i := 0; i < len(s) && printable; i++ {
+		if s[i] < 0x20 && s[i] != '\n' && s[i] != '\t' || s[i] == 0x7f {
+			printable = false
+		}
+	}
+
+	if printable {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("$'")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&sb, `\x%02x`, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('\'')
+
+	return sb.String()
+}
@@ -0,0 +1,143 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+func TestParseCurl(t *testing.T) {
+	t.Run("browser copy as curl", func(t *testing.T) {
+		command := `curl 'https://api.example.com/users?page=2' \
+  -H 'accept: application/json' \
+  -H 'authorization: Bearer $TOKEN' \
+  -H "x-tenant: $TENANT" \
+  --data-raw $'{"name":"O\'Brien","note":"a\nb"}' \
+  --compressed`
+
+		entry, err := ParseCurl(command, map[string]string{"TENANT": "acme", "TOKEN": "unused"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Method != "POST" || entry.Path != "/users?page=2" {
+			t.Errorf("unexpected request: %s %s", entry.Method, entry.Path)
+		}
+
+		if entry.Headers["Authorization"][0] != "Bearer $TOKEN" {
+			t.Errorf("expected single quoted variable to be kept, got %v", entry.Headers["Authorization"])
+		}
+
+		if entry.Headers["X-Tenant"][0] != "acme" || entry.Headers["Host"][0] != "api.example.com" {
+			t.Errorf("unexpected headers: %v", entry.Headers)
+		}
+
+		if body := string(models.DecodeBody(entry.Body)); body != "{\"name\":\"O'Brien\",\"note\":\"a\nb\"}" {
+			t.Errorf("unexpected body: %q", body)
+		}
+	})
+
+	t.Run("short options and placeholders", func(t *testing.T) {
+		entry, err := ParseCurl(`curl -sXPUT -uadmin:secret {{base}}/items/{{id}} -d a=1 -d b=2`, map[string]string{"base": "localhost:8080", "id": "7"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Method != "PUT" || entry.Path != "/items/7" {
+			t.Errorf("unexpected request: %s %s", entry.Method, entry.Path)
+		}
+
+		want := "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:secret"))
+		if entry.Headers["Authorization"][0] != want {
+			t.Errorf("unexpected auth header: %v", entry.Headers["Authorization"])
+		}
+
+		if string(models.DecodeBody(entry.Body)) != "a=1&b=2" || entry.Headers["Content-Type"][0] != "application/x-www-form-urlencoded" {
+			t.Errorf("unexpected body: %s %v", models.DecodeBody(entry.Body), entry.Headers)
+		}
+	})
+
+	t.Run("get with data and json", func(t *testing.T) {
+		entry, err := ParseCurl(`curl -G https://x.io/search --data-urlencode 'q=a b'`, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Method != "GET" || entry.Path != "/search?q=a+b" || entry.Body != "" {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+
+		entry, err = ParseCurl(`curl --json '{"a":1}' https://x.io/`, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Method != "POST" || entry.Headers["Content-Type"][0] != "application/json" {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, command := range []string{`wget http://x.io`, `curl -X GET`, `curl 'http://x.io`, `curl -F file=@a.png http://x.io`} {
+			if _, err := ParseCurl(command, nil); err == nil {
+				t.Errorf("expected error for %q", command)
+			}
+		}
+	})
+}
+
+func TestParseCurlCommands(t *testing.T) {
+	input := `# reproduce checkout bug
+curl http://localhost/a
+
+echo done
+curl -X DELETE \
+  http://localhost/b | jq .
+`
+
+	entries, err := ParseCurlCommands(strings.NewReader(input), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	if entries[1].Method != "DELETE" || entries[1].Path != "/b" {
+		t.Errorf("unexpected entry: %+v", entries[1])
+	}
+}
+
+func TestCurlCommand_RoundTrip(t *testing.T) {
+	bodies := [][]byte{
+		[]byte(`{"msg":"it's done"}`),
+		{0x00, 0xff, '\'', '\\', 'a'},
+	}
+
+	for _, body := range bodies {
+		req, err := http.NewRequest("PATCH", "http://staging.api/orders/1?x=1", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		req.Header.Set("X-Request-Id", "abc")
+
+		entry, err := ParseCurl(CurlCommand(req, body), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Method != "PATCH" || entry.Path != "/orders/1?x=1" || entry.Headers["X-Request-Id"][0] != "abc" {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+
+		if !bytes.Equal(models.DecodeBody(entry.Body), body) {
+			t.Errorf("body did not round trip: %q", models.DecodeBody(entry.Body))
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/pcap"
+	"github.com/kx0101/replayer/internal/redact"
+)
+
+// Import converts a curl, Postman or packet capture source into LogEntry
+// JSON Lines.
+func Import(args *cli.ImportArgs) error {
+	in, closeIn, err := openInput(args.InputFile)
+	if err != nil {
+		return err
+	}
+	defer closeIn()
+
+	var entries []models.LogEntry
+	switch args.Source {
+	case "curl":
+		entries, err = ParseCurlCommands(in, args.Vars)
+	case "postman":
+		entries, err = importPostman(in, args)
+	case "pcap":
+		entries, err = pcap.ReadEntries(in, 0)
+	default:
+		err = fmt.Errorf("unknown import source: %s", args.Source)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if args.Redact {
+		redactor, err := redact.Load(args.RedactConfig)
+		if err != nil {
+			return err
+		}
+
+		for i := range entries {
+			redactor.Entry(&entries[i])
+		}
+	}
+
+	out := io.Writer(os.Stdout)
+	if args.OutputFile != "" {
+		if strings.Contains(args.OutputFile, "..") {
+			return fmt.Errorf("invalid output path: %s", args.OutputFile)
+		}
+
+		file, err := os.Create(args.OutputFile) // #nosec G304
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+
+		defer func() {
+			err = file.Close()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to close output file: %v\n", err)
+			}
+		}()
+
+		out = file
+	}
+
+	if err := WriteFile(out, "import:"+args.Source, entries); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d requests from %s\n", len(entries), args.Source)
+	return nil
+}
+
+func importPostman(in io.Reader, args *cli.ImportArgs) ([]models.LogEntry, error) {
+	collection, err := DecodeCollection(in)
+	if err != nil {
+		return nil, err
+	}
+
+	var env *Environment
+	if args.Environment != "" {
+		envFile, closeEnv, err := openInput(args.Environment)
+		if err != nil {
+			return nil, err
+		}
+		defer closeEnv()
+
+		if env, err = DecodeEnvironment(envFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return collection.LogEntries(collection.Variables(env, args.Vars))
+}
+
+// WriteFile writes a header record describing entries, followed by the
+// entries themselves.
+func WriteFile(w io.Writer, source string, entries []models.LogEntry) error {
+	if err := json.NewEncoder(w).Encode(models.NewFileHeader(source, entries)); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return WriteEntries(w, entries)
+}
+
+// WriteEntries writes entries as JSON Lines, the format read by --input-file.
+func WriteEntries(w io.Writer, entries []models.LogEntry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to write entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func openInput(path string) (io.Reader, func(), error) {
+	if path == "-" {
+		return os.Stdin, func() {}, nil
+	}
+
+	if strings.Contains(path, "..") {
+		return nil, nil, fmt.Errorf("invalid input path: %s", path)
+	}
+
+	file, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+
+	return file, func() {
+		if err := file.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close input file: %v\n", err)
+		}
+	}, nil
+}
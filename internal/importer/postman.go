@@ -0,0 +1,475 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+var pathVariableRegex = regexp.MustCompile(`/:([A-Za-z_][A-Za-z0-9_]*)`)
+
+// Collection is the subset of the Postman Collection v2.1 format needed to
+// rebuild requests.
+type Collection struct {
+	Info     CollectionInfo `json:"info"`
+	Item     []Item         `json:"item"`
+	Auth     *Auth          `json:"auth,omitempty"`
+	Variable []KeyValue     `json:"variable,omitempty"`
+}
+
+type CollectionInfo struct {
+	Name   string `json:"name"`
+	Schema string `json:"schema"`
+}
+
+// Item is either a folder (Item set) or a request.
+type Item struct {
+	Name    string   `json:"name"`
+	Item    []Item   `json:"item,omitempty"`
+	Auth    *Auth    `json:"auth,omitempty"`
+	Request *Request `json:"request,omitempty"`
+}
+
+type Request struct {
+	Method string     `json:"method"`
+	Header []KeyValue `json:"header,omitempty"`
+	URL    URL        `json:"url"`
+	Body   *Body      `json:"body,omitempty"`
+	Auth   *Auth      `json:"auth,omitempty"`
+}
+
+type KeyValue struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Type     string `json:"type,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+	Enabled  *bool  `json:"enabled,omitempty"`
+}
+
+func (kv KeyValue) active() bool {
+	return !kv.Disabled && (kv.Enabled == nil || *kv.Enabled)
+}
+
+// URL accepts both the plain string and the structured object form.
+type URL struct {
+	Raw      string     `json:"raw"`
+	Host     []string   `json:"-"`
+	Path     []string   `json:"-"`
+	Protocol string     `json:"protocol,omitempty"`
+	Port     string     `json:"port,omitempty"`
+	Query    []KeyValue `json:"query,omitempty"`
+	Variable []KeyValue `json:"variable,omitempty"`
+}
+
+func (u *URL) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err == nil {
+		u.Raw = raw
+		return nil
+	}
+
+	type plain URL
+	var obj struct {
+		plain
+		Host json.RawMessage `json:"host"`
+		Path json.RawMessage `json:"path"`
+	}
+
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	*u = URL(obj.plain)
+	u.Host = stringOrList(obj.Host, ".")
+	u.Path = stringOrList(obj.Path, "/")
+
+	return nil
+}
+
+func stringOrList(data json.RawMessage, sep string) []string {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		return list
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil && s != "" {
+		return strings.Split(strings.Trim(s, sep), sep)
+	}
+
+	return nil
+}
+
+type Body struct {
+	Mode       string         `json:"mode"`
+	Raw        string         `json:"raw,omitempty"`
+	URLEncoded []KeyValue     `json:"urlencoded,omitempty"`
+	FormData   []KeyValue     `json:"formdata,omitempty"`
+	GraphQL    *GraphQLBody   `json:"graphql,omitempty"`
+	Options    map[string]any `json:"options,omitempty"`
+}
+
+type GraphQLBody struct {
+	Query     string `json:"query"`
+	Variables string `json:"variables,omitempty"`
+}
+
+// Auth holds a Postman auth block. Parameters are stored per auth type as
+// a list of key/value pairs (v2.1) or as an object (v2.0).
+type Auth struct {
+	Type   string                     `json:"type"`
+	Params map[string]json.RawMessage `json:"-"`
+}
+
+func (a *Auth) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(raw["type"], &a.Type); err != nil {
+		return fmt.Errorf("invalid auth type: %w", err)
+	}
+
+	delete(raw, "type")
+	a.Params = raw
+
+	return nil
+}
+
+func (a *Auth) param(key string) string {
+	data := a.Params[a.Type]
+
+	var list []KeyValue
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, kv := range list {
+			if kv.Key == key {
+				return kv.Value
+			}
+		}
+
+		return ""
+	}
+
+	var obj map[string]string
+	if err := json.Unmarshal(data, &obj); err == nil {
+		return obj[key]
+	}
+
+	return ""
+}
+
+type Environment struct {
+	Name   string     `json:"name"`
+	Values []KeyValue `json:"values"`
+}
+
+func DecodeCollection(r io.Reader) (*Collection, error) {
+	var c Collection
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, fmt.Errorf("failed to decode Postman collection: %w", err)
+	}
+
+	return &c, nil
+}
+
+func DecodeEnvironment(r io.Reader) (*Environment, error) {
+	var env Environment
+	if err := json.NewDecoder(r).Decode(&env); err != nil {
+		return nil, fmt.Errorf("failed to decode Postman environment: %w", err)
+	}
+
+	return &env, nil
+}
+
+// Variables merges collection variables, the environment and overrides, in
+// increasing order of precedence.
+func (c *Collection) Variables(env *Environment, overrides map[string]string) map[string]string {
+	vars := make(map[string]string)
+	for _, kv := range c.Variable {
+		if kv.active() {
+			vars[kv.Key] = kv.Value
+		}
+	}
+
+	if env != nil {
+		for _, kv := range env.Values {
+			if kv.active() {
+				vars[kv.Key] = kv.Value
+			}
+		}
+	}
+
+	for k, v := range overrides {
+		vars[k] = v
+	}
+
+	return vars
+}
+
+// LogEntries flattens the collection folders into replayable entries, in
+// collection order.
+func (c *Collection) LogEntries(vars map[string]string) ([]models.LogEntry, error) {
+	var entries []models.LogEntry
+	if err := collectEntries(c.Item, c.Auth, vars, "", &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func collectEntries(items []Item, auth *Auth, vars map[string]string, folder string, entries *[]models.LogEntry) error {
+	for _, item := range items {
+		name := item.Name
+		if folder != "" {
+			name = folder + "/" + item.Name
+		}
+
+		itemAuth := auth
+		if item.Auth != nil && item.Auth.Type != "inherit" {
+			itemAuth = item.Auth
+		}
+
+		if item.Request == nil {
+			if err := collectEntries(item.Item, itemAuth, vars, name, entries); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if item.Request.Auth != nil && item.Request.Auth.Type != "inherit" {
+			itemAuth = item.Request.Auth
+		}
+
+		entry, err := item.Request.logEntry(itemAuth, vars)
+		if err != nil {
+			return fmt.Errorf("request %q: %w", name, err)
+		}
+
+		*entries = append(*entries, entry)
+	}
+
+	return nil
+}
+
+func (r *Request) logEntry(auth *Auth, vars map[string]string) (models.LogEntry, error) {
+	rawURL := Expand(r.URL.raw(), vars)
+	for _, v := range r.URL.Variable {
+		rawURL = strings.ReplaceAll(rawURL, "/:"+v.Key, "/"+url.PathEscape(Expand(v.Value, vars)))
+	}
+
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return models.LogEntry{}, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+
+	if m := pathVariableRegex.FindString(u.Path); m != "" {
+		return models.LogEntry{}, fmt.Errorf("path variable %s has no value", m[1:])
+	}
+
+	headers := make(map[string][]string)
+	for _, h := range r.Header {
+		if h.active() && h.Key != "" {
+			key := textproto.CanonicalMIMEHeaderKey(Expand(h.Key, vars))
+			headers[key] = append(headers[key], Expand(h.Value, vars))
+		}
+	}
+
+	if _, ok := headers["Host"]; !ok && u.Host != "" {
+		headers["Host"] = []string{u.Host}
+	}
+
+	body, contentType, err := r.Body.encode(vars)
+	if err != nil {
+		return models.LogEntry{}, err
+	}
+
+	if _, ok := headers["Content-Type"]; !ok && contentType != "" {
+		headers["Content-Type"] = []string{contentType}
+	}
+
+	if err := applyAuth(auth, vars, headers, u); err != nil {
+		return models.LogEntry{}, err
+	}
+
+	method := strings.ToUpper(r.Method)
+	if method == "" {
+		method = "GET"
+	}
+
+	entry := models.LogEntry{
+		BodyEncoding: models.BodyEncodingBase64,
+		Method:       method,
+		Path:         requestPath(u),
+		Headers:      headers,
+	}
+
+	if body != nil {
+		entry.Body = base64.StdEncoding.EncodeToString(body)
+	}
+
+	return entry, nil
+}
+
+func (u URL) raw() string {
+	if u.Raw != "" || len(u.Host) == 0 {
+		return u.Raw
+	}
+
+	var sb strings.Builder
+	if u.Protocol != "" {
+		sb.WriteString(u.Protocol + "://")
+	}
+
+	sb.WriteString(strings.Join(u.Host, "."))
+	if u.Port != "" {
+		sb.WriteString(":" + u.Port)
+	}
+
+	if len(u.Path) > 0 {
+		sb.WriteString("/" + strings.Join(u.Path, "/"))
+	}
+
+	var query []string
+	for _, q := range u.Query {
+		if q.active() {
+			query = append(query, q.Key+"="+q.Value)
+		}
+	}
+
+	if len(query) > 0 {
+		sb.WriteString("?" + strings.Join(query, "&"))
+	}
+
+	return sb.String()
+}
+
+// encode returns the request body and the content type Postman would send
+// with it.
+func (b *Body) encode(vars map[string]string) ([]byte, string, error) {
+	if b == nil {
+		return nil, "", nil
+	}
+
+	switch b.Mode {
+	case "raw":
+		if b.Raw == "" {
+			return nil, "", nil
+		}
+
+		return []byte(Expand(b.Raw, vars)), b.rawContentType(), nil
+	case "urlencoded":
+		form := url.Values{}
+		for _, kv := range b.URLEncoded {
+			if kv.active() {
+				form.Add(Expand(kv.Key, vars), Expand(kv.Value, vars))
+			}
+		}
+
+		return []byte(form.Encode()), "application/x-www-form-urlencoded", nil
+	case "formdata":
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		for _, kv := range b.FormData {
+			if !kv.active() {
+				continue
+			}
+
+			if kv.Type == "file" {
+				return nil, "", fmt.Errorf("file form field %q is not supported", kv.Key)
+			}
+
+			if err := writer.WriteField(Expand(kv.Key, vars), Expand(kv.Value, vars)); err != nil {
+				return nil, "", err
+			}
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, "", err
+		}
+
+		return buf.Bytes(), writer.FormDataContentType(), nil
+	case "graphql":
+		if b.GraphQL == nil {
+			return nil, "", nil
+		}
+
+		payload := map[string]any{"query": Expand(b.GraphQL.Query, vars)}
+		if variables := strings.TrimSpace(Expand(b.GraphQL.Variables, vars)); variables != "" {
+			payload["variables"] = json.RawMessage(variables)
+		}
+
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid GraphQL variables: %w", err)
+		}
+
+		return data, "application/json", nil
+	case "", "none":
+		return nil, "", nil
+	default:
+		return nil, "", fmt.Errorf("body mode %q is not supported", b.Mode)
+	}
+}
+
+func (b *Body) rawContentType() string {
+	raw, _ := b.Options["raw"].(map[string]any)
+	switch raw["language"] {
+	case "json":
+		return "application/json"
+	case "xml":
+		return "application/xml"
+	case "html":
+		return "text/html"
+	case "javascript":
+		return "application/javascript"
+	default:
+		return "text/plain"
+	}
+}
+
+func applyAuth(auth *Auth, vars map[string]string, headers map[string][]string, u *url.URL) error {
+	if auth == nil {
+		return nil
+	}
+
+	param := func(key string) string {
+		return Expand(auth.param(key), vars)
+	}
+
+	switch auth.Type {
+	case "noauth", "inherit":
+	case "bearer":
+		headers["Authorization"] = []string{"Bearer " + param("token")}
+	case "basic":
+		creds := param("username") + ":" + param("password")
+		headers["Authorization"] = []string{"Basic " + base64.StdEncoding.EncodeToString([]byte(creds))}
+	case "apikey":
+		key, value := param("key"), param("value")
+		if param("in") == "query" {
+			q := u.Query()
+			q.Set(key, value)
+			u.RawQuery = q.Encode()
+		} else {
+			headers[textproto.CanonicalMIMEHeaderKey(key)] = []string{value}
+		}
+	default:
+		return fmt.Errorf("auth type %q is not supported", auth.Type)
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package importer
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+const postmanCollection = `{
+  "info": {"name": "Shop", "schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"},
+  "auth": {"type": "bearer", "bearer": [{"key": "token", "value": "{{token}}", "type": "string"}]},
+  "variable": [
+    {"key": "baseUrl", "value": "https://{{host}}/api"},
+    {"key": "host", "value": "shop.example.com"},
+    {"key": "token", "value": "collection-token"}
+  ],
+  "item": [
+    {
+      "name": "Orders",
+      "item": [
+        {
+          "name": "Get order",
+          "request": {
+            "method": "GET",
+            "header": [
+              {"key": "Accept", "value": "application/json"},
+              {"key": "X-Debug", "value": "1", "disabled": true}
+            ],
+            "url": {
+              "raw": "{{baseUrl}}/orders/:id?expand=items",
+              "host": ["{{baseUrl}}"],
+              "path": ["orders", ":id"],
+              "query": [{"key": "expand", "value": "items"}],
+              "variable": [{"key": "id", "value": "42"}]
+            }
+          }
+        },
+        {
+          "name": "Create order",
+          "request": {
+            "method": "POST",
+            "auth": {"type": "basic", "basic": [{"key": "username", "value": "admin"}, {"key": "password", "value": "{{password}}"}]},
+            "url": "{{baseUrl}}/orders",
+            "body": {"mode": "raw", "raw": "{\"sku\":\"{{sku}}\"}", "options": {"raw": {"language": "json"}}}
+          }
+        }
+      ]
+    },
+    {
+      "name": "Login",
+      "request": {
+        "method": "POST",
+        "auth": {"type": "noauth"},
+        "url": {"host": ["{{host}}"], "path": ["login"], "protocol": "https"},
+        "body": {"mode": "urlencoded", "urlencoded": [{"key": "user", "value": "bob"}, {"key": "skip", "value": "x", "disabled": true}]}
+      }
+    },
+    {
+      "name": "Search",
+      "request": {
+        "method": "POST",
+        "auth": {"type": "apikey", "apikey": [{"key": "key", "value": "api_key"}, {"key": "value", "value": "k1"}, {"key": "in", "value": "query"}]},
+        "url": "{{baseUrl}}/graphql",
+        "body": {"mode": "graphql", "graphql": {"query": "query { products { id } }", "variables": "{\"first\": 10}"}}
+      }
+    }
+  ]
+}`
+
+const postmanEnvironment = `{"name": "staging", "values": [
+  {"key": "host", "value": "staging.example.com", "enabled": true},
+  {"key": "sku", "value": "A-1", "enabled": true},
+  {"key": "password", "value": "unused", "enabled": false}
+]}`
+
+func TestCollection_LogEntries(t *testing.T) {
+	collection, err := DecodeCollection(strings.NewReader(postmanCollection))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env, err := DecodeEnvironment(strings.NewReader(postmanEnvironment))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, err := collection.LogEntries(collection.Variables(env, map[string]string{"password": "s3cret"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	}
+
+	t.Run("folder request with path variable and inherited auth", func(t *testing.T) {
+		entry := entries[0]
+		if entry.Method != "GET" || entry.Path != "/api/orders/42?expand=items" {
+			t.Errorf("unexpected request: %s %s", entry.Method, entry.Path)
+		}
+
+		if entry.Headers["Host"][0] != "staging.example.com" {
+			t.Errorf("expected environment to override collection variable, got %v", entry.Headers["Host"])
+		}
+
+		if entry.Headers["Authorization"][0] != "Bearer collection-token" {
+			t.Errorf("unexpected auth: %v", entry.Headers["Authorization"])
+		}
+
+		if _, ok := entry.Headers["X-Debug"]; ok {
+			t.Error("expected disabled header to be dropped")
+		}
+	})
+
+	t.Run("request auth and raw json body", func(t *testing.T) {
+		entry := entries[1]
+		want := "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:s3cret"))
+		if entry.Headers["Authorization"][0] != want {
+			t.Errorf("unexpected auth: %v", entry.Headers["Authorization"])
+		}
+
+		if string(models.DecodeBody(entry.Body)) != `{"sku":"A-1"}` || entry.Headers["Content-Type"][0] != "application/json" {
+			t.Errorf("unexpected body: %s %v", models.DecodeBody(entry.Body), entry.Headers)
+		}
+	})
+
+	t.Run("noauth and urlencoded body", func(t *testing.T) {
+		entry := entries[2]
+		if _, ok := entry.Headers["Authorization"]; ok {
+			t.Error("expected noauth to drop the collection auth")
+		}
+
+		if entry.Path != "/login" || string(models.DecodeBody(entry.Body)) != "user=bob" {
+			t.Errorf("unexpected entry: %s %s", entry.Path, models.DecodeBody(entry.Body))
+		}
+	})
+
+	t.Run("apikey in query and graphql body", func(t *testing.T) {
+		entry := entries[3]
+		if entry.Path != "/api/graphql?api_key=k1" {
+			t.Errorf("unexpected path: %s", entry.Path)
+		}
+
+		if string(models.DecodeBody(entry.Body)) != `{"query":"query { products { id } }","variables":{"first":10}}` {
+			t.Errorf("unexpected body: %s", models.DecodeBody(entry.Body))
+		}
+	})
+}
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"a": "{{b}}", "b": "value", "loop": "{{loop}}"}
+
+	if got := Expand("{{ a }}-{{missing}}", vars); got != "value-{{missing}}" {
+		t.Errorf("unexpected expansion: %s", got)
+	}
+
+	if got := Expand("{{loop}}", vars); got != "{{loop}}" {
+		t.Errorf("expected self reference to stop, got %s", got)
+	}
+
+	if got := Expand("{{$guid}}", nil); len(got) != 36 {
+		t.Errorf("expected a uuid, got %s", got)
+	}
+}
@@ -0,0 +1,63 @@
+package importer
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxExpandDepth bounds nested variable references such as a baseUrl that
+// itself refers to {{host}}.
+const maxExpandDepth = 10
+
+var placeholderRegex = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// Expand replaces Postman style {{name}} placeholders. Unknown variables are
+// left untouched so they are easy to spot in the imported entries.
+func Expand(s string, vars map[string]string) string {
+	for range maxExpandDepth {
+		if !strings.Contains(s, "{{") {
+			return s
+		}
+
+		expanded := placeholderRegex.ReplaceAllStringFunc(s, func(match string) string {
+			name := placeholderRegex.FindStringSubmatch(match)[1]
+			if v, ok := vars[name]; ok {
+				return v
+			}
+
+			if v, ok := dynamicVariable(name); ok {
+				return v
+			}
+
+			return match
+		})
+
+		if expanded == s {
+			return s
+		}
+
+		s = expanded
+	}
+
+	return s
+}
+
+func dynamicVariable(name string) (string, bool) {
+	switch name {
+	case "$guid", "$randomUUID":
+		return uuid.NewString(), true
+	case "$timestamp":
+		return fmt.Sprint(time.Now().Unix()), true
+	case "$isoTimestamp":
+		return time.Now().UTC().Format(time.RFC3339), true
+	case "$randomInt":
+		return fmt.Sprint(rand.IntN(1001)), true // #nosec G404 -- not used for security
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,121 @@
+package input
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// ALB access log fields, see
+// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-access-logs.html
+const (
+	albFieldType = iota
+	albFieldTime
+	albFieldELB
+	albFieldClient
+	albFieldTarget
+	albFieldRequestProcessingTime
+	albFieldTargetProcessingTime
+	albFieldResponseProcessingTime
+	albFieldELBStatusCode
+	albFieldTargetStatusCode
+	albFieldReceivedBytes
+	albFieldSentBytes
+	albFieldRequest
+	albFieldUserAgent
+	albFieldSSLCipher
+	albFieldSSLProtocol
+	albFieldTargetGroupARN
+	albFieldTraceID
+
+	albMinFields = albFieldUserAgent + 1
+)
+
+var albTypes = map[string]bool{
+	"http": true, "https": true, "h2": true, "grpcs": true, "ws": true, "wss": true,
+}
+
+type ALBParser struct{}
+
+func NewALBParser() *ALBParser {
+	return &ALBParser{}
+}
+
+func (p *ALBParser) parseLine(line string) (*models.LogEntry, error) {
+	fields := splitQuotedFields(line)
+	if len(fields) < albMinFields || !albTypes[fields[albFieldType]] {
+		return nil, fmt.Errorf("line does not match ALB log format")
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, fields[albFieldTime])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ALB timestamp %q: %w", fields[albFieldTime], err)
+	}
+
+	parts := strings.Fields(fields[albFieldRequest])
+	if len(parts) < 2 || parts[0] == "-" {
+		return nil, fmt.Errorf("malformed ALB request %q", fields[albFieldRequest])
+	}
+
+	u, err := url.Parse(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ALB request URL: %w", err)
+	}
+
+	headers := make(map[string][]string)
+	if host := hostWithoutDefaultPort(u); host != "" {
+		headers["Host"] = []string{host}
+	}
+
+	if ua := fields[albFieldUserAgent]; ua != "-" && ua != "" {
+		headers["User-Agent"] = []string{ua}
+	}
+
+	if len(fields) > albFieldTraceID && fields[albFieldTraceID] != "-" {
+		headers["X-Amzn-Trace-Id"] = []string{fields[albFieldTraceID]}
+	}
+
+	status, _ := strconv.Atoi(fields[albFieldELBStatusCode])
+
+	return &models.LogEntry{
+		Method:    strings.ToUpper(parts[0]),
+		Path:      u.RequestURI(),
+		Headers:   headers,
+		Status:    status,
+		Timestamp: ts,
+		LatencyMs: sumSeconds(
+			fields[albFieldRequestProcessingTime],
+			fields[albFieldTargetProcessingTime],
+			fields[albFieldResponseProcessingTime],
+		),
+	}, nil
+}
+
+// sumSeconds adds up processing times reported in seconds, skipping the -1
+// that load balancers log for phases that did not happen.
+func sumSeconds(values ...string) int64 {
+	var total float64
+	for _, v := range values {
+		secs, err := strconv.ParseFloat(v, 64)
+		if err != nil || secs < 0 {
+			continue
+		}
+
+		total += secs
+	}
+
+	return int64(total*1000 + 0.5)
+}
+
+func hostWithoutDefaultPort(u *url.URL) string {
+	host := u.Host
+	if (u.Scheme == "http" && strings.HasSuffix(host, ":80")) || (u.Scheme == "https" && strings.HasSuffix(host, ":443")) {
+		host = u.Hostname()
+	}
+
+	return host
+}
@@ -0,0 +1,257 @@
+package input
+
+import (
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+const (
+	apacheCombinedFormat = `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`
+	apacheCommonFormat   = `%h %l %u %t "%r" %>s %b`
+)
+
+var apacheDirectiveRegex = regexp.MustCompile(`%[<>]?(?:\{([^}]*)\})?([a-zA-Z%])`)
+
+type apacheField struct {
+	param     string
+	directive string
+}
+
+type ApacheParser struct {
+	formats []*apacheFormat
+	err     error
+}
+
+type apacheFormat struct {
+	fields []apacheField
+	regex  *regexp.Regexp
+}
+
+// NewApacheParser accepts "combined", "common" or an Apache LogFormat string
+// such as `%h %l %u %t "%r" %>s %b %D`.
+func NewApacheParser(format string) *ApacheParser {
+	if format == "" {
+		format = "combined"
+	}
+
+	parser := &ApacheParser{}
+
+	var definitions []string
+	switch format {
+	case "combined":
+		definitions = []string{apacheCombinedFormat + " %D", apacheCombinedFormat, apacheCommonFormat}
+	case "common":
+		definitions = []string{apacheCommonFormat}
+	default:
+		definitions = []string{format}
+	}
+
+	for _, def := range definitions {
+		compiled, err := compileApacheFormat(def)
+		if err != nil {
+			parser.err = err
+			return parser
+		}
+
+		parser.formats = append(parser.formats, compiled)
+	}
+
+	return parser
+}
+
+func compileApacheFormat(definition string) (*apacheFormat, error) {
+	locs := apacheDirectiveRegex.FindAllStringSubmatchIndex(definition, -1)
+
+	var sb strings.Builder
+	var fields []apacheField
+	hasRequest := false
+	sb.WriteString("^")
+
+	last := 0
+	for i, loc := range locs {
+		sb.WriteString(literalPattern(definition[last:loc[0]]))
+
+		field := apacheField{directive: definition[loc[4]:loc[5]]}
+		if loc[2] >= 0 {
+			field.param = definition[loc[2]:loc[3]]
+		}
+
+		switch field.directive {
+		case "%":
+			sb.WriteString("%")
+			last = loc[1]
+			continue
+		case "r", "U":
+			hasRequest = true
+		}
+
+		fields = append(fields, field)
+
+		switch {
+		case field.directive == "t" && field.param == "":
+			sb.WriteString(`(\[[^\]]*\])`)
+		case field.directive == "U":
+			sb.WriteString(`([^?\s"]*)`)
+		case field.directive == "q":
+			sb.WriteString(`((?:\?[^\s"]*)?)`)
+		case i+1 < len(locs):
+			sb.WriteString("(" + variablePattern(definition[loc[1]:locs[i+1][0]], false) + ")")
+		default:
+			sb.WriteString("(" + variablePattern(definition[loc[1]:], true) + ")")
+		}
+
+		last = loc[1]
+	}
+
+	sb.WriteString(literalPattern(definition[last:]))
+	sb.WriteString("$")
+
+	if !hasRequest {
+		return nil, fmt.Errorf("log format must contain %%r or %%U")
+	}
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile log format: %w", err)
+	}
+
+	return &apacheFormat{fields: fields, regex: re}, nil
+}
+
+func (p *ApacheParser) parseLine(line string) (*models.LogEntry, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	for _, format := range p.formats {
+		if entry, err := format.parse(line); err == nil {
+			return entry, nil
+		}
+	}
+
+	return nil, fmt.Errorf("line does not match apache log format")
+}
+
+func (f *apacheFormat) parse(line string) (*models.LogEntry, error) {
+	matches := f.regex.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, fmt.Errorf("line does not match apache log format")
+	}
+
+	entry := &models.LogEntry{
+		Headers: make(map[string][]string),
+	}
+
+	var path, query string
+	var cookies []string
+
+	for i, field := range f.fields {
+		value := matches[i+1]
+		if value == "-" || value == "" {
+			continue
+		}
+
+		switch field.directive {
+		case "r":
+			parts := strings.Fields(value)
+			if len(parts) < 2 {
+				return nil, fmt.Errorf("malformed request line: %q", value)
+			}
+
+			entry.Method = parts[0]
+			path = parts[1]
+		case "m":
+			entry.Method = value
+		case "U":
+			if path == "" {
+				path = value
+			}
+		case "q":
+			query = strings.TrimPrefix(value, "?")
+		case "s":
+			status, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid status %q", value)
+			}
+
+			entry.Status = status
+		case "t":
+			ts, err := parseApacheTime(field.param, value)
+			if err != nil {
+				return nil, err
+			}
+
+			entry.Timestamp = ts
+		case "D":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+				entry.LatencyMs = us / 1000
+			}
+		case "T":
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				switch field.param {
+				case "ms":
+					entry.LatencyMs = n
+				case "us":
+					entry.LatencyMs = n / 1000
+				default:
+					entry.LatencyMs = n * 1000
+				}
+			}
+		case "v", "V":
+			entry.Headers["Host"] = []string{value}
+		case "i":
+			key := textproto.CanonicalMIMEHeaderKey(field.param)
+			entry.Headers[key] = append(entry.Headers[key], unescapeNginxString(value))
+		case "C":
+			cookies = append(cookies, field.param+"="+value)
+		}
+	}
+
+	if entry.Method == "" || path == "" {
+		return nil, fmt.Errorf("line has no request method or URI")
+	}
+
+	if query != "" && !strings.Contains(path, "?") {
+		path += "?" + query
+	}
+
+	if len(cookies) > 0 {
+		if _, ok := entry.Headers["Cookie"]; !ok {
+			entry.Headers["Cookie"] = []string{strings.Join(cookies, "; ")}
+		}
+	}
+
+	entry.Method = strings.ToUpper(entry.Method)
+	entry.Path = path
+
+	return entry, nil
+}
+
+func parseApacheTime(param, value string) (time.Time, error) {
+	switch param {
+	case "":
+		return time.Parse("["+nginxTimeLocalLayout+"]", value)
+	case "sec":
+		secs, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+		}
+
+		return time.Unix(secs, 0).UTC(), nil
+	case "msec":
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+		}
+
+		return time.UnixMilli(ms).UTC(), nil
+	default:
+		return time.Parse(time.RFC3339, value)
+	}
+}
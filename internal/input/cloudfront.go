@@ -0,0 +1,122 @@
+package input
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// Standard CloudFront access log fields, used until a #Fields header says otherwise
+var defaultCloudFrontFields = []string{
+	"date", "time", "x-edge-location", "sc-bytes", "c-ip", "cs-method", "cs(Host)",
+	"cs-uri-stem", "sc-status", "cs(Referer)", "cs(User-Agent)", "cs-uri-query",
+	"cs(Cookie)", "x-edge-result-type", "x-edge-request-id", "x-host-header",
+	"cs-protocol", "cs-bytes", "time-taken", "x-forwarded-for", "ssl-protocol",
+	"ssl-cipher", "x-edge-response-result-type", "cs-protocol-version", "fle-status",
+	"fle-encrypted-fields", "c-port", "time-to-first-byte", "x-edge-detailed-result-type",
+	"sc-content-type", "sc-content-len", "sc-range-start", "sc-range-end",
+}
+
+type CloudFrontParser struct {
+	fields map[string]int
+}
+
+func NewCloudFrontParser() *CloudFrontParser {
+	p := &CloudFrontParser{}
+	p.setFields(defaultCloudFrontFields)
+
+	return p
+}
+
+func (p *CloudFrontParser) setFields(names []string) {
+	p.fields = make(map[string]int, len(names))
+	for i, name := range names {
+		p.fields[name] = i
+	}
+}
+
+func (p *CloudFrontParser) parseLine(line string) (*models.LogEntry, error) {
+	if after, ok := strings.CutPrefix(line, "#Fields:"); ok {
+		p.setFields(strings.Fields(after))
+		return nil, errSkipLine
+	}
+
+	if strings.HasPrefix(line, "#") {
+		return nil, errSkipLine
+	}
+
+	values := strings.Split(line, "\t")
+	get := func(name string) string {
+		idx, ok := p.fields[name]
+		if !ok || idx >= len(values) || values[idx] == "-" {
+			return ""
+		}
+
+		return values[idx]
+	}
+
+	method := get("cs-method")
+	stem := get("cs-uri-stem")
+	if len(values) < 10 || method == "" || !strings.HasPrefix(stem, "/") {
+		return nil, fmt.Errorf("line does not match CloudFront log format")
+	}
+
+	ts, err := time.Parse("2006-01-02 15:04:05", get("date")+" "+get("time"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CloudFront timestamp: %w", err)
+	}
+
+	path := stem
+	if query := get("cs-uri-query"); query != "" {
+		path += "?" + query
+	}
+
+	headers := make(map[string][]string)
+	host := get("x-host-header")
+	if host == "" {
+		host = get("cs(Host)")
+	}
+
+	if host != "" {
+		headers["Host"] = []string{host}
+	}
+
+	for field, header := range map[string]string{
+		"cs(User-Agent)": "User-Agent",
+		"cs(Referer)":    "Referer",
+		"cs(Cookie)":     "Cookie",
+	} {
+		if v := get(field); v != "" {
+			headers[header] = []string{unescapeCloudFront(v)}
+		}
+	}
+
+	status, _ := strconv.Atoi(get("sc-status"))
+
+	return &models.LogEntry{
+		Method:    strings.ToUpper(method),
+		Path:      path,
+		Headers:   headers,
+		Status:    status,
+		Timestamp: ts,
+		LatencyMs: sumSeconds(get("time-taken")),
+	}, nil
+}
+
+// CloudFront URL-encodes header values, and some characters twice.
+func unescapeCloudFront(v string) string {
+	for range 2 {
+		decoded, err := url.PathUnescape(v)
+		if err != nil || decoded == v {
+			break
+		}
+
+		v = decoded
+	}
+
+	return v
+}
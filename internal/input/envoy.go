@@ -0,0 +1,124 @@
+package input
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// Envoy JSON access logs have user-defined keys; these are the names used by
+// the Istio default format and common Envoy setups.
+var (
+	envoyMethodKeys    = []string{"method", "request_method"}
+	envoyPathKeys      = []string{"x_envoy_original_path", "path", "request_path", "uri"}
+	envoyStatusKeys    = []string{"response_code", "status", "status_code"}
+	envoyDurationKeys  = []string{"duration", "duration_ms", "request_duration"}
+	envoyStartTimeKeys = []string{"start_time", "timestamp"}
+
+	envoyHeaderKeys = map[string]string{
+		"authority":       "Host",
+		"user_agent":      "User-Agent",
+		"request_id":      "X-Request-Id",
+		"x_forwarded_for": "X-Forwarded-For",
+		"referer":         "Referer",
+		"content_type":    "Content-Type",
+		"traceparent":     "Traceparent",
+	}
+)
+
+type EnvoyParser struct{}
+
+func NewEnvoyParser() *EnvoyParser {
+	return &EnvoyParser{}
+}
+
+func (p *EnvoyParser) parseLine(line string) (*models.LogEntry, error) {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return nil, fmt.Errorf("line is not an Envoy JSON access log: %w", err)
+	}
+
+	fields := make(map[string]any, len(raw))
+	for k, v := range raw {
+		key := strings.ToLower(strings.TrimPrefix(k, ":"))
+		fields[strings.ReplaceAll(key, "-", "_")] = v
+	}
+
+	method := envoyString(fields, envoyMethodKeys)
+	path := envoyString(fields, envoyPathKeys)
+	if method == "" || !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("Envoy access log has no method or path")
+	}
+
+	headers := make(map[string][]string)
+	for key, header := range envoyHeaderKeys {
+		if v := envoyString(fields, []string{key}); v != "" {
+			headers[header] = []string{v}
+		}
+	}
+
+	entry := &models.LogEntry{
+		BodyEncoding: models.BodyEncodingBase64,
+		Method:       strings.ToUpper(method),
+		Path:         path,
+		Headers:      headers,
+	}
+
+	if status, ok := envoyNumber(fields, envoyStatusKeys); ok {
+		entry.Status = int(status)
+	}
+
+	if duration, ok := envoyNumber(fields, envoyDurationKeys); ok {
+		entry.LatencyMs = int64(duration)
+	}
+
+	if start := envoyString(fields, envoyStartTimeKeys); start != "" {
+		ts, err := time.Parse(time.RFC3339Nano, start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Envoy start_time %q: %w", start, err)
+		}
+
+		entry.Timestamp = ts
+	}
+
+	if body := envoyString(fields, []string{"request_body"}); body != "" {
+		entry.Body = base64.StdEncoding.EncodeToString([]byte(body))
+	}
+
+	return entry, nil
+}
+
+func envoyString(fields map[string]any, keys []string) string {
+	for _, key := range keys {
+		switch v := fields[key].(type) {
+		case string:
+			if v != "" && v != "-" {
+				return v
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+
+	return ""
+}
+
+func envoyNumber(fields map[string]any, keys []string) (float64, bool) {
+	for _, key := range keys {
+		switch v := fields[key].(type) {
+		case float64:
+			return v, true
+		case string:
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				return n, true
+			}
+		}
+	}
+
+	return 0, false
+}
@@ -1,34 +1,62 @@
 package input
 
 import (
+	"fmt"
+	"os"
 	"strings"
 
 	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/filter"
 	"github.com/kx0101/replayer/internal/models"
 )
 
 func Apply(entries []models.LogEntry, args *cli.CliArgs) []models.LogEntry {
-	if args.FilterMethod == "" && args.FilterPath == "" {
+	match, err := newMatcher(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid filter: %v\n", err)
+		return nil
+	}
+
+	if match == nil {
 		return entries
 	}
 
 	filtered := make([]models.LogEntry, 0)
 
 	for _, entry := range entries {
+		if match(&entry) {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	return filtered
+}
+
+// newMatcher combines --filter-method, --filter-path and the --filter and
+// --exclude expressions. It returns nil when no filter is set.
+func newMatcher(args *cli.CliArgs) (func(*models.LogEntry) bool, error) {
+	set, err := filter.NewSet(args.Filters, args.Excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.FilterMethod == "" && args.FilterPath == "" && set == nil {
+		return nil, nil
+	}
+
+	return func(entry *models.LogEntry) bool {
 		if args.FilterMethod != "" {
 			if !strings.EqualFold(entry.Method, args.FilterMethod) {
-				continue
+				return false
 			}
 		}
 
 		if args.FilterPath != "" {
 			if !strings.Contains(entry.Path, args.FilterPath) {
-				continue
+				return false
 			}
 		}
 
-		filtered = append(filtered, entry)
-	}
-
-	return filtered
+		return set.Match(entry)
+	}, nil
 }
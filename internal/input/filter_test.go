@@ -327,4 +327,29 @@ func TestApply(t *testing.T) {
 			t.Errorf("unexpected path: %s", filtered[0].Path)
 		}
 	})
+
+	t.Run("filter and exclude expressions", func(t *testing.T) {
+		entries := []models.LogEntry{
+			{Method: "POST", Path: "/api/v2/orders", Status: 201},
+			{Method: "PUT", Path: "/api/v2/orders/1", Status: 500, Headers: map[string][]string{"X-Internal": {"1"}}},
+			{Method: "PUT", Path: "/api/v2/orders/2", Status: 404},
+			{Method: "GET", Path: "/api/v2/orders", Status: 200},
+			{Method: "POST", Path: "/api/v1/orders", Status: 201},
+		}
+
+		args := &cli.CliArgs{
+			FilterPath: "orders",
+			Filters:    []string{`method in (POST,PUT) && path ~ "^/api/v2" && !header("X-Internal")`},
+			Excludes:   []string{`status == 4xx`},
+		}
+
+		filtered := Apply(entries, args)
+		if len(filtered) != 1 || filtered[0].Status != 201 || filtered[0].Path != "/api/v2/orders" {
+			t.Errorf("unexpected entries: %+v", filtered)
+		}
+
+		if filtered := Apply(entries, &cli.CliArgs{Filters: []string{"method =="}}); len(filtered) != 0 {
+			t.Errorf("expected invalid filter to drop everything, got %d", len(filtered))
+		}
+	})
 }
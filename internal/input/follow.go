@@ -0,0 +1,325 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// followPollInterval is how often a followed file is checked for new data.
+var followPollInterval = 250 * time.Millisecond
+
+// Follow tails --input-file like tail -F and sends every new entry that
+// passes the filters to out. Files are followed from their current end and
+// reopened from the start when truncated or rotated; stdin is read until
+// EOF. Follow closes out when ctx is done or the limit is reached.
+func Follow(ctx context.Context, args *cli.CliArgs, out chan<- models.LogEntry) error {
+	defer close(out)
+
+	match, err := newMatcher(args)
+	if err != nil {
+		return err
+	}
+
+	f := &follower{args: args, out: out, match: match}
+	if args.JSONMapping != "" {
+		mapping, err := LoadJSONMapping(args.JSONMapping)
+		if err != nil {
+			return err
+		}
+
+		f.parser = jsonlParser{mapping: mapping}
+	} else if args.InputFormat != "" && args.InputFormat != FormatAuto {
+		parser, err := f.newParser(args.InputFormat)
+		if err != nil {
+			return err
+		}
+
+		f.parser = parser
+	}
+
+	if args.InputFile == "-" {
+		return f.followReader(ctx, os.Stdin)
+	}
+
+	return f.followFile(ctx, args.InputFile)
+}
+
+type follower struct {
+	args    *cli.CliArgs
+	out     chan<- models.LogEntry
+	parser  lineParser
+	match   func(*models.LogEntry) bool
+	lineNum int
+	sent    int
+}
+
+func (f *follower) newParser(format string) (lineParser, error) {
+	switch format {
+	case FormatJSONL:
+		return jsonlParser{}, nil
+	case FormatHAR, FormatPCAP:
+		return nil, fmt.Errorf("--follow does not support %s input", format)
+	default:
+		return newLineParser(format, f.args)
+	}
+}
+
+func (f *follower) followReader(ctx context.Context, r io.Reader) error {
+	lines := make(chan string)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		errs <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-lines:
+			if !ok {
+				select {
+				case err := <-errs:
+					return err
+				default:
+					return nil
+				}
+			}
+
+			if done, err := f.handle(ctx, line); done || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (f *follower) followFile(ctx context.Context, path string) error {
+	file, info, err := f.openFollowed(path, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close file: %v\n", err)
+		}
+	}()
+
+	offset := info.Size()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to end of file: %w", err)
+	}
+
+	buf := make([]byte, 32*1024)
+	var pending []byte
+
+	for {
+		for {
+			n, err := file.Read(buf)
+			pending = append(pending, buf[:n]...)
+			offset += int64(n)
+
+			if errors.Is(err, io.EOF) || n == 0 {
+				break
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+		}
+
+		for {
+			idx := bytes.IndexByte(pending, '\n')
+			if idx < 0 {
+				break
+			}
+
+			line := string(pending[:idx])
+			pending = pending[idx+1:]
+
+			if done, err := f.handle(ctx, line); done || err != nil {
+				return err
+			}
+		}
+
+		current, err := os.Stat(path)
+		switch {
+		case err != nil:
+			// The file is being rotated; wait for it to reappear.
+		case !os.SameFile(info, current):
+			next, nextInfo, err := f.openFollowed(path, false)
+			if err != nil {
+				return err
+			}
+
+			if err := file.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to close file: %v\n", err)
+			}
+
+			file, info, offset, pending = next, nextInfo, 0, nil
+			continue
+		case current.Size() < offset:
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to seek to start of file: %w", err)
+			}
+
+			offset, pending = 0, nil
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(followPollInterval):
+		}
+	}
+}
+
+// openFollowed opens path and, on the first open, detects the format from
+// the lines already in the file.
+func (f *follower) openFollowed(path string, detect bool) (*os.File, os.FileInfo, error) {
+	file, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = fmt.Errorf("%s is not a regular file", path)
+	}
+
+	if err == nil {
+		err = f.sniff(file, detect)
+	}
+
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, err
+	}
+
+	return file, info, nil
+}
+
+func (f *follower) sniff(file *os.File, detect bool) error {
+	reader := bufio.NewReaderSize(file, sniffSize)
+	prefix, _ := reader.Peek(sniffSize)
+	if bytes.HasPrefix(prefix, gzipMagic) || bytes.HasPrefix(prefix, zstdMagic) {
+		return fmt.Errorf("--follow cannot tail a compressed file")
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind file: %w", err)
+	}
+
+	if !detect || f.parser != nil || len(prefix) == 0 {
+		return nil
+	}
+
+	parser, err := f.newParser(detectFormat(f.args, reader))
+	if err != nil {
+		return err
+	}
+
+	f.parser = parser
+	return nil
+}
+
+// handle parses one line and forwards the entry. It reports true once
+// following should stop.
+func (f *follower) handle(ctx context.Context, line string) (bool, error) {
+	line = strings.TrimRight(line, "\r")
+	f.lineNum++
+
+	if strings.TrimSpace(line) == "" {
+		return false, nil
+	}
+
+	if f.parser == nil {
+		if strings.HasPrefix(line, "#") {
+			return false, nil
+		}
+
+		parser, err := f.newParser(DetectFormat([]string{line}, f.args))
+		if err != nil {
+			return true, err
+		}
+
+		f.parser = parser
+	}
+
+	entry, err := f.parser.parseLine(line)
+	if errors.Is(err, errSkipLine) {
+		return false, nil
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Skipping line %d: %v\n", f.lineNum, err)
+		return false, nil
+	}
+
+	if f.match != nil && !f.match(entry) {
+		return false, nil
+	}
+
+	select {
+	case f.out <- *entry:
+	case <-ctx.Done():
+		return true, nil
+	}
+
+	f.sent++
+	return f.args.Limit > 0 && f.sent >= f.args.Limit, nil
+}
+
+// jsonlParser reads one JSON Lines entry, optionally through a mapping.
+type jsonlParser struct {
+	mapping *JSONMapping
+}
+
+func (p jsonlParser) parseLine(line string) (*models.LogEntry, error) {
+	if _, ok, err := models.ParseFileHeader([]byte(line)); ok {
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, errSkipLine
+	}
+
+	if p.mapping != nil {
+		entry, err := p.mapping.Apply([]byte(line))
+		if err != nil {
+			return nil, err
+		}
+
+		return &entry, nil
+	}
+
+	var entry models.LogEntry
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return nil, fmt.Errorf("invalid JSON object: %w", err)
+	}
+
+	return &entry, nil
+}
@@ -0,0 +1,142 @@
+package input
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/models"
+)
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600) // #nosec G304
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+}
+
+func nextEntry(t *testing.T, entries <-chan models.LogEntry) models.LogEntry {
+	t.Helper()
+
+	select {
+	case entry, ok := <-entries:
+		if !ok {
+			t.Fatal("entries closed early")
+		}
+
+		return entry
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for entry")
+	}
+
+	return models.LogEntry{}
+}
+
+func TestFollow(t *testing.T) {
+	followPollInterval = 10 * time.Millisecond
+
+	line := func(path string) string {
+		return `10.0.0.1 - - [10/Dec/2024:14:23:45 +0000] "GET ` + path + ` HTTP/1.1" 200 2 "-" "curl"` + "\n"
+	}
+
+	t.Run("tails new lines, truncation and rotation", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "access.log")
+		writeFile(t, path, []byte(line("/old")))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		entries := make(chan models.LogEntry)
+		errCh := make(chan error, 1)
+		args := &cli.CliArgs{InputFile: path, FilterMethod: "GET"}
+		go func() { errCh <- Follow(ctx, args, entries) }()
+
+		// Give Follow time to seek to the end before appending.
+		time.Sleep(50 * time.Millisecond)
+		appendFile(t, path, line("/new")+`10.0.0.1 - - [10/Dec/2024:14:23:45 +0000] "POST /skipped HTTP/1.1" 200 2 "-" "curl"`+"\n"+`10.0.0.1 - - [10/Dec/2024:14:23:45 +0000] "GET /par`)
+		if got := nextEntry(t, entries); got.Path != "/new" {
+			t.Fatalf("expected /new, got %s", got.Path)
+		}
+
+		appendFile(t, path, `tial HTTP/1.1" 200 2 "-" "curl"`+"\n")
+		if got := nextEntry(t, entries); got.Path != "/partial" {
+			t.Fatalf("expected /partial, got %s", got.Path)
+		}
+
+		writeFile(t, path, []byte(line("/truncated")))
+		if got := nextEntry(t, entries); got.Path != "/truncated" {
+			t.Fatalf("expected /truncated, got %s", got.Path)
+		}
+
+		if err := os.Rename(path, path+".1"); err != nil {
+			t.Fatalf("failed to rotate: %v", err)
+		}
+
+		writeFile(t, path, []byte(line("/rotated")))
+		if got := nextEntry(t, entries); got.Path != "/rotated" {
+			t.Fatalf("expected /rotated, got %s", got.Path)
+		}
+
+		cancel()
+		if err := <-errCh; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if _, ok := <-entries; ok {
+			t.Error("expected entries to be closed")
+		}
+	})
+
+	t.Run("detects format of an empty file and stops at the limit", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "captured.json")
+		writeFile(t, path, nil)
+
+		entries := make(chan models.LogEntry, 4)
+		errCh := make(chan error, 1)
+		args := &cli.CliArgs{InputFile: path, Limit: 1}
+		go func() { errCh <- Follow(context.Background(), args, entries) }()
+
+		time.Sleep(50 * time.Millisecond)
+		appendFile(t, path, `{"method":"PUT","path":"/items/1"}`+"\n"+`{"method":"PUT","path":"/items/2"}`+"\n")
+
+		if got := nextEntry(t, entries); got.Method != "PUT" || got.Path != "/items/1" {
+			t.Fatalf("unexpected entry %+v", got)
+		}
+
+		if err := <-errCh; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if _, ok := <-entries; ok {
+			t.Error("expected follow to stop at the limit")
+		}
+	})
+
+	t.Run("rejects compressed and HAR input", func(t *testing.T) {
+		dir := t.TempDir()
+		compressed := filepath.Join(dir, "access.log.gz")
+		writeFile(t, compressed, gzipData(t, line("/a")))
+		har := filepath.Join(dir, "session.har")
+		writeFile(t, har, []byte(`{"log":{"entries":[]}}`))
+
+		for _, path := range []string{compressed, har} {
+			err := Follow(context.Background(), &cli.CliArgs{InputFile: path}, make(chan models.LogEntry))
+			if err == nil {
+				t.Errorf("%s: expected error", path)
+			}
+		}
+	})
+}
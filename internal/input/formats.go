@@ -0,0 +1,241 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/pcap"
+)
+
+const (
+	FormatAuto       = "auto"
+	FormatJSONL      = "jsonl"
+	FormatHAR        = "har"
+	FormatNginx      = "nginx"
+	FormatApache     = "apache"
+	FormatALB        = "alb"
+	FormatCloudFront = "cloudfront"
+	FormatEnvoy      = "envoy"
+	FormatPCAP       = "pcap"
+
+	sniffSize       = 64 * 1024
+	sniffSampleSize = 20
+)
+
+var (
+	harPrefixRegex = regexp.MustCompile(`^\s*\{\s*"log"\s*:`)
+
+	// errSkipLine is returned by parsers for comment or header lines that
+	// carry no request.
+	errSkipLine = errors.New("skip line")
+)
+
+type lineParser interface {
+	parseLine(line string) (*models.LogEntry, error)
+}
+
+func newLineParser(format string, args *cli.CliArgs) (lineParser, error) {
+	switch format {
+	case FormatNginx:
+		parser := NewNginxParser(args.NginxFormat)
+		if parser.err != nil {
+			return nil, fmt.Errorf("invalid nginx log format: %w", parser.err)
+		}
+
+		return parser, nil
+	case FormatApache:
+		parser := NewApacheParser(args.ApacheFormat)
+		if parser.err != nil {
+			return nil, fmt.Errorf("invalid apache log format: %w", parser.err)
+		}
+
+		return parser, nil
+	case FormatALB:
+		return NewALBParser(), nil
+	case FormatCloudFront:
+		return NewCloudFrontParser(), nil
+	case FormatEnvoy:
+		return NewEnvoyParser(), nil
+	default:
+		return nil, fmt.Errorf("unknown input format: %s", format)
+	}
+}
+
+func detectFormat(args *cli.CliArgs, r *bufio.Reader) string {
+	if args.InputFormat != "" && args.InputFormat != FormatAuto {
+		return args.InputFormat
+	}
+
+	prefix, _ := r.Peek(sniffSize)
+	if pcap.IsCapture(prefix) {
+		return FormatPCAP
+	}
+
+	if harPrefixRegex.Match(prefix) {
+		return FormatHAR
+	}
+
+	return DetectFormat(sampleLines(prefix), args)
+}
+
+// DetectFormat picks the format that parses the most lines of the sample.
+// Ties are resolved in favour of the earlier candidate, so plain JSON Lines
+// captures win over anything else and nginx wins over the identical apache
+// combined format.
+func DetectFormat(lines []string, args *cli.CliArgs) string {
+	candidates := []string{FormatJSONL, FormatEnvoy, FormatALB, FormatCloudFront, FormatNginx, FormatApache}
+
+	best := FormatJSONL
+	bestScore := 0
+
+	for _, format := range candidates {
+		score := 0
+		if format == FormatJSONL {
+			for _, line := range lines {
+				if looksLikeLogEntry(line) {
+					score++
+				}
+			}
+		} else {
+			parser, err := newLineParser(format, args)
+			if err != nil {
+				continue
+			}
+
+			for _, line := range lines {
+				if _, err := parser.parseLine(line); err == nil {
+					score++
+				}
+			}
+		}
+
+		if score > bestScore {
+			best = format
+			bestScore = score
+		}
+	}
+
+	return best
+}
+
+func sampleLines(prefix []byte) []string {
+	// drop the trailing partial line unless the whole input fit in the sample
+	if len(prefix) == sniffSize {
+		if idx := bytes.LastIndexByte(prefix, '\n'); idx >= 0 {
+			prefix = prefix[:idx]
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(prefix), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lines = append(lines, line)
+		if len(lines) >= sniffSampleSize {
+			break
+		}
+	}
+
+	return lines
+}
+
+func parseLines(r io.Reader, parser lineParser, limit int) ([]models.LogEntry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+
+	var entries []models.LogEntry
+	lineNum := 0
+
+	for scanner.Scan() {
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+
+		line := strings.TrimRight(scanner.Text(), "\r")
+		lineNum++
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		entry, err := parser.parseLine(line)
+		if errors.Is(err, errSkipLine) {
+			continue
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping line %d: %v\n", lineNum, err)
+			continue
+		}
+
+		entries = append(entries, *entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// splitQuotedFields splits on spaces while keeping "double quoted" values
+// together, as used by load balancer access logs.
+func splitQuotedFields(line string) []string {
+	var fields []string
+	var sb strings.Builder
+	inQuotes := false
+	hasField := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && inQuotes && i+1 < len(line):
+			sb.WriteByte(line[i+1])
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+			hasField = true
+		case c == ' ' && !inQuotes:
+			if hasField {
+				fields = append(fields, sb.String())
+				sb.Reset()
+				hasField = false
+			}
+		default:
+			sb.WriteByte(c)
+			hasField = true
+		}
+	}
+
+	if hasField {
+		fields = append(fields, sb.String())
+	}
+
+	return fields
+}
+
+func looksLikeLogEntry(line string) bool {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return false
+	}
+
+	_, hasMethod := obj["method"]
+	_, hasPath := obj["path"]
+	_, hasResponseCode := obj["response_code"]
+	_, hasStartTime := obj["start_time"]
+
+	return hasMethod && hasPath && !hasResponseCode && !hasStartTime
+}
@@ -0,0 +1,239 @@
+package input
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/pcap"
+)
+
+const (
+	albLine = `https 2024-12-10T14:23:45.123456Z app/my-lb/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.001 0.048 0.002 200 200 34 366 "GET https://api.example.com:443/users/42?expand=orders HTTP/1.1" "curl/7.46.0" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337262-36d228ad5d99923122bbe354" "-" "-" 0 2024-12-10T14:23:45.070000Z "forward" "-" "-" "10.0.0.1:80" "200" "-" "-"`
+
+	cloudFrontHeader = "#Version: 1.0\n#Fields: date time x-edge-location sc-bytes c-ip cs-method cs(Host) cs-uri-stem sc-status cs(Referer) cs(User-Agent) cs-uri-query cs(Cookie) x-edge-result-type x-edge-request-id x-host-header cs-protocol cs-bytes time-taken"
+	cloudFrontLine   = "2024-12-10\t14:23:45\tSEA19-C1\t392\t192.0.2.100\tGET\td111111abcdef8.cloudfront.net\t/index.html\t200\t-\tMozilla/5.0%20(Windows%20NT%2010.0)\tlang=en\tsession=abc\tHit\tSOX4xwn4XV6Q\twww.example.com\thttps\t20\t0.082"
+
+	envoyLine = `{"start_time":"2024-12-10T14:23:45.123Z","method":"POST","path":"/api/orders?dry_run=true","protocol":"HTTP/1.1","response_code":201,"duration":37,"authority":"orders.default.svc","user_agent":"Go-http-client/1.1","request_id":"abc-123"}`
+
+	apacheLine = `127.0.0.1 - frank [10/Dec/2024:14:23:45 -0700] "GET /apache_pb.gif?x=1 HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08" 15250`
+)
+
+func TestALBParser(t *testing.T) {
+	entry, err := NewALBParser().parseLine(albLine)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if entry.Method != "GET" || entry.Path != "/users/42?expand=orders" {
+		t.Errorf("unexpected request: %s %s", entry.Method, entry.Path)
+	}
+
+	if entry.Status != 200 {
+		t.Errorf("expected status 200, got %d", entry.Status)
+	}
+
+	if entry.LatencyMs != 51 {
+		t.Errorf("expected latency 51ms, got %d", entry.LatencyMs)
+	}
+
+	if entry.Headers["Host"][0] != "api.example.com" {
+		t.Errorf("expected default port to be stripped from host, got %v", entry.Headers["Host"])
+	}
+
+	if entry.Headers["X-Amzn-Trace-Id"][0] != "Root=1-58337262-36d228ad5d99923122bbe354" {
+		t.Errorf("unexpected trace id: %v", entry.Headers["X-Amzn-Trace-Id"])
+	}
+
+	if !entry.Timestamp.Equal(time.Date(2024, 12, 10, 14, 23, 45, 123456000, time.UTC)) {
+		t.Errorf("unexpected timestamp: %v", entry.Timestamp)
+	}
+
+	if _, err := NewALBParser().parseLine(cloudFrontLine); err == nil {
+		t.Error("expected error for non ALB line")
+	}
+}
+
+func TestCloudFrontParser(t *testing.T) {
+	parser := NewCloudFrontParser()
+	for _, line := range strings.Split(cloudFrontHeader, "\n") {
+		if _, err := parser.parseLine(line); err != errSkipLine {
+			t.Fatalf("expected header line to be skipped, got %v", err)
+		}
+	}
+
+	entry, err := parser.parseLine(cloudFrontLine)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if entry.Path != "/index.html?lang=en" {
+		t.Errorf("unexpected path: %s", entry.Path)
+	}
+
+	if entry.Status != 200 || entry.LatencyMs != 82 {
+		t.Errorf("unexpected status/latency: %d %d", entry.Status, entry.LatencyMs)
+	}
+
+	if entry.Headers["Host"][0] != "www.example.com" {
+		t.Errorf("expected viewer host header, got %v", entry.Headers["Host"])
+	}
+
+	if entry.Headers["User-Agent"][0] != "Mozilla/5.0 (Windows NT 10.0)" {
+		t.Errorf("expected decoded user agent, got %v", entry.Headers["User-Agent"])
+	}
+
+	if entry.Headers["Cookie"][0] != "session=abc" {
+		t.Errorf("unexpected cookie: %v", entry.Headers["Cookie"])
+	}
+}
+
+func TestEnvoyParser(t *testing.T) {
+	entry, err := NewEnvoyParser().parseLine(envoyLine)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if entry.Method != "POST" || entry.Path != "/api/orders?dry_run=true" {
+		t.Errorf("unexpected request: %s %s", entry.Method, entry.Path)
+	}
+
+	if entry.Status != 201 || entry.LatencyMs != 37 {
+		t.Errorf("unexpected status/latency: %d %d", entry.Status, entry.LatencyMs)
+	}
+
+	if entry.Headers["Host"][0] != "orders.default.svc" || entry.Headers["X-Request-Id"][0] != "abc-123" {
+		t.Errorf("unexpected headers: %v", entry.Headers)
+	}
+
+	t.Run("string values and pseudo header keys", func(t *testing.T) {
+		line := `{":method":"GET",":path":"/health","response_code":"503","duration":"12"}`
+		entry, err := NewEnvoyParser().parseLine(line)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Status != 503 || entry.LatencyMs != 12 || entry.Path != "/health" {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+	})
+}
+
+func TestApacheParser(t *testing.T) {
+	t.Run("combined with %D", func(t *testing.T) {
+		entry, err := NewApacheParser("combined").parseLine(apacheLine)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Path != "/apache_pb.gif?x=1" || entry.Status != 200 {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+
+		if entry.LatencyMs != 15 {
+			t.Errorf("expected latency 15ms from %%D, got %d", entry.LatencyMs)
+		}
+
+		if entry.Headers["Referer"][0] != "http://www.example.com/start.html" {
+			t.Errorf("unexpected referer: %v", entry.Headers["Referer"])
+		}
+
+		if !entry.Timestamp.Equal(time.Date(2024, 12, 10, 21, 23, 45, 0, time.UTC)) {
+			t.Errorf("unexpected timestamp: %v", entry.Timestamp)
+		}
+	})
+
+	t.Run("custom LogFormat", func(t *testing.T) {
+		parser := NewApacheParser(`%v %m %U%q %>s %{ms}T "%{X-Request-ID}i"`)
+		entry, err := parser.parseLine(`shop.example.com PUT /cart/1?force=1 204 42 "req-7"`)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Method != "PUT" || entry.Path != "/cart/1?force=1" || entry.LatencyMs != 42 {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+
+		if entry.Headers["X-Request-Id"][0] != "req-7" || entry.Headers["Host"][0] != "shop.example.com" {
+			t.Errorf("unexpected headers: %v", entry.Headers)
+		}
+	})
+
+	t.Run("format without request", func(t *testing.T) {
+		if parser := NewApacheParser(`%h %>s`); parser.err == nil {
+			t.Error("expected error for format without request")
+		}
+	})
+}
+
+func TestDetectFormat(t *testing.T) {
+	args := &cli.CliArgs{NginxFormat: "combined", ApacheFormat: "combined"}
+	nginxLine := `127.0.0.1 - - [10/Dec/2024:14:23:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "curl/7.68.0"`
+
+	tests := []struct {
+		name     string
+		lines    []string
+		expected string
+	}{
+		{"jsonl", []string{`{"method":"GET","path":"/","headers":{},"body":""}`}, FormatJSONL},
+		{"envoy", []string{envoyLine, envoyLine}, FormatEnvoy},
+		{"alb", []string{albLine}, FormatALB},
+		{"cloudfront", []string{cloudFrontLine}, FormatCloudFront},
+		{"nginx", []string{nginxLine, "garbage"}, FormatNginx},
+		{"unknown falls back to jsonl", []string{"garbage"}, FormatJSONL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat(tt.lines, args); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestReadEntries_AutoDetectedFormats(t *testing.T) {
+	content := cloudFrontHeader + "\n" + cloudFrontLine + "\n" + cloudFrontLine + "\n"
+	tmpfile := createTempFile(t, content)
+	defer func() {
+		err := os.Remove(tmpfile)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}()
+
+	entries, err := ReadEntries(&cli.CliArgs{InputFile: tmpfile})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	if entries[0].Path != "/index.html?lang=en" || entries[0].Timestamp.IsZero() {
+		t.Errorf("unexpected entry: %+v", entries[0])
+	}
+
+	t.Run("packet capture", func(t *testing.T) {
+		header := "\xd4\xc3\xb2\xa1\x02\x00\x04\x00" + strings.Repeat("\x00", 8) + "\xff\xff\x00\x00\x01\x00\x00\x00"
+		if format := detectFormat(&cli.CliArgs{}, bufio.NewReader(strings.NewReader(header))); format != FormatPCAP {
+			t.Errorf("expected pcap, got %s", format)
+		}
+
+		entries, err := pcap.ReadEntries(strings.NewReader(header), 0)
+		if err != nil || len(entries) != 0 {
+			t.Errorf("expected empty capture, got %d entries (%v)", len(entries), err)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := ReadEntries(&cli.CliArgs{InputFile: tmpfile, InputFormat: "w3c"})
+		if err == nil {
+			t.Error("expected error for unknown format")
+		}
+	})
+}
@@ -0,0 +1,299 @@
+package input
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// JSONMapping says which field of an arbitrary JSON log line fills each
+// LogEntry field. Paths are dot separated (`http.request.method`); keys that
+// themselves contain dots (`url.path` in ECS logs) are matched as well.
+type JSONMapping struct {
+	Method             string            `yaml:"method"`
+	Path               string            `yaml:"path"`
+	Query              string            `yaml:"query,omitempty"`
+	Headers            string            `yaml:"headers,omitempty"`
+	HeaderFields       map[string]string `yaml:"header_fields,omitempty"`
+	Body               string            `yaml:"body,omitempty"`
+	BodyBase64         bool              `yaml:"body_base64,omitempty"`
+	Status             string            `yaml:"status,omitempty"`
+	ResponseHeaders    string            `yaml:"response_headers,omitempty"`
+	ResponseBody       string            `yaml:"response_body,omitempty"`
+	ResponseBodyBase64 bool              `yaml:"response_body_base64,omitempty"`
+	Timestamp          string            `yaml:"timestamp,omitempty"`
+	TimestampFormat    string            `yaml:"timestamp_format,omitempty"`
+	Latency            string            `yaml:"latency,omitempty"`
+	LatencyUnit        string            `yaml:"latency_unit,omitempty"`
+}
+
+func LoadJSONMapping(path string) (*JSONMapping, error) {
+	data, err := os.ReadFile(filepath.Clean(path)) // #nosec G304 -- mapping path comes from CLI flags
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping file: %w", err)
+	}
+
+	var mapping JSONMapping
+	if err := yaml.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping YAML: %w", err)
+	}
+
+	if err := mapping.validate(); err != nil {
+		return nil, fmt.Errorf("invalid mapping: %w", err)
+	}
+
+	return &mapping, nil
+}
+
+func (m *JSONMapping) validate() error {
+	if m.Method == "" {
+		return fmt.Errorf("method is required")
+	}
+
+	if m.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+
+	switch m.LatencyUnit {
+	case "", "ms", "s", "us", "ns":
+	default:
+		return fmt.Errorf("invalid latency_unit '%s', must be one of: ms, s, us, ns", m.LatencyUnit)
+	}
+
+	return nil
+}
+
+func (m *JSONMapping) Apply(line []byte) (models.LogEntry, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(line, &doc); err != nil {
+		return models.LogEntry{}, err
+	}
+
+	entry := models.LogEntry{
+		BodyEncoding: models.BodyEncodingBase64,
+		Method:       strings.ToUpper(stringValue(lookupPath(doc, m.Method))),
+		Path:         stringValue(lookupPath(doc, m.Path)),
+	}
+
+	if entry.Method == "" || entry.Path == "" {
+		return models.LogEntry{}, fmt.Errorf("missing %s or %s", m.Method, m.Path)
+	}
+
+	if m.Query != "" {
+		if query := strings.TrimPrefix(stringValue(lookupPath(doc, m.Query)), "?"); query != "" {
+			entry.Path += "?" + query
+		}
+	}
+
+	entry.Headers = headerValue(lookupPath(doc, m.Headers))
+	for header, path := range m.HeaderFields {
+		if v := stringValue(lookupPath(doc, path)); v != "" {
+			entry.Headers[textproto.CanonicalMIMEHeaderKey(header)] = []string{v}
+		}
+	}
+
+	var err error
+	if entry.Body, err = bodyValue(lookupPath(doc, m.Body), m.BodyBase64); err != nil {
+		return models.LogEntry{}, fmt.Errorf("body: %w", err)
+	}
+
+	if entry.ResponseBody, err = bodyValue(lookupPath(doc, m.ResponseBody), m.ResponseBodyBase64); err != nil {
+		return models.LogEntry{}, fmt.Errorf("response_body: %w", err)
+	}
+
+	if m.ResponseHeaders != "" {
+		entry.ResponseHeaders = headerValue(lookupPath(doc, m.ResponseHeaders))
+	}
+
+	if status, ok := numberValue(lookupPath(doc, m.Status)); ok {
+		entry.Status = int(status)
+	}
+
+	if latency, ok := numberValue(lookupPath(doc, m.Latency)); ok {
+		entry.LatencyMs = latencyToMs(latency, m.LatencyUnit)
+	}
+
+	if raw := lookupPath(doc, m.Timestamp); raw != nil {
+		if entry.Timestamp, err = parseTimestamp(raw, m.TimestampFormat); err != nil {
+			return models.LogEntry{}, fmt.Errorf("timestamp: %w", err)
+		}
+	}
+
+	return entry, nil
+}
+
+// lookupPath resolves a dot separated path, preferring the longest key that
+// matches literally at each level so both nested and flattened logs work.
+func lookupPath(value any, path string) any {
+	if path == "" {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		if direct, ok := v[path]; ok {
+			return direct
+		}
+
+		for i := len(path) - 1; i > 0; i-- {
+			if path[i] != '.' {
+				continue
+			}
+
+			if child, ok := v[path[:i]]; ok {
+				if found := lookupPath(child, path[i+1:]); found != nil {
+					return found
+				}
+			}
+		}
+	case []any:
+		head, rest, _ := strings.Cut(path, ".")
+		idx, err := strconv.Atoi(head)
+		if err != nil || idx < 0 || idx >= len(v) {
+			return nil
+		}
+
+		if rest == "" {
+			return v[idx]
+		}
+
+		return lookupPath(v[idx], rest)
+	}
+
+	return nil
+}
+
+func stringValue(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case nil:
+		return ""
+	default:
+		data, _ := json.Marshal(val)
+		return string(data)
+	}
+}
+
+func numberValue(v any) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case string:
+		n, err := strconv.ParseFloat(val, 64)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func headerValue(v any) map[string][]string {
+	headers := make(map[string][]string)
+
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return headers
+	}
+
+	for k, raw := range obj {
+		key := textproto.CanonicalMIMEHeaderKey(k)
+		switch val := raw.(type) {
+		case []any:
+			for _, item := range val {
+				headers[key] = append(headers[key], stringValue(item))
+			}
+		default:
+			headers[key] = append(headers[key], stringValue(val))
+		}
+	}
+
+	return headers
+}
+
+// bodyValue returns the base64 encoding used by LogEntry. Structured bodies
+// are re-encoded as JSON.
+func bodyValue(v any, isBase64 bool) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+
+	if isBase64 {
+		if _, err := base64.StdEncoding.DecodeString(s); err != nil {
+			return "", fmt.Errorf("not valid base64: %w", err)
+		}
+
+		return s, nil
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(s)), nil
+}
+
+func latencyToMs(value float64, unit string) int64 {
+	switch unit {
+	case "s":
+		return int64(math.Round(value * 1000))
+	case "us":
+		return int64(value / 1000)
+	case "ns":
+		return int64(value / 1e6)
+	default:
+		return int64(value)
+	}
+}
+
+func parseTimestamp(v any, format string) (time.Time, error) {
+	switch format {
+	case "unix", "unix_ms", "unix_us", "unix_ns":
+		n, ok := numberValue(v)
+		if !ok {
+			return time.Time{}, fmt.Errorf("expected a number, got %v", v)
+		}
+
+		switch format {
+		case "unix":
+			return time.UnixMilli(int64(n * 1000)).UTC(), nil
+		case "unix_ms":
+			return time.UnixMilli(int64(n)).UTC(), nil
+		case "unix_us":
+			return time.UnixMicro(int64(n)).UTC(), nil
+		default:
+			return time.Unix(0, int64(n)).UTC(), nil
+		}
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("expected a string, got %v", v)
+	}
+
+	layout := format
+	if layout == "" || layout == "rfc3339" {
+		layout = time.RFC3339Nano
+	}
+
+	return time.Parse(layout, s)
+}
@@ -0,0 +1,176 @@
+package input
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/models"
+)
+
+const mappingYAML = `method: http.method
+path: url.path
+query: url.query
+headers: http.request.headers
+header_fields:
+  x-trace-id: trace.id
+body: http.request.body
+status: http.response.status_code
+response_body: http.response.body
+response_body_base64: true
+timestamp: "@timestamp"
+latency: duration_ms
+`
+
+func writeMapping(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "mapping.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write mapping: %v", err)
+	}
+
+	return path
+}
+
+func TestJSONMapping_Apply(t *testing.T) {
+	mapping, err := LoadJSONMapping(writeMapping(t, mappingYAML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("nested paths", func(t *testing.T) {
+		line := `{"@timestamp":"2024-12-10T14:23:45.5Z","http":{"method":"post","request":{"headers":{"content-type":"application/json","accept":["a","b"]},"body":{"name":"Liakos"}},"response":{"status_code":201,"body":"eyJpZCI6MX0="}},"url":{"path":"/users","query":"notify=true"},"trace":{"id":"t-1"},"duration_ms":12.9}`
+
+		entry, err := mapping.Apply([]byte(line))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Method != "POST" || entry.Path != "/users?notify=true" {
+			t.Errorf("unexpected request: %s %s", entry.Method, entry.Path)
+		}
+
+		if entry.Headers["Content-Type"][0] != "application/json" || len(entry.Headers["Accept"]) != 2 {
+			t.Errorf("unexpected headers: %v", entry.Headers)
+		}
+
+		if entry.Headers["X-Trace-Id"][0] != "t-1" {
+			t.Errorf("expected header from header_fields, got %v", entry.Headers)
+		}
+
+		if string(models.DecodeBody(entry.Body)) != `{"name":"Liakos"}` {
+			t.Errorf("expected object body to be JSON encoded, got %s", models.DecodeBody(entry.Body))
+		}
+
+		if entry.ResponseBody != "eyJpZCI6MX0=" {
+			t.Errorf("expected base64 response body to be kept, got %s", entry.ResponseBody)
+		}
+
+		if entry.Status != 201 || entry.LatencyMs != 12 {
+			t.Errorf("unexpected status/latency: %d %d", entry.Status, entry.LatencyMs)
+		}
+
+		if !entry.Timestamp.Equal(time.Date(2024, 12, 10, 14, 23, 45, 500000000, time.UTC)) {
+			t.Errorf("unexpected timestamp: %v", entry.Timestamp)
+		}
+	})
+
+	t.Run("flattened dotted keys", func(t *testing.T) {
+		line := `{"http.method":"GET","url.path":"/health","http.response.status_code":"200"}`
+
+		entry, err := mapping.Apply([]byte(line))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Method != "GET" || entry.Path != "/health" || entry.Status != 200 {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+	})
+
+	t.Run("missing required fields", func(t *testing.T) {
+		if _, err := mapping.Apply([]byte(`{"msg":"started"}`)); err == nil {
+			t.Error("expected error for line without method and path")
+		}
+	})
+
+	t.Run("invalid base64 body", func(t *testing.T) {
+		line := `{"http":{"method":"GET","response":{"body":"%%%"}},"url":{"path":"/"}}`
+		if _, err := mapping.Apply([]byte(line)); err == nil {
+			t.Error("expected error for invalid base64")
+		}
+	})
+}
+
+func TestJSONMapping_TimeFormats(t *testing.T) {
+	expected := time.Date(2024, 12, 10, 14, 23, 45, 0, time.UTC)
+
+	tests := []struct {
+		format string
+		value  any
+	}{
+		{"unix", float64(expected.Unix())},
+		{"unix_ms", float64(expected.UnixMilli())},
+		{"unix_us", "1733840625000000"},
+		{"2006-01-02 15:04:05", "2024-12-10 14:23:45"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			ts, err := parseTimestamp(tt.value, tt.format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !ts.Equal(expected) {
+				t.Errorf("expected %v, got %v", expected, ts)
+			}
+		})
+	}
+
+	if ms := latencyToMs(0.25, "s"); ms != 250 {
+		t.Errorf("expected 250ms, got %d", ms)
+	}
+}
+
+func TestLoadJSONMapping_Invalid(t *testing.T) {
+	if _, err := LoadJSONMapping(writeMapping(t, "path: url.path\n")); err == nil {
+		t.Error("expected error for mapping without method")
+	}
+
+	if _, err := LoadJSONMapping(writeMapping(t, "method: m\npath: p\nlatency_unit: hours\n")); err == nil {
+		t.Error("expected error for invalid latency unit")
+	}
+}
+
+func TestReadEntries_JSONMapping(t *testing.T) {
+	content := `{"http":{"method":"GET"},"url":{"path":"/a"}}
+{"level":"info","msg":"not a request"}
+{"http":{"method":"DELETE"},"url":{"path":"/b"}}
+`
+	tmpfile := createTempFile(t, content)
+	defer func() {
+		err := os.Remove(tmpfile)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}()
+
+	args := &cli.CliArgs{InputFile: tmpfile, JSONMapping: writeMapping(t, mappingYAML)}
+	entries, err := ReadEntries(args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 mapped entries, got %d", len(entries))
+	}
+
+	if entries[1].Method != "DELETE" || !strings.HasPrefix(entries[1].Path, "/b") {
+		t.Errorf("unexpected entry: %+v", entries[1])
+	}
+}
@@ -5,35 +5,52 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"regexp"
 	"strings"
 
 	"github.com/kx0101/replayer/internal/models"
 )
 
-var (
-	// Combined log format: 127.0.0.1 - - [07/Dec/2024:10:15:30 +0000] "GET /users/123 HTTP/1.1" 200 1234 "http://example.com" "Mozilla/5.0"
-	combinedLogRegex = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) (\S+) \S+" (\d+) (\d+) "([^"]*)" "([^"]*)"`)
-
-	// Common log format: 127.0.0.1 - - [07/Dec/2024:10:15:30 +0000] "GET /users/123 HTTP/1.1" 200 1234
-	commonLogRegex = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) (\S+) \S+" (\d+) (\d+)`)
-)
-
 type NginxParser struct {
-	format string
+	format  string
+	formats []*LogFormat
+	err     error
 }
 
+// NewNginxParser accepts "combined", "common" or an nginx log_format
+// definition such as `$remote_addr [$time_local] "$request" $status $request_time`.
 func NewNginxParser(format string) *NginxParser {
 	if format == "" {
 		format = "combined"
 	}
 
-	return &NginxParser{
+	parser := &NginxParser{
 		format: format,
 	}
+
+	definitions := []string{format}
+	if format == "combined" {
+		// combined lines are often mixed with common ones (no referer/user agent)
+		definitions = append(definitions, "common")
+	}
+
+	for _, def := range definitions {
+		compiled, err := CompileLogFormat(def)
+		if err != nil {
+			parser.err = err
+			return parser
+		}
+
+		parser.formats = append(parser.formats, compiled)
+	}
+
+	return parser
 }
 
 func (p *NginxParser) ParseFile(inputPath, outputPath string) error {
+	if p.err != nil {
+		return fmt.Errorf("invalid nginx log format: %w", p.err)
+	}
+
 	if strings.Contains(inputPath, "..") {
 		return fmt.Errorf("invalid output path: %s", inputPath)
 	}
@@ -113,53 +130,21 @@ func (p *NginxParser) ParseFile(inputPath, outputPath string) error {
 }
 
 func (p *NginxParser) parseLine(line string) (*models.LogEntry, error) {
-	var matches []string
-
-	matches = combinedLogRegex.FindStringSubmatch(line)
-	if matches == nil {
-		matches = commonLogRegex.FindStringSubmatch(line)
-
-		if matches == nil {
-			return nil, fmt.Errorf("line does not match nginx log format")
-		}
+	if p.err != nil {
+		return nil, p.err
 	}
 
-	// matches[0] = full match
-	// matches[1] = IP
-	// matches[2] = timestamp
-	// matches[3] = method
-	// matches[4] = path
-	// matches[5] = status
-	// matches[6] = bytes
-	// matches[7] = referer (combined only)
-	// matches[8] = user agent (combined only) 
-
-	method := matches[3]
-	path := matches[4]
-
-	headers := make(map[string][]string)
-
-	if len(matches) > 8 {
-		if matches[8] != "-" {
-			headers["User-Agent"] = []string{matches[8]}
-		}
-
-		if matches[7] != "-" && matches[7] == "" {
-			headers["Referrer"] = []string{matches[7]}
+	var lastErr error
+	for _, format := range p.formats {
+		entry, err := format.Parse(line)
+		if err == nil {
+			return entry, nil
 		}
-	}
-
-	pathParts := strings.SplitN(path, "?", 2)
-	cleanPath := pathParts[0]
 
-	entry := &models.LogEntry{
-		Method:  strings.ToUpper(method),
-		Path:    cleanPath,
-		Headers: headers,
-		Body:    "",
+		lastErr = err
 	}
 
-	return entry, nil
+	return nil, lastErr
 }
 
 func ConvertNginxLogs(inputPath, outputPath, format string) error {
@@ -0,0 +1,358 @@
+package input
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+const (
+	combinedLogFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+	commonLogFormat   = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent`
+
+	nginxTimeLocalLayout = "02/Jan/2006:15:04:05 -0700"
+)
+
+var (
+	logFormatVarRegex     = regexp.MustCompile(`\$(\{[a-zA-Z0-9_]+\}|[a-zA-Z0-9_]+)`)
+	logFormatQuotedRegex  = regexp.MustCompile(`'([^']*)'|"((?:[^"\\]|\\.)*)"`)
+	logFormatDirectiveArg = regexp.MustCompile(`^log_format\s+\S+\s+(?:escape=\S+\s+)?`)
+)
+
+// LogFormat is an nginx log_format definition compiled into a regular
+// expression with one capture group per variable.
+type LogFormat struct {
+	Definition string
+	variables  []string
+	regex      *regexp.Regexp
+}
+
+func CompileLogFormat(definition string) (*LogFormat, error) {
+	definition = normalizeLogFormatDefinition(definition)
+	if definition == "" {
+		return nil, fmt.Errorf("empty log format")
+	}
+
+	locs := logFormatVarRegex.FindAllStringSubmatchIndex(definition, -1)
+	if len(locs) == 0 {
+		return nil, fmt.Errorf("log format has no variables: %s", definition)
+	}
+
+	var sb strings.Builder
+	var variables []string
+	sb.WriteString("^")
+
+	last := 0
+	for i, loc := range locs {
+		sb.WriteString(literalPattern(definition[last:loc[0]]))
+
+		name := strings.Trim(definition[loc[2]:loc[3]], "{}")
+		variables = append(variables, name)
+
+		if i+1 < len(locs) {
+			sb.WriteString("(" + variablePattern(definition[loc[1]:locs[i+1][0]], false) + ")")
+		} else {
+			sb.WriteString("(" + variablePattern(definition[loc[1]:], true) + ")")
+		}
+
+		last = loc[1]
+	}
+
+	sb.WriteString(literalPattern(definition[last:]))
+
+	hasRequest := false
+	for _, v := range variables {
+		if v == "request" || v == "request_uri" || v == "uri" {
+			hasRequest = true
+		}
+	}
+
+	if !hasRequest {
+		return nil, fmt.Errorf("log format must contain $request, $request_uri or $uri")
+	}
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile log format: %w", err)
+	}
+
+	return &LogFormat{
+		Definition: definition,
+		variables:  variables,
+		regex:      re,
+	}, nil
+}
+
+// normalizeLogFormatDefinition accepts either the raw format string or a full
+// `log_format name '...' '...';` directive copied from nginx.conf.
+func normalizeLogFormatDefinition(definition string) string {
+	definition = strings.TrimSpace(definition)
+
+	switch definition {
+	case "", "combined":
+		return combinedLogFormat
+	case "common":
+		return commonLogFormat
+	}
+
+	if !strings.HasPrefix(definition, "log_format") {
+		return definition
+	}
+
+	rest := logFormatDirectiveArg.ReplaceAllString(definition, "")
+	rest = strings.TrimSuffix(strings.TrimSpace(rest), ";")
+
+	var sb strings.Builder
+	for _, m := range logFormatQuotedRegex.FindAllStringSubmatch(rest, -1) {
+		if m[1] != "" {
+			sb.WriteString(m[1])
+		} else {
+			sb.WriteString(strings.ReplaceAll(m[2], `\"`, `"`))
+		}
+	}
+
+	return sb.String()
+}
+
+func literalPattern(literal string) string {
+	var sb strings.Builder
+	for _, r := range literal {
+		if r == ' ' {
+			sb.WriteString(`\s+`)
+			continue
+		}
+
+		sb.WriteString(regexp.QuoteMeta(string(r)))
+	}
+
+	return sb.String()
+}
+
+// variablePattern matches a variable value up to the literal that follows it
+// in the format. Quoted values may contain escaped quotes (escape=json).
+func variablePattern(next string, last bool) string {
+	if next == "" && last {
+		return ".*"
+	}
+
+	if next == "" {
+		return ".*?"
+	}
+
+	r, _ := utf8.DecodeRuneInString(next)
+	switch r {
+	case '"':
+		return `(?:[^"\\]|\\.)*`
+	case ' ':
+		return `\S*`
+	default:
+		return `[^` + regexp.QuoteMeta(string(r)) + `]*`
+	}
+}
+
+func (f *LogFormat) Parse(line string) (*models.LogEntry, error) {
+	matches := f.regex.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, fmt.Errorf("line does not match nginx log format")
+	}
+
+	entry := &models.LogEntry{
+		BodyEncoding: models.BodyEncodingBase64,
+		Headers:      make(map[string][]string),
+	}
+
+	var uri, query, requestTime, upstreamTime string
+	var cookies []string
+
+	for i, name := range f.variables {
+		value := matches[i+1]
+		if value == "-" || value == "" {
+			continue
+		}
+
+		switch {
+		case name == "request":
+			parts := strings.Fields(value)
+			if len(parts) < 2 {
+				return nil, fmt.Errorf("malformed request line: %q", value)
+			}
+
+			entry.Method = parts[0]
+			uri = parts[1]
+		case name == "request_method":
+			entry.Method = value
+		case name == "request_uri":
+			uri = value
+		case name == "uri":
+			if uri == "" {
+				uri = value
+			}
+		case name == "args" || name == "query_string":
+			query = value
+		case name == "status":
+			status, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid status %q", value)
+			}
+
+			entry.Status = status
+		case name == "time_local":
+			ts, err := time.Parse(nginxTimeLocalLayout, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time_local %q: %w", value, err)
+			}
+
+			entry.Timestamp = ts
+		case name == "time_iso8601":
+			ts, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time_iso8601 %q: %w", value, err)
+			}
+
+			entry.Timestamp = ts
+		case name == "msec":
+			secs, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid msec %q", value)
+			}
+
+			entry.Timestamp = time.UnixMilli(int64(secs * 1000)).UTC()
+		case name == "request_time":
+			requestTime = value
+		case name == "upstream_response_time":
+			upstreamTime = value
+		case name == "request_body":
+			entry.Body = base64.StdEncoding.EncodeToString(unescapeNginxValue(value))
+		case name == "content_type":
+			entry.Headers["Content-Type"] = []string{unescapeNginxString(value)}
+		case name == "host":
+			entry.Headers["Host"] = []string{value}
+		case strings.HasPrefix(name, "http_"):
+			key := textproto.CanonicalMIMEHeaderKey(strings.ReplaceAll(strings.TrimPrefix(name, "http_"), "_", "-"))
+			entry.Headers[key] = append(entry.Headers[key], unescapeNginxString(value))
+		case strings.HasPrefix(name, "cookie_"):
+			cookies = append(cookies, strings.TrimPrefix(name, "cookie_")+"="+unescapeNginxString(value))
+		}
+	}
+
+	if entry.Method == "" || uri == "" {
+		return nil, fmt.Errorf("line has no request method or URI")
+	}
+
+	if query != "" && !strings.Contains(uri, "?") {
+		uri += "?" + query
+	}
+
+	if len(cookies) > 0 {
+		if _, ok := entry.Headers["Cookie"]; !ok {
+			entry.Headers["Cookie"] = []string{strings.Join(cookies, "; ")}
+		}
+	}
+
+	if requestTime == "" {
+		requestTime = upstreamTime
+	}
+
+	if ms, ok := parseNginxSeconds(requestTime); ok {
+		entry.LatencyMs = ms
+	}
+
+	entry.Method = strings.ToUpper(entry.Method)
+	entry.Path = uri
+
+	return entry, nil
+}
+
+// parseNginxSeconds parses $request_time style values ("0.123"). Upstream
+// times may list several attempts ("0.010, 0.020"), which are summed.
+func parseNginxSeconds(value string) (int64, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	var total float64
+	for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ':' || r == ' ' }) {
+		secs, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, false
+		}
+
+		total += secs
+	}
+
+	return int64(total*1000 + 0.5), true
+}
+
+func unescapeNginxString(value string) string {
+	return string(unescapeNginxValue(value))
+}
+
+// unescapeNginxValue reverses both nginx escaping modes: the default `\xHH`
+// form and escape=json string escapes.
+func unescapeNginxValue(value string) []byte {
+	if !strings.Contains(value, `\`) {
+		return []byte(value)
+	}
+
+	out := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c != '\\' || i+1 >= len(value) {
+			out = append(out, c)
+			continue
+		}
+
+		next := value[i+1]
+		switch next {
+		case 'x':
+			if i+3 < len(value) {
+				if b, err := strconv.ParseUint(value[i+2:i+4], 16, 8); err == nil {
+					out = append(out, byte(b))
+					i += 3
+					continue
+				}
+			}
+
+			out = append(out, c)
+		case 'u':
+			if i+5 < len(value) {
+				if r, err := strconv.ParseUint(value[i+2:i+6], 16, 32); err == nil {
+					out = utf8.AppendRune(out, rune(r))
+					i += 5
+					continue
+				}
+			}
+
+			out = append(out, c)
+		case 'n':
+			out = append(out, '\n')
+			i++
+		case 'r':
+			out = append(out, '\r')
+			i++
+		case 't':
+			out = append(out, '\t')
+			i++
+		case 'b':
+			out = append(out, '\b')
+			i++
+		case 'f':
+			out = append(out, '\f')
+			i++
+		case '"', '\\', '/':
+			out = append(out, next)
+			i++
+		default:
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
@@ -1,10 +1,12 @@
 package input
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/kx0101/replayer/internal/models"
 )
@@ -66,8 +68,8 @@ func TestNginxParser_ParseLine(t *testing.T) {
 			t.Fatalf("unexpected error: %v", err)
 		}
 
-		if entry.Path != "/search" {
-			t.Errorf("expected path /search (without query), got %s", entry.Path)
+		if entry.Path != "/search?q=test&page=1" {
+			t.Errorf("expected path /search?q=test&page=1 (with query), got %s", entry.Path)
 		}
 	})
 
@@ -125,6 +127,105 @@ func TestNginxParser_ParseLine(t *testing.T) {
 	})
 }
 
+func TestNginxParser_CustomLogFormat(t *testing.T) {
+	t.Run("timestamp, status and latency", func(t *testing.T) {
+		parser := NewNginxParser("combined")
+		line := `127.0.0.1 - - [10/Dec/2024:14:23:45 +0200] "GET /api/users HTTP/1.1" 404 12 "-" "curl/8.0"`
+
+		entry, err := parser.parseLine(line)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Status != 404 {
+			t.Errorf("expected status 404, got %d", entry.Status)
+		}
+
+		if !entry.Timestamp.Equal(time.Date(2024, 12, 10, 12, 23, 45, 0, time.UTC)) {
+			t.Errorf("unexpected timestamp: %v", entry.Timestamp)
+		}
+	})
+
+	t.Run("request_time and escaped request body", func(t *testing.T) {
+		format := `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent $request_time "$http_x_request_id" "$request_body"`
+		parser := NewNginxParser(format)
+		line := `10.0.0.1 - - [10/Dec/2024:14:23:45 +0000] "POST /api/orders?dry_run=1 HTTP/1.1" 201 87 0.137 "req-42" "{\x22item\x22:\x22caf\xC3\xA9\x22}"`
+
+		entry, err := parser.parseLine(line)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Method != "POST" || entry.Path != "/api/orders?dry_run=1" {
+			t.Errorf("unexpected request: %s %s", entry.Method, entry.Path)
+		}
+
+		if entry.LatencyMs != 137 {
+			t.Errorf("expected latency 137ms, got %d", entry.LatencyMs)
+		}
+
+		if got := entry.Headers["X-Request-Id"]; len(got) != 1 || got[0] != "req-42" {
+			t.Errorf("unexpected X-Request-Id header: %v", got)
+		}
+
+		body, err := base64.StdEncoding.DecodeString(entry.Body)
+		if err != nil {
+			t.Fatalf("body is not base64: %v", err)
+		}
+
+		if string(body) != `{"item":"café"}` {
+			t.Errorf("unexpected body: %s", body)
+		}
+	})
+
+	t.Run("json escaped body", func(t *testing.T) {
+		parser := NewNginxParser(`$time_iso8601 $request_method $request_uri $status "$request_body"`)
+		line := `2024-12-10T14:23:45+00:00 PUT /items/1 200 "{\"a\":\"b\\n\"}"`
+
+		entry, err := parser.parseLine(line)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		body, _ := base64.StdEncoding.DecodeString(entry.Body)
+		if string(body) != `{"a":"b\n"}` {
+			t.Errorf("unexpected body: %s", body)
+		}
+
+		if entry.Timestamp.IsZero() {
+			t.Error("expected timestamp to be set")
+		}
+	})
+
+	t.Run("log_format directive", func(t *testing.T) {
+		directive := `log_format timed '$remote_addr [$time_local] '
+                          '"$request" $status $request_time';`
+		parser := NewNginxParser(directive)
+		line := `10.0.0.1 [10/Dec/2024:14:23:45 +0000] "DELETE /users/7 HTTP/2.0" 204 0.004`
+
+		entry, err := parser.parseLine(line)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry.Method != "DELETE" || entry.Status != 204 || entry.LatencyMs != 4 {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+	})
+
+	t.Run("format without request variable", func(t *testing.T) {
+		_, err := CompileLogFormat(`$remote_addr $status`)
+		if err == nil {
+			t.Error("expected error for format without request")
+		}
+
+		parser := NewNginxParser(`$remote_addr $status`)
+		if err := parser.ParseFile("in.log", "out.json"); err == nil {
+			t.Error("expected ParseFile to report the invalid format")
+		}
+	})
+}
+
 func TestNginxParser_ParseFile(t *testing.T) {
 	t.Run("valid log file", func(t *testing.T) {
 		content := `127.0.0.1 - - [10/Dec/2024:14:23:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "http://example.com" "Mozilla/5.0"
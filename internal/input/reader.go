@@ -9,13 +9,49 @@ import (
 	"strings"
 
 	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/har"
 	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/pcap"
 )
 
+// MaxLineSize is the longest line the JSON Lines readers accept.
+const MaxLineSize = 10 * 1024 * 1024
+
+// ReadEntries reads every file --input-file resolves to. Entries from
+// several files, such as a directory of rotated logs, are merged by
+// timestamp before the limit is applied.
 func ReadEntries(args *cli.CliArgs) ([]models.LogEntry, error) {
-	file, err := os.Open(args.InputFile)
+	paths, err := ExpandPaths(args.InputFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 1 {
+		return readFile(paths[0], args, args.Limit)
+	}
+
+	files := make([][]models.LogEntry, 0, len(paths))
+	for _, path := range paths {
+		entries, err := readFile(path, args, 0)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		files = append(files, entries)
+	}
+
+	entries := mergeByTimestamp(files)
+	if args.Limit > 0 && len(entries) > args.Limit {
+		entries = entries[:args.Limit]
+	}
+
+	return entries, nil
+}
+
+func readFile(path string, args *cli.CliArgs, limit int) ([]models.LogEntry, error) {
+	file, err := Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return nil, err
 	}
 	defer func() {
 		err = file.Close()
@@ -24,7 +60,42 @@ func ReadEntries(args *cli.CliArgs) ([]models.LogEntry, error) {
 		}
 	}()
 
-	return parseEntries(file, args.Limit, false)
+	reader := bufio.NewReaderSize(file, sniffSize)
+
+	if args.JSONMapping != "" {
+		mapping, err := LoadJSONMapping(args.JSONMapping)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseEntries(reader, limit, false, mapping)
+	}
+
+	format := detectFormat(args, reader)
+	switch format {
+	case FormatHAR:
+		return parseHAR(reader, limit)
+	case FormatPCAP:
+		return pcap.ReadEntries(reader, limit)
+	case FormatJSONL:
+		return parseEntries(reader, limit, false, nil)
+	default:
+		parser, err := newLineParser(format, args)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseLines(reader, parser, limit)
+	}
+}
+
+func parseHAR(r io.Reader, limit int) ([]models.LogEntry, error) {
+	doc, err := har.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.LogEntries(limit)
 }
 
 func DryRun(input string) error {
@@ -32,9 +103,9 @@ func DryRun(input string) error {
 		return fmt.Errorf("invalid input path: %s", input)
 	}
 
-	file, err := os.Open(input) // #nosec G304
+	file, err := Open(input)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return err
 	}
 	defer func() {
 		err = file.Close()
@@ -43,12 +114,14 @@ func DryRun(input string) error {
 		}
 	}()
 
-	_, err = parseEntries(file, 0, true)
+	_, err = parseEntries(file, 0, true, nil)
 	return err
 }
 
-func parseEntries(r io.Reader, limit int, dryRun bool) ([]models.LogEntry, error) {
+func parseEntries(r io.Reader, limit int, dryRun bool, mapping *JSONMapping) ([]models.LogEntry, error) {
 	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+
 	var entries []models.LogEntry
 	lineNum := 0
 
@@ -64,8 +137,24 @@ func parseEntries(r io.Reader, limit int, dryRun bool) ([]models.LogEntry, error
 			continue
 		}
 
+		if _, ok, err := models.ParseFileHeader([]byte(line)); ok {
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
 		var entry models.LogEntry
-		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		if mapping != nil {
+			mapped, err := mapping.Apply([]byte(line))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "unmappable JSON object %d: %v\n", lineNum, err)
+				continue
+			}
+
+			entry = mapped
+		} else if err := json.Unmarshal([]byte(line), &entry); err != nil {
 			fmt.Fprintf(os.Stderr, "invalid JSON object %d: %v\n", lineNum, err)
 			continue
 		}
@@ -1,6 +1,8 @@
 package input
 
 import (
+	"bytes"
+	"encoding/base64"
 	"os"
 	"strings"
 	"testing"
@@ -206,6 +208,108 @@ func TestReadEntries(t *testing.T) {
 	})
 }
 
+func TestReadEntries_Versioned(t *testing.T) {
+	t.Run("header is skipped and body encodings are honoured", func(t *testing.T) {
+		content := `{"replayer_format":1,"source":"capture","capture_host":"proxy-1","created_at":"2024-12-10T14:00:00Z"}
+{"method":"POST","path":"/text","body":"dGVzdA==","body_encoding":"text"}
+{"method":"POST","path":"/base64","body":"dGVzdA==","body_encoding":"base64"}
+{"method":"POST","path":"/legacy","body":"dGVzdA=="}
+`
+		tmpfile := createTempFile(t, content)
+		defer func() {
+			_ = os.Remove(tmpfile)
+		}()
+
+		entries, err := ReadEntries(&cli.CliArgs{InputFile: tmpfile})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(entries) != 3 {
+			t.Fatalf("expected 3 entries, got %d", len(entries))
+		}
+
+		want := []string{"dGVzdA==", "test", "test"}
+		for i, entry := range entries {
+			if got := string(entry.DecodedBody()); got != want[i] {
+				t.Errorf("%s: expected body %q, got %q", entry.Path, want[i], got)
+			}
+		}
+	})
+
+	t.Run("newer format version is rejected", func(t *testing.T) {
+		tmpfile := createTempFile(t, `{"replayer_format":99}
+{"method":"GET","path":"/"}
+`)
+		defer func() {
+			_ = os.Remove(tmpfile)
+		}()
+
+		if _, err := ReadEntries(&cli.CliArgs{InputFile: tmpfile}); err == nil {
+			t.Error("expected error for an unsupported format version")
+		}
+	})
+}
+
+func TestReadEntries_HAR(t *testing.T) {
+	content := `{
+  "log": {
+    "version": "1.2",
+    "creator": {"name": "test", "version": "1"},
+    "entries": [{
+      "startedDateTime": "2024-12-10T14:23:45Z",
+      "time": 10,
+      "request": {"method": "GET", "url": "http://example.com/search?q=go", "httpVersion": "HTTP/1.1", "cookies": [], "headers": [], "queryString": [], "headersSize": -1, "bodySize": 0},
+      "response": {"status": 200, "statusText": "OK", "httpVersion": "HTTP/1.1", "cookies": [], "headers": [], "content": {"size": 0, "mimeType": ""}, "redirectURL": "", "headersSize": -1, "bodySize": 0},
+      "cache": {},
+      "timings": {"send": 0, "wait": 10, "receive": 0}
+    }]
+  }
+}`
+
+	t.Run("auto detected", func(t *testing.T) {
+		tmpfile := createTempFile(t, content)
+		defer func() {
+			err := os.Remove(tmpfile)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}()
+
+		entries, err := ReadEntries(&cli.CliArgs{InputFile: tmpfile})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(entries) != 1 {
+			t.Fatalf("expected 1 entry, got %d", len(entries))
+		}
+
+		if entries[0].Path != "/search?q=go" || entries[0].Status != 200 {
+			t.Errorf("unexpected entry: %+v", entries[0])
+		}
+	})
+
+	t.Run("forced jsonl format does not parse HAR", func(t *testing.T) {
+		tmpfile := createTempFile(t, content)
+		defer func() {
+			err := os.Remove(tmpfile)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}()
+
+		entries, err := ReadEntries(&cli.CliArgs{InputFile: tmpfile, InputFormat: FormatJSONL})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(entries) != 0 {
+			t.Errorf("expected no entries, got %d", len(entries))
+		}
+	})
+}
+
 func TestDryRun(t *testing.T) {
 	t.Run("valid file", func(t *testing.T) {
 		content := `{"method":"GET","path":"/test1","headers":{},"body":""}
@@ -273,7 +377,7 @@ func TestParseEntries(t *testing.T) {
 `
 		reader := strings.NewReader(content)
 
-		entries, err := parseEntries(reader, 0, false)
+		entries, err := parseEntries(reader, 0, false, nil)
 
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
@@ -291,7 +395,7 @@ func TestParseEntries(t *testing.T) {
 `
 		reader := strings.NewReader(content)
 
-		entries, err := parseEntries(reader, 2, false)
+		entries, err := parseEntries(reader, 2, false, nil)
 
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
@@ -307,7 +411,7 @@ func TestParseEntries(t *testing.T) {
 `
 		reader := strings.NewReader(content)
 
-		entries, err := parseEntries(reader, 0, true)
+		entries, err := parseEntries(reader, 0, true, nil)
 
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
@@ -327,7 +431,7 @@ also invalid
 `
 		reader := strings.NewReader(content)
 
-		entries, err := parseEntries(reader, 0, false)
+		entries, err := parseEntries(reader, 0, false, nil)
 
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
@@ -350,10 +454,30 @@ also invalid
 		}
 	})
 
+	t.Run("lines over 64KB", func(t *testing.T) {
+		body := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("x"), 200*1024))
+		content := `{"method":"POST","path":"/upload","headers":{},"body":"` + body + `"}
+{"method":"GET","path":"/after","headers":{},"body":""}
+`
+		tmpfile := createTempFile(t, content)
+		defer func() {
+			_ = os.Remove(tmpfile)
+		}()
+
+		entries, err := ReadEntries(&cli.CliArgs{InputFile: tmpfile})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(entries) != 2 || len(entries[0].DecodedBody()) != 200*1024 {
+			t.Errorf("expected both entries with the whole body, got %d", len(entries))
+		}
+	})
+
 	t.Run("empty input", func(t *testing.T) {
 		reader := strings.NewReader("")
 
-		entries, err := parseEntries(reader, 0, false)
+		entries, err := parseEntries(reader, 0, false, nil)
 
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
@@ -0,0 +1,184 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ExpandPaths resolves an --input-file value into the files to read. "-"
+// stands for stdin, a directory expands to the regular files it holds and
+// a glob expands to its matches. Hidden files are skipped.
+func ExpandPaths(pattern string) ([]string, error) {
+	if pattern == "-" {
+		return []string{pattern}, nil
+	}
+
+	info, err := os.Stat(pattern)
+	switch {
+	case err == nil && info.IsDir():
+		return directoryFiles(pattern)
+	case err == nil:
+		return []string{pattern}, nil
+	case !strings.ContainsAny(pattern, "*?["):
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input pattern %q: %w", pattern, err)
+	}
+
+	var paths []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() && !hidden(match) {
+			paths = append(paths, match)
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no input files match %s", pattern)
+	}
+
+	return paths, nil
+}
+
+func directoryFiles(dir string) ([]string, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var paths []string
+	for _, entry := range dirEntries {
+		if entry.Type().IsRegular() && !hidden(entry.Name()) {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no input files in directory %s", dir)
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func hidden(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
+
+type source struct {
+	io.Reader
+	closers []func() error
+}
+
+func (s *source) Close() error {
+	var first error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i](); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// Open opens path for reading, "-" being stdin, and transparently
+// decompresses gzip and zstd content based on its magic bytes.
+func Open(path string) (io.ReadCloser, error) {
+	src := &source{}
+	if path == "-" {
+		src.Reader = os.Stdin
+	} else {
+		file, err := os.Open(path) // #nosec G304
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file: %w", err)
+		}
+
+		src.Reader = file
+		src.closers = append(src.closers, file.Close)
+	}
+
+	br := bufio.NewReaderSize(src.Reader, sniffSize)
+	magic, _ := br.Peek(len(zstdMagic))
+	src.Reader = br
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			_ = src.Close()
+			return nil, fmt.Errorf("failed to read gzip stream: %w", err)
+		}
+
+		src.Reader = gz
+		src.closers = append(src.closers, gz.Close)
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			_ = src.Close()
+			return nil, fmt.Errorf("failed to read zstd stream: %w", err)
+		}
+
+		src.Reader = zr
+		src.closers = append(src.closers, func() error {
+			zr.Close()
+			return nil
+		})
+	}
+
+	return src, nil
+}
+
+// mergeByTimestamp interleaves entries read from several files. Every file
+// is assumed to be in order already; entries without a timestamp are kept
+// in place relative to the rest of their file.
+func mergeByTimestamp(files [][]models.LogEntry) []models.LogEntry {
+	total := 0
+	for _, entries := range files {
+		total += len(entries)
+	}
+
+	merged := make([]models.LogEntry, 0, total)
+	heads := make([]int, len(files))
+
+	for len(merged) < total {
+		best := -1
+		for i, entries := range files {
+			if heads[i] >= len(entries) {
+				continue
+			}
+
+			ts := entries[heads[i]].Timestamp
+			if ts.IsZero() {
+				best = i
+				break
+			}
+
+			if best < 0 || ts.Before(files[best][heads[best]].Timestamp) {
+				best = i
+			}
+		}
+
+		merged = append(merged, files[best][heads[best]])
+		heads[best]++
+	}
+
+	return merged
+}
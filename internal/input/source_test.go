@@ -0,0 +1,151 @@
+package input
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/kx0101/replayer/internal/cli"
+)
+
+func gzipData(t *testing.T, data string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatalf("failed to write gzip: %v", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to close gzip: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func zstdData(t *testing.T, data string) []byte {
+	t.Helper()
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("failed to create zstd encoder: %v", err)
+	}
+	defer func() { _ = enc.Close() }()
+
+	return enc.EncodeAll([]byte(data), nil)
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestReadEntries_Sources(t *testing.T) {
+	nginx := `10.0.0.1 - - [10/Dec/2024:14:23:47 +0000] "GET /c HTTP/1.1" 200 2 "-" "curl"
+10.0.0.1 - - [10/Dec/2024:14:23:49 +0000] "GET /e HTTP/1.1" 200 2 "-" "curl"
+`
+	rotated := `10.0.0.1 - - [10/Dec/2024:14:23:45 +0000] "GET /a HTTP/1.1" 200 2 "-" "curl"
+10.0.0.1 - - [10/Dec/2024:14:23:48 +0000] "GET /d HTTP/1.1" 200 2 "-" "curl"
+`
+	older := `10.0.0.1 - - [10/Dec/2024:14:23:46 +0000] "GET /b HTTP/1.1" 200 2 "-" "curl"
+`
+
+	paths := func(t *testing.T, args *cli.CliArgs) []string {
+		t.Helper()
+
+		entries, err := ReadEntries(args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Path)
+		}
+
+		return got
+	}
+
+	t.Run("gzip and zstd files", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "access.log.gz"), gzipData(t, nginx))
+		writeFile(t, filepath.Join(dir, "access.log.zst"), zstdData(t, nginx))
+
+		for _, name := range []string{"access.log.gz", "access.log.zst"} {
+			got := paths(t, &cli.CliArgs{InputFile: filepath.Join(dir, name)})
+			if len(got) != 2 || got[0] != "/c" || got[1] != "/e" {
+				t.Errorf("%s: unexpected entries %v", name, got)
+			}
+		}
+	})
+
+	t.Run("directory of rotated logs merged by timestamp", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "access.log"), []byte(nginx))
+		writeFile(t, filepath.Join(dir, "access.log.1"), []byte(rotated))
+		writeFile(t, filepath.Join(dir, "access.log.2.gz"), gzipData(t, older))
+		writeFile(t, filepath.Join(dir, ".access.log.swp"), []byte("garbage"))
+
+		got := paths(t, &cli.CliArgs{InputFile: dir})
+		want := []string{"/a", "/b", "/c", "/d", "/e"}
+		if len(got) != len(want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		}
+
+		limited := paths(t, &cli.CliArgs{InputFile: dir, Limit: 2})
+		if len(limited) != 2 || limited[1] != "/b" {
+			t.Errorf("expected limit after merge, got %v", limited)
+		}
+	})
+
+	t.Run("glob", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "access.log"), []byte(nginx))
+		writeFile(t, filepath.Join(dir, "access.log.1"), []byte(rotated))
+		writeFile(t, filepath.Join(dir, "other.log"), []byte(older))
+
+		got := paths(t, &cli.CliArgs{InputFile: filepath.Join(dir, "access.log*")})
+		if len(got) != 4 || got[0] != "/a" || got[3] != "/e" {
+			t.Errorf("unexpected entries %v", got)
+		}
+
+		if _, err := ReadEntries(&cli.CliArgs{InputFile: filepath.Join(dir, "missing*")}); err == nil {
+			t.Error("expected error for a glob without matches")
+		}
+	})
+
+	t.Run("stdin", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("failed to create pipe: %v", err)
+		}
+
+		stdin := os.Stdin
+		os.Stdin = r
+		defer func() { os.Stdin = stdin }()
+
+		go func() {
+			_, _ = w.Write(gzipData(t, `{"method":"GET","path":"/stdin"}`+"\n"))
+			_ = w.Close()
+		}()
+
+		got := paths(t, &cli.CliArgs{InputFile: "-"})
+		if len(got) != 1 || got[0] != "/stdin" {
+			t.Errorf("unexpected entries %v", got)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"encoding/base64"
+)
+
+// Body encodings for LogEntry.BodyEncoding. Both the request and response
+// body of an entry use the same encoding.
+const (
+	BodyEncodingBase64 = "base64"
+	BodyEncodingText   = "text"
+)
+
+// DecodeBody decodes a body written without a body_encoding. Such bodies
+// are base64 when they decode as base64 and raw text otherwise.
+func DecodeBody(body string) []byte {
+	if body == "" || body == "null" {
+		return nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return []byte(body)
+	}
+
+	return b
+}
+
+// DecodeBodyAs decodes a body stored with the given encoding, falling back
+// to DecodeBody when the encoding is empty.
+func DecodeBodyAs(body, encoding string) []byte {
+	switch encoding {
+	case BodyEncodingBase64:
+		if body == "" {
+			return nil
+		}
+
+		b, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return []byte(body)
+		}
+
+		return b
+	case BodyEncodingText:
+		if body == "" {
+			return nil
+		}
+
+		return []byte(body)
+	default:
+		return DecodeBody(body)
+	}
+}
+
+// DecodedBody returns the decoded request body.
+func (e *LogEntry) DecodedBody() []byte {
+	return DecodeBodyAs(e.Body, e.BodyEncoding)
+}
+
+// DecodedResponseBody returns the decoded recorded response body.
+func (e *LogEntry) DecodedResponseBody() []byte {
+	return DecodeBodyAs(e.ResponseBody, e.BodyEncoding)
+}
+
+// SetBodies stores both bodies base64 encoded and records the encoding.
+func (e *LogEntry) SetBodies(body, responseBody []byte) {
+	e.Body = encodeBase64(body)
+	e.ResponseBody = encodeBase64(responseBody)
+	e.BodyEncoding = BodyEncodingBase64
+}
+
+func encodeBase64(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecodeBodyAs(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		encoding string
+		want     string
+	}{
+		{"legacy base64", "aGVsbG8=", "", "hello"},
+		{"legacy raw", "hello world", "", "hello world"},
+		{"text that looks like base64", "abcd", BodyEncodingText, "abcd"},
+		{"explicit base64", "aGVsbG8=", BodyEncodingBase64, "hello"},
+		{"empty", "", BodyEncodingBase64, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(DecodeBodyAs(tt.body, tt.encoding)); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	var entry LogEntry
+	entry.SetBodies([]byte("abcd"), nil)
+	if entry.BodyEncoding != BodyEncodingBase64 || string(entry.DecodedBody()) != "abcd" || entry.ResponseBody != "" {
+		t.Errorf("unexpected entry after SetBodies: %+v", entry)
+	}
+}
+
+func TestFileHeader(t *testing.T) {
+	early := time.Date(2024, 12, 10, 14, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+
+	header := NewFileHeader("capture", []LogEntry{{Timestamp: late}, {}, {Timestamp: early}})
+	if header.Format != FormatVersion || !header.Start.Equal(early) || !header.End.Equal(late) {
+		t.Errorf("unexpected header: %+v", header)
+	}
+
+	if _, ok, _ := ParseFileHeader([]byte(`{"method":"GET","path":"/"}`)); ok {
+		t.Error("expected an entry not to be a header")
+	}
+
+	if h, ok, err := ParseFileHeader([]byte(`{"replayer_format":1,"source":"import:curl"}`)); !ok || err != nil || h.Source != "import:curl" {
+		t.Errorf("expected a header, got %+v %v %v", h, ok, err)
+	}
+
+	if _, ok, err := ParseFileHeader([]byte(`{"replayer_format":2}`)); !ok || err == nil {
+		t.Error("expected an error for a newer format version")
+	}
+}
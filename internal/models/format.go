@@ -0,0 +1,68 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// FormatVersion is the traffic file format version written by this build.
+const FormatVersion = 1
+
+// FileHeader is the optional first record of a traffic file. Readers skip
+// it, so files with and without a header are read the same way.
+type FileHeader struct {
+	Format      int        `json:"replayer_format"`
+	Source      string     `json:"source,omitempty"`
+	CaptureHost string     `json:"capture_host,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Start       *time.Time `json:"start,omitempty"`
+	End         *time.Time `json:"end,omitempty"`
+}
+
+// NewFileHeader describes entries produced by source. The time range is
+// left empty when no entry has a timestamp.
+func NewFileHeader(source string, entries []LogEntry) FileHeader {
+	header := FileHeader{Format: FormatVersion, Source: source, CreatedAt: time.Now().UTC()}
+	if host, err := os.Hostname(); err == nil {
+		header.CaptureHost = host
+	}
+
+	for _, entry := range entries {
+		if entry.Timestamp.IsZero() {
+			continue
+		}
+
+		ts := entry.Timestamp
+		if header.Start == nil || ts.Before(*header.Start) {
+			header.Start = &ts
+		}
+
+		if header.End == nil || ts.After(*header.End) {
+			header.End = &ts
+		}
+	}
+
+	return header
+}
+
+// ParseFileHeader reports whether line is a header record. Headers from a
+// newer format version are rejected.
+func ParseFileHeader(line []byte) (*FileHeader, bool, error) {
+	if !bytes.Contains(line, []byte(`"replayer_format"`)) {
+		return nil, false, nil
+	}
+
+	var header FileHeader
+	if err := json.Unmarshal(line, &header); err != nil || header.Format == 0 {
+		return nil, false, nil
+	}
+
+	if header.Format > FormatVersion {
+		return &header, true, fmt.Errorf("unsupported traffic file format version %d (this build reads up to %d)", header.Format, FormatVersion)
+	}
+
+	return &header, true, nil
+}
@@ -14,6 +14,104 @@ type LogEntry struct {
 	ResponseBody    string              `json:"response_body"`
 	Timestamp       time.Time           `json:"timestamp"`
 	LatencyMs       int64               `json:"latency_ms"`
+	// BodyEncoding is how Body and ResponseBody are stored. Entries
+	// written before it existed leave it empty; see DecodeBody.
+	BodyEncoding string `json:"body_encoding,omitempty"`
+	// WebSocket holds the messages of an upgraded WebSocket session, and
+	// WebSocketTruncated marks sessions the capture proxy stopped recording
+	// at its size limit.
+	WebSocket          []WebSocketMessage `json:"websocket,omitempty"`
+	WebSocketTruncated bool               `json:"websocket_truncated,omitempty"`
+	// GRPC holds the status of a gRPC call. Status is then the HTTP
+	// status the gRPC code maps to.
+	GRPC *GRPCStatus `json:"grpc,omitempty"`
+	// Timing breaks LatencyMs down for entries recorded by the capture
+	// proxy.
+	Timing *Timing `json:"timing,omitempty"`
+	// BodyTruncated and ResponseBodyTruncated mark bodies the capture
+	// proxy cut at its size limit; BodySize and ResponseBodySize are then
+	// their full size in bytes.
+	BodyTruncated         bool  `json:"body_truncated,omitempty"`
+	BodySize              int64 `json:"body_size,omitempty"`
+	ResponseBodyTruncated bool  `json:"response_body_truncated,omitempty"`
+	ResponseBodySize      int64 `json:"response_body_size,omitempty"`
+	// Host, RemoteAddr, Proto, TLS and Trailers describe the original
+	// client request. Only the capture proxy records them.
+	Host       string              `json:"host,omitempty"`
+	RemoteAddr string              `json:"remote_addr,omitempty"`
+	Proto      string              `json:"proto,omitempty"`
+	TLS        *TLSInfo            `json:"tls,omitempty"`
+	Trailers   map[string][]string `json:"trailers,omitempty"`
+	// Chunks time the pieces of a server-sent event stream as the
+	// upstream sent them, up to the recorded size.
+	Chunks []Chunk `json:"chunks,omitempty"`
+	// Error is set when the exchange did not complete: the upstream
+	// failed or the client went away. Status is then what the capture
+	// proxy answered, 502, or 499 when the client aborted first.
+	Error string `json:"error,omitempty"`
+	// Upstream is the URL the capture proxy forwarded the request to, and
+	// Tag the name of its upstream route.
+	Upstream string `json:"upstream,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+	// Fault is set on exchanges the capture proxy injected faults into.
+	Fault *Fault `json:"fault,omitempty"`
+}
+
+// Fault is what the fault injection proxy did to an exchange: it added
+// DelayMs before forwarding the request, and Type, when set, is the
+// failure it caused: an error Status instead of the upstream's answer, a
+// connection reset, or a response truncated after TruncatedAt bytes.
+type Fault struct {
+	Rule        string `json:"rule,omitempty"`
+	DelayMs     int64  `json:"delay_ms,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	TruncatedAt int64  `json:"truncated_at,omitempty"`
+}
+
+// Chunk is a piece of a streamed response body. OffsetMs is the time since
+// the response headers arrived.
+type Chunk struct {
+	OffsetMs int64 `json:"offset_ms"`
+	Size     int   `json:"size"`
+}
+
+// Timing is the upstream part of a captured exchange, in milliseconds.
+// DNS, connect and TLS are zero when the proxy reused a connection.
+type Timing struct {
+	DNSMs     int64 `json:"dns_ms"`
+	ConnectMs int64 `json:"connect_ms"`
+	TLSMs     int64 `json:"tls_ms"`
+	// TTFBMs runs from sending the request to the first response byte.
+	TTFBMs int64 `json:"ttfb_ms"`
+	// UpstreamMs runs from sending the request to the end of the response
+	// body, leaving out the time spent between the client and the proxy.
+	UpstreamMs int64 `json:"upstream_ms"`
+	Reused     bool  `json:"reused"`
+}
+
+// UpstreamLatencyMs is the latency of the service itself: the upstream
+// time for captured entries, LatencyMs otherwise.
+func (e LogEntry) UpstreamLatencyMs() int64 {
+	if e.Timing != nil {
+		return e.Timing.UpstreamMs
+	}
+
+	return e.LatencyMs
+}
+
+// TLSInfo is the TLS connection state of a captured request.
+type TLSInfo struct {
+	Version            string `json:"version"`
+	CipherSuite        string `json:"cipher_suite"`
+	ServerName         string `json:"server_name,omitempty"`
+	NegotiatedProtocol string `json:"negotiated_protocol,omitempty"`
+}
+
+// GRPCStatus is the grpc-status code and grpc-message of a gRPC response.
+type GRPCStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
 }
 
 type ReplayResult struct {
@@ -29,6 +127,7 @@ type MultiEnvResult struct {
 	Request   LogEntry
 	Responses map[string]ReplayResult
 	RequestID string
+	Route     string        `json:"route,omitempty"`
 	Diff      *ResponseDiff `json:"diff,omitempty"`
 }
 
@@ -48,6 +147,7 @@ type Summary struct {
 	Failed        int                    `json:"failed"`
 	Latency       LatencyStats           `json:"latency"`
 	ByTarget      map[string]TargetStats `json:"by_target"`
+	ByRoute       map[string]RouteStats  `json:"by_route,omitempty"`
 }
 
 type LatencyStats struct {
@@ -66,10 +166,20 @@ type TargetStats struct {
 	Latency   LatencyStats `json:"latency"`
 }
 
+// RouteStats counts requests (not per-target responses) for one route; a
+// request failed when any target returned an error or a status >= 400.
+type RouteStats struct {
+	Requests int          `json:"requests"`
+	Failed   int          `json:"failed"`
+	Diffs    int          `json:"diffs"`
+	Latency  LatencyStats `json:"latency"`
+}
+
 type AggregatedStats struct {
 	TotalRequests int
 	Succeeded     int
 	Failed        int
 	Latencies     []int64
 	TargetStats   map[string]*TargetStats
+	RouteStats    map[string]*RouteStats
 }
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/base64"
+)
+
+// WebSocket message directions and types.
+const (
+	DirectionClient = "client"
+	DirectionServer = "server"
+
+	MessageText   = "text"
+	MessageBinary = "binary"
+	MessageClose  = "close"
+)
+
+// WebSocketMessage is one message of a captured WebSocket session. Text
+// and close payloads are stored as is, binary payloads base64 encoded.
+type WebSocketMessage struct {
+	Direction string `json:"direction"`
+	Type      string `json:"type"`
+	Data      string `json:"data"`
+	// OffsetMs is the time since the handshake completed.
+	OffsetMs int64 `json:"offset_ms"`
+}
+
+// Payload returns the raw message payload.
+func (m WebSocketMessage) Payload() []byte {
+	if m.Type == MessageBinary {
+		if b, err := base64.StdEncoding.DecodeString(m.Data); err == nil {
+			return b
+		}
+	}
+
+	return []byte(m.Data)
+}
+
+// NewWebSocketMessage records a payload, base64 encoding binary messages.
+func NewWebSocketMessage(direction, messageType string, payload []byte, offsetMs int64) WebSocketMessage {
+	data := string(payload)
+	if messageType == MessageBinary {
+		data = base64.StdEncoding.EncodeToString(payload)
+	}
+
+	return WebSocketMessage{Direction: direction, Type: messageType, Data: data, OffsetMs: offsetMs}
+}
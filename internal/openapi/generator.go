@@ -0,0 +1,398 @@
+package openapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+type operation struct {
+	method string
+	path   string
+	op     *Operation
+	params []*Parameter
+	weight int
+}
+
+type Generator struct {
+	doc      *Document
+	rng      *rand.Rand
+	ops      []*operation
+	total    int
+	basePath string
+	host     string
+}
+
+// NewGenerator prepares weighted operations from doc. Weights come from the
+// x-replayer-weight extension and can be overridden by weights, keyed by
+// operationId or "METHOD /path". A weight of 0 excludes an operation.
+func NewGenerator(doc *Document, seed int64, weights map[string]int) (*Generator, error) {
+	g := &Generator{
+		doc: doc,
+		rng: rand.New(rand.NewSource(seed)), // #nosec G404 -- reproducible test data
+	}
+
+	if base := doc.BaseURL(); base != "" {
+		u, err := url.Parse(base)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server URL %q: %w", base, err)
+		}
+
+		g.basePath = strings.TrimSuffix(u.Path, "/")
+		g.host = u.Host
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	used := make(map[string]bool, len(weights))
+	for _, path := range paths {
+		item := doc.Paths[path]
+		ops := item.operations()
+
+		for _, method := range []string{"GET", "PUT", "POST", "DELETE", "OPTIONS", "HEAD", "PATCH", "TRACE"} {
+			op := ops[method]
+			if op == nil {
+				continue
+			}
+
+			weight := 1
+			if op.Weight != nil {
+				weight = *op.Weight
+			}
+
+			for _, key := range []string{op.OperationID, method + " " + path} {
+				if w, ok := weights[key]; ok && key != "" {
+					weight = w
+					used[key] = true
+				}
+			}
+
+			if weight <= 0 {
+				continue
+			}
+
+			params, err := g.mergeParameters(item.Parameters, op.Parameters)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+
+			g.ops = append(g.ops, &operation{method: method, path: path, op: op, params: params, weight: weight})
+			g.total += weight
+		}
+	}
+
+	for key := range weights {
+		if !used[key] {
+			return nil, fmt.Errorf("weight for unknown operation %q", key)
+		}
+	}
+
+	if len(g.ops) == 0 {
+		return nil, fmt.Errorf("no operations to generate")
+	}
+
+	return g, nil
+}
+
+// mergeParameters applies operation level parameters over path level ones,
+// matching on name and location.
+func (g *Generator) mergeParameters(pathParams, opParams []*Parameter) ([]*Parameter, error) {
+	var merged []*Parameter
+	index := make(map[string]int)
+
+	for _, p := range append(append([]*Parameter{}, pathParams...), opParams...) {
+		resolved, err := g.doc.resolveParameter(p)
+		if err != nil {
+			return nil, err
+		}
+
+		key := resolved.In + ":" + resolved.Name
+		if i, ok := index[key]; ok {
+			merged[i] = resolved
+			continue
+		}
+
+		index[key] = len(merged)
+		merged = append(merged, resolved)
+	}
+
+	return merged, nil
+}
+
+func (g *Generator) Generate(n int) ([]models.LogEntry, error) {
+	entries := make([]models.LogEntry, 0, n)
+	for range n {
+		entry, err := g.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (g *Generator) Next() (models.LogEntry, error) {
+	roll := g.rng.Intn(g.total)
+	op := g.ops[len(g.ops)-1]
+	for _, candidate := range g.ops {
+		if roll < candidate.weight {
+			op = candidate
+			break
+		}
+
+		roll -= candidate.weight
+	}
+
+	entry, err := g.build(op)
+	if err != nil {
+		return models.LogEntry{}, fmt.Errorf("%s %s: %w", op.method, op.path, err)
+	}
+
+	return entry, nil
+}
+
+func (g *Generator) build(op *operation) (models.LogEntry, error) {
+	path := op.path
+	query := url.Values{}
+	headers := make(map[string][]string)
+	var cookies []string
+
+	for _, p := range op.params {
+		if !p.Required && p.In != "path" && g.rng.Intn(2) == 0 {
+			continue
+		}
+
+		v, err := g.parameterValue(p)
+		if err != nil {
+			return models.LogEntry{}, fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+
+		switch p.In {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(simpleString(v)))
+		case "query":
+			addQuery(query, p.Name, v, p.Explode == nil || *p.Explode)
+		case "header":
+			headers[textproto.CanonicalMIMEHeaderKey(p.Name)] = []string{simpleString(v)}
+		case "cookie":
+			cookies = append(cookies, p.Name+"="+simpleString(v))
+		}
+	}
+
+	if len(cookies) > 0 {
+		headers["Cookie"] = []string{strings.Join(cookies, "; ")}
+	}
+
+	if g.host != "" {
+		headers["Host"] = []string{g.host}
+	}
+
+	entry := models.LogEntry{
+		BodyEncoding: models.BodyEncodingBase64,
+		Method:       op.method,
+		Path:         g.basePath + path,
+		Headers:      headers,
+	}
+
+	if encoded := query.Encode(); encoded != "" {
+		entry.Path += "?" + encoded
+	}
+
+	body, contentType, err := g.body(op.op.RequestBody)
+	if err != nil {
+		return models.LogEntry{}, fmt.Errorf("request body: %w", err)
+	}
+
+	if body != nil {
+		entry.Body = base64.StdEncoding.EncodeToString(body)
+		headers["Content-Type"] = []string{contentType}
+	}
+
+	return entry, nil
+}
+
+func (g *Generator) parameterValue(p *Parameter) (any, error) {
+	if p.Example != nil {
+		return p.Example, nil
+	}
+
+	if v, ok, err := g.pickExample(p.Examples); ok || err != nil {
+		return v, err
+	}
+
+	return g.value(p.Schema, 0)
+}
+
+func (g *Generator) pickExample(examples map[string]*Example) (any, bool, error) {
+	if len(examples) == 0 {
+		return nil, false, nil
+	}
+
+	names := make([]string, 0, len(examples))
+	for name := range examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	example, err := g.doc.resolveExample(examples[names[g.rng.Intn(len(names))]])
+	if err != nil {
+		return nil, false, err
+	}
+
+	return example.Value, true, nil
+}
+
+// mediaTypePreference lists the request content types a body can be
+// generated for, most preferred first.
+var mediaTypePreference = []string{"application/json", "+json", "application/x-www-form-urlencoded", "text/plain", "*/*"}
+
+func (g *Generator) body(rb *RequestBody) ([]byte, string, error) {
+	rb, err := g.doc.resolveRequestBody(rb)
+	if err != nil || rb == nil || len(rb.Content) == 0 {
+		return nil, "", err
+	}
+
+	contentType := ""
+	for _, preferred := range mediaTypePreference {
+		for ct := range rb.Content {
+			if ct == preferred || (strings.HasPrefix(preferred, "+") && strings.HasSuffix(ct, preferred)) {
+				if contentType == "" || ct < contentType {
+					contentType = ct
+				}
+			}
+		}
+
+		if contentType != "" {
+			break
+		}
+	}
+
+	if contentType == "" {
+		if !rb.Required {
+			return nil, "", nil
+		}
+
+		return nil, "", fmt.Errorf("no supported content type (json, form or text)")
+	}
+
+	media := rb.Content[contentType]
+
+	var v any
+	var ok bool
+	if media.Example != nil {
+		v, ok = media.Example, true
+	} else if v, ok, err = g.pickExample(media.Examples); err != nil {
+		return nil, "", err
+	}
+
+	if !ok {
+		if v, err = g.value(media.Schema, 0); err != nil {
+			return nil, "", err
+		}
+	}
+
+	switch contentType {
+	case "application/x-www-form-urlencoded":
+		form := url.Values{}
+		if obj, isObj := v.(map[string]any); isObj {
+			keys := make([]string, 0, len(obj))
+			for k := range obj {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				addQuery(form, k, obj[k], true)
+			}
+		}
+
+		return []byte(form.Encode()), contentType, nil
+	case "text/plain":
+		return []byte(simpleString(v)), contentType, nil
+	case "*/*":
+		contentType = "application/json"
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, contentType, nil
+}
+
+func addQuery(q url.Values, name string, v any, explode bool) {
+	switch val := v.(type) {
+	case []any:
+		if !explode {
+			q.Add(name, simpleString(val))
+			return
+		}
+
+		for _, item := range val {
+			q.Add(name, simpleString(item))
+		}
+	case map[string]any:
+		if !explode {
+			q.Add(name, simpleString(val))
+			return
+		}
+
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			q.Add(k, simpleString(val[k]))
+		}
+	default:
+		q.Add(name, simpleString(val))
+	}
+}
+
+// simpleString serializes a value with the OpenAPI "simple" style.
+func simpleString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []any:
+		parts := make([]string, len(val))
+		for i, item := range val {
+			parts[i] = simpleString(item)
+		}
+
+		return strings.Join(parts, ",")
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		parts := make([]string, 0, len(val)*2)
+		for _, k := range keys {
+			parts = append(parts, k, simpleString(val[k]))
+		}
+
+		return strings.Join(parts, ",")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(val)
+	}
+}
@@ -0,0 +1,244 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+const petstore = `
+openapi: 3.0.3
+servers:
+  - url: https://{env}.example.com/v1
+    variables:
+      env:
+        default: api
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      x-replayer-weight: 3
+      parameters:
+        - name: limit
+          in: query
+          required: true
+          schema: {type: integer, minimum: 1, maximum: 50}
+        - $ref: '#/components/parameters/RequestID'
+    post:
+      operationId: createPet
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/NewPet'}
+  /pets/{petId}:
+    parameters:
+      - name: petId
+        in: path
+        required: true
+        schema: {type: string, format: uuid}
+    put:
+      operationId: updatePet
+      requestBody:
+        content:
+          application/json:
+            examples:
+              rex:
+                $ref: '#/components/examples/Rex'
+    delete:
+      operationId: deletePet
+      x-replayer-weight: 0
+components:
+  parameters:
+    RequestID:
+      name: X-Request-ID
+      in: header
+      required: true
+      schema: {type: string, pattern: '^req-[0-9a-f]{8}$'}
+  examples:
+    Rex:
+      value: {name: Rex, tag: dog}
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        id: {type: integer, readOnly: true}
+        name: {type: string, minLength: 2, maxLength: 10}
+        tag: {type: string, enum: [dog, cat]}
+    NewPet:
+      allOf:
+        - $ref: '#/components/schemas/Pet'
+        - type: object
+          required: [age, owner]
+          properties:
+            age: {type: integer, minimum: 0, exclusiveMinimum: true, maximum: 30}
+            weight: {type: number, multipleOf: 0.5, minimum: 1, maximum: 40}
+            owner:
+              type: object
+              required: [email, tags]
+              properties:
+                email: {type: string, format: email}
+                tags: {type: array, minItems: 2, maxItems: 2, items: {type: string}}
+`
+
+func newTestGenerator(t *testing.T, seed int64, weights map[string]int) *Generator {
+	t.Helper()
+
+	doc, err := Parse([]byte(petstore))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	g, err := NewGenerator(doc, seed, weights)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return g
+}
+
+func TestGenerator_SchemaValid(t *testing.T) {
+	entries, err := newTestGenerator(t, 42, nil).Generate(200)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	counts := make(map[string]int)
+	uuidRegex := regexp.MustCompile(`^/v1/pets/[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	for _, entry := range entries {
+		if entry.Headers["Host"][0] != "api.example.com" {
+			t.Fatalf("expected host from server URL, got %v", entry.Headers["Host"])
+		}
+
+		switch {
+		case entry.Method == "GET":
+			counts["list"]++
+			if !strings.HasPrefix(entry.Path, "/v1/pets?limit=") {
+				t.Errorf("unexpected path: %s", entry.Path)
+			}
+
+			if !regexp.MustCompile(`^req-[0-9a-f]{8}$`).MatchString(entry.Headers["X-Request-Id"][0]) {
+				t.Errorf("header does not match pattern: %v", entry.Headers["X-Request-Id"])
+			}
+		case entry.Method == "POST":
+			counts["create"]++
+			checkNewPet(t, entry)
+		case entry.Method == "PUT":
+			counts["update"]++
+			if !uuidRegex.MatchString(entry.Path) {
+				t.Errorf("unexpected path: %s", entry.Path)
+			}
+
+			if string(models.DecodeBody(entry.Body)) != `{"name":"Rex","tag":"dog"}` {
+				t.Errorf("expected example body, got %s", models.DecodeBody(entry.Body))
+			}
+		default:
+			t.Errorf("unexpected method %s, zero weight operations must be skipped", entry.Method)
+		}
+	}
+
+	if counts["list"] < counts["create"] || counts["list"] < counts["update"] {
+		t.Errorf("expected listPets to dominate with weight 3, got %v", counts)
+	}
+}
+
+func checkNewPet(t *testing.T, entry models.LogEntry) {
+	t.Helper()
+
+	if entry.Headers["Content-Type"][0] != "application/json" {
+		t.Errorf("unexpected content type: %v", entry.Headers["Content-Type"])
+	}
+
+	var pet struct {
+		ID     *int     `json:"id"`
+		Name   string   `json:"name"`
+		Tag    *string  `json:"tag"`
+		Age    int      `json:"age"`
+		Weight *float64 `json:"weight"`
+		Owner  struct {
+			Email string   `json:"email"`
+			Tags  []string `json:"tags"`
+		} `json:"owner"`
+	}
+
+	if err := json.Unmarshal(models.DecodeBody(entry.Body), &pet); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+
+	if pet.ID != nil {
+		t.Error("readOnly property must not be generated")
+	}
+
+	if len(pet.Name) < 2 || len(pet.Name) > 10 {
+		t.Errorf("name violates length bounds: %q", pet.Name)
+	}
+
+	if pet.Tag != nil && *pet.Tag != "dog" && *pet.Tag != "cat" {
+		t.Errorf("tag not in enum: %s", *pet.Tag)
+	}
+
+	if pet.Age < 1 || pet.Age > 30 {
+		t.Errorf("age out of range: %d", pet.Age)
+	}
+
+	if pet.Weight != nil && (*pet.Weight < 1 || *pet.Weight > 40 || *pet.Weight*2 != float64(int(*pet.Weight*2))) {
+		t.Errorf("weight violates constraints: %v", *pet.Weight)
+	}
+
+	if !strings.HasSuffix(pet.Owner.Email, "@example.com") || len(pet.Owner.Tags) != 2 {
+		t.Errorf("unexpected owner: %+v", pet.Owner)
+	}
+}
+
+func TestGenerator_Seed(t *testing.T) {
+	a, err := newTestGenerator(t, 7, nil).Generate(20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := newTestGenerator(t, 7, nil).Generate(20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		t.Error("expected identical traffic for the same seed")
+	}
+
+	c, err := newTestGenerator(t, 8, nil).Generate(20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if reflect.DeepEqual(a, c) {
+		t.Error("expected different traffic for a different seed")
+	}
+}
+
+func TestGenerator_Weights(t *testing.T) {
+	entries, err := newTestGenerator(t, 1, map[string]int{"listPets": 0, "PUT /pets/{petId}": 0, "deletePet": 1}).Generate(10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, entry := range entries {
+		if entry.Method != "POST" && entry.Method != "DELETE" {
+			t.Errorf("unexpected operation %s %s", entry.Method, entry.Path)
+		}
+	}
+
+	doc, _ := Parse([]byte(petstore))
+	if _, err := NewGenerator(doc, 1, map[string]int{"getPet": 1}); err == nil {
+		t.Error("expected error for unknown operation weight")
+	}
+
+	if _, err := Parse([]byte("swagger: '2.0'\npaths: {}")); err == nil {
+		t.Error("expected error for Swagger 2.0 document")
+	}
+}
@@ -0,0 +1,272 @@
+package openapi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is the subset of an OpenAPI 3.0/3.1 document needed to generate
+// requests. JSON documents are read through the YAML decoder.
+type Document struct {
+	OpenAPI    string               `yaml:"openapi"`
+	Servers    []Server             `yaml:"servers"`
+	Paths      map[string]*PathItem `yaml:"paths"`
+	Components Components           `yaml:"components"`
+}
+
+type Server struct {
+	URL       string                    `yaml:"url"`
+	Variables map[string]ServerVariable `yaml:"variables"`
+}
+
+type ServerVariable struct {
+	Default string `yaml:"default"`
+}
+
+type Components struct {
+	Schemas       map[string]*Schema      `yaml:"schemas"`
+	Parameters    map[string]*Parameter   `yaml:"parameters"`
+	RequestBodies map[string]*RequestBody `yaml:"requestBodies"`
+	Examples      map[string]*Example     `yaml:"examples"`
+}
+
+type PathItem struct {
+	Parameters []*Parameter `yaml:"parameters"`
+	Get        *Operation   `yaml:"get"`
+	Put        *Operation   `yaml:"put"`
+	Post       *Operation   `yaml:"post"`
+	Delete     *Operation   `yaml:"delete"`
+	Options    *Operation   `yaml:"options"`
+	Head       *Operation   `yaml:"head"`
+	Patch      *Operation   `yaml:"patch"`
+	Trace      *Operation   `yaml:"trace"`
+}
+
+func (p *PathItem) operations() map[string]*Operation {
+	return map[string]*Operation{
+		"GET": p.Get, "PUT": p.Put, "POST": p.Post, "DELETE": p.Delete,
+		"OPTIONS": p.Options, "HEAD": p.Head, "PATCH": p.Patch, "TRACE": p.Trace,
+	}
+}
+
+type Operation struct {
+	OperationID string       `yaml:"operationId"`
+	Parameters  []*Parameter `yaml:"parameters"`
+	RequestBody *RequestBody `yaml:"requestBody"`
+	Weight      *int         `yaml:"x-replayer-weight"`
+}
+
+type Parameter struct {
+	Ref      string              `yaml:"$ref"`
+	Name     string              `yaml:"name"`
+	In       string              `yaml:"in"`
+	Required bool                `yaml:"required"`
+	Explode  *bool               `yaml:"explode"`
+	Schema   *Schema             `yaml:"schema"`
+	Example  any                 `yaml:"example"`
+	Examples map[string]*Example `yaml:"examples"`
+}
+
+type RequestBody struct {
+	Ref      string                `yaml:"$ref"`
+	Required bool                  `yaml:"required"`
+	Content  map[string]*MediaType `yaml:"content"`
+}
+
+type MediaType struct {
+	Schema   *Schema             `yaml:"schema"`
+	Example  any                 `yaml:"example"`
+	Examples map[string]*Example `yaml:"examples"`
+}
+
+type Example struct {
+	Ref   string `yaml:"$ref"`
+	Value any    `yaml:"value"`
+}
+
+type Schema struct {
+	Ref              string             `yaml:"$ref"`
+	Type             SchemaType         `yaml:"type"`
+	Format           string             `yaml:"format"`
+	Enum             []any              `yaml:"enum"`
+	Const            any                `yaml:"const"`
+	Example          any                `yaml:"example"`
+	Examples         []any              `yaml:"examples"`
+	Pattern          string             `yaml:"pattern"`
+	MinLength        *int               `yaml:"minLength"`
+	MaxLength        *int               `yaml:"maxLength"`
+	Minimum          *float64           `yaml:"minimum"`
+	Maximum          *float64           `yaml:"maximum"`
+	ExclusiveMinimum any                `yaml:"exclusiveMinimum"`
+	ExclusiveMaximum any                `yaml:"exclusiveMaximum"`
+	MultipleOf       *float64           `yaml:"multipleOf"`
+	Items            *Schema            `yaml:"items"`
+	MinItems         *int               `yaml:"minItems"`
+	MaxItems         *int               `yaml:"maxItems"`
+	Properties       map[string]*Schema `yaml:"properties"`
+	Required         []string           `yaml:"required"`
+	ReadOnly         bool               `yaml:"readOnly"`
+	AllOf            []*Schema          `yaml:"allOf"`
+	OneOf            []*Schema          `yaml:"oneOf"`
+	AnyOf            []*Schema          `yaml:"anyOf"`
+}
+
+// SchemaType accepts both `type: string` (3.0) and `type: [string, "null"]`
+// (3.1).
+type SchemaType []string
+
+func (t *SchemaType) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*t = SchemaType{node.Value}
+		return nil
+	}
+
+	var types []string
+	if err := node.Decode(&types); err != nil {
+		return err
+	}
+
+	*t = types
+	return nil
+}
+
+// primary returns the first non-null type.
+func (t SchemaType) primary() string {
+	for _, typ := range t {
+		if typ != "null" {
+			return typ
+		}
+	}
+
+	return ""
+}
+
+func Load(path string) (*Document, error) {
+	data, err := os.ReadFile(filepath.Clean(path)) // #nosec G304 -- spec path comes from CLI flags
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAPI document: %w", err)
+	}
+
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q, expected 3.x", doc.OpenAPI)
+	}
+
+	if len(doc.Paths) == 0 {
+		return nil, fmt.Errorf("OpenAPI document has no paths")
+	}
+
+	return &doc, nil
+}
+
+// BaseURL returns the first server URL with its variables set to their
+// defaults.
+func (d *Document) BaseURL() string {
+	if len(d.Servers) == 0 {
+		return ""
+	}
+
+	u := d.Servers[0].URL
+	for name, v := range d.Servers[0].Variables {
+		u = strings.ReplaceAll(u, "{"+name+"}", v.Default)
+	}
+
+	return u
+}
+
+func refName(ref, section string) (string, error) {
+	prefix := "#/components/" + section + "/"
+	if !strings.HasPrefix(ref, prefix) {
+		return "", fmt.Errorf("unsupported $ref %q, only local %s references are supported", ref, section)
+	}
+
+	return strings.ReplaceAll(strings.ReplaceAll(ref[len(prefix):], "~1", "/"), "~0", "~"), nil
+}
+
+func (d *Document) resolveSchema(s *Schema) (*Schema, error) {
+	for depth := 0; s != nil && s.Ref != ""; depth++ {
+		if depth > 32 {
+			return nil, fmt.Errorf("$ref cycle at %s", s.Ref)
+		}
+
+		name, err := refName(s.Ref, "schemas")
+		if err != nil {
+			return nil, err
+		}
+
+		target, ok := d.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown schema %s", s.Ref)
+		}
+
+		s = target
+	}
+
+	return s, nil
+}
+
+func (d *Document) resolveParameter(p *Parameter) (*Parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+
+	name, err := refName(p.Ref, "parameters")
+	if err != nil {
+		return nil, err
+	}
+
+	target, ok := d.Components.Parameters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown parameter %s", p.Ref)
+	}
+
+	return target, nil
+}
+
+func (d *Document) resolveRequestBody(b *RequestBody) (*RequestBody, error) {
+	if b == nil || b.Ref == "" {
+		return b, nil
+	}
+
+	name, err := refName(b.Ref, "requestBodies")
+	if err != nil {
+		return nil, err
+	}
+
+	target, ok := d.Components.RequestBodies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown request body %s", b.Ref)
+	}
+
+	return target, nil
+}
+
+func (d *Document) resolveExample(e *Example) (*Example, error) {
+	if e == nil || e.Ref == "" {
+		return e, nil
+	}
+
+	name, err := refName(e.Ref, "examples")
+	if err != nil {
+		return nil, err
+	}
+
+	target, ok := d.Components.Examples[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown example %s", e.Ref)
+	}
+
+	return target, nil
+}
@@ -0,0 +1,401 @@
+package openapi
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDepth stops optional properties from being generated for deeply
+	// nested or recursive schemas.
+	maxDepth      = 6
+	maxRepeat     = 8
+	letters       = "abcdefghijklmnopqrstuvwxyz"
+	defaultMaxInt = 1000
+)
+
+var words = []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel", "india", "juliet"}
+
+// value builds a random instance of s. Examples, const and enum values
+// are preferred so that generated bodies stay realistic.
+func (g *Generator) value(s *Schema, depth int) (any, error) {
+	s, err := g.doc.resolveSchema(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil {
+		return g.word(), nil
+	}
+
+	switch {
+	case s.Const != nil:
+		return s.Const, nil
+	case s.Example != nil:
+		return s.Example, nil
+	case len(s.Examples) > 0:
+		return s.Examples[g.rng.Intn(len(s.Examples))], nil
+	case len(s.Enum) > 0:
+		return s.Enum[g.rng.Intn(len(s.Enum))], nil
+	case len(s.AllOf) > 0:
+		merged, err := g.mergeAllOf(s)
+		if err != nil {
+			return nil, err
+		}
+
+		return g.value(merged, depth)
+	case len(s.OneOf) > 0:
+		return g.value(s.OneOf[g.rng.Intn(len(s.OneOf))], depth)
+	case len(s.AnyOf) > 0:
+		return g.value(s.AnyOf[g.rng.Intn(len(s.AnyOf))], depth)
+	}
+
+	switch schemaType(s) {
+	case "object":
+		return g.object(s, depth)
+	case "array":
+		return g.array(s, depth)
+	case "integer":
+		return g.integer(s), nil
+	case "number":
+		return g.number(s), nil
+	case "boolean":
+		return g.rng.Intn(2) == 1, nil
+	default:
+		return g.str(s), nil
+	}
+}
+
+func schemaType(s *Schema) string {
+	if t := s.Type.primary(); t != "" {
+		return t
+	}
+
+	switch {
+	case len(s.Properties) > 0:
+		return "object"
+	case s.Items != nil:
+		return "array"
+	default:
+		return "string"
+	}
+}
+
+func (g *Generator) mergeAllOf(s *Schema) (*Schema, error) {
+	merged := *s
+	merged.AllOf = nil
+	merged.Properties = make(map[string]*Schema, len(s.Properties))
+	for k, v := range s.Properties {
+		merged.Properties[k] = v
+	}
+
+	for _, part := range s.AllOf {
+		resolved, err := g.doc.resolveSchema(part)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(resolved.AllOf) > 0 {
+			if resolved, err = g.mergeAllOf(resolved); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(merged.Type) == 0 {
+			merged.Type = resolved.Type
+		}
+
+		for k, v := range resolved.Properties {
+			merged.Properties[k] = v
+		}
+
+		merged.Required = append(merged.Required, resolved.Required...)
+	}
+
+	return &merged, nil
+}
+
+func (g *Generator) object(s *Schema, depth int) (map[string]any, error) {
+	required := make(map[string]bool, len(s.Required))
+	for _, name := range s.Required {
+		required[name] = true
+	}
+
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	obj := make(map[string]any)
+	for _, name := range names {
+		prop, err := g.doc.resolveSchema(s.Properties[name])
+		if err != nil {
+			return nil, err
+		}
+
+		if prop != nil && prop.ReadOnly {
+			continue
+		}
+
+		if !required[name] && (depth >= maxDepth || g.rng.Intn(4) == 0) {
+			continue
+		}
+
+		v, err := g.value(prop, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		obj[name] = v
+	}
+
+	return obj, nil
+}
+
+func (g *Generator) array(s *Schema, depth int) ([]any, error) {
+	lo, hi := 1, 3
+	if depth >= maxDepth {
+		hi = 1
+	}
+
+	if s.MinItems != nil {
+		lo = *s.MinItems
+		hi = max(hi, lo)
+	}
+
+	if s.MaxItems != nil {
+		hi = min(hi, *s.MaxItems)
+		lo = min(lo, hi)
+	}
+
+	items := make([]any, 0, hi)
+	for range lo + g.rng.Intn(hi-lo+1) {
+		v, err := g.value(s.Items, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, v)
+	}
+
+	return items, nil
+}
+
+// bounds returns the inclusive range allowed by minimum/maximum and both
+// exclusive forms (a boolean in 3.0, a number in 3.1).
+func bounds(s *Schema, step, defaultMax float64) (float64, float64) {
+	lo, hi := 0.0, defaultMax
+	if s.Minimum != nil {
+		lo = *s.Minimum
+		if exclusive, ok := s.ExclusiveMinimum.(bool); ok && exclusive {
+			lo += step
+		}
+	}
+
+	if v, ok := toFloat(s.ExclusiveMinimum); ok {
+		lo = v + step
+	}
+
+	if s.Maximum != nil {
+		hi = *s.Maximum
+		if exclusive, ok := s.ExclusiveMaximum.(bool); ok && exclusive {
+			hi -= step
+		}
+	} else if s.Minimum != nil {
+		hi = lo + defaultMax
+	}
+
+	if v, ok := toFloat(s.ExclusiveMaximum); ok {
+		hi = v - step
+	}
+
+	if s.Maximum != nil && s.Minimum == nil && hi < lo {
+		lo = hi - defaultMax
+	}
+
+	return lo, hi
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func (g *Generator) integer(s *Schema) int64 {
+	fLo, fHi := bounds(s, 1, defaultMaxInt)
+	lo, hi := int64(math.Ceil(fLo)), int64(math.Floor(fHi))
+	if hi < lo {
+		return lo
+	}
+
+	n := lo + g.rng.Int63n(hi-lo+1)
+	if s.MultipleOf != nil && *s.MultipleOf >= 1 {
+		m := int64(*s.MultipleOf)
+		if rounded := (n / m) * m; rounded >= lo {
+			return rounded
+		}
+
+		return ((lo + m - 1) / m) * m
+	}
+
+	return n
+}
+
+func (g *Generator) number(s *Schema) float64 {
+	lo, hi := bounds(s, 0.01, defaultMaxInt)
+	n := lo + g.rng.Float64()*(hi-lo)
+
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		n = math.Ceil(lo / *s.MultipleOf) * *s.MultipleOf
+		steps := math.Floor((hi - n) / *s.MultipleOf)
+		if steps > 0 {
+			n += float64(g.rng.Int63n(int64(steps)+1)) * *s.MultipleOf
+		}
+
+		return n
+	}
+
+	return math.Round(n*100) / 100
+}
+
+func (g *Generator) str(s *Schema) string {
+	if s.Pattern != "" {
+		if v, err := g.fromPattern(s.Pattern); err == nil {
+			return v
+		}
+	}
+
+	switch s.Format {
+	case "date-time":
+		return g.timestamp().Format(time.RFC3339)
+	case "date":
+		return g.timestamp().Format(time.DateOnly)
+	case "time":
+		return g.timestamp().Format(time.TimeOnly)
+	case "email":
+		return fmt.Sprintf("%s%d@example.com", g.word(), g.rng.Intn(1000))
+	case "uuid":
+		return g.uuid()
+	case "uri", "url", "uri-reference":
+		return "https://example.com/" + g.word()
+	case "hostname":
+		return g.word() + ".example.com"
+	case "ipv4":
+		return fmt.Sprintf("10.%d.%d.%d", g.rng.Intn(256), g.rng.Intn(256), 1+g.rng.Intn(254))
+	case "ipv6":
+		return fmt.Sprintf("2001:db8::%x", 1+g.rng.Intn(0xffff))
+	case "byte":
+		buf := make([]byte, 8)
+		g.rng.Read(buf)
+		return base64.StdEncoding.EncodeToString(buf)
+	}
+
+	lo, hi := 0, 0
+	if s.MinLength != nil {
+		lo = *s.MinLength
+	}
+
+	if s.MaxLength != nil {
+		hi = *s.MaxLength
+	}
+
+	v := g.word()
+	if hi > 0 && len(v) > hi {
+		v = v[:hi]
+	}
+
+	for len(v) < lo {
+		v += string(letters[g.rng.Intn(len(letters))])
+	}
+
+	return v
+}
+
+func (g *Generator) word() string {
+	return words[g.rng.Intn(len(words))]
+}
+
+func (g *Generator) timestamp() time.Time {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return start.Add(time.Duration(g.rng.Int63n(int64(365 * 24 * time.Hour)))).Truncate(time.Second)
+}
+
+func (g *Generator) uuid() string {
+	b := make([]byte, 16)
+	g.rng.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// fromPattern produces a string matching a regular expression by walking its
+// syntax tree.
+func (g *Generator) fromPattern(pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	g.writeRegexp(&sb, re.Simplify())
+
+	return sb.String(), nil
+}
+
+func (g *Generator) writeRegexp(sb *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		sb.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		if len(re.Rune) < 2 {
+			return
+		}
+
+		pair := g.rng.Intn(len(re.Rune)/2) * 2
+		lo, hi := re.Rune[pair], re.Rune[pair+1]
+		if hi > lo+0x7f {
+			hi = lo + 0x7f
+		}
+
+		sb.WriteRune(lo + rune(g.rng.Intn(int(hi-lo)+1)))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		sb.WriteByte(letters[g.rng.Intn(len(letters))])
+	case syntax.OpCapture, syntax.OpConcat:
+		for _, sub := range re.Sub {
+			g.writeRegexp(sb, sub)
+		}
+	case syntax.OpAlternate:
+		g.writeRegexp(sb, re.Sub[g.rng.Intn(len(re.Sub))])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		lo, hi := 0, maxRepeat
+		switch re.Op {
+		case syntax.OpPlus:
+			lo = 1
+		case syntax.OpQuest:
+			hi = 1
+		case syntax.OpRepeat:
+			lo = re.Min
+			hi = re.Max
+			if hi < 0 {
+				hi = lo + maxRepeat
+			}
+		}
+
+		for range lo + g.rng.Intn(hi-lo+1) {
+			g.writeRegexp(sb, re.Sub[0])
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/importer"
+	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/replay"
+)
+
+// ExportCurl writes, for every result with a diff, the exact request sent to
+// each target as a curl command. The file can be run as a shell script or
+// fed back into `replayer import curl`.
+func ExportCurl(results []models.MultiEnvResult, args *cli.CliArgs, outputPath string) error {
+	if strings.Contains(outputPath, "..") {
+		return fmt.Errorf("invalid output path: %s", outputPath)
+	}
+
+	var sb strings.Builder
+	exported := 0
+
+	for _, r := range results {
+		if r.Diff == nil {
+			continue
+		}
+
+		targets := make([]string, 0, len(r.Responses))
+		for target := range r.Responses {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+
+		for _, target := range targets {
+			req, err := replay.BuildRequest(r.Request, target, args)
+			if err != nil {
+				return fmt.Errorf("failed to build request %d: %w", r.Index, err)
+			}
+
+			fmt.Fprintf(&sb, "# request %d (%s %s) against %s%s\n", r.Index, r.Request.Method, r.Request.Path, target, describeResponse(r.Responses[target]))
+			sb.WriteString(importer.CurlCommand(req, r.Request.DecodedBody()))
+			sb.WriteString("\n\n")
+			exported++
+		}
+	}
+
+	if err := os.WriteFile(outputPath, []byte(sb.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write curl commands: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d curl commands to %s\n", exported, outputPath)
+	return nil
+}
+
+func describeResponse(res models.ReplayResult) string {
+	switch {
+	case res.Error != nil:
+		return ": error " + strings.ReplaceAll(*res.Error, "\n", " ")
+	case res.Status != nil:
+		return fmt.Sprintf(": status %d", *res.Status)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,95 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/har"
+	"github.com/kx0101/replayer/internal/input"
+	"github.com/kx0101/replayer/internal/models"
+)
+
+func ExportHAR(inputPath, outputPath string) error {
+	if strings.Contains(inputPath, "..") {
+		return fmt.Errorf("invalid input path: %s", inputPath)
+	}
+
+	results, isResults, err := readResultsFile(inputPath)
+	if err != nil {
+		return err
+	}
+
+	var doc *har.HAR
+	if isResults {
+		doc = har.FromResults(results, "http", time.Now())
+	} else {
+		entries, err := input.ReadEntries(&cli.CliArgs{InputFile: inputPath})
+		if err != nil {
+			return err
+		}
+
+		doc = har.FromEntries(entries)
+	}
+
+	if strings.Contains(outputPath, "..") {
+		return fmt.Errorf("invalid output path: %s", outputPath)
+	}
+
+	file, err := os.Create(outputPath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to create HAR file: %w", err)
+	}
+
+	defer func() {
+		err = file.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close output file: %v\n", err)
+		}
+	}()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to write HAR: %w", err)
+	}
+
+	fmt.Printf("Exported %d HAR entries to %s\n", len(doc.Log.Entries), outputPath)
+	return nil
+}
+
+// readResultsFile reports whether the file is a replay results document
+// (as written by --output-json) rather than a JSON Lines capture.
+func readResultsFile(path string) ([]models.MultiEnvResult, bool, error) {
+	file, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	defer func() {
+		err = file.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close file: %v\n", err)
+		}
+	}()
+
+	var doc map[string]json.RawMessage
+	if err := json.NewDecoder(file).Decode(&doc); err != nil {
+		return nil, false, nil
+	}
+
+	raw, ok := doc["results"]
+	if !ok {
+		return nil, false, nil
+	}
+
+	var results []models.MultiEnvResult
+	if err := json.Unmarshal(raw, &results); err != nil {
+		return nil, false, fmt.Errorf("failed to parse results: %w", err)
+	}
+
+	return results, true, nil
+}
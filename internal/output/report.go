@@ -22,6 +22,7 @@ type ReportData struct {
 	DiffCount      int
 	Latency        models.LatencyStats
 	ByTarget       map[string]models.TargetStats
+	Routes         []RouteRow
 	Results        []models.MultiEnvResult
 	ComparisonMode bool
 }
@@ -121,6 +122,7 @@ func buildReportData(results []models.MultiEnvResult, args *cli.CliArgs) ReportD
 		DiffCount:      diffCount,
 		Latency:        overallLatency,
 		ByTarget:       byTarget,
+		Routes:         SortedRoutes(AggregateResults(results).RouteStats),
 		Results:        results,
 		ComparisonMode: args.Compare,
 	}
@@ -429,6 +431,38 @@ const htmlTemplate = `<!DOCTYPE html>
         </div>
         {{end}}
 
+        {{if gt (len .Routes) 1}}
+        <div class="section">
+            <div class="section-title">🧭 Per-Route Breakdown</div>
+            <table>
+                <thead>
+                    <tr>
+                        <th class="col-path">Route</th>
+                        <th>Requests</th>
+                        <th>Failed</th>
+                        {{if .ComparisonMode}}<th>Diffs</th>{{end}}
+                        <th>p50</th>
+                        <th>p95</th>
+                        <th>Max</th>
+                    </tr>
+                </thead>
+                <tbody>
+                    {{range .Routes}}
+                    <tr>
+                        <td><span class="code">{{.Route}}</span></td>
+                        <td>{{.Requests}}</td>
+                        <td>{{if .Failed}}<span class="status-badge status-error">{{.Failed}}</span>{{else}}0{{end}}</td>
+                        {{if $.ComparisonMode}}<td>{{if .Diffs}}<span class="diff-badge">{{.Diffs}}</span>{{else}}0{{end}}</td>{{end}}
+                        <td>{{.Latency.P50}}ms</td>
+                        <td>{{.Latency.P95}}ms</td>
+                        <td>{{.Latency.Max}}ms</td>
+                    </tr>
+                    {{end}}
+                </tbody>
+            </table>
+        </div>
+        {{end}}
+
         <div class="section">
             <div class="section-title">📋 Request Details</div>
             <table>
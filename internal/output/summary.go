@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"slices"
+	"sort"
 
 	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/route"
 )
 
 const (
@@ -46,7 +48,23 @@ func AggregateResults(results []models.MultiEnvResult) models.AggregatedStats {
 	var totalRequests, succeeded, failed int
 	var latencies []int64
 
+	routeStats := map[string]*models.RouteStats{}
+	routeLatencies := map[string][]int64{}
+
 	for _, r := range results {
+		key := route.Of(r)
+		rs, ok := routeStats[key]
+		if !ok {
+			rs = &models.RouteStats{}
+			routeStats[key] = rs
+		}
+
+		rs.Requests++
+		if r.Diff != nil {
+			rs.Diffs++
+		}
+
+		requestFailed := false
 		for target, replay := range r.Responses {
 			totalRequests++
 			ts := targetStats[target]
@@ -57,9 +75,15 @@ func AggregateResults(results []models.MultiEnvResult) models.AggregatedStats {
 			} else {
 				failed++
 				ts.Failed++
+				requestFailed = true
 			}
 
 			latencies = append(latencies, replay.LatencyMs)
+			routeLatencies[key] = append(routeLatencies[key], replay.LatencyMs)
+		}
+
+		if requestFailed {
+			rs.Failed++
 		}
 	}
 
@@ -74,13 +98,42 @@ func AggregateResults(results []models.MultiEnvResult) models.AggregatedStats {
 		ts.Latency = models.CalculateLatencyStats(targetLat)
 	}
 
+	for key, rs := range routeStats {
+		rs.Latency = models.CalculateLatencyStats(routeLatencies[key])
+	}
+
 	return models.AggregatedStats{
 		TotalRequests: totalRequests,
 		Succeeded:     succeeded,
 		Failed:        failed,
 		Latencies:     latencies,
 		TargetStats:   targetStats,
+		RouteStats:    routeStats,
+	}
+}
+
+// RouteRow is one line of the per-route breakdown.
+type RouteRow struct {
+	Route string
+	models.RouteStats
+}
+
+// SortedRoutes orders routes by request count, busiest first.
+func SortedRoutes(stats map[string]*models.RouteStats) []RouteRow {
+	rows := make([]RouteRow, 0, len(stats))
+	for key, rs := range stats {
+		rows = append(rows, RouteRow{Route: key, RouteStats: *rs})
 	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Requests != rows[j].Requests {
+			return rows[i].Requests > rows[j].Requests
+		}
+
+		return rows[i].Route < rows[j].Route
+	})
+
+	return rows
 }
 
 func PrintJSONOutput(results []models.MultiEnvResult) {
@@ -110,6 +163,10 @@ func printResults(results []models.MultiEnvResult, diffCount int, compare bool,
 	fmt.Println("\nLatency (ms):")
 	printLatencyStats(overallLatency)
 
+	if len(agg.RouteStats) > 1 {
+		printRouteStats(agg.RouteStats, compare)
+	}
+
 	if len(agg.TargetStats) > 1 {
 		fmt.Println("\nPer-Target Statistics:")
 
@@ -124,19 +181,60 @@ func printResults(results []models.MultiEnvResult, diffCount int, compare bool,
 	}
 
 	for _, r := range results {
-		for target, replay := range r.Responses {
-			statusStr, color := formatStatus(replay.Status)
-			errMsg := ""
-			if replay.Error != nil {
-				errMsg = fmt.Sprintf(" (%s)", *replay.Error)
-			}
+		PrintResult(r, compare)
+	}
+}
+
+// PrintResult prints the per-target outcome of one replayed request and its
+// diff when comparing.
+func PrintResult(r models.MultiEnvResult, compare bool) {
+	for target, replay := range r.Responses {
+		statusStr, color := formatStatus(replay.Status)
+		errMsg := ""
+		if replay.Error != nil {
+			errMsg = fmt.Sprintf(" (%s)", *replay.Error)
+		}
+
+		fmt.Printf("[%d][%s] %s%s%s -> %dms%s\n", r.Index, target, color, statusStr, ColorReset, replay.LatencyMs, errMsg)
+	}
+
+	if compare && r.Diff != nil {
+		printDiff(r)
+	}
+}
+
+func printRouteStats(stats map[string]*models.RouteStats, compare bool) {
+	rows := SortedRoutes(stats)
+	width := len("Route")
+	for _, row := range rows {
+		width = max(width, len(row.Route))
+	}
 
-			fmt.Printf("[%d][%s] %s%s%s -> %dms%s\n", r.Index, target, color, statusStr, ColorReset, replay.LatencyMs, errMsg)
+	fmt.Println("\nPer-Route Statistics:")
+	fmt.Printf("  %-*s %8s %8s", width, "Route", "Requests", "Failed")
+	if compare {
+		fmt.Printf(" %8s", "Diffs")
+	}
+
+	fmt.Printf(" %8s %8s %8s\n", "p50", "p95", "max")
+
+	for _, row := range rows {
+		failedColor := ColorReset
+		if row.Failed > 0 {
+			failedColor = ColorRed
 		}
 
-		if compare && r.Diff != nil {
-			printDiff(r)
+		fmt.Printf("  %-*s %8d %s%8d%s", width, row.Route, row.Requests, failedColor, row.Failed, ColorReset)
+		if compare {
+			diffColor := ColorReset
+			if row.Diffs > 0 {
+				diffColor = ColorYellow
+			}
+
+			fmt.Printf(" %s%8d%s", diffColor, row.Diffs, ColorReset)
 		}
+
+		fmt.Printf(" %6dms %6dms %6dms\n", row.Latency.P50, row.Latency.P95, row.Latency.Max)
 	}
 }
 
@@ -217,6 +315,7 @@ func ConvertToSummary(agg models.AggregatedStats) models.Summary {
 		Failed:        agg.Failed,
 		Latency:       models.CalculateLatencyStats(agg.Latencies),
 		ByTarget:      byTarget,
+		ByRoute:       routeSummary(agg.RouteStats),
 	}
 }
 
@@ -234,5 +333,15 @@ func generateSummary(results []models.MultiEnvResult) models.Summary {
 		Failed:        agg.Failed,
 		Latency:       models.CalculateLatencyStats(agg.Latencies),
 		ByTarget:      byTarget,
+		ByRoute:       routeSummary(agg.RouteStats),
 	}
 }
+
+func routeSummary(stats map[string]*models.RouteStats) map[string]models.RouteStats {
+	byRoute := make(map[string]models.RouteStats, len(stats))
+	for key, rs := range stats {
+		byRoute[key] = *rs
+	}
+
+	return byRoute
+}
@@ -0,0 +1,80 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+func result(method, path, routeKey string, staging, production *int, diff bool) models.MultiEnvResult {
+	r := models.MultiEnvResult{
+		Request: models.LogEntry{Method: method, Path: path},
+		Route:   routeKey,
+		Responses: map[string]models.ReplayResult{
+			"staging":    {Status: staging, LatencyMs: 10},
+			"production": {Status: production, LatencyMs: 20},
+		},
+	}
+
+	if diff {
+		r.Diff = &models.ResponseDiff{StatusMismatch: true}
+	}
+
+	return r
+}
+
+func TestAggregateRoutes(t *testing.T) {
+	ok, failed := 200, 500
+
+	results := []models.MultiEnvResult{
+		result("GET", "/users/1", "", &ok, &ok, false),
+		result("GET", "/orders/9", "", &ok, &ok, false),
+		result("GET", "/users/2", "", &failed, &ok, true),
+		result("POST", "/graphql", "POST /graphql query GetUser", &ok, &ok, true),
+		result("POST", "/graphql", "POST /graphql query GetUser", nil, &ok, false),
+	}
+
+	agg := AggregateResults(results)
+	if agg.TotalRequests != 10 || agg.Failed != 2 {
+		t.Errorf("expected 10 requests and 2 failures, got %d and %d", agg.TotalRequests, agg.Failed)
+	}
+
+	tests := []struct {
+		route    string
+		requests int
+		failed   int
+		diffs    int
+	}{
+		// Busiest first, ties by route.
+		{"GET /users/{id}", 2, 1, 1},
+		{"POST /graphql query GetUser", 2, 1, 1},
+		{"GET /orders/{id}", 1, 0, 0},
+	}
+
+	rows := SortedRoutes(agg.RouteStats)
+	if len(rows) != len(tests) {
+		t.Fatalf("expected %d routes, got %+v", len(tests), rows)
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			row := rows[i]
+			if row.Route != tt.route {
+				t.Fatalf("expected %s at position %d, got %s", tt.route, i, row.Route)
+			}
+
+			if row.Requests != tt.requests || row.Failed != tt.failed || row.Diffs != tt.diffs {
+				t.Errorf("expected %d requests, %d failed and %d diffs, got %d, %d and %d",
+					tt.requests, tt.failed, tt.diffs, row.Requests, row.Failed, row.Diffs)
+			}
+
+			if row.Latency.Max != 20 {
+				t.Errorf("expected the latencies of every target, got %+v", row.Latency)
+			}
+		})
+	}
+
+	if byRoute := ConvertToSummary(agg).ByRoute; len(byRoute) != len(tests) || byRoute["GET /users/{id}"].Diffs != 1 {
+		t.Errorf("unexpected summary by route: %+v", byRoute)
+	}
+}
@@ -0,0 +1,192 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net/netip"
+)
+
+// Link types from https://www.tcpdump.org/linktypes.html
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLoop     = 108
+	linkSLL      = 113
+	linkSLL2     = 276
+	linkIPv4     = 228
+	linkIPv6     = 229
+
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+
+	protoTCP = 6
+
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpRST = 0x04
+	tcpACK = 0x10
+)
+
+type endpoint struct {
+	addr netip.Addr
+	port uint16
+}
+
+func (e endpoint) String() string {
+	return netip.AddrPortFrom(e.addr, e.port).String()
+}
+
+type segment struct {
+	src, dst endpoint
+	seq      uint32
+	flags    uint8
+	payload  []byte
+}
+
+// decodeTCP extracts the TCP segment from a link layer frame. It returns nil
+// for anything that is not unfragmented TCP over IPv4 or IPv6.
+func decodeTCP(linkType uint32, data []byte) *segment {
+	var etherType uint16
+
+	switch linkType {
+	case linkEthernet:
+		if len(data) < 14 {
+			return nil
+		}
+
+		etherType = binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+		for (etherType == etherTypeVLAN || etherType == etherTypeQinQ) && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+	case linkSLL:
+		if len(data) < 16 {
+			return nil
+		}
+
+		etherType = binary.BigEndian.Uint16(data[14:])
+		data = data[16:]
+	case linkSLL2:
+		if len(data) < 20 {
+			return nil
+		}
+
+		etherType = binary.BigEndian.Uint16(data)
+		data = data[20:]
+	case linkNull, linkLoop:
+		// The 4 byte address family is in host byte order; IPv4 is 2 and
+		// IPv6 is 24, 28 or 30 depending on the OS, so use the IP version.
+		if len(data) < 4 {
+			return nil
+		}
+
+		data = data[4:]
+	case linkRaw, linkIPv4, linkIPv6:
+	default:
+		return nil
+	}
+
+	if etherType == 0 && len(data) > 0 {
+		switch data[0] >> 4 {
+		case 4:
+			etherType = etherTypeIPv4
+		case 6:
+			etherType = etherTypeIPv6
+		}
+	}
+
+	switch etherType {
+	case etherTypeIPv4:
+		return decodeIPv4(data)
+	case etherTypeIPv6:
+		return decodeIPv6(data)
+	default:
+		return nil
+	}
+}
+
+func decodeIPv4(data []byte) *segment {
+	if len(data) < 20 || data[0]>>4 != 4 {
+		return nil
+	}
+
+	ihl := int(data[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(data[2:]))
+	if ihl < 20 || total < ihl || len(data) < ihl {
+		return nil
+	}
+
+	// Fragments are rare for TCP (which negotiates MSS), so skip them.
+	if frag := binary.BigEndian.Uint16(data[6:]); frag&0x2000 != 0 || frag&0x1fff != 0 {
+		return nil
+	}
+
+	if data[9] != protoTCP {
+		return nil
+	}
+
+	src, _ := netip.AddrFromSlice(data[12:16])
+	dst, _ := netip.AddrFromSlice(data[16:20])
+
+	end := min(total, len(data))
+	return decodeTCPHeader(src, dst, data[ihl:end])
+}
+
+func decodeIPv6(data []byte) *segment {
+	if len(data) < 40 || data[0]>>4 != 6 {
+		return nil
+	}
+
+	payloadLen := int(binary.BigEndian.Uint16(data[4:]))
+	next := data[6]
+	src, _ := netip.AddrFromSlice(data[8:24])
+	dst, _ := netip.AddrFromSlice(data[24:40])
+
+	payload := data[40:]
+	if payloadLen < len(payload) {
+		payload = payload[:payloadLen]
+	}
+
+	// Skip hop-by-hop, routing and destination options headers.
+	for next == 0 || next == 43 || next == 60 {
+		if len(payload) < 8 {
+			return nil
+		}
+
+		length := (int(payload[1]) + 1) * 8
+		if length > len(payload) {
+			return nil
+		}
+
+		next = payload[0]
+		payload = payload[length:]
+	}
+
+	if next != protoTCP {
+		return nil
+	}
+
+	return decodeTCPHeader(src, dst, payload)
+}
+
+func decodeTCPHeader(src, dst netip.Addr, data []byte) *segment {
+	if len(data) < 20 {
+		return nil
+	}
+
+	offset := int(data[12]>>4) * 4
+	if offset < 20 || offset > len(data) {
+		return nil
+	}
+
+	return &segment{
+		src:     endpoint{addr: src.Unmap(), port: binary.BigEndian.Uint16(data)},
+		dst:     endpoint{addr: dst.Unmap(), port: binary.BigEndian.Uint16(data[2:])},
+		seq:     binary.BigEndian.Uint32(data[4:]),
+		flags:   data[13],
+		payload: data[offset:],
+	}
+}
@@ -0,0 +1,301 @@
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+)
+
+const (
+	pcapMagicMicros = 0xa1b2c3d4
+	pcapMagicNanos  = 0xa1b23c4d
+	pcapngSHB       = 0x0a0d0d0a
+	pcapngByteOrder = 0x1a2b3c4d
+
+	pcapngIDB = 0x00000001
+	pcapngPB  = 0x00000002
+	pcapngSPB = 0x00000003
+	pcapngEPB = 0x00000006
+
+	// maxBlockSize guards against corrupt length fields.
+	maxBlockSize = 64 << 20
+)
+
+type packet struct {
+	ts       time.Time
+	linkType uint32
+	data     []byte
+}
+
+// packetReader iterates over the packets of a pcap or pcapng file.
+type packetReader interface {
+	next() (*packet, error)
+}
+
+// IsCapture reports whether prefix starts with a pcap or pcapng magic number.
+func IsCapture(prefix []byte) bool {
+	if len(prefix) < 4 {
+		return false
+	}
+
+	switch binary.LittleEndian.Uint32(prefix) {
+	case pcapMagicMicros, pcapMagicNanos, pcapngSHB:
+		return true
+	}
+
+	switch binary.BigEndian.Uint32(prefix) {
+	case pcapMagicMicros, pcapMagicNanos:
+		return true
+	}
+
+	return false
+}
+
+func newPacketReader(r io.Reader) (packetReader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture header: %w", err)
+	}
+
+	if binary.LittleEndian.Uint32(magic) == pcapngSHB {
+		return &pcapngReader{r: br}, nil
+	}
+
+	return newPcapReader(br)
+}
+
+type pcapReader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	nanos    bool
+	linkType uint32
+}
+
+func newPcapReader(r io.Reader) (*pcapReader, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read pcap header: %w", err)
+	}
+
+	p := &pcapReader{r: r}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(header) {
+		case pcapMagicMicros:
+			p.order = order
+		case pcapMagicNanos:
+			p.order = order
+			p.nanos = true
+		}
+	}
+
+	if p.order == nil {
+		return nil, fmt.Errorf("not a pcap file")
+	}
+
+	p.linkType = p.order.Uint32(header[20:]) & 0x0fffffff
+	return p, nil
+}
+
+func (p *pcapReader) next() (*packet, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(p.r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+
+		return nil, err
+	}
+
+	sec := int64(p.order.Uint32(header))
+	frac := int64(p.order.Uint32(header[4:]))
+	capLen := p.order.Uint32(header[8:])
+	if capLen > maxBlockSize {
+		return nil, fmt.Errorf("invalid packet length %d", capLen)
+	}
+
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return nil, io.EOF
+	}
+
+	if !p.nanos {
+		frac *= 1000
+	}
+
+	return &packet{ts: time.Unix(sec, frac).UTC(), linkType: p.linkType, data: data}, nil
+}
+
+type pcapngInterface struct {
+	linkType uint32
+	// tsResol is the if_tsresol option: a negative power of ten, or of two
+	// when the top bit is set. The default is microseconds.
+	tsResol byte
+}
+
+func (i pcapngInterface) time(ticks uint64) time.Time {
+	exp := int(i.tsResol & 0x7f)
+	if i.tsResol&0x80 != 0 {
+		hi, lo := bits.Mul64(ticks, 1e9)
+		if hi>>exp != 0 {
+			return time.Time{}
+		}
+
+		return time.Unix(0, int64(lo>>exp|hi<<(64-exp))).UTC() // #nosec G115 -- checked above
+	}
+
+	nanos := ticks
+	for ; exp < 9; exp++ {
+		nanos *= 10
+	}
+
+	for ; exp > 9; exp-- {
+		nanos /= 10
+	}
+
+	return time.Unix(0, int64(nanos)).UTC() // #nosec G115 -- timestamps fit in int64
+}
+
+type pcapngReader struct {
+	r          io.Reader
+	order      binary.ByteOrder
+	interfaces []pcapngInterface
+}
+
+func (p *pcapngReader) next() (*packet, error) {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(p.r, header); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, io.EOF
+			}
+
+			return nil, err
+		}
+
+		blockType := binary.LittleEndian.Uint32(header)
+		if blockType == pcapngSHB {
+			if err := p.readSectionHeader(header); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if p.order == nil {
+			return nil, fmt.Errorf("pcapng block before section header")
+		}
+
+		blockType = p.order.Uint32(header)
+		length := p.order.Uint32(header[4:])
+		if length < 12 || length > maxBlockSize {
+			return nil, fmt.Errorf("invalid pcapng block length %d", length)
+		}
+
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(p.r, body); err != nil {
+			return nil, io.EOF
+		}
+
+		body = body[:len(body)-4]
+
+		switch blockType {
+		case pcapngIDB:
+			p.readInterface(body)
+		case pcapngEPB, pcapngPB:
+			if pkt := p.readPacket(body, blockType == pcapngPB); pkt != nil {
+				return pkt, nil
+			}
+		case pcapngSPB:
+			if len(p.interfaces) > 0 && len(body) >= 4 {
+				capLen := min(int(p.order.Uint32(body)), len(body)-4)
+				return &packet{linkType: p.interfaces[0].linkType, data: body[4 : 4+capLen]}, nil
+			}
+		}
+	}
+}
+
+func (p *pcapngReader) readSectionHeader(header []byte) error {
+	rest := make([]byte, 4)
+	if _, err := io.ReadFull(p.r, rest); err != nil {
+		return fmt.Errorf("failed to read pcapng section header: %w", err)
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(rest) == pcapngByteOrder:
+		p.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(rest) == pcapngByteOrder:
+		p.order = binary.BigEndian
+	default:
+		return fmt.Errorf("invalid pcapng byte order magic")
+	}
+
+	length := p.order.Uint32(header[4:])
+	if length < 12 || length > maxBlockSize {
+		return fmt.Errorf("invalid pcapng section header length %d", length)
+	}
+
+	if _, err := io.CopyN(io.Discard, p.r, int64(length-12)); err != nil {
+		return fmt.Errorf("failed to read pcapng section header: %w", err)
+	}
+
+	// Interface IDs are scoped to a section.
+	p.interfaces = nil
+	return nil
+}
+
+func (p *pcapngReader) readInterface(body []byte) {
+	if len(body) < 8 {
+		return
+	}
+
+	iface := pcapngInterface{linkType: uint32(p.order.Uint16(body)), tsResol: 6}
+
+	opts := body[8:]
+	for len(opts) >= 4 {
+		code := p.order.Uint16(opts)
+		length := int(p.order.Uint16(opts[2:]))
+		if code == 0 || 4+length > len(opts) {
+			break
+		}
+
+		if code == 9 && length >= 1 {
+			iface.tsResol = opts[4]
+		}
+
+		// The last option may come without its padding.
+		opts = opts[min(4+(length+3)&^3, len(opts)):]
+	}
+
+	p.interfaces = append(p.interfaces, iface)
+}
+
+func (p *pcapngReader) readPacket(body []byte, obsolete bool) *packet {
+	if len(body) < 20 {
+		return nil
+	}
+
+	var id uint32
+	if obsolete {
+		id = uint32(p.order.Uint16(body))
+	} else {
+		id = p.order.Uint32(body)
+	}
+
+	if int(id) >= len(p.interfaces) {
+		return nil
+	}
+
+	iface := p.interfaces[id]
+	ticks := uint64(p.order.Uint32(body[4:]))<<32 | uint64(p.order.Uint32(body[8:]))
+	capLen := int(p.order.Uint32(body[12:]))
+	if capLen > len(body)-20 {
+		return nil
+	}
+
+	return &packet{ts: iface.time(ticks), linkType: iface.linkType, data: body[20 : 20+capLen]}
+}
@@ -0,0 +1,262 @@
+package pcap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+var requestPrefixes = []string{"GET ", "POST ", "PUT ", "DELETE ", "HEAD ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE "}
+
+func looksLikeRequest(data []byte) bool {
+	for _, prefix := range requestPrefixes {
+		if bytes.HasPrefix(data, []byte(prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReadEntries reassembles the TCP connections in a pcap or pcapng capture
+// and returns one entry per HTTP/1.x request, ordered by the time the
+// request started. Latency spans from the first request byte to the last
+// response byte seen on the wire.
+func ReadEntries(r io.Reader, limit int) ([]models.LogEntry, error) {
+	packets, err := newPacketReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	active := make(map[[2]endpoint]*connection)
+	var done []*connection
+
+	for {
+		pkt, err := packets.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read capture: %w", err)
+		}
+
+		seg := decodeTCP(pkt.linkType, pkt.data)
+		if seg == nil {
+			continue
+		}
+
+		key := connectionKey(seg.src, seg.dst)
+		conn, ok := active[key]
+
+		// A new SYN on a finished 4-tuple starts a new connection.
+		if ok && seg.flags&tcpSYN != 0 && seg.flags&tcpACK == 0 && (conn.closed || conn.hasData()) {
+			done = append(done, conn)
+			ok = false
+		}
+
+		if !ok {
+			conn = newConnection()
+			active[key] = conn
+		}
+
+		conn.add(seg, pkt.ts)
+	}
+
+	for _, conn := range active {
+		done = append(done, conn)
+	}
+
+	var entries []models.LogEntry
+	for _, conn := range done {
+		entries = append(entries, conn.entries()...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+type message struct {
+	start, end time.Time
+}
+
+func (c *connection) entries() []models.LogEntry {
+	client, server, clientAddr, ok := c.sides()
+	if !ok || !looksLikeRequest(client.data) {
+		return nil
+	}
+
+	requests, reqTimes, err := readRequests(client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Skipping rest of HTTP stream from %s: %v\n", clientAddr, err)
+	}
+
+	var responses []*http.Response
+	var respBodies [][]byte
+	var respTimes []message
+	if server != nil {
+		responses, respBodies, respTimes, err = readResponses(server, requests)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Incomplete HTTP responses to %s: %v\n", clientAddr, err)
+		}
+	}
+
+	entries := make([]models.LogEntry, 0, len(requests))
+	for i, req := range requests {
+		entry := requestEntry(req.req, req.body)
+		entry.Timestamp = reqTimes[i].start
+
+		if i < len(responses) {
+			resp := responses[i]
+			entry.Status = resp.StatusCode
+			entry.ResponseHeaders = resp.Header
+			entry.ResponseBody = base64.StdEncoding.EncodeToString(respBodies[i])
+			entry.LatencyMs = respTimes[i].end.Sub(reqTimes[i].start).Milliseconds()
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+type parsedRequest struct {
+	req  *http.Request
+	body []byte
+}
+
+// consumed returns how many bytes of data the buffered reader has handed out.
+func consumed(data []byte, r *bytes.Reader, br *bufio.Reader) int {
+	return len(data) - r.Len() - br.Buffered()
+}
+
+func readRequests(h *halfStream) ([]parsedRequest, []message, error) {
+	r := bytes.NewReader(h.data)
+	br := bufio.NewReader(r)
+
+	var requests []parsedRequest
+	var times []message
+
+	for {
+		start := consumed(h.data, r, br)
+		if start >= len(h.data) {
+			return requests, times, nil
+		}
+
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return requests, times, fmt.Errorf("request %d: %w", len(requests)+1, err)
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return requests, times, fmt.Errorf("request %d body: %w", len(requests)+1, err)
+		}
+
+		end := consumed(h.data, r, br)
+		requests = append(requests, parsedRequest{req: req, body: body})
+		times = append(times, message{start: h.timeAt(start), end: h.timeAt(end - 1)})
+
+		if req.Method == http.MethodConnect || strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+			return requests, times, nil
+		}
+	}
+}
+
+func readResponses(h *halfStream, requests []parsedRequest) ([]*http.Response, [][]byte, []message, error) {
+	r := bytes.NewReader(h.data)
+	br := bufio.NewReader(r)
+
+	var responses []*http.Response
+	var bodies [][]byte
+	var times []message
+
+	for _, req := range requests {
+		start := consumed(h.data, r, br)
+		if start >= len(h.data) {
+			break
+		}
+
+		var resp *http.Response
+		var err error
+		for {
+			resp, err = http.ReadResponse(br, req.req)
+			if err != nil {
+				return responses, bodies, times, fmt.Errorf("response %d: %w", len(responses)+1, err)
+			}
+
+			// Skip interim responses such as 100 Continue.
+			if resp.StatusCode < 200 && resp.StatusCode != http.StatusSwitchingProtocols {
+				continue
+			}
+
+			break
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return responses, bodies, times, fmt.Errorf("response %d body: %w", len(responses)+1, err)
+		}
+
+		end := consumed(h.data, r, br)
+		responses = append(responses, resp)
+		bodies = append(bodies, body)
+		times = append(times, message{start: h.timeAt(start), end: h.timeAt(end - 1)})
+
+		if resp.StatusCode == http.StatusSwitchingProtocols {
+			break
+		}
+	}
+
+	return responses, bodies, times, nil
+}
+
+func requestEntry(req *http.Request, body []byte) models.LogEntry {
+	headers := make(map[string][]string, len(req.Header)+1)
+	for k, v := range req.Header {
+		headers[k] = v
+	}
+
+	if req.Host != "" {
+		headers["Host"] = []string{req.Host}
+	}
+
+	if len(req.TransferEncoding) > 0 {
+		headers["Transfer-Encoding"] = req.TransferEncoding
+	}
+
+	path := req.RequestURI
+	if req.URL != nil && req.URL.IsAbs() {
+		path = req.URL.RequestURI()
+	}
+
+	entry := models.LogEntry{
+		BodyEncoding: models.BodyEncodingBase64,
+		Method:       req.Method,
+		Path:         path,
+		Headers:      headers,
+	}
+
+	if len(body) > 0 {
+		entry.Body = base64.StdEncoding.EncodeToString(body)
+	}
+
+	return entry
+}
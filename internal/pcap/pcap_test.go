@@ -0,0 +1,234 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+type testPacket struct {
+	ts      time.Duration
+	src     string
+	dst     string
+	seq     uint32
+	flags   uint8
+	payload string
+}
+
+var base = time.Date(2024, 12, 10, 14, 23, 45, 0, time.UTC)
+
+func tcpFrame(p testPacket) []byte {
+	src := netip.MustParseAddrPort(p.src)
+	dst := netip.MustParseAddrPort(p.dst)
+
+	tcp := make([]byte, 20, 20+len(p.payload))
+	binary.BigEndian.PutUint16(tcp, src.Port())
+	binary.BigEndian.PutUint16(tcp[2:], dst.Port())
+	binary.BigEndian.PutUint32(tcp[4:], p.seq)
+	tcp[12] = 5 << 4
+	tcp[13] = p.flags
+	tcp = append(tcp, p.payload...)
+
+	if src.Addr().Is6() {
+		ip := make([]byte, 40)
+		ip[0] = 6 << 4
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(tcp)))
+		ip[6] = protoTCP
+		copy(ip[8:], src.Addr().AsSlice())
+		copy(ip[24:], dst.Addr().AsSlice())
+		return append(ip, tcp...)
+	}
+
+	ip := make([]byte, 20)
+	ip[0] = 4<<4 | 5
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+	ip[9] = protoTCP
+	copy(ip[12:], src.Addr().AsSlice())
+	copy(ip[16:], dst.Addr().AsSlice())
+
+	eth := make([]byte, 14)
+	binary.BigEndian.PutUint16(eth[12:], etherTypeIPv4)
+	return append(append(eth, ip...), tcp...)
+}
+
+func writePcap(packets []testPacket) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, pcapMagicMicros)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linkEthernet)
+	buf.Write(header)
+
+	for _, p := range packets {
+		frame := tcpFrame(p)
+		ts := base.Add(p.ts)
+
+		rec := make([]byte, 16)
+		binary.LittleEndian.PutUint32(rec, uint32(ts.Unix()))
+		binary.LittleEndian.PutUint32(rec[4:], uint32(ts.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(rec[8:], uint32(len(frame)))
+		binary.LittleEndian.PutUint32(rec[12:], uint32(len(frame)))
+		buf.Write(rec)
+		buf.Write(frame)
+	}
+
+	return buf.Bytes()
+}
+
+func pcapngBlock(blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+
+	block := make([]byte, 8, 12+len(body))
+	binary.BigEndian.PutUint32(block, blockType)
+	binary.BigEndian.PutUint32(block[4:], uint32(12+len(body)))
+	block = append(block, body...)
+	return binary.BigEndian.AppendUint32(block, uint32(12+len(body)))
+}
+
+// writePcapng writes a big endian pcapng file with nanosecond timestamps
+// and raw IP frames.
+func writePcapng(packets []testPacket) []byte {
+	var buf bytes.Buffer
+
+	shb := binary.BigEndian.AppendUint32(nil, pcapngByteOrder)
+	shb = append(shb, 0, 1, 0, 0)
+	shb = append(shb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	buf.Write(pcapngBlock(pcapngSHB, shb))
+
+	idb := []byte{0, linkRaw, 0, 0, 0, 0, 0xff, 0xff}
+	idb = append(idb, 0, 9, 0, 1, 9, 0, 0, 0) // if_tsresol = 10^-9
+	idb = append(idb, 0, 0, 0, 0)
+	buf.Write(pcapngBlock(pcapngIDB, idb))
+
+	for _, p := range packets {
+		frame := tcpFrame(p)
+		if frame[0]>>4 != 6 {
+			frame = frame[14:]
+		}
+
+		ns := uint64(base.Add(p.ts).UnixNano())
+		epb := make([]byte, 20)
+		binary.BigEndian.PutUint32(epb[4:], uint32(ns>>32))
+		binary.BigEndian.PutUint32(epb[8:], uint32(ns))
+		binary.BigEndian.PutUint32(epb[12:], uint32(len(frame)))
+		binary.BigEndian.PutUint32(epb[16:], uint32(len(frame)))
+		buf.Write(pcapngBlock(pcapngEPB, append(epb, frame...)))
+	}
+
+	return buf.Bytes()
+}
+
+func TestReadEntries_Pcap(t *testing.T) {
+	client, server := "10.0.0.1:51000", "10.0.0.2:80"
+	req1a := "POST /orders?dry_run=1 HTTP/1.1\r\nHost: shop.local\r\nContent-Length: 11\r\n\r\n"
+	req1b := `{"sku":"a"}`
+	req2 := "GET /health HTTP/1.1\r\nHost: shop.local\r\n\r\n"
+	resp1 := "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 201 Created\r\nTransfer-Encoding: chunked\r\nContent-Type: application/json\r\n\r\n5\r\n{\"id\"\r\n3\r\n:7}\r\n0\r\n\r\n"
+	resp2 := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+
+	cSeq, sSeq := uint32(1000), uint32(0xfffffff0) // server sequence wraps around
+	packets := []testPacket{
+		{0, client, server, cSeq, tcpSYN, ""},
+		{time.Millisecond, server, client, sSeq, tcpSYN | tcpACK, ""},
+		// body arrives before the headers and the headers are retransmitted
+		{3 * time.Millisecond, client, server, cSeq + 1 + uint32(len(req1a)), tcpACK, req1b},
+		{2 * time.Millisecond, client, server, cSeq + 1, tcpACK, req1a},
+		{4 * time.Millisecond, client, server, cSeq + 1, tcpACK, req1a},
+		{20 * time.Millisecond, server, client, sSeq + 1, tcpACK, resp1[:40]},
+		{45 * time.Millisecond, server, client, sSeq + 41, tcpACK, resp1[40:]},
+		{50 * time.Millisecond, client, server, cSeq + 1 + uint32(len(req1a)+len(req1b)), tcpACK, req2},
+		{58 * time.Millisecond, server, client, sSeq + 1 + uint32(len(resp1)), tcpACK, resp2},
+		// unrelated non-HTTP traffic is ignored
+		{60 * time.Millisecond, "10.0.0.1:51001", "10.0.0.3:443", 1, tcpACK, "\x16\x03\x01\x00"},
+	}
+
+	entries, err := ReadEntries(bytes.NewReader(writePcap(packets)), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	first := entries[0]
+	if first.Method != "POST" || first.Path != "/orders?dry_run=1" || first.Headers["Host"][0] != "shop.local" {
+		t.Errorf("unexpected request: %s %s %v", first.Method, first.Path, first.Headers)
+	}
+
+	if string(models.DecodeBody(first.Body)) != req1b {
+		t.Errorf("unexpected request body: %s", models.DecodeBody(first.Body))
+	}
+
+	if first.Status != 201 || string(models.DecodeBody(first.ResponseBody)) != `{"id":7}` {
+		t.Errorf("unexpected response: %d %s", first.Status, models.DecodeBody(first.ResponseBody))
+	}
+
+	if !first.Timestamp.Equal(base.Add(2*time.Millisecond)) || first.LatencyMs != 43 {
+		t.Errorf("unexpected timing: %v %dms", first.Timestamp, first.LatencyMs)
+	}
+
+	second := entries[1]
+	if second.Path != "/health" || second.Status != 200 || second.LatencyMs != 8 {
+		t.Errorf("unexpected second entry: %+v", second)
+	}
+
+	limited, err := ReadEntries(bytes.NewReader(writePcap(packets)), 1)
+	if err != nil || len(limited) != 1 {
+		t.Errorf("expected limit to apply, got %d entries (%v)", len(limited), err)
+	}
+}
+
+func TestReadEntries_PcapngWithoutHandshake(t *testing.T) {
+	client, server := "[2001:db8::1]:40000", "[2001:db8::2]:8080"
+	packets := []testPacket{
+		{0, server, client, 500, tcpACK, "HTTP/1.1 204 No Content\r\n\r\n"},
+		{-1500 * time.Microsecond, client, server, 77, tcpACK, "DELETE /items/3 HTTP/1.1\r\nHost: api\r\n\r\n"},
+	}
+
+	data := writePcapng(packets)
+	if !IsCapture(data) || !IsCapture(writePcap(packets)) || IsCapture([]byte(`{"method":"GET"}`)) {
+		t.Fatal("unexpected capture detection")
+	}
+
+	entries, err := ReadEntries(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.Method != "DELETE" || entry.Status != 204 || entry.LatencyMs != 1 {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	if !entry.Timestamp.Equal(base.Add(-1500 * time.Microsecond)) {
+		t.Errorf("expected nanosecond timestamp, got %v", entry.Timestamp)
+	}
+}
+
+func TestReadInterfaceUnpaddedOption(t *testing.T) {
+	// if_tsresol, then a 5 byte option that ends the block unpadded.
+	body := make([]byte, 8, 8+8+9)
+	binary.LittleEndian.PutUint16(body, 1)
+	body = append(body, 9, 0, 1, 0, 9, 0, 0, 0)
+	body = append(body, 2, 0, 5, 0, 'e', 't', 'h', '0', '!')
+
+	p := &pcapngReader{order: binary.LittleEndian}
+	p.readInterface(body)
+
+	if len(p.interfaces) != 1 || p.interfaces[0].tsResol != 9 {
+		t.Errorf("unexpected interfaces: %+v", p.interfaces)
+	}
+}
@@ -0,0 +1,162 @@
+package pcap
+
+import (
+	"sort"
+	"time"
+)
+
+type chunk struct {
+	offset int
+	ts     time.Time
+}
+
+type pendingSegment struct {
+	payload []byte
+	ts      time.Time
+}
+
+// halfStream reassembles one direction of a TCP connection. Every in-order
+// chunk remembers its capture time so HTTP messages can be timed.
+type halfStream struct {
+	started bool
+	next    uint32
+	data    []byte
+	chunks  []chunk
+	pending map[uint32]pendingSegment
+}
+
+func (h *halfStream) add(seg *segment, ts time.Time) {
+	if seg.flags&tcpSYN != 0 {
+		h.started = true
+		h.next = seg.seq + 1
+		return
+	}
+
+	if len(seg.payload) == 0 {
+		return
+	}
+
+	if !h.started {
+		h.started = true
+		h.next = seg.seq
+	}
+
+	h.insert(seg.seq, seg.payload, ts)
+}
+
+func (h *halfStream) insert(seq uint32, payload []byte, ts time.Time) {
+	// Sequence numbers wrap, so compare them as a signed distance.
+	diff := int32(seq - h.next) // #nosec G115 -- intentional wraparound
+	if diff > 0 {
+		if h.pending == nil {
+			h.pending = make(map[uint32]pendingSegment)
+		}
+
+		if existing, ok := h.pending[seq]; !ok || len(payload) > len(existing.payload) {
+			h.pending[seq] = pendingSegment{payload: append([]byte(nil), payload...), ts: ts}
+		}
+
+		return
+	}
+
+	if -int(diff) >= len(payload) {
+		return
+	}
+
+	payload = payload[-diff:]
+	h.chunks = append(h.chunks, chunk{offset: len(h.data), ts: ts})
+	h.data = append(h.data, payload...)
+	h.next += uint32(len(payload)) // #nosec G115 -- payload is bounded by the packet size
+
+	for seq, p := range h.pending {
+		if int32(seq-h.next) <= 0 { // #nosec G115 -- intentional wraparound
+			delete(h.pending, seq)
+			h.insert(seq, p.payload, p.ts)
+			return
+		}
+	}
+}
+
+// timeAt returns the capture time of the packet holding byte offset.
+func (h *halfStream) timeAt(offset int) time.Time {
+	i := sort.Search(len(h.chunks), func(i int) bool { return h.chunks[i].offset > offset })
+	if i == 0 {
+		return time.Time{}
+	}
+
+	return h.chunks[i-1].ts
+}
+
+type connection struct {
+	client      endpoint
+	clientKnown bool
+	halves      map[endpoint]*halfStream
+	closed      bool
+}
+
+func newConnection() *connection {
+	return &connection{halves: make(map[endpoint]*halfStream)}
+}
+
+func (c *connection) add(seg *segment, ts time.Time) {
+	if seg.flags&tcpSYN != 0 && seg.flags&tcpACK == 0 {
+		c.client = seg.src
+		c.clientKnown = true
+	}
+
+	if seg.flags&(tcpFIN|tcpRST) != 0 {
+		c.closed = true
+	}
+
+	half, ok := c.halves[seg.src]
+	if !ok {
+		half = &halfStream{}
+		c.halves[seg.src] = half
+	}
+
+	half.add(seg, ts)
+}
+
+func (c *connection) hasData() bool {
+	for _, half := range c.halves {
+		if len(half.data) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sides returns the client and server streams. Without a SYN in the capture
+// the client is the side whose data starts with an HTTP request line.
+func (c *connection) sides() (client, server *halfStream, clientAddr endpoint, ok bool) {
+	if c.clientKnown {
+		for addr, half := range c.halves {
+			if addr == c.client {
+				client = half
+			} else {
+				server = half
+			}
+		}
+
+		return client, server, c.client, client != nil
+	}
+
+	for addr, half := range c.halves {
+		if looksLikeRequest(half.data) {
+			client, clientAddr = half, addr
+		} else {
+			server = half
+		}
+	}
+
+	return client, server, clientAddr, client != nil
+}
+
+func connectionKey(a, b endpoint) [2]endpoint {
+	if a.addr.Less(b.addr) || (a.addr == b.addr && a.port < b.port) {
+		return [2]endpoint{a, b}
+	}
+
+	return [2]endpoint{b, a}
+}
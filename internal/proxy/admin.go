@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// newAdminHandler serves the admin API of a running capture:
+//
+//	POST /pause    stop recording; requests are still proxied
+//	POST /resume   record again
+//	POST /rotate   start a new capture file now
+//	GET  /stats    counters as JSON
+//	GET  /metrics  counters and the latency histogram for Prometheus
+//	GET  /ca.pem   the CA certificate of a forward proxy
+func newAdminHandler(rec *recorder) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		rec.paused.Store(true)
+		writeJSON(w, rec.stats())
+	})
+
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		rec.paused.Store(false)
+		writeJSON(w, rec.stats())
+	})
+
+	mux.HandleFunc("POST /rotate", func(w http.ResponseWriter, r *http.Request) {
+		if err := rec.forceRotate(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		writeJSON(w, rec.stats())
+	})
+
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, rec.stats())
+	})
+
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		rec.metrics.writePrometheus(w, rec.paused.Load())
+	})
+
+	if ca := rec.config.CA; ca != nil {
+		mux.HandleFunc("GET /ca.pem", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/x-pem-file")
+			_, _ = w.Write(ca.PEM())
+		})
+	}
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,319 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/websocket"
+)
+
+func TestAdmin(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "traffic.json")
+	file, err := openCaptureFile(path, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &CaptureConfig{Upstream: upstream.URL, OutputFile: path}
+	rec := &recorder{config: config, writer: bufio.NewWriter(file), file: file}
+	if err := rec.writeHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newHandler(config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	admin := httptest.NewServer(newAdminHandler(rec))
+	defer admin.Close()
+
+	get := func(t *testing.T, path string) {
+		t.Helper()
+
+		resp, err := http.Get(proxy.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	call := func(t *testing.T, method, path string) string {
+		t.Helper()
+
+		req, _ := http.NewRequest(method, admin.URL+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: unexpected status %d: %s", method, path, resp.StatusCode, body)
+		}
+
+		return string(body)
+	}
+
+	current := func(t *testing.T) stats {
+		t.Helper()
+
+		var s stats
+		if err := json.Unmarshal([]byte(call(t, http.MethodGet, "/stats")), &s); err != nil {
+			t.Fatal(err)
+		}
+
+		return s
+	}
+
+	t.Run("pause and resume", func(t *testing.T) {
+		get(t, "/recorded")
+		call(t, http.MethodPost, "/pause")
+		get(t, "/paused")
+
+		if s := current(t); !s.Paused || s.Requests != 2 || s.Captured != 1 || s.Dropped != 1 {
+			t.Errorf("unexpected stats while paused: %+v", s)
+		}
+
+		call(t, http.MethodPost, "/resume")
+		get(t, "/resumed")
+
+		data, _ := os.ReadFile(path)
+		if strings.Contains(string(data), "/paused") || !strings.Contains(string(data), "/resumed") {
+			t.Errorf("expected only the exchanges outside the pause, got %s", data)
+		}
+
+		if s := current(t); s.Paused || s.Captured != 2 || s.Output != path || s.Bytes == 0 {
+			t.Errorf("unexpected stats after resume: %+v", s)
+		}
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		call(t, http.MethodPost, "/rotate")
+		get(t, "/rotated")
+
+		rotated, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "traffic-*.json"))
+		if len(rotated) != 1 {
+			t.Fatalf("expected 1 rotated file, got %v", rotated)
+		}
+
+		data, _ := os.ReadFile(path)
+		if !strings.Contains(string(data), "replayer_format") || !strings.Contains(string(data), "/rotated") || strings.Contains(string(data), "/resumed") {
+			t.Errorf("expected a new file with its own header, got %s", data)
+		}
+
+		if s := current(t); s.Rotations != 1 {
+			t.Errorf("expected 1 rotation, got %d", s.Rotations)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, admin.URL+"/rotate", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("expected rotate to require POST, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("upstream errors", func(t *testing.T) {
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+
+		config := &CaptureConfig{Upstream: down.URL}
+		rec := &recorder{config: config, writer: bufio.NewWriter(io.Discard)}
+
+		handler, err := newHandler(config, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/down", nil))
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("expected 502, got %d", w.Code)
+		}
+
+		if s := rec.stats(); s.UpstreamErrors != 1 || s.Requests != 1 {
+			t.Errorf("unexpected stats: %+v", s)
+		}
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		body := call(t, http.MethodGet, "/metrics")
+
+		for _, want := range []string{
+			"# TYPE replayer_capture_requests_total counter\nreplayer_capture_requests_total 4\n",
+			"replayer_capture_entries_total 3\n",
+			"replayer_capture_dropped_total 1\n",
+			"replayer_capture_rotations_total 1\n",
+			"replayer_capture_paused 0\n",
+			"# TYPE replayer_capture_latency_seconds histogram\n",
+			`replayer_capture_latency_seconds_bucket{le="0.005"} `,
+			`replayer_capture_latency_seconds_bucket{le="+Inf"} 4` + "\n",
+			"replayer_capture_latency_seconds_count 4\n",
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("expected %q in:\n%s", want, body)
+			}
+		}
+	})
+}
+
+func TestServeShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, &CaptureConfig{ListenAddr: "127.0.0.1:0", Upstream: "http://127.0.0.1:1", OutputFile: path})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the capture to shut down")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), "replayer_format") {
+		t.Errorf("expected the flushed header, got %q", data)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsUpgrade(r.Header) {
+			conn, err := websocket.Upgrade(w, r)
+			if err != nil {
+				return
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			for {
+				opcode, payload, err := conn.ReadMessage()
+				if err != nil || conn.WriteMessage(opcode, payload) != nil {
+					return
+				}
+			}
+		}
+
+		// A long poll that only ends when the proxy gives up on it.
+		_, _ = io.WriteString(w, "partial")
+		http.NewResponseController(w).Flush()
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	var buf bytes.Buffer
+	rec := &recorder{config: &CaptureConfig{Upstream: upstream.URL}, writer: bufio.NewWriter(&buf)}
+
+	handler, err := newHandler(rec.config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 2 * time.Second}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	addr := listener.Addr().String()
+
+	resp, err := http.Get("http://" + addr + "/poll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if _, err := io.ReadFull(resp.Body, make([]byte, len("partial"))); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, _, err := websocket.Dial("ws://"+addr+"/ws", nil, 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if err := conn.WriteMessage(websocket.OpText, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := shutdown([]*http.Server{server}, rec, 100*time.Millisecond); err != nil {
+		t.Fatalf("expected the deadline to be a clean stop, got %v", err)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	entries := map[string]CapturedEntry{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry CapturedEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("unexpected record %q: %v", line, err)
+		}
+
+		entries[entry.Path] = entry
+	}
+
+	if poll, ok := entries["/poll"]; !ok || string(poll.logEntry().DecodedResponseBody()) != "partial" {
+		t.Errorf("expected the cut long poll to be recorded, got %+v", entries)
+	}
+
+	if ws, ok := entries["/ws"]; !ok || len(ws.WebSocket) == 0 || ws.WebSocket[0].Data != "hello" {
+		t.Errorf("expected the websocket session to be recorded, got %+v", entries)
+	}
+}
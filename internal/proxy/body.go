@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// bodyTap keeps a copy of the first limit bytes (all of them when limit is
+// 0) that the proxy streams through a body and counts the rest, so large
+// bodies are never buffered whole. done runs once, at the end of the body
+// or when it is closed early.
+type bodyTap struct {
+	body  io.ReadCloser
+	limit int64
+	// drain reads what is left of the body, up to the limit, when it is
+	// closed early, so a request the upstream failed on is still
+	// recorded whole.
+	drain bool
+
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	size int64
+	eof  bool
+	err  error
+
+	// chunks time the reads from start on, while the copy is not cut.
+	start  time.Time
+	chunks []models.Chunk
+
+	once sync.Once
+	done func()
+}
+
+func newBodyTap(body io.ReadCloser, limit int64, done func()) *bodyTap {
+	return &bodyTap{body: body, limit: limit, done: done}
+}
+
+func (t *bodyTap) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+
+	t.mu.Lock()
+	t.size += int64(n)
+	keep := int64(n)
+	if t.limit > 0 {
+		keep = min(keep, max(t.limit-int64(t.buf.Len()), 0))
+	}
+	t.buf.Write(p[:keep])
+	if !t.start.IsZero() && n > 0 && keep == int64(n) {
+		t.chunks = append(t.chunks, models.Chunk{OffsetMs: time.Since(t.start).Milliseconds(), Size: n})
+	}
+	if err == io.EOF {
+		t.eof = true
+	} else if err != nil && t.err == nil {
+		t.err = err
+	}
+	t.mu.Unlock()
+
+	if err == io.EOF {
+		t.finish()
+	}
+
+	return n, err
+}
+
+// timeChunks records when every piece of the body is read, relative to
+// start.
+func (t *bodyTap) timeChunks(start time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.start = start
+}
+
+func (t *bodyTap) timedChunks() []models.Chunk {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.chunks
+}
+
+func (t *bodyTap) Close() error {
+	if t.drain {
+		t.drainRest()
+	}
+
+	err := t.body.Close()
+	t.finish()
+	return err
+}
+
+func (t *bodyTap) drainRest() {
+	t.mu.Lock()
+	ended := t.eof || t.err != nil
+	left := t.limit - int64(t.buf.Len())
+	t.mu.Unlock()
+
+	if ended || (t.limit > 0 && left <= 0) {
+		return
+	}
+
+	var r io.Reader = t
+	if t.limit > 0 {
+		// One byte more tells whether the copy is cut.
+		r = io.LimitReader(t, left+1)
+	}
+
+	_, _ = io.Copy(io.Discard, r)
+}
+
+func (t *bodyTap) finish() {
+	if t.done != nil {
+		t.once.Do(t.done)
+	}
+}
+
+// interrupted reports whether the body was closed before its end, and the
+// read error that cut it short, if any. Without one, the reader stopped:
+// for a response, the proxy could no longer write to the client.
+func (t *bodyTap) interrupted() (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return !t.eof, t.err
+}
+
+// captured returns the bytes kept so far, the size of everything read and
+// whether the copy was cut at the limit.
+func (t *bodyTap) captured() ([]byte, int64, bool) {
+	if t == nil {
+		return nil, 0, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return bytes.Clone(t.buf.Bytes()), t.size, t.size > int64(t.buf.Len())
+}
@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"container/list"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLeaves is how many issued certificates are kept for reuse.
+const maxLeaves = 1024
+
+// CertAuthority issues the certificates the forward proxy presents for the
+// hosts it intercepts. Clients must trust its certificate.
+type CertAuthority struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	certPEM []byte
+
+	mu      sync.Mutex
+	leafKey *ecdsa.PrivateKey
+	// leaves caches certificates by host, least recently used at the back
+	// of recent, up to maxLeaves of them.
+	leaves    map[string]*list.Element
+	recent    *list.List
+	maxLeaves int
+}
+
+type leafEntry struct {
+	host string
+	cert *tls.Certificate
+}
+
+// NewCA generates a CA that lives as long as the process.
+func NewCA() (*CertAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "replayer capture CA", Organization: []string{"replayer"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	return newCertAuthority(der, key)
+}
+
+// LoadOrCreateCA reads the CA certificate and key from PEM files, or
+// generates a CA and writes it there on first use.
+func LoadOrCreateCA(certPath, keyPath string) (*CertAuthority, error) {
+	certPEM, certErr := os.ReadFile(filepath.Clean(certPath)) // #nosec G304 -- CA path comes from CLI flags
+	keyPEM, keyErr := os.ReadFile(filepath.Clean(keyPath))    // #nosec G304 -- CA path comes from CLI flags
+
+	if errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist) {
+		ca, err := NewCA()
+		if err != nil {
+			return nil, err
+		}
+
+		keyDER, err := x509.MarshalPKCS8PrivateKey(ca.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode CA key: %w", err)
+		}
+
+		if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write CA key: %w", err)
+		}
+
+		if err := os.WriteFile(certPath, ca.certPEM, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write CA certificate: %w", err)
+		}
+
+		return ca, nil
+	}
+
+	if certErr != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", certErr)
+	}
+
+	if keyErr != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", keyErr)
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA: %w", err)
+	}
+
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type %T", pair.PrivateKey)
+	}
+
+	return newCertAuthority(pair.Certificate[0], key)
+}
+
+func newCertAuthority(der []byte, key crypto.Signer) (*CertAuthority, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	if !cert.IsCA {
+		return nil, fmt.Errorf("certificate %q is not a CA", cert.Subject.CommonName)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+
+	return &CertAuthority{
+		cert:      cert,
+		key:       key,
+		certPEM:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		leafKey:   leafKey,
+		leaves:    map[string]*list.Element{},
+		recent:    list.New(),
+		maxLeaves: maxLeaves,
+	}, nil
+}
+
+// PEM returns the CA certificate for clients to trust.
+func (ca *CertAuthority) PEM() []byte {
+	return ca.certPEM
+}
+
+// leaf returns the certificate for host, issuing it on first use. All
+// of them share one key.
+func (ca *CertAuthority) leaf(host string) (*tls.Certificate, error) {
+	host = strings.ToLower(host)
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if elem, ok := ca.leaves[host]; ok {
+		if cert := elem.Value.(*leafEntry).cert; time.Now().Before(cert.Leaf.NotAfter) {
+			ca.recent.MoveToFront(elem)
+			return cert, nil
+		}
+
+		ca.recent.Remove(elem)
+		delete(ca.leaves, host)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.AddDate(1, 0, 0)
+	if ca.cert.NotAfter.Before(notAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &ca.leafKey.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue certificate for %s: %w", host, err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  ca.leafKey,
+		Leaf:        leaf,
+	}
+
+	ca.leaves[host] = ca.recent.PushFront(&leafEntry{host: host, cert: cert})
+	if ca.recent.Len() > ca.maxLeaves {
+		oldest := ca.recent.Back()
+		ca.recent.Remove(oldest)
+		delete(ca.leaves, oldest.Value.(*leafEntry).host)
+	}
+
+	return cert, nil
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	return serial, nil
+}
@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// connTracker keeps the connections hijacked from the servers: WebSocket
+// sessions, CONNECT tunnels and h2c connections. Shutdown and Close leave
+// those open, so they are closed here once the servers have stopped. It
+// also keeps the servers of the intercepted tunnels, to stop them with the
+// others.
+type connTracker struct {
+	mu      sync.Mutex
+	conns   map[*trackedConn]struct{}
+	servers map[*http.Server]struct{}
+	closed  bool
+}
+
+// addServer registers the server of a tunnel. It returns false once the
+// servers are being stopped; the tunnel must not be served then.
+func (t *connTracker) addServer(server *http.Server) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return false
+	}
+
+	if t.servers == nil {
+		t.servers = make(map[*http.Server]struct{})
+	}
+
+	t.servers[server] = struct{}{}
+	return true
+}
+
+func (t *connTracker) removeServer(server *http.Server) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.servers, server)
+}
+
+// stopServers stops the tunnel servers like the others, and keeps new
+// ones from starting.
+func (t *connTracker) stopServers(ctx context.Context) error {
+	t.mu.Lock()
+	t.closed = true
+	servers := make([]*http.Server, 0, len(t.servers))
+	for server := range t.servers {
+		servers = append(servers, server)
+	}
+	t.mu.Unlock()
+
+	var errs []error
+	for _, server := range servers {
+		if err := stopServer(ctx, server); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// stopServer shuts server down gracefully until ctx is done, then closes
+// the connections still open.
+func stopServer(ctx context.Context, server *http.Server) error {
+	err := server.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return server.Close()
+	}
+
+	return err
+}
+
+// add returns conn wrapped so it leaves the tracker when closed. After
+// closeAll the connection is closed right away.
+func (t *connTracker) add(conn net.Conn) net.Conn {
+	tc := &trackedConn{Conn: conn, tracker: t}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		_ = conn.Close()
+		return tc
+	}
+
+	if t.conns == nil {
+		t.conns = make(map[*trackedConn]struct{})
+	}
+
+	t.conns[tc] = struct{}{}
+	return tc
+}
+
+func (t *connTracker) remove(tc *trackedConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.conns, tc)
+}
+
+// closeAll closes the tracked connections and any added later.
+func (t *connTracker) closeAll() {
+	t.mu.Lock()
+	t.closed = true
+	conns := make([]*trackedConn, 0, len(t.conns))
+	for tc := range t.conns {
+		conns = append(conns, tc)
+	}
+	t.mu.Unlock()
+
+	for _, tc := range conns {
+		_ = tc.Close()
+	}
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.tracker.remove(c)
+	})
+
+	return c.Conn.Close()
+}
+
+// trackingWriter registers the connections hijacked through it.
+type trackingWriter struct {
+	http.ResponseWriter
+	conns *connTracker
+}
+
+func (w *trackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return w.conns.add(conn), brw, nil
+}
+
+func (w *trackingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// trackHijacked makes the connections next hijacks known to conns.
+func trackHijacked(next http.Handler, conns *connTracker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&trackingWriter{ResponseWriter: w, conns: conns}, r)
+	})
+}
@@ -0,0 +1,378 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/route"
+)
+
+// FaultRule injects faults into the requests of a route, a route key such
+// as "GET /users/{id}" or a template such as "/users/{id}" (see --route),
+// or under a path prefix. Without either it applies to every request. Each
+// fault fires at its own rate; latency comes on top of the others, and at
+// most one of error, reset and truncate fires, in that order.
+type FaultRule struct {
+	Name   string `yaml:"name"`
+	Route  string `yaml:"route"`
+	Prefix string `yaml:"prefix"`
+
+	Latency  *LatencyFault  `yaml:"latency"`
+	Error    *ErrorFault    `yaml:"error"`
+	Reset    *ResetFault    `yaml:"reset"`
+	Truncate *TruncateFault `yaml:"truncate"`
+}
+
+// LatencyFault delays requests before they are forwarded, by Delay
+// (fixed), between Min and Max (uniform), around Mean with StdDev (normal)
+// or with Mean on average (exponential).
+type LatencyFault struct {
+	Rate         float64       `yaml:"rate"`
+	Distribution string        `yaml:"distribution"`
+	Delay        time.Duration `yaml:"delay"`
+	Min          time.Duration `yaml:"min"`
+	Max          time.Duration `yaml:"max"`
+	Mean         time.Duration `yaml:"mean"`
+	StdDev       time.Duration `yaml:"stddev"`
+}
+
+// ErrorFault answers with Status and Body instead of the upstream.
+type ErrorFault struct {
+	Rate   float64 `yaml:"rate"`
+	Status int     `yaml:"status"`
+	Body   string  `yaml:"body"`
+}
+
+// ResetFault drops the client connection without an answer.
+type ResetFault struct {
+	Rate float64 `yaml:"rate"`
+}
+
+// TruncateFault cuts the upstream response after After bytes of its body
+// and drops the connection.
+type TruncateFault struct {
+	Rate  float64 `yaml:"rate"`
+	After int64   `yaml:"after"`
+}
+
+// Latency distributions.
+const (
+	DistributionFixed       = "fixed"
+	DistributionUniform     = "uniform"
+	DistributionNormal      = "normal"
+	DistributionExponential = "exponential"
+)
+
+// LoadFaults reads the fault rules of a YAML file:
+//
+//	faults:
+//	  - name: slow-users
+//	    route: GET /users/{id}
+//	    latency: {rate: 0.2, distribution: normal, mean: 300ms, stddev: 100ms}
+//	    error: {rate: 0.05, status: 503}
+func LoadFaults(path string) ([]FaultRule, error) {
+	data, err := os.ReadFile(filepath.Clean(path)) // #nosec G304 -- config path comes from CLI flags
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fault config: %w", err)
+	}
+
+	var config struct {
+		Faults []FaultRule `yaml:"faults"`
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse fault config: %w", err)
+	}
+
+	if len(config.Faults) == 0 {
+		return nil, fmt.Errorf("fault config has no faults")
+	}
+
+	return config.Faults, nil
+}
+
+func (r FaultRule) validate() error {
+	rates := map[string]float64{}
+	if r.Latency != nil {
+		rates["latency"] = r.Latency.Rate
+
+		switch r.Latency.Distribution {
+		case "", DistributionFixed:
+			if r.Latency.Delay <= 0 {
+				return fmt.Errorf("latency: delay is required")
+			}
+		case DistributionUniform:
+			if r.Latency.Max <= r.Latency.Min || r.Latency.Min < 0 {
+				return fmt.Errorf("latency: max must be greater than min")
+			}
+		case DistributionNormal, DistributionExponential:
+			if r.Latency.Mean <= 0 || r.Latency.StdDev < 0 {
+				return fmt.Errorf("latency: mean is required")
+			}
+		default:
+			return fmt.Errorf("latency: unknown distribution %q", r.Latency.Distribution)
+		}
+	}
+
+	if r.Error != nil {
+		rates["error"] = r.Error.Rate
+		if r.Error.Status != 0 && (r.Error.Status < 100 || r.Error.Status > 599) {
+			return fmt.Errorf("error: invalid status %d", r.Error.Status)
+		}
+	}
+
+	if r.Reset != nil {
+		rates["reset"] = r.Reset.Rate
+	}
+
+	if r.Truncate != nil {
+		rates["truncate"] = r.Truncate.Rate
+		if r.Truncate.After < 0 {
+			return fmt.Errorf("truncate: after cannot be negative")
+		}
+	}
+
+	if len(rates) == 0 {
+		return fmt.Errorf("no fault is configured")
+	}
+
+	for name, rate := range rates {
+		if rate <= 0 || rate > 1 {
+			return fmt.Errorf("%s: rate must be greater than 0 and at most 1", name)
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether a request belongs to the rule, by the route key
+// or template the templater gives it, or by path prefix.
+func (r FaultRule) matches(routes *route.Templater, req *http.Request) bool {
+	if r.Prefix != "" && !hasPathPrefix(req.URL.Path, r.Prefix) {
+		return false
+	}
+
+	if r.Route == "" {
+		return true
+	}
+
+	key := routes.Key(req.Method, req.URL.Path)
+	_, template, _ := strings.Cut(key, " ")
+	return key == r.Route || template == r.Route
+}
+
+// delay draws a latency from the distribution.
+func (f *LatencyFault) delay() time.Duration {
+	var d float64
+	switch f.Distribution {
+	case DistributionUniform:
+		d = float64(f.Min) + rand.Float64()*float64(f.Max-f.Min) // #nosec G404 -- fault injection needs no secure randomness
+	case DistributionNormal:
+		d = float64(f.Mean) + rand.NormFloat64()*float64(f.StdDev) // #nosec G404 -- fault injection needs no secure randomness
+	case DistributionExponential:
+		d = rand.ExpFloat64() * float64(f.Mean) // #nosec G404 -- fault injection needs no secure randomness
+	default:
+		d = float64(f.Delay)
+	}
+
+	return time.Duration(max(d, 0))
+}
+
+// Fault types.
+const (
+	faultError    = "error"
+	faultReset    = "reset"
+	faultTruncate = "truncate"
+)
+
+// injector decides which faults a request gets.
+type injector struct {
+	rules  []FaultRule
+	routes *route.Templater
+}
+
+// newInjector returns nil without fault rules.
+func newInjector(config *CaptureConfig) (*injector, error) {
+	if len(config.Faults) == 0 {
+		return nil, nil
+	}
+
+	for i, rule := range config.Faults {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("fault %d: %w", i+1, err)
+		}
+
+		if rule.Prefix != "" && !strings.HasPrefix(rule.Prefix, "/") {
+			return nil, fmt.Errorf("fault %d: prefix %q must start with /", i+1, rule.Prefix)
+		}
+	}
+
+	return &injector{rules: config.Faults, routes: config.Routes}, nil
+}
+
+// pick returns the faults of the first rule matching the request, or nil
+// when none fires.
+func (in *injector) pick(req *http.Request) *injection {
+	if in == nil {
+		return nil
+	}
+
+	for _, rule := range in.rules {
+		if !rule.matches(in.routes, req) {
+			continue
+		}
+
+		inj := &injection{Fault: models.Fault{Rule: rule.Name}}
+		if rule.Latency != nil && fires(rule.Latency.Rate) {
+			inj.delay = rule.Latency.delay()
+			inj.DelayMs = inj.delay.Milliseconds()
+		}
+
+		switch {
+		case rule.Error != nil && fires(rule.Error.Rate):
+			inj.Type, inj.Status, inj.body = faultError, rule.Error.Status, rule.Error.Body
+			if inj.Status == 0 {
+				inj.Status = http.StatusServiceUnavailable
+			}
+		case rule.Reset != nil && fires(rule.Reset.Rate):
+			inj.Type = faultReset
+		case rule.Truncate != nil && fires(rule.Truncate.Rate):
+			inj.Type, inj.TruncatedAt = faultTruncate, rule.Truncate.After
+		}
+
+		if inj.delay == 0 && inj.Type == "" {
+			return nil
+		}
+
+		return inj
+	}
+
+	return nil
+}
+
+func fires(rate float64) bool {
+	return rate >= 1 || rand.Float64() < rate // #nosec G404 -- fault injection needs no secure randomness
+}
+
+// injection is what happens to one request; Fault is recorded with it.
+type injection struct {
+	models.Fault
+	delay time.Duration
+	body  string
+}
+
+// errInjected marks the failures the proxy caused on purpose.
+var errInjected = errors.New("injected fault")
+
+// truncatedBody ends a response body early with an error, so the proxy
+// drops the connection as if the upstream had.
+type truncatedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		return 0, fmt.Errorf("%w: response truncated", errInjected)
+	}
+
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
+
+// reset drops the client connection, with a TCP reset where possible.
+// HTTP/2 streams, which cannot be hijacked, are reset instead.
+func reset(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		_ = tcp.SetLinger(0)
+	}
+
+	_ = conn.Close()
+}
+
+// inject applies the faults of a request before it is forwarded, and
+// reports whether it still should be. Errors and resets are recorded here,
+// as the upstream is never called.
+func inject(w http.ResponseWriter, r *http.Request, inj *injection, rec *recorder) bool {
+	cr, ok := r.Context().Value(clientRequestKey{}).(*clientRequest)
+	if !ok {
+		return true
+	}
+
+	cr.fault = inj
+
+	if inj.delay > 0 {
+		timer := time.NewTimer(inj.delay)
+		defer timer.Stop()
+
+		// A client that gives up is recorded by the proxy as an abort.
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+		}
+	}
+
+	if inj.Type != faultError && inj.Type != faultReset {
+		return true
+	}
+
+	// The request is recorded whole for replay.
+	if cr.body != nil {
+		cr.body.drainRest()
+	}
+
+	resp := &http.Response{Request: r, Header: http.Header{}}
+	if inj.Type == faultError {
+		resp.StatusCode = inj.Status
+		if inj.body != "" {
+			resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		}
+	}
+
+	entry := newEntry(resp)
+	entry.ResponseBody = base64.StdEncoding.EncodeToString([]byte(inj.body))
+	entry.LatencyMs = time.Since(entry.Timestamp).Milliseconds()
+	if inj.Type == faultReset {
+		entry.Error = fmt.Sprintf("%v: connection reset", errInjected)
+	}
+
+	if err := rec.record(entry); err != nil {
+		log.Printf("Failed to record exchange: %v\n", err)
+	}
+
+	if inj.Type == faultReset {
+		reset(w)
+		return false
+	}
+
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+
+	w.WriteHeader(inj.Status)
+	_, _ = io.WriteString(w, inj.body)
+	return false
+}
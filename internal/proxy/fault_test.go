@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/route"
+)
+
+func TestLoadFaults(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "faults.yaml")
+		config := "faults:\n  - name: slow-users\n    route: GET /users/{id}\n    latency: {rate: 0.5, distribution: uniform, min: 100ms, max: 300ms}\n    error: {rate: 0.1, status: 500}\n"
+		if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		rules, err := LoadFaults(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(rules) != 1 || rules[0].Latency.Max != 300*time.Millisecond || rules[0].Error.Status != 500 {
+			t.Errorf("unexpected rules: %+v", rules)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "faults.yaml")
+		if err := os.WriteFile(path, []byte("faults: []\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadFaults(path); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for name, rule := range map[string]FaultRule{
+			"no fault":      {Route: "/users"},
+			"zero rate":     {Reset: &ResetFault{}},
+			"rate above 1":  {Reset: &ResetFault{Rate: 2}},
+			"no delay":      {Latency: &LatencyFault{Rate: 1}},
+			"uniform range": {Latency: &LatencyFault{Rate: 1, Distribution: DistributionUniform, Min: time.Second}},
+			"distribution":  {Latency: &LatencyFault{Rate: 1, Distribution: "pareto", Mean: time.Second}},
+			"status":        {Error: &ErrorFault{Rate: 1, Status: 700}},
+			"prefix":        {Prefix: "users", Reset: &ResetFault{Rate: 1}},
+		} {
+			t.Run(name, func(t *testing.T) {
+				if _, err := newInjector(&CaptureConfig{Faults: []FaultRule{rule}}); err == nil {
+					t.Error("expected an error")
+				}
+			})
+		}
+	})
+}
+
+func TestLatencyDistributions(t *testing.T) {
+	tests := []struct {
+		fault    LatencyFault
+		min, max time.Duration
+	}{
+		{LatencyFault{Delay: 50 * time.Millisecond}, 50 * time.Millisecond, 50 * time.Millisecond},
+		{LatencyFault{Distribution: DistributionUniform, Min: 10 * time.Millisecond, Max: 20 * time.Millisecond}, 10 * time.Millisecond, 20 * time.Millisecond},
+		{LatencyFault{Distribution: DistributionNormal, Mean: 100 * time.Millisecond, StdDev: time.Second}, 0, time.Hour},
+		{LatencyFault{Distribution: DistributionExponential, Mean: 100 * time.Millisecond}, 0, time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fault.Distribution, func(t *testing.T) {
+			for range 100 {
+				if d := tt.fault.delay(); d < tt.min || d > tt.max {
+					t.Fatalf("delay %v out of [%v, %v]", d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestCaptureFaults(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello from "+r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	routes, err := route.New([]string{"/users/{id}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capture := func(t *testing.T, rule FaultRule, send func(url string)) (CapturedEntry, *recorder) {
+		t.Helper()
+
+		var buf bytes.Buffer
+		rec := &recorder{config: &CaptureConfig{Upstream: upstream.URL, Routes: routes, Faults: []FaultRule{rule}}, writer: bufio.NewWriter(&buf)}
+
+		handler, err := newHandler(rec.config, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		proxy := httptest.NewServer(handler)
+		defer proxy.Close()
+
+		send(proxy.URL)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for rec.metrics.captured.Load() == 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("expected the exchange to be recorded")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+
+		var entry CapturedEntry
+		if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		return entry, rec
+	}
+
+	get := func(path string) func(url string) {
+		return func(url string) {
+			resp, err := http.Get(url + path)
+			if err != nil {
+				return
+			}
+
+			_, _ = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+		}
+	}
+
+	t.Run("latency", func(t *testing.T) {
+		rule := FaultRule{Name: "slow", Route: "GET /users/{id}", Latency: &LatencyFault{Rate: 1, Delay: 100 * time.Millisecond}}
+		entry, rec := capture(t, rule, get("/users/7"))
+
+		if entry.Status != http.StatusOK || entry.LatencyMs < 100 {
+			t.Errorf("expected a delayed 200, got %d after %dms", entry.Status, entry.LatencyMs)
+		}
+
+		if entry.Fault == nil || entry.Fault.Rule != "slow" || entry.Fault.DelayMs != 100 || entry.Fault.Type != "" {
+			t.Errorf("unexpected fault: %+v", entry.Fault)
+		}
+
+		if rec.metrics.faults.Load() != 1 {
+			t.Errorf("expected 1 fault, got %d", rec.metrics.faults.Load())
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		rule := FaultRule{Prefix: "/users", Error: &ErrorFault{Rate: 1, Status: http.StatusTooManyRequests, Body: "slow down"}}
+		entry, _ := capture(t, rule, func(url string) {
+			resp, err := http.Post(url+"/users", "application/json", strings.NewReader(`{"id":1}`))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusTooManyRequests || string(body) != "slow down" {
+				t.Errorf("unexpected response %d %q", resp.StatusCode, body)
+			}
+		})
+
+		if entry.Status != http.StatusTooManyRequests || entry.Fault == nil || entry.Fault.Type != faultError || entry.Fault.Status != http.StatusTooManyRequests {
+			t.Errorf("unexpected entry: %d %+v", entry.Status, entry.Fault)
+		}
+
+		log := entry.logEntry()
+		if string(log.DecodedResponseBody()) != "slow down" || string(log.DecodedBody()) != `{"id":1}` {
+			t.Errorf("unexpected bodies %q %q", log.DecodedBody(), log.DecodedResponseBody())
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		rule := FaultRule{Reset: &ResetFault{Rate: 1}}
+		entry, rec := capture(t, rule, func(url string) {
+			if resp, err := http.Get(url + "/orders"); err == nil {
+				_ = resp.Body.Close()
+				t.Error("expected the connection to be reset")
+			}
+		})
+
+		if entry.Status != 0 || entry.Fault == nil || entry.Fault.Type != faultReset || !strings.HasPrefix(entry.Error, "injected fault") {
+			t.Errorf("unexpected entry: %d %q %+v", entry.Status, entry.Error, entry.Fault)
+		}
+
+		if rec.metrics.upstreamErrors.Load() != 0 {
+			t.Error("expected injected faults not to count as upstream errors")
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		rule := FaultRule{Truncate: &TruncateFault{Rate: 1, After: 5}}
+		entry, rec := capture(t, rule, get("/orders"))
+
+		if entry.Fault == nil || entry.Fault.Type != faultTruncate || entry.Fault.TruncatedAt != 5 {
+			t.Errorf("unexpected fault: %+v", entry.Fault)
+		}
+
+		if entry.Error != "injected fault: response truncated" {
+			t.Errorf("unexpected error %q", entry.Error)
+		}
+
+		if body := entry.logEntry().DecodedResponseBody(); string(body) != "hello" {
+			t.Errorf("unexpected recorded response %q", body)
+		}
+
+		if rec.metrics.upstreamErrors.Load() != 0 {
+			t.Error("expected injected faults not to count as upstream errors")
+		}
+	})
+
+	t.Run("sampled", func(t *testing.T) {
+		config := &CaptureConfig{Upstream: upstream.URL, SampleRate: 0.001, Faults: []FaultRule{{Prefix: "/users", Error: &ErrorFault{Rate: 1}}}}
+		rec := &recorder{config: config, writer: bufio.NewWriter(io.Discard), sampler: newSampler(config)}
+
+		handler, err := newHandler(config, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		proxy := httptest.NewServer(handler)
+		defer proxy.Close()
+
+		for range 20 {
+			get("/users/7")(proxy.URL)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for rec.metrics.captured.Load() < 20 {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected every fault to be recorded, got %d (%d dropped)", rec.metrics.captured.Load(), rec.metrics.dropped.Load())
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("unmatched", func(t *testing.T) {
+		rule := FaultRule{Route: "/users/{id}", Reset: &ResetFault{Rate: 1}}
+		entry, _ := capture(t, rule, get("/orders"))
+
+		if entry.Status != http.StatusOK || entry.Fault != nil {
+			t.Errorf("expected no fault, got %d %+v", entry.Status, entry.Fault)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// forwardHandler serves a forward proxy. Plain HTTP requests arrive with
+// absolute URLs; HTTPS ones through CONNECT tunnels, whose TLS is
+// terminated with a certificate for the host signed by ca so the requests
+// inside can be recorded.
+type forwardHandler struct {
+	ca      *CertAuthority
+	capture http.Handler
+	// conns stops the servers of the tunnels on shutdown.
+	conns *connTracker
+}
+
+func (f *forwardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		f.intercept(w, r)
+		return
+	}
+
+	if r.URL.Host == "" {
+		http.Error(w, "forward proxy requests need an absolute URL", http.StatusBadRequest)
+		return
+	}
+
+	f.capture.ServeHTTP(w, r)
+}
+
+// intercept answers CONNECT, then serves the requests the client sends
+// through the tunnel as if they came with https://host URLs.
+func (f *forwardHandler) intercept(w http.ResponseWriter, r *http.Request) {
+	authority := r.Host
+	host := authority
+	if h, _, err := net.SplitHostPort(authority); err == nil {
+		host = h
+	}
+
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "failed to open the tunnel", http.StatusInternalServerError)
+		return
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	tlsConn := tls.Server(conn, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				return f.ca.leaf(hello.ServerName)
+			}
+
+			return f.ca.leaf(host)
+		},
+	})
+
+	if err := tlsConn.HandshakeContext(r.Context()); err != nil {
+		log.Printf("TLS handshake for %s failed: %v\n", authority, err) //#nosec G706 -- the authority is logged for diagnostics only
+		_ = conn.Close()
+		return
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.URL.Scheme = "https"
+		req.URL.Host = authority
+		f.capture.ServeHTTP(w, req)
+	})
+
+	if tlsConn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+		(&http2.Server{}).ServeConn(tlsConn, &http2.ServeConnOpts{Context: r.Context(), Handler: handler})
+		return
+	}
+
+	listener := newConnListener(tlsConn)
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		ConnState:         listener.done,
+	}
+
+	if !f.conns.addServer(server) {
+		_ = tlsConn.Close()
+		return
+	}
+	defer f.conns.removeServer(server)
+
+	_ = server.Serve(listener)
+}
+
+// directUpstream is the upstream of a forward proxy request: the host it
+// was sent to.
+func directUpstream(u *url.URL) *upstream {
+	target := &url.URL{Scheme: u.Scheme, Host: u.Host}
+	return &upstream{UpstreamRoute: UpstreamRoute{URL: target.String()}, url: target}
+}
+
+// connListener hands out a single connection, then blocks until done is
+// called, so an http.Server can serve an intercepted tunnel.
+type connListener struct {
+	conn   net.Conn
+	once   sync.Once
+	served bool
+	closed chan struct{}
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	return &connListener{conn: conn, closed: make(chan struct{})}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	if !l.served {
+		l.served = true
+		return l.conn, nil
+	}
+
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+// done ends Serve once the connection is closed or hijacked.
+func (l *connListener) done(_ net.Conn, state http.ConnState) {
+	if state == http.StateClosed || state == http.StateHijacked {
+		l.once.Do(func() {
+			close(l.closed)
+		})
+	}
+}
+
+func (l *connListener) Close() error {
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
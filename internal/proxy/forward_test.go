@@ -0,0 +1,292 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreateCA(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+
+	created, err := LoadOrCreateCA(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := LoadOrCreateCA(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(created.PEM(), loaded.PEM()) {
+		t.Fatal("expected the saved CA to be loaded")
+	}
+
+	leaf, err := loaded.leaf("api.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(created.PEM())
+	if _, err := leaf.Leaf.Verify(x509.VerifyOptions{DNSName: "api.example.com", Roots: roots}); err != nil {
+		t.Errorf("expected the certificate to chain to the CA: %v", err)
+	}
+
+	if again, _ := loaded.leaf("API.example.com"); again != leaf {
+		t.Error("expected the certificate to be reused")
+	}
+
+	// Only the most recently used certificates are kept.
+	loaded.maxLeaves = 2
+	for _, host := range []string{"a.example.com", "api.example.com", "b.example.com"} {
+		if _, err := loaded.leaf(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(loaded.leaves) != 2 || loaded.recent.Len() != 2 {
+		t.Fatalf("expected 2 cached certificates, got %d", len(loaded.leaves))
+	}
+
+	if again, _ := loaded.leaf("api.example.com"); again != leaf {
+		t.Error("expected the recently used certificate to be kept")
+	}
+
+	if _, ok := loaded.leaves["a.example.com"]; ok {
+		t.Error("expected the least recently used certificate to be evicted")
+	}
+}
+
+func TestForwardProxy(t *testing.T) {
+	secure := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "secure "+r.URL.Path)
+	}))
+	secure.EnableHTTP2 = true
+	secure.StartTLS()
+	defer secure.Close()
+
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "plain "+r.URL.Path)
+	}))
+	defer plain.Close()
+
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstreamRoots := x509.NewCertPool()
+	upstreamRoots.AddCert(secure.Certificate())
+
+	var buf bytes.Buffer
+	config := &CaptureConfig{Forward: true, CA: ca, upstreamTLS: &tls.Config{RootCAs: upstreamRoots, MinVersion: tls.VersionTLS12}}
+	rec := &recorder{config: config, writer: bufio.NewWriter(&buf)}
+
+	handler, err := newHandler(config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	clientRoots := x509.NewCertPool()
+	clientRoots.AppendCertsFromPEM(ca.PEM())
+
+	client := func(http2 bool) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			Proxy:             http.ProxyURL(proxyURL),
+			TLSClientConfig:   &tls.Config{RootCAs: clientRoots, MinVersion: tls.VersionTLS12},
+			ForceAttemptHTTP2: http2,
+		}}
+	}
+
+	last := func(t *testing.T) CapturedEntry {
+		t.Helper()
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+		var entry CapturedEntry
+		if err := json.Unmarshal([]byte(lines[len(lines)-1]), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		return entry
+	}
+
+	get := func(t *testing.T, c *http.Client, target string) string {
+		t.Helper()
+
+		resp, err := c.Get(target)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	t.Run("intercepted https", func(t *testing.T) {
+		for _, tt := range []struct {
+			name  string
+			http2 bool
+			proto string
+		}{
+			{"http/1.1", false, "HTTP/1.1"},
+			{"h2", true, "HTTP/2.0"},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				if body := get(t, client(tt.http2), secure.URL+"/orders?page=2"); body != "secure /orders" {
+					t.Fatalf("unexpected response %q", body)
+				}
+
+				entry := last(t)
+				if entry.Path != "/orders?page=2" || entry.Upstream != secure.URL || entry.Proto != tt.proto {
+					t.Errorf("unexpected entry: %s %s %s", entry.Path, entry.Upstream, entry.Proto)
+				}
+
+				if entry.TLS == nil || entry.TLS.Version == "" {
+					t.Errorf("expected the client TLS details, got %+v", entry.TLS)
+				}
+
+				if body := entry.logEntry().DecodedResponseBody(); string(body) != "secure /orders" {
+					t.Errorf("unexpected recorded response %q", body)
+				}
+			})
+		}
+	})
+
+	t.Run("plain http", func(t *testing.T) {
+		if body := get(t, client(false), plain.URL+"/users"); body != "plain /users" {
+			t.Fatalf("unexpected response %q", body)
+		}
+
+		if entry := last(t); entry.Path != "/users" || entry.Upstream != plain.URL || entry.TLS != nil {
+			t.Errorf("unexpected entry: %s %s %+v", entry.Path, entry.Upstream, entry.TLS)
+		}
+	})
+
+	t.Run("origin form", func(t *testing.T) {
+		resp, err := http.Get(proxy.URL + "/users")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 without an absolute URL, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("default upstream", func(t *testing.T) {
+		config := &CaptureConfig{Forward: true, CA: ca, Upstream: plain.URL}
+		if _, err := newHandler(config, &recorder{config: config}); err == nil {
+			t.Error("expected an error with a default upstream")
+		}
+	})
+
+	t.Run("ca export", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		newAdminHandler(rec).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ca.pem", nil))
+		if !bytes.Equal(w.Body.Bytes(), ca.PEM()) {
+			t.Errorf("expected the CA certificate, got %q", w.Body.String())
+		}
+	})
+}
+
+func TestForwardShutdown(t *testing.T) {
+	received := make(chan struct{})
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		time.Sleep(200 * time.Millisecond)
+		_, _ = io.WriteString(w, "done")
+	}))
+	defer secure.Close()
+
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstreamRoots := x509.NewCertPool()
+	upstreamRoots.AddCert(secure.Certificate())
+
+	var buf bytes.Buffer
+	config := &CaptureConfig{Forward: true, CA: ca, upstreamTLS: &tls.Config{RootCAs: upstreamRoots, MinVersion: tls.VersionTLS12}}
+	rec := &recorder{config: config, writer: bufio.NewWriter(&buf)}
+
+	handler, err := newHandler(config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	clientRoots := x509.NewCertPool()
+	clientRoots.AppendCertsFromPEM(ca.PEM())
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{RootCAs: clientRoots, MinVersion: tls.VersionTLS12},
+	}}
+
+	result := make(chan string, 1)
+	go func() {
+		resp, err := client.Get(secure.URL + "/slow")
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		body, _ := io.ReadAll(resp.Body)
+		result <- string(body)
+	}()
+
+	<-received
+
+	// The exchange inside the tunnel gets to complete like the others.
+	if err := shutdown([]*http.Server{proxy.Config}, rec, 5*time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if body := <-result; body != "done" {
+		t.Errorf("expected the tunnelled exchange to complete, got %q", body)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	var entry CapturedEntry
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Path != "/slow" || entry.Error != "" || string(entry.logEntry().DecodedResponseBody()) != "done" {
+		t.Errorf("unexpected entry: %s %q", entry.Path, entry.Error)
+	}
+
+	if len(rec.conns.servers) != 0 {
+		t.Errorf("expected the tunnel servers to be gone, got %d", len(rec.conns.servers))
+	}
+}
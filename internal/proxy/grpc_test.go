@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kx0101/replayer/internal/grpc"
+	"github.com/kx0101/replayer/internal/grpc/grpctest"
+)
+
+func TestGRPCCapture(t *testing.T) {
+	upstream := httptest.NewServer(grpctest.Handler("Hello"))
+	defer upstream.Close()
+
+	var buf bytes.Buffer
+	rec := &recorder{config: &CaptureConfig{Upstream: upstream.URL}, writer: bufio.NewWriter(&buf)}
+
+	handler, err := newHandler(rec.config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	client := &http.Client{Transport: grpc.NewTransport(false, nil)}
+	call := func(name string) (int, string) {
+		msg := append([]byte{0x0A, byte(len(name))}, name...)
+		req, _ := http.NewRequest(http.MethodPost, proxy.URL+grpctest.SayHelloPath, bytes.NewReader(grpc.EncodeFrame(msg)))
+		req.Header.Set("Content-Type", grpc.ContentType)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		body, _ := io.ReadAll(resp.Body)
+		code, _, ok := grpc.Status(resp.Header, resp.Trailer)
+		if !ok {
+			t.Fatal("expected a grpc-status through the proxy")
+		}
+
+		return code, string(body)
+	}
+
+	if code, body := call("ada"); code != grpc.CodeOK || !strings.Contains(body, "Hello, ada") {
+		t.Errorf("unexpected reply: %d %q", code, body)
+	}
+
+	if code, _ := call(""); code != grpc.CodeInvalidArgument {
+		t.Errorf("expected INVALID_ARGUMENT, got %d", code)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 recorded calls, got %d", len(lines))
+	}
+
+	var ok, failed CapturedEntry
+	if err := json.Unmarshal([]byte(lines[0]), &ok); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &failed); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok.Status != http.StatusOK || ok.GRPC == nil || ok.GRPC.Code != grpc.CodeOK || ok.Path != grpctest.SayHelloPath {
+		t.Errorf("unexpected entry: %+v", ok)
+	}
+
+	if failed.Status != http.StatusBadRequest || failed.GRPC == nil || failed.GRPC.Message != "name is required" {
+		t.Errorf("unexpected entry: %+v", failed)
+	}
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the latency
+// histogram.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics counts what the capture proxy does.
+type metrics struct {
+	started time.Time
+
+	requests       atomic.Int64
+	captured       atomic.Int64
+	dropped        atomic.Int64
+	bytes          atomic.Int64
+	upstreamErrors atomic.Int64
+	rotations      atomic.Int64
+	faults         atomic.Int64
+
+	mu           sync.Mutex
+	bucketCounts []int64
+	latencySum   float64
+	latencyCount int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{started: time.Now(), bucketCounts: make([]int64, len(latencyBuckets))}
+}
+
+// observe adds the latency of a completed exchange to the histogram.
+func (m *metrics) observe(latency time.Duration) {
+	seconds := latency.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			m.bucketCounts[i]++
+		}
+	}
+
+	m.latencySum += seconds
+	m.latencyCount++
+}
+
+// stats is the JSON view of the counters served by the admin API.
+type stats struct {
+	Paused         bool      `json:"paused"`
+	Output         string    `json:"output"`
+	StartedAt      time.Time `json:"started_at"`
+	Requests       int64     `json:"requests"`
+	Captured       int64     `json:"captured"`
+	Dropped        int64     `json:"dropped"`
+	Bytes          int64     `json:"bytes"`
+	UpstreamErrors int64     `json:"upstream_errors"`
+	Rotations      int64     `json:"rotations"`
+	Faults         int64     `json:"faults"`
+}
+
+func (m *metrics) stats() stats {
+	return stats{
+		StartedAt:      m.started,
+		Requests:       m.requests.Load(),
+		Captured:       m.captured.Load(),
+		Dropped:        m.dropped.Load(),
+		Bytes:          m.bytes.Load(),
+		UpstreamErrors: m.upstreamErrors.Load(),
+		Rotations:      m.rotations.Load(),
+		Faults:         m.faults.Load(),
+	}
+}
+
+// writePrometheus writes the metrics in the Prometheus text format.
+func (m *metrics) writePrometheus(w io.Writer, paused bool) {
+	counter := func(name, help string, value int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+
+	counter("replayer_capture_requests_total", "Requests proxied to the upstream.", m.requests.Load())
+	counter("replayer_capture_entries_total", "Exchanges written to the capture.", m.captured.Load())
+	counter("replayer_capture_dropped_total", "Exchanges not written because of filters, sampling or a pause.", m.dropped.Load())
+	counter("replayer_capture_bytes_total", "Bytes written to the capture.", m.bytes.Load())
+	counter("replayer_capture_upstream_errors_total", "Requests the upstream could not answer.", m.upstreamErrors.Load())
+	counter("replayer_capture_rotations_total", "Capture file rotations.", m.rotations.Load())
+	counter("replayer_capture_faults_total", "Requests faults were injected into.", m.faults.Load())
+
+	pausedValue := 0
+	if paused {
+		pausedValue = 1
+	}
+	fmt.Fprintf(w, "# HELP replayer_capture_paused Whether recording is paused.\n# TYPE replayer_capture_paused gauge\nreplayer_capture_paused %d\n", pausedValue)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	const name = "replayer_capture_latency_seconds"
+	fmt.Fprintf(w, "# HELP %s End-to-end latency of proxied exchanges.\n# TYPE %s histogram\n", name, name)
+	for i, bound := range latencyBuckets {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), m.bucketCounts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, m.latencyCount)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(m.latencySum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, m.latencyCount)
+}
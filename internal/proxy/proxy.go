@@ -3,27 +3,74 @@ package proxy
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"mime"
 	"net/http"
+	"net/http/httptrace"
 	"net/http/httputil"
-	"net/url"
 	"os"
-	"strings"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/kx0101/replayer/internal/filter"
+	"github.com/kx0101/replayer/internal/grpc"
+	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/redact"
+	"github.com/kx0101/replayer/internal/route"
+	"github.com/kx0101/replayer/internal/websocket"
 )
 
 type CaptureConfig struct {
 	ListenAddr string
+	// Upstream receives the requests no route in Upstreams matches.
 	Upstream   string
+	Upstreams  []UpstreamRoute
 	OutputFile string
 	Stream     bool
 	TLSCert    string
 	TLSKey     string
+	// Forward makes the capture a forward proxy: clients send absolute
+	// URLs or CONNECT, and HTTPS is intercepted with certificates from CA.
+	Forward bool
+	CA      *CertAuthority
+	// upstreamTLS, when set, configures the connections to the upstreams.
+	// Only tests set it, to trust their own upstreams.
+	upstreamTLS *tls.Config
+	// Filter selects which exchanges are recorded; all are proxied.
+	Filter *filter.Set
+	// Redactor, when set, scrubs entries before they are written or logged.
+	Redactor *redact.Redactor
+	// SampleRate is the share of matching exchanges recorded, and
+	// SamplePerRoute caps them per route (from Routes) and second.
+	SampleRate     float64
+	SamplePerRoute int
+	Routes         *route.Templater
+	// MaxBodySize truncates recorded bodies; 0 keeps them whole.
+	// MaxStreamSize caps streamed responses, event streams and bodies of
+	// unknown length, when it is lower.
+	MaxBodySize   int64
+	MaxStreamSize int64
+	// RotateSize and RotateInterval start a new output file, gzipped
+	// with RotateGzip, once the current one is too large or too old.
+	RotateSize     int64
+	RotateInterval time.Duration
+	RotateGzip     bool
+	// AdminAddr is where the admin API listens; empty disables it.
+	AdminAddr string
+	// Faults are injected into the matching requests.
+	Faults []FaultRule
 }
 
 type CapturedEntry struct {
@@ -36,120 +83,802 @@ type CapturedEntry struct {
 	ResponseHeaders http.Header `json:"response_headers"`
 	ResponseBody    string      `json:"response_body"`
 	LatencyMs       int64       `json:"latency_ms"`
+	BodyEncoding    string      `json:"body_encoding"`
+
+	WebSocket          []models.WebSocketMessage `json:"websocket,omitempty"`
+	WebSocketTruncated bool                      `json:"websocket_truncated,omitempty"`
+	GRPC               *models.GRPCStatus        `json:"grpc,omitempty"`
+	Timing             *models.Timing            `json:"timing,omitempty"`
+
+	BodyTruncated         bool  `json:"body_truncated,omitempty"`
+	BodySize              int64 `json:"body_size,omitempty"`
+	ResponseBodyTruncated bool  `json:"response_body_truncated,omitempty"`
+	ResponseBodySize      int64 `json:"response_body_size,omitempty"`
+
+	Host       string          `json:"host,omitempty"`
+	RemoteAddr string          `json:"remote_addr,omitempty"`
+	Proto      string          `json:"proto,omitempty"`
+	TLS        *models.TLSInfo `json:"tls,omitempty"`
+	Trailers   http.Header     `json:"trailers,omitempty"`
+	Chunks     []models.Chunk  `json:"chunks,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Upstream   string          `json:"upstream,omitempty"`
+	Tag        string          `json:"tag,omitempty"`
+	Fault      *models.Fault   `json:"fault,omitempty"`
 }
 
+// StartReverseProxy runs the capture until SIGINT or SIGTERM.
 func StartReverseProxy(config *CaptureConfig) error {
-	out, err := os.OpenFile(config.OutputFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
-	if err == nil {
-		_ = os.Chmod(config.OutputFile, 0600)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return serve(ctx, config)
+}
+
+// serve runs the capture until ctx is done, then stops accepting
+// connections, waits for in-flight exchanges to be recorded and closes the
+// capture file.
+func serve(ctx context.Context, config *CaptureConfig) error {
+	out, err := openCaptureFile(config.OutputFile, config.RotateSize, config.RotateInterval, config.RotateGzip)
+	if err != nil {
+		return err
 	}
 
-	writer := bufio.NewWriter(out)
+	rec := &recorder{config: config, writer: bufio.NewWriter(out), file: out, sampler: newSampler(config), metrics: newMetrics()}
 	defer func() {
-		err = writer.Flush()
-		if err != nil {
-			log.Printf("Error flushing writer: %v\n", err)
+		if err := rec.close(); err != nil {
+			log.Printf("Error closing output file: %v\n", err)
 		}
+	}()
 
-		err = out.Close()
-		if err != nil {
-			log.Printf("Error closing output file: %v\n", err)
+	if out.size == 0 {
+		if err := rec.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	if err := rec.openOutputs(); err != nil {
+		return err
+	}
+
+	handler, err := newHandler(config, rec)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:        config.ListenAddr,
+		Handler:     handler,
+		ReadTimeout: 5 * time.Second,
+		// No write timeout: event streams, long polls and downloads take as
+		// long as the upstream does.
+		IdleTimeout:       60 * time.Second,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+
+	log.Printf("Capture mode ON -- listening on %s --> %s\n", config.ListenAddr, config.Upstream) //#nosec G706 -- config values are from CLI flags, not user input
+	for _, route := range config.Upstreams {
+		log.Printf("Routing %s%s --> %s\n", route.Host, route.Prefix, route.URL) //#nosec G706 -- config values are from the upstream config, not user input
+	}
+
+	servers := []*http.Server{server}
+	errCh := make(chan error, 2)
+
+	go func() {
+		if config.TLSCert != "" && config.TLSKey != "" {
+			server.TLSConfig = &tls.Config{
+				MinVersion: tls.VersionTLS12,
+			}
+
+			errCh <- server.ListenAndServeTLS(config.TLSCert, config.TLSKey)
+			return
 		}
+
+		errCh <- server.ListenAndServe()
 	}()
 
-	rawUp := strings.TrimSpace(config.Upstream)
-	if rawUp == "" {
-		return fmt.Errorf("upstream is empty")
+	if config.AdminAddr != "" {
+		admin := &http.Server{
+			Addr:              config.AdminAddr,
+			Handler:           newAdminHandler(rec),
+			ReadHeaderTimeout: 2 * time.Second,
+		}
+
+		servers = append(servers, admin)
+		go func() {
+			errCh <- admin.ListenAndServe()
+		}()
+
+		log.Printf("Admin API listening on %s\n", config.AdminAddr) //#nosec G706 -- config values are from CLI flags, not user input
+	}
+
+	select {
+	case err := <-errCh:
+		_ = shutdown(servers, rec, shutdownTimeout)
+		return err
+	case <-ctx.Done():
+		log.Println("Shutting down, waiting for in-flight requests...")
+	}
+
+	return shutdown(servers, rec, shutdownTimeout)
+}
+
+// shutdownTimeout is how long in-flight exchanges get to complete.
+const shutdownTimeout = 10 * time.Second
+
+// shutdown stops the servers gracefully, giving in-flight exchanges up to
+// timeout to complete. The ones still running then, and the hijacked
+// connections, are cut, and shutdown waits for them to be recorded.
+func shutdown(servers []*http.Server, rec *recorder, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	for _, server := range servers {
+		if err := stopServer(ctx, server); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := rec.conns.stopServers(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if ctx.Err() != nil {
+		log.Println("Shutdown timed out, closed the remaining connections")
+	}
+
+	rec.conns.closeAll()
+	rec.inflight.Wait()
+
+	return errors.Join(errs...)
+}
+
+// newHandler returns the reverse proxy that forwards to the upstreams and
+// records every exchange with rec.
+func newHandler(config *CaptureConfig, rec *recorder) (http.Handler, error) {
+	if rec.metrics == nil {
+		rec.metrics = newMetrics()
+	}
+
+	router, err := newRouter(config)
+	if err != nil {
+		return nil, err
 	}
 
-	upURL, err := url.Parse(rawUp)
+	faults, err := newInjector(config)
 	if err != nil {
-		return fmt.Errorf("invalid upstream URL: %w", err)
+		return nil, err
+	}
+
+	if config.Forward && config.CA == nil {
+		return nil, fmt.Errorf("forward proxy needs a CA")
+	}
+
+	var transport http.RoundTripper = http.DefaultTransport
+	if config.upstreamTLS != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = config.upstreamTLS
+		transport = t
 	}
 
 	proxy := &httputil.ReverseProxy{
+		Transport: &upstreamTransport{
+			http:    transport,
+			grpc:    grpc.NewTransport(false, nil),
+			grpcTLS: grpc.NewTransport(true, config.upstreamTLS),
+		},
 		Director: func(req *http.Request) {
-			if req.Body != nil {
-				bodyBytes, _ := io.ReadAll(req.Body)
-				req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+			cr, ok := req.Context().Value(clientRequestKey{}).(*clientRequest)
+			if !ok {
+				return
+			}
+
+			req.URL.Scheme = cr.upstream.url.Scheme
+			req.URL.Host = cr.upstream.url.Host
 
-				req.Header.Set("X-Original-Body-Buffer", base64.StdEncoding.EncodeToString(bodyBytes))
+			// Frames are recorded as sent, so sessions must not be
+			// compressed with permessage-deflate; replay does not
+			// negotiate it either.
+			if websocket.IsUpgrade(req.Header) {
+				req.Header.Del("Sec-WebSocket-Extensions")
 			}
 
-			req.URL.Scheme = upURL.Scheme
-			req.URL.Host = upURL.Host
+			// The outgoing request holds a copy of the trailers taken
+			// before the body was read; share the one that gets filled in.
+			if cr.trailer != nil {
+				req.Trailer = cr.trailer
+			}
 		},
-		ModifyResponse: func(resp *http.Response) error {
-			start := time.Now()
+		// Without a response, the failure is recorded with the status the
+		// client got.
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			status := http.StatusBadGateway
+			if r.Context().Err() != nil {
+				status = statusClientClosed
+			} else {
+				rec.metrics.upstreamErrors.Add(1)
+				log.Printf("http: proxy error: %v\n", err)
+			}
 
-			var reqBody []byte
-			if b64 := resp.Request.Header.Get("X-Original-Body-Buffer"); b64 != "" {
-				reqBody, err = base64.StdEncoding.DecodeString(b64)
-				if err != nil {
-					return err
-				}
+			w.WriteHeader(http.StatusBadGateway)
+
+			entry := newEntry(&http.Response{Request: r, StatusCode: status, Header: http.Header{}})
+			entry.Error = failure(r, err)
+			entry.LatencyMs = time.Since(entry.Timestamp).Milliseconds()
+			if err := rec.record(entry); err != nil {
+				log.Printf("Failed to record exchange: %v\n", err)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			if resp.StatusCode == http.StatusSwitchingProtocols && websocket.IsUpgrade(resp.Request.Header) {
+				return tapWebSocket(resp, rec)
 			}
 
-			respBody, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return err
+			if cr, ok := resp.Request.Context().Value(clientRequestKey{}).(*clientRequest); ok && cr.fault != nil && cr.fault.Type == faultTruncate {
+				resp.Body = &truncatedBody{ReadCloser: resp.Body, left: cr.fault.TruncatedAt}
 			}
 
-			resp.Body = io.NopCloser(bytes.NewReader(respBody))
-
-			entry := CapturedEntry{
-				Timestamp:       start,
-				Method:          resp.Request.Method,
-				Path:            resp.Request.URL.Path,
-				Headers:         resp.Request.Header,
-				Body:            base64.StdEncoding.EncodeToString(reqBody),
-				Status:          resp.StatusCode,
-				ResponseHeaders: resp.Header,
-				ResponseBody:    base64.StdEncoding.EncodeToString(respBody),
-				LatencyMs:       time.Since(start).Milliseconds(),
+			// The exchange is recorded once the proxy has streamed the
+			// whole response to the client.
+			var tap *bodyTap
+			tap = newBodyTap(resp.Body, bodyLimit(config, resp), func() {
+				entry := newEntry(resp)
+				body, size, truncated := tap.captured()
+				entry.ResponseBody = base64.StdEncoding.EncodeToString(body)
+				if truncated {
+					entry.ResponseBodyTruncated = true
+					entry.ResponseBodySize = size
+				}
+
+				entry.LatencyMs = time.Since(entry.Timestamp).Milliseconds()
+				entry.Chunks = tap.timedChunks()
+
+				if interrupted, err := tap.interrupted(); interrupted {
+					entry.Error = failure(resp.Request, err)
+					if resp.Request.Context().Err() == nil && err != nil && !errors.Is(err, errInjected) {
+						rec.metrics.upstreamErrors.Add(1)
+					}
+				}
+
+				// The body has been read, so the trailers carrying the
+				// gRPC status are available.
+				if grpc.IsGRPC(resp.Header) {
+					if code, message, ok := grpc.Status(resp.Header, resp.Trailer); ok {
+						entry.Status = grpc.HTTPStatus(code)
+						entry.GRPC = &models.GRPCStatus{Code: code, Message: message}
+					}
+				}
+
+				if err := rec.record(entry); err != nil {
+					log.Printf("Failed to record exchange: %v\n", err)
+				}
+			})
+
+			if isEventStream(resp.Header) {
+				tap.timeChunks(time.Now())
 			}
 
-			data, _ := json.Marshal(entry)
-			log.Println(string(data))
+			resp.Body = tap
+			return nil
+		},
+	}
 
-			_, err = writer.Write(data)
-			if err != nil {
-				return err
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec.inflight.Add(1)
+		defer rec.inflight.Done()
+
+		if websocket.IsUpgrade(r.Header) {
+			// The server timeouts would cut long lived sessions short once
+			// the connection is hijacked.
+			rc := http.NewResponseController(w)
+			_ = rc.SetReadDeadline(time.Time{})
+			_ = rc.SetWriteDeadline(time.Time{})
+		}
+
+		rec.metrics.requests.Add(1)
+
+		up := router.match(r)
+		if up == nil && config.Forward && r.URL.Host != "" {
+			up = directUpstream(r.URL)
+		}
+
+		if up == nil {
+			http.Error(w, "no upstream for this request", http.StatusBadGateway)
+			return
+		}
+
+		req := withClientRequest(r, up, config.MaxBodySize)
+		if inj := faults.pick(r); inj != nil {
+			rec.metrics.faults.Add(1)
+			if !inject(w, req, inj, rec) {
+				return
 			}
+		}
+
+		proxy.ServeHTTP(w, req)
+	})
+
+	// gRPC clients speak HTTP/2 without TLS; TLS listeners negotiate it.
+	capture := h2c.NewHandler(handler, &http2.Server{})
+	if config.Forward {
+		return trackHijacked(&forwardHandler{ca: config.CA, capture: capture, conns: &rec.conns}, &rec.conns), nil
+	}
+
+	return trackHijacked(capture, &rec.conns), nil
+}
+
+// bodyLimit is the recorded size of a response body. Streamed responses
+// may never end, so MaxStreamSize applies to them as well.
+func bodyLimit(config *CaptureConfig, resp *http.Response) int64 {
+	limit := config.MaxBodySize
+	if config.MaxStreamSize <= 0 || (!isEventStream(resp.Header) && resp.ContentLength != -1) {
+		return limit
+	}
+
+	if limit == 0 || config.MaxStreamSize < limit {
+		return config.MaxStreamSize
+	}
+
+	return limit
+}
+
+// sessionLimit is the recorded size of a WebSocket session in message
+// bytes. Sessions have no length, so it is the stream limit.
+func sessionLimit(config *CaptureConfig) int64 {
+	limit := config.MaxBodySize
+	if config.MaxStreamSize > 0 && (limit == 0 || config.MaxStreamSize < limit) {
+		return config.MaxStreamSize
+	}
+
+	return limit
+}
+
+func isEventStream(header http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// statusClientClosed is recorded for requests the client aborted before
+// the upstream answered, as nginx logs them.
+const statusClientClosed = 499
+
+// failure describes why an exchange did not complete. A canceled request
+// means the client went away, whatever error that caused upstream.
+func failure(r *http.Request, err error) string {
+	if r.Context().Err() != nil || err == nil {
+		return "client aborted"
+	}
+
+	if errors.Is(err, errInjected) {
+		return err.Error()
+	}
+
+	return "upstream: " + err.Error()
+}
+
+// clientRequest is the request as the client sent it, before the reverse
+// proxy rewrites it for the upstream.
+type clientRequest struct {
+	upstream   *upstream
+	start      time.Time
+	timer      *upstreamTimer
+	uri        string
+	host       string
+	remoteAddr string
+	proto      string
+	header     http.Header
+	tls        *models.TLSInfo
+	body       *bodyTap
+	// trailer is the request's own map, which the server fills in once
+	// the body has been read.
+	trailer http.Header
+	fault   *injection
+}
+
+type clientRequestKey struct{}
+
+// withClientRequest keeps the original request in the context for
+// ModifyResponse, and taps its body to record it as it is streamed to the
+// upstream.
+func withClientRequest(r *http.Request, up *upstream, maxBodySize int64) *http.Request {
+	cr := &clientRequest{
+		upstream:   up,
+		start:      time.Now(),
+		timer:      &upstreamTimer{},
+		uri:        r.URL.RequestURI(),
+		host:       r.Host,
+		remoteAddr: r.RemoteAddr,
+		proto:      r.Proto,
+		header:     r.Header.Clone(),
+	}
 
-			_, err = writer.Write([]byte("\n"))
+	if r.Body != nil && r.Body != http.NoBody {
+		cr.body = newBodyTap(r.Body, maxBodySize, nil)
+		cr.body.drain = true
+		r.Body = cr.body
+	}
+
+	if len(r.Trailer) > 0 {
+		cr.trailer = r.Trailer
+	}
+
+	if r.TLS != nil {
+		cr.tls = &models.TLSInfo{
+			Version:            tls.VersionName(r.TLS.Version),
+			CipherSuite:        tls.CipherSuiteName(r.TLS.CipherSuite),
+			ServerName:         r.TLS.ServerName,
+			NegotiatedProtocol: r.TLS.NegotiatedProtocol,
+		}
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), clientRequestKey{}, cr))
+}
+
+// newEntry starts the entry for an exchange from the original client
+// request. Its timestamp is when the proxy received the request, and the
+// upstream timing runs until now, so call it once the response body has
+// been read.
+func newEntry(resp *http.Response) CapturedEntry {
+	entry := CapturedEntry{
+		Timestamp:       time.Now(),
+		Method:          resp.Request.Method,
+		Path:            resp.Request.URL.RequestURI(),
+		Headers:         resp.Request.Header,
+		Status:          resp.StatusCode,
+		ResponseHeaders: resp.Header,
+		BodyEncoding:    models.BodyEncodingBase64,
+	}
+
+	if cr, ok := resp.Request.Context().Value(clientRequestKey{}).(*clientRequest); ok {
+		entry.Timestamp = cr.start
+		entry.Upstream = cr.upstream.URL
+		entry.Tag = cr.upstream.Name
+		entry.Timing = cr.timer.timing(time.Now())
+		entry.Path = cr.uri
+		entry.Headers = cr.header
+		body, size, truncated := cr.body.captured()
+		entry.Body = base64.StdEncoding.EncodeToString(body)
+		if truncated {
+			entry.BodyTruncated = true
+			entry.BodySize = size
+		}
+
+		entry.Host = cr.host
+		entry.RemoteAddr = cr.remoteAddr
+		entry.Proto = cr.proto
+		entry.TLS = cr.tls
+		if len(cr.trailer) > 0 {
+			entry.Trailers = cr.trailer.Clone()
+		}
+
+		if cr.fault != nil {
+			fault := cr.fault.Fault
+			entry.Fault = &fault
+		}
+	}
+
+	return entry
+}
+
+// upstreamTransport sends gRPC calls over HTTP/2, which gRPC servers
+// require, and everything else over the default transport.
+type upstreamTransport struct {
+	http    http.RoundTripper
+	grpc    http.RoundTripper
+	grpcTLS http.RoundTripper
+}
+
+// RoundTrip also traces the round trip for the timing breakdown of the
+// entry.
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if cr, ok := req.Context().Value(clientRequestKey{}).(*clientRequest); ok {
+		cr.timer.mu.Lock()
+		cr.timer.sent = time.Now()
+		cr.timer.mu.Unlock()
+
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), cr.timer.trace()))
+	}
+
+	if grpc.IsGRPC(req.Header) && req.URL.Scheme == "https" {
+		return t.grpcTLS.RoundTrip(req)
+	}
+
+	if grpc.IsGRPC(req.Header) {
+		return t.grpc.RoundTrip(req)
+	}
+
+	return t.http.RoundTrip(req)
+}
+
+func (e CapturedEntry) logEntry() *models.LogEntry {
+	return &models.LogEntry{
+		Method:          e.Method,
+		Path:            e.Path,
+		Headers:         e.Headers,
+		Body:            e.Body,
+		Status:          e.Status,
+		ResponseHeaders: e.ResponseHeaders,
+		ResponseBody:    e.ResponseBody,
+		Timestamp:       e.Timestamp,
+		LatencyMs:       e.LatencyMs,
+		BodyEncoding:    e.BodyEncoding,
+		WebSocket:       e.WebSocket,
+		GRPC:            e.GRPC,
+		Timing:          e.Timing,
+
+		WebSocketTruncated: e.WebSocketTruncated,
+
+		BodyTruncated:         e.BodyTruncated,
+		BodySize:              e.BodySize,
+		ResponseBodyTruncated: e.ResponseBodyTruncated,
+		ResponseBodySize:      e.ResponseBodySize,
+
+		Host:       e.Host,
+		RemoteAddr: e.RemoteAddr,
+		Proto:      e.Proto,
+		TLS:        e.TLS,
+		Trailers:   e.Trailers,
+		Chunks:     e.Chunks,
+		Error:      e.Error,
+		Upstream:   e.Upstream,
+		Tag:        e.Tag,
+		Fault:      e.Fault,
+	}
+}
+
+// redacted returns a scrubbed copy of the entry.
+func (e CapturedEntry) redacted(r *redact.Redactor) CapturedEntry {
+	le := e.logEntry()
+	r.Entry(le)
+
+	e.Path = le.Path
+	e.Headers = le.Headers
+	e.Body = le.Body
+	e.ResponseHeaders = le.ResponseHeaders
+	e.ResponseBody = le.ResponseBody
+	e.BodyEncoding = le.BodyEncoding
+	e.WebSocket = le.WebSocket
+	e.GRPC = le.GRPC
+	e.Trailers = le.Trailers
+	return e
+}
+
+// recorder appends captured entries to the output file. Handlers run
+// concurrently, so writes are serialized.
+type recorder struct {
+	config  *CaptureConfig
+	sampler *sampler
+	metrics *metrics
+	paused  atomic.Bool
+
+	// conns are the hijacked connections and inflight the exchanges being
+	// proxied, which shutdown closes and waits for.
+	conns    connTracker
+	inflight sync.WaitGroup
+
+	mu     sync.Mutex
+	writer *bufio.Writer
+	// file, when set, is what writer writes to, and is rotated.
+	file   *captureFile
+	closed bool
+
+	// outputs are the capture files of the upstream routes with their
+	// own, by route name.
+	outputs map[string]*recorder
+}
+
+func (r *recorder) record(entry CapturedEntry) error {
+	if len(entry.WebSocket) == 0 {
+		r.metrics.observe(time.Duration(entry.LatencyMs) * time.Millisecond)
+	}
+
+	// Injected faults are rare by design, so they are never sampled out.
+	le := entry.logEntry()
+	if r.paused.Load() || !r.config.Filter.Match(le) || (entry.Fault == nil && !r.sampler.keep(le, time.Now())) {
+		r.metrics.dropped.Add(1)
+		return nil
+	}
+
+	if r.config.Redactor != nil {
+		entry = entry.redacted(r.config.Redactor)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	log.Println(string(data))
+
+	if out, ok := r.outputs[entry.Tag]; ok {
+		return out.write(data, entry.Timestamp)
+	}
+
+	return r.write(data, entry.Timestamp)
+}
+
+// write appends a record to the capture file, rotating it first when due.
+func (r *recorder) write(data []byte, ts time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return fmt.Errorf("capture file is closed")
+	}
+
+	if r.file != nil && r.file.due(len(data)+1) {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := r.writer.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	if r.file != nil {
+		r.file.entries++
+		r.file.observe(ts)
+	}
+
+	r.metrics.captured.Add(1)
+	r.metrics.bytes.Add(int64(len(data) + 1))
+	return r.writer.Flush()
+}
+
+// rotate starts a new output file with its own header.
+func (r *recorder) rotate() error {
+	if err := r.writer.Flush(); err != nil {
+		return err
+	}
+
+	if err := r.file.finishHeader(); err != nil {
+		return err
+	}
+
+	if err := r.file.rotate(); err != nil {
+		return err
+	}
+
+	r.metrics.rotations.Add(1)
+	return r.writeHeader()
+}
+
+// openOutputs opens the capture files of the upstream routes with an
+// output. Routes may share one.
+func (r *recorder) openOutputs() error {
+	byPath := map[string]*recorder{}
+
+	for _, route := range r.config.Upstreams {
+		if route.Output == "" || route.Output == r.config.OutputFile {
+			continue
+		}
+
+		out, ok := byPath[route.Output]
+		if !ok {
+			file, err := openCaptureFile(route.Output, r.config.RotateSize, r.config.RotateInterval, r.config.RotateGzip)
 			if err != nil {
 				return err
 			}
 
-			err = writer.Flush()
-			if err != nil {
-				return err
+			out = &recorder{config: r.config, metrics: r.metrics, writer: bufio.NewWriter(file), file: file}
+			if file.size == 0 {
+				if err := out.writeHeader(); err != nil {
+					_ = file.Close()
+					return err
+				}
 			}
 
-			return nil
-		},
+			byPath[route.Output] = out
+		}
+
+		if r.outputs == nil {
+			r.outputs = map[string]*recorder{}
+		}
+
+		r.outputs[route.Name] = out
 	}
 
-	server := &http.Server{
-		Addr:              config.ListenAddr,
-		Handler:           proxy,
-		ReadTimeout:       5 * time.Second,
-		WriteTimeout:      10 * time.Second,
-		IdleTimeout:       60 * time.Second,
-		ReadHeaderTimeout: 2 * time.Second,
+	return nil
+}
+
+// each runs fn for the capture file of the recorder and those of the
+// upstream routes.
+func (r *recorder) each(fn func(*recorder) error) error {
+	errs := []error{fn(r)}
+	seen := map[*recorder]bool{}
+
+	for _, out := range r.outputs {
+		if !seen[out] {
+			seen[out] = true
+			errs = append(errs, fn(out))
+		}
 	}
 
-	log.Printf("Capture mode ON -- listening on %s --> %s\n", config.ListenAddr, upURL.Host) //#nosec G706 -- config values are from CLI flags, not user input
+	return errors.Join(errs...)
+}
+
+// forceRotate rotates on request, whatever the size and age of the files.
+func (r *recorder) forceRotate() error {
+	return r.each(func(out *recorder) error {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+
+		if out.file == nil || out.closed {
+			return fmt.Errorf("capture file cannot be rotated")
+		}
+
+		return out.rotate()
+	})
+}
+
+// close flushes and closes the capture files. Exchanges that complete
+// afterwards, such as WebSocket sessions still open, are not recorded.
+func (r *recorder) close() error {
+	return r.each(func(out *recorder) error {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+
+		out.closed = true
+		flushErr := out.writer.Flush()
+
+		if out.file == nil {
+			return flushErr
+		}
+
+		return errors.Join(flushErr, out.file.finishHeader(), out.file.Close())
+	})
+}
 
-	if config.TLSCert != "" && config.TLSKey != "" {
-		tlsConfig := &tls.Config{
-			MinVersion: tls.VersionTLS12,
+func (r *recorder) stats() stats {
+	s := r.metrics.stats()
+	s.Paused = r.paused.Load()
+	s.Output = r.config.OutputFile
+	return s
+}
+
+// writeHeader starts a new capture file with a header record. Appending to
+// an existing file keeps its header.
+func (r *recorder) writeHeader() error {
+	header := models.NewFileHeader("capture", nil)
+	data, err := marshalHeader(header, true)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.writer.Write(data); err != nil {
+		return fmt.Errorf("failed to write capture header: %w", err)
+	}
+
+	if r.file != nil {
+		r.file.header = &header
+		r.file.headerSize = len(data)
+	}
+
+	return r.writer.Flush()
+}
+
+// marshalHeader encodes a header record. With reserve, it is padded with
+// the room its time range takes, so the record can be rewritten in place
+// once the file is done.
+func marshalHeader(header models.FileHeader, reserve bool) ([]byte, error) {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	if reserve {
+		longest := time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC)
+		header.Start, header.End = &longest, &longest
+
+		full, err := json.Marshal(header)
+		if err != nil {
+			return nil, err
 		}
 
-		server.TLSConfig = tlsConfig
-		return server.ListenAndServeTLS(config.TLSCert, config.TLSKey)
+		data = append(data, bytes.Repeat([]byte{' '}, len(full)-len(data))...)
 	}
 
-	return server.ListenAndServe()
+	return append(data, '\n'), nil
 }
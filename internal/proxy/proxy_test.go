@@ -0,0 +1,625 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/input"
+	"github.com/kx0101/replayer/internal/models"
+)
+
+func TestCaptureRequest(t *testing.T) {
+	var upstreamReq *http.Request
+	var upstreamBody []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamBody, _ = io.ReadAll(r.Body)
+		upstreamReq = r
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	var buf bytes.Buffer
+	rec := &recorder{config: &CaptureConfig{Upstream: upstream.URL}, writer: bufio.NewWriter(&buf)}
+
+	handler, err := newHandler(rec.config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	// An unknown length makes the body chunked, so the trailer is sent.
+	req, _ := http.NewRequest(http.MethodPost, proxy.URL+"/search?q=a%20b&page=2", io.MultiReader(strings.NewReader(`{"term":"x"}`)))
+	req.Host = "api.example.com"
+	req.Header.Set("X-Tenant", "acme")
+	req.Trailer = http.Header{"X-Checksum": {"abc"}}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_ = resp.Body.Close()
+
+	t.Run("upstream", func(t *testing.T) {
+		if upstreamReq.Header.Get("X-Original-Body-Buffer") != "" {
+			t.Error("expected no internal headers upstream")
+		}
+
+		if upstreamReq.Host != "api.example.com" || upstreamReq.URL.RawQuery != "q=a%20b&page=2" {
+			t.Errorf("unexpected upstream request: %s %s", upstreamReq.Host, upstreamReq.URL)
+		}
+
+		if string(upstreamBody) != `{"term":"x"}` || upstreamReq.Trailer.Get("X-Checksum") != "abc" {
+			t.Errorf("unexpected upstream body %q or trailer %v", upstreamBody, upstreamReq.Trailer)
+		}
+	})
+
+	t.Run("entry", func(t *testing.T) {
+		var entry CapturedEntry
+		if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if entry.Path != "/search?q=a%20b&page=2" {
+			t.Errorf("expected the full request URI, got %q", entry.Path)
+		}
+
+		if entry.Host != "api.example.com" || entry.Proto != "HTTP/1.1" || !strings.HasPrefix(entry.RemoteAddr, "127.0.0.1:") {
+			t.Errorf("unexpected client info: %q %q %q", entry.Host, entry.Proto, entry.RemoteAddr)
+		}
+
+		if entry.Trailers.Get("X-Checksum") != "abc" {
+			t.Errorf("expected the trailer, got %v", entry.Trailers)
+		}
+
+		if entry.Headers.Get("X-Tenant") != "acme" || entry.Headers.Get("X-Original-Body-Buffer") != "" || entry.Headers.Get("X-Forwarded-For") != "" {
+			t.Errorf("expected the client headers only, got %v", entry.Headers)
+		}
+
+		if body := entry.logEntry().DecodedBody(); string(body) != `{"term":"x"}` {
+			t.Errorf("unexpected body %q", body)
+		}
+	})
+}
+
+func TestCaptureTLS(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	var buf bytes.Buffer
+	rec := &recorder{config: &CaptureConfig{Upstream: upstream.URL}, writer: bufio.NewWriter(&buf)}
+
+	handler, err := newHandler(rec.config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewTLSServer(handler)
+	defer proxy.Close()
+
+	resp, err := proxy.Client().Get(proxy.URL + "/health")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_ = resp.Body.Close()
+
+	var entry CapturedEntry
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.TLS == nil || !strings.HasPrefix(entry.TLS.Version, "TLS 1.") || entry.TLS.CipherSuite == "" {
+		t.Errorf("expected TLS details, got %+v", entry.TLS)
+	}
+}
+
+func TestCaptureTiming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		time.Sleep(30 * time.Millisecond)
+		_, _ = io.WriteString(w, "done")
+	}))
+	defer upstream.Close()
+
+	var buf bytes.Buffer
+	rec := &recorder{config: &CaptureConfig{Upstream: upstream.URL}, writer: bufio.NewWriter(&buf)}
+
+	handler, err := newHandler(rec.config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	before := time.Now()
+	for range 2 {
+		resp, err := http.Get(proxy.URL + "/slow")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(lines))
+	}
+
+	for i, line := range lines {
+		var entry CapturedEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if entry.Timestamp.Before(before) || entry.LatencyMs < 60 {
+			t.Errorf("expected the latency from the start of the request, got %dms at %v", entry.LatencyMs, entry.Timestamp)
+		}
+
+		timing := entry.Timing
+		if timing == nil {
+			t.Fatal("expected a timing breakdown")
+		}
+
+		if timing.TTFBMs < 30 || timing.TTFBMs >= timing.UpstreamMs || timing.UpstreamMs < 60 || timing.UpstreamMs > entry.LatencyMs {
+			t.Errorf("unexpected timing %+v for latency %dms", timing, entry.LatencyMs)
+		}
+
+		// The second request reuses the pooled upstream connection.
+		if timing.Reused != (i == 1) {
+			t.Errorf("request %d: expected reused=%v", i, i == 1)
+		}
+	}
+}
+
+func TestCaptureLimits(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer upstream.Close()
+
+	capture := func(config *CaptureConfig, paths ...string) []CapturedEntry {
+		t.Helper()
+
+		var buf bytes.Buffer
+		config.Upstream = upstream.URL
+		rec := &recorder{config: config, writer: bufio.NewWriter(&buf), sampler: newSampler(config)}
+
+		handler, err := newHandler(config, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		proxy := httptest.NewServer(handler)
+		defer proxy.Close()
+
+		for _, path := range paths {
+			resp, err := http.Post(proxy.URL+path, "text/plain", strings.NewReader("0123456789abcdef"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if string(body) != "0123456789abcdef" {
+				t.Fatalf("expected the whole body through the proxy, got %q", body)
+			}
+		}
+
+		var entries []CapturedEntry
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+
+			var entry CapturedEntry
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatal(err)
+			}
+
+			entries = append(entries, entry)
+		}
+
+		return entries
+	}
+
+	t.Run("max body size", func(t *testing.T) {
+		entries := capture(&CaptureConfig{MaxBodySize: 10}, "/echo")
+		if len(entries) != 1 {
+			t.Fatalf("expected 1 entry, got %d", len(entries))
+		}
+
+		le := entries[0].logEntry()
+		if string(le.DecodedBody()) != "0123456789" || !le.BodyTruncated || le.BodySize != 16 {
+			t.Errorf("unexpected request body %q (truncated %v, size %d)", le.DecodedBody(), le.BodyTruncated, le.BodySize)
+		}
+
+		if string(le.DecodedResponseBody()) != "0123456789" || !le.ResponseBodyTruncated || le.ResponseBodySize != 16 {
+			t.Errorf("unexpected response body %q (truncated %v, size %d)", le.DecodedResponseBody(), le.ResponseBodyTruncated, le.ResponseBodySize)
+		}
+	})
+
+	t.Run("under the limit", func(t *testing.T) {
+		entries := capture(&CaptureConfig{MaxBodySize: 16}, "/echo")
+		if len(entries) != 1 || entries[0].BodyTruncated || entries[0].ResponseBodyTruncated {
+			t.Errorf("expected whole bodies, got %+v", entries)
+		}
+	})
+
+	t.Run("per route sampling", func(t *testing.T) {
+		entries := capture(&CaptureConfig{SamplePerRoute: 2}, "/users/1", "/users/2", "/users/3", "/orders/1", "/users/4")
+
+		// The requests run within a second unless the machine is very
+		// slow, so each route keeps its first two.
+		counts := map[string]int{}
+		for _, entry := range entries {
+			counts[strings.Split(entry.Path, "/")[1]]++
+		}
+
+		if counts["users"] > 2 || counts["users"] == 0 || counts["orders"] != 1 {
+			t.Errorf("unexpected sample %v", counts)
+		}
+	})
+
+	t.Run("rate sampling", func(t *testing.T) {
+		paths := make([]string, 200)
+		for i := range paths {
+			paths[i] = "/sampled"
+		}
+
+		entries := capture(&CaptureConfig{SampleRate: 0.1}, paths...)
+		if len(entries) == 0 || len(entries) > 60 {
+			t.Errorf("expected about 20 of 200 entries, got %d", len(entries))
+		}
+	})
+}
+
+func TestSamplerWindow(t *testing.T) {
+	s := newSampler(&CaptureConfig{SamplePerRoute: 2})
+	entry := &models.LogEntry{Method: "GET", Path: "/users/1"}
+	start := time.Date(2024, 12, 10, 14, 0, 1, 0, time.UTC)
+
+	tests := []struct {
+		now  time.Time
+		want bool
+	}{
+		{start, true},
+		{start.Add(500 * time.Millisecond), true},
+		// A clock that steps back does not reopen the window.
+		{start.Add(-time.Second), false},
+		{start.Add(900 * time.Millisecond), false},
+		{start.Add(time.Second), true},
+	}
+
+	for i, tt := range tests {
+		if got := s.keep(entry, tt.now); got != tt.want {
+			t.Errorf("record %d: expected keep %v, got %v", i, tt.want, got)
+		}
+	}
+}
+
+func TestCaptureFailures(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			<-r.Context().Done()
+		case "/stream":
+			_, _ = io.WriteString(w, "first")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		case "/broken":
+			w.Header().Set("Content-Length", "10")
+			_, _ = io.WriteString(w, "first")
+			w.(http.Flusher).Flush()
+
+			conn, _, _ := http.NewResponseController(w).Hijack()
+			_ = conn.Close()
+		}
+	}))
+	defer upstream.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	capture := func(t *testing.T, target string, send func(url string)) (CapturedEntry, *recorder) {
+		t.Helper()
+
+		var buf bytes.Buffer
+		rec := &recorder{config: &CaptureConfig{Upstream: target}, writer: bufio.NewWriter(&buf)}
+
+		handler, err := newHandler(rec.config, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		proxy := httptest.NewServer(handler)
+		defer proxy.Close()
+
+		send(proxy.URL)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for rec.metrics.captured.Load() == 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("expected the exchange to be recorded")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+
+		var entry CapturedEntry
+		if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		return entry, rec
+	}
+
+	abort := func(path string, read int) func(url string) {
+		return func(url string) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url+path, nil)
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				cancel()
+			}()
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return
+			}
+
+			_, _ = io.ReadFull(resp.Body, make([]byte, read))
+			<-ctx.Done()
+			_ = resp.Body.Close()
+		}
+	}
+
+	t.Run("upstream unreachable", func(t *testing.T) {
+		entry, rec := capture(t, down.URL, func(url string) {
+			resp, err := http.Post(url+"/orders", "application/json", strings.NewReader(`{"id":1}`))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusBadGateway {
+				t.Errorf("expected 502, got %d", resp.StatusCode)
+			}
+		})
+
+		if entry.Status != http.StatusBadGateway || !strings.HasPrefix(entry.Error, "upstream: ") {
+			t.Errorf("unexpected status %d or error %q", entry.Status, entry.Error)
+		}
+
+		if entry.Method != http.MethodPost || string(entry.logEntry().DecodedBody()) != `{"id":1}` {
+			t.Errorf("expected the request to be recorded for replay, got %s %q", entry.Method, entry.logEntry().DecodedBody())
+		}
+
+		if rec.metrics.upstreamErrors.Load() != 1 {
+			t.Errorf("expected 1 upstream error, got %d", rec.metrics.upstreamErrors.Load())
+		}
+	})
+
+	t.Run("client aborted before the response", func(t *testing.T) {
+		entry, rec := capture(t, upstream.URL, abort("/slow", 0))
+
+		if entry.Status != statusClientClosed || entry.Error != "client aborted" {
+			t.Errorf("unexpected status %d or error %q", entry.Status, entry.Error)
+		}
+
+		if rec.metrics.upstreamErrors.Load() != 0 {
+			t.Error("expected a client abort not to count as an upstream error")
+		}
+	})
+
+	t.Run("client aborted while streaming", func(t *testing.T) {
+		entry, _ := capture(t, upstream.URL, abort("/stream", 5))
+
+		if entry.Status != http.StatusOK || entry.Error != "client aborted" {
+			t.Errorf("unexpected status %d or error %q", entry.Status, entry.Error)
+		}
+
+		if body := entry.logEntry().DecodedResponseBody(); string(body) != "first" {
+			t.Errorf("expected the part of the response sent, got %q", body)
+		}
+	})
+
+	t.Run("upstream broke off", func(t *testing.T) {
+		entry, _ := capture(t, upstream.URL, func(url string) {
+			resp, err := http.Get(url + "/broken")
+			if err != nil {
+				return
+			}
+
+			_, _ = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+		})
+
+		if entry.Status != http.StatusOK || !strings.HasPrefix(entry.Error, "upstream: ") {
+			t.Errorf("unexpected status %d or error %q", entry.Status, entry.Error)
+		}
+
+		if body := entry.logEntry().DecodedResponseBody(); string(body) != "first" {
+			t.Errorf("expected the part of the response sent, got %q", body)
+		}
+	})
+
+	t.Run("completed", func(t *testing.T) {
+		entry, _ := capture(t, upstream.URL, func(url string) {
+			resp, err := http.Get(url + "/ok")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_ = resp.Body.Close()
+		})
+
+		if entry.Error != "" {
+			t.Errorf("expected no error, got %q", entry.Error)
+		}
+	})
+}
+
+func TestCaptureStream(t *testing.T) {
+	next := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			if i > 0 {
+				<-next
+			}
+
+			_, _ = fmt.Fprintf(w, "data: event %d\n\n", i)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	var buf bytes.Buffer
+	config := &CaptureConfig{Upstream: upstream.URL, MaxStreamSize: 32}
+	rec := &recorder{config: config, writer: bufio.NewWriter(&buf)}
+
+	handler, err := newHandler(config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/events")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			time.Sleep(20 * time.Millisecond)
+			next <- struct{}{}
+		}
+
+		// Each event arrives before the upstream sends the next one.
+		line, err := reader.ReadString('\n')
+		if err != nil || line != fmt.Sprintf("data: event %d\n", i) {
+			t.Fatalf("expected event %d, got %q (%v)", i, line, err)
+		}
+
+		_, _ = reader.ReadString('\n')
+	}
+
+	_, _ = io.ReadAll(reader)
+	_ = resp.Body.Close()
+
+	var entry CapturedEntry
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	le := entry.logEntry()
+	if string(le.DecodedResponseBody()) != "data: event 0\n\ndata: event 1\n\nda" || !le.ResponseBodyTruncated || le.ResponseBodySize != 45 {
+		t.Errorf("expected the stream cut at 32 bytes, got %q (size %d)", le.DecodedResponseBody(), le.ResponseBodySize)
+	}
+
+	if len(entry.Chunks) != 2 || entry.Chunks[0].Size != 15 || entry.Chunks[1].OffsetMs < 20 {
+		t.Errorf("expected the timing of the recorded events, got %+v", entry.Chunks)
+	}
+}
+
+func TestCaptureReadBack(t *testing.T) {
+	large := bytes.Repeat([]byte{0xff, 0x00, 0x7f}, 1<<20)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Without a length the response is streamed and capped at
+		// --max-stream-size.
+		for chunk := range slices.Chunk(large, 64*1024) {
+			_, _ = w.Write(chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "traffic.json")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	// The default --max-stream-size.
+	config := &CaptureConfig{Upstream: upstream.URL, MaxStreamSize: 1 << 20}
+	rec := &recorder{config: config, writer: bufio.NewWriter(file)}
+	if err := rec.writeHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newHandler(config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/download")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if body, _ := io.ReadAll(resp.Body); len(body) != len(large) {
+		t.Errorf("expected the whole response, got %d bytes", len(body))
+	}
+	_ = resp.Body.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for rec.metrics.captured.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the exchange to be recorded")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec.mu.Lock()
+	err = rec.writer.Flush()
+	rec.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := input.ReadEntries(&cli.CliArgs{InputFile: path})
+	if err != nil {
+		t.Fatalf("expected the capture to be readable: %v", err)
+	}
+
+	if len(entries) != 1 || len(entries[0].DecodedResponseBody()) != 1<<20 {
+		t.Errorf("expected one entry with the response cut at 1MB, got %d", len(entries))
+	}
+}
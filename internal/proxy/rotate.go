@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// captureFile is the capture output. With a size or age limit it is
+// rotated: the current file is renamed after the time it was started,
+// optionally gzipped in the background, and a new file takes its place.
+type captureFile struct {
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	compress bool
+
+	file    *os.File
+	size    int64
+	entries int
+	opened  time.Time
+
+	// header is the record the file was started with, and headerSize its
+	// padded size; the time range of the entries is filled in when the
+	// file is rotated or closed. Files appended to keep their header.
+	header     *models.FileHeader
+	headerSize int
+
+	compressing sync.WaitGroup
+}
+
+func openCaptureFile(path string, maxSize int64, maxAge time.Duration, compress bool) (*captureFile, error) {
+	f := &captureFile{path: path, maxSize: maxSize, maxAge: maxAge, compress: compress}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *captureFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600) // #nosec G304 -- output path comes from CLI flags
+	if err != nil {
+		return fmt.Errorf("failed to open capture file: %w", err)
+	}
+
+	_ = os.Chmod(f.path, 0600)
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat capture file: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.entries = 0
+	f.opened = time.Now()
+	f.header = nil
+	return nil
+}
+
+// observe extends the time range of the header with an entry's timestamp.
+func (f *captureFile) observe(ts time.Time) {
+	if f.header == nil || ts.IsZero() {
+		return
+	}
+
+	ts = ts.UTC()
+	if f.header.Start == nil || ts.Before(*f.header.Start) {
+		f.header.Start = &ts
+	}
+
+	if f.header.End == nil || ts.After(*f.header.End) {
+		f.header.End = &ts
+	}
+}
+
+// finishHeader rewrites the header with the time range of the entries.
+// The writes before it must have been flushed.
+func (f *captureFile) finishHeader() error {
+	if f.header == nil || f.header.Start == nil {
+		return nil
+	}
+
+	data, err := marshalHeader(*f.header, false)
+	if err != nil {
+		return err
+	}
+
+	if len(data) > f.headerSize {
+		return nil
+	}
+
+	// The padding goes before the newline, where JSON allows it.
+	data = append(data[:len(data)-1], bytes.Repeat([]byte{' '}, f.headerSize-len(data))...)
+	data = append(data, '\n')
+
+	// The capture file is opened for appending, which rules out WriteAt.
+	file, err := os.OpenFile(f.path, os.O_WRONLY, 0600) // #nosec G304 -- output path comes from CLI flags
+	if err != nil {
+		return fmt.Errorf("failed to update capture header: %w", err)
+	}
+
+	if _, err := file.WriteAt(data, 0); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to update capture header: %w", err)
+	}
+
+	return file.Close()
+}
+
+func (f *captureFile) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// due reports whether the next record of n bytes belongs in a new file.
+// A file always takes at least one record, and an idle file past its age
+// is only rotated when the next record arrives.
+func (f *captureFile) due(n int) bool {
+	if f.entries == 0 {
+		return false
+	}
+
+	return (f.maxSize > 0 && f.size+int64(n) > f.maxSize) ||
+		(f.maxAge > 0 && time.Since(f.opened) >= f.maxAge)
+}
+
+// rotate moves the current file aside and opens a new, empty one.
+func (f *captureFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close capture file: %w", err)
+	}
+
+	rotated := f.rotatedName()
+	if err := os.Rename(f.path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate capture file: %w", err)
+	}
+
+	if f.compress {
+		f.compressing.Add(1)
+		go func() {
+			defer f.compressing.Done()
+
+			if err := gzipFile(rotated); err != nil {
+				log.Printf("Failed to compress %s: %v\n", rotated, err)
+			}
+		}()
+	}
+
+	return f.open()
+}
+
+// rotatedName is the path with the start time of the file before its
+// extension, e.g. traffic-20241210T140000Z.json.
+func (f *captureFile) rotatedName() string {
+	ext := filepath.Ext(f.path)
+	base := strings.TrimSuffix(f.path, ext) + "-" + f.opened.UTC().Format("20060102T150405Z")
+
+	name := base + ext
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+
+	return name
+}
+
+// Close closes the current file and waits for rotated files to be
+// compressed.
+func (f *captureFile) Close() error {
+	err := f.file.Close()
+	f.compressing.Wait()
+	return err
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// gzipFile replaces path with path.gz.
+func gzipFile(path string) error {
+	src, err := os.Open(path) // #nosec G304 -- rotated capture file
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600) // #nosec G304 -- rotated capture file
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
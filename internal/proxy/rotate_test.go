@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+func TestRotation(t *testing.T) {
+	record := func(t *testing.T, file *captureFile, n int) {
+		t.Helper()
+
+		rec := &recorder{config: &CaptureConfig{}, writer: bufio.NewWriter(file), file: file, metrics: newMetrics()}
+		if err := rec.writeHeader(); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < n; i++ {
+			if err := rec.record(CapturedEntry{Method: "GET", Path: "/items", Timestamp: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := file.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := func(t *testing.T, path string) []string {
+		t.Helper()
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+
+		var r io.Reader = f
+		if strings.HasSuffix(path, ".gz") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r = gz
+		}
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	t.Run("by size", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "traffic.json")
+
+		file, err := openCaptureFile(path, 600, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		record(t, file, 5)
+
+		rotated, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "traffic-*.json"))
+		if len(rotated) == 0 {
+			t.Fatal("expected rotated files")
+		}
+
+		total := 0
+		for _, name := range append(rotated, path) {
+			got := lines(t, name)
+			if !strings.Contains(got[0], "replayer_format") {
+				t.Errorf("%s: expected a header, got %s", name, got[0])
+			}
+
+			if header, _, _ := models.ParseFileHeader([]byte(got[0])); name != path && (header == nil || header.Start == nil) {
+				t.Errorf("%s: expected the time range in the header, got %s", name, got[0])
+			}
+
+			if info, _ := os.Stat(name); info.Size() > 600 {
+				t.Errorf("%s: expected at most 600 bytes, got %d", name, info.Size())
+			}
+
+			total += len(got) - 1
+		}
+
+		if total != 5 {
+			t.Errorf("expected 5 entries across the files, got %d", total)
+		}
+	})
+
+	t.Run("time range", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "traffic.json")
+
+		file, err := openCaptureFile(path, 0, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := &recorder{config: &CaptureConfig{}, writer: bufio.NewWriter(file), file: file, metrics: newMetrics()}
+		if err := rec.writeHeader(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Exchanges are recorded as they finish, not as they start.
+		start := time.Date(2024, 12, 10, 14, 0, 0, 0, time.UTC)
+		for _, ts := range []time.Time{start.Add(time.Minute), start, start.Add(30 * time.Second)} {
+			if err := rec.record(CapturedEntry{Method: "GET", Path: "/items", Timestamp: ts}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := rec.close(); err != nil {
+			t.Fatal(err)
+		}
+
+		got := lines(t, path)
+		header, ok, err := models.ParseFileHeader([]byte(got[0]))
+		if !ok || err != nil {
+			t.Fatalf("expected a header, got %s (%v)", got[0], err)
+		}
+
+		if header.Start == nil || !header.Start.Equal(start) || header.End == nil || !header.End.Equal(start.Add(time.Minute)) {
+			t.Errorf("unexpected time range %v - %v", header.Start, header.End)
+		}
+
+		if len(got) != 4 {
+			t.Errorf("expected the header and 3 entries, got %d lines", len(got))
+		}
+	})
+
+	t.Run("by age with gzip", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "traffic.json")
+
+		file, err := openCaptureFile(path, 0, time.Nanosecond, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		record(t, file, 3)
+
+		rotated, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "traffic-*"))
+		if len(rotated) != 2 {
+			t.Fatalf("expected 2 rotated files, got %v", rotated)
+		}
+
+		for _, name := range rotated {
+			if !strings.HasSuffix(name, ".json.gz") {
+				t.Errorf("expected %s to be compressed", name)
+				continue
+			}
+
+			if got := lines(t, name); len(got) != 2 {
+				t.Errorf("%s: expected a header and an entry, got %d lines", name, len(got))
+			}
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/route"
+)
+
+// sampler thins out the recorded exchanges: a random share of them, then
+// at most perRoute a second for every route.
+type sampler struct {
+	rate     float64
+	perRoute int
+	routes   *route.Templater
+
+	mu     sync.Mutex
+	window time.Time
+	counts map[string]int
+}
+
+// newSampler returns nil when every exchange is recorded.
+func newSampler(config *CaptureConfig) *sampler {
+	rate := config.SampleRate
+	if rate <= 0 || rate >= 1 {
+		rate = 1
+	}
+
+	if rate == 1 && config.SamplePerRoute <= 0 {
+		return nil
+	}
+
+	return &sampler{rate: rate, perRoute: config.SamplePerRoute, routes: config.Routes}
+}
+
+// keep is called as exchanges are recorded, at the end, so now is the
+// recording time: their timestamps, taken at the start, arrive out of
+// order.
+func (s *sampler) keep(entry *models.LogEntry, now time.Time) bool {
+	if s == nil {
+		return true
+	}
+
+	if s.rate < 1 && rand.Float64() >= s.rate { // #nosec G404 -- sampling needs no secure randomness
+		return false
+	}
+
+	if s.perRoute <= 0 {
+		return true
+	}
+
+	key := s.routes.EntryKey(*entry)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if second := now.Truncate(time.Second); second.After(s.window) {
+		s.window = second
+		s.counts = map[string]int{}
+	}
+
+	if s.counts[key] >= s.perRoute {
+		return false
+	}
+
+	s.counts[key]++
+	return true
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// upstreamTimer collects the phases of the upstream round trip from an
+// httptrace.ClientTrace. Callbacks may run on the transport's dialing
+// goroutines, so fields are guarded.
+type upstreamTimer struct {
+	mu sync.Mutex
+
+	sent                      time.Time
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	firstByte                 time.Time
+	reused                    bool
+}
+
+func (t *upstreamTimer) trace() *httptrace.ClientTrace {
+	now := func(field *time.Time, keepFirst bool) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if !keepFirst || field.IsZero() {
+			*field = time.Now()
+		}
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { now(&t.dnsStart, true) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { now(&t.dnsDone, false) },
+		// Dialing may try several addresses; the first start and the last
+		// completion bound the connect phase.
+		ConnectStart:         func(string, string) { now(&t.connectStart, true) },
+		ConnectDone:          func(string, string, error) { now(&t.connectDone, false) },
+		TLSHandshakeStart:    func() { now(&t.tlsStart, true) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { now(&t.tlsDone, false) },
+		GotFirstResponseByte: func() { now(&t.firstByte, true) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			t.reused = info.Reused
+		},
+	}
+}
+
+// timing returns the breakdown once the response body has been read.
+func (t *upstreamTimer) timing(end time.Time) *models.Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sent.IsZero() {
+		return nil
+	}
+
+	return &models.Timing{
+		DNSMs:      between(t.dnsStart, t.dnsDone),
+		ConnectMs:  between(t.connectStart, t.connectDone),
+		TLSMs:      between(t.tlsStart, t.tlsDone),
+		TTFBMs:     between(t.sent, t.firstByte),
+		UpstreamMs: between(t.sent, end),
+		Reused:     t.reused,
+	}
+}
+
+func between(start, end time.Time) int64 {
+	if start.IsZero() || end.Before(start) {
+		return 0
+	}
+
+	return end.Sub(start).Milliseconds()
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UpstreamRoute sends the requests for Host and under the path Prefix to
+// URL. Their entries are tagged with Name and, with Output, written to a
+// capture file of their own.
+type UpstreamRoute struct {
+	Name   string `yaml:"name"`
+	Host   string `yaml:"host"`
+	Prefix string `yaml:"prefix"`
+	URL    string `yaml:"url"`
+	Output string `yaml:"output"`
+}
+
+// LoadUpstreams reads a YAML routing table:
+//
+//	upstreams:
+//	  - name: users
+//	    prefix: /api/users
+//	    url: http://users.internal:8080
+//	    output: users.json
+//	  - name: admin
+//	    host: admin.example.com
+//	    url: http://admin.internal
+func LoadUpstreams(path string) ([]UpstreamRoute, error) {
+	data, err := os.ReadFile(filepath.Clean(path)) // #nosec G304 -- config path comes from CLI flags
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upstream config: %w", err)
+	}
+
+	var config struct {
+		Upstreams []UpstreamRoute `yaml:"upstreams"`
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse upstream config: %w", err)
+	}
+
+	if len(config.Upstreams) == 0 {
+		return nil, fmt.Errorf("upstream config has no upstreams")
+	}
+
+	return config.Upstreams, nil
+}
+
+// upstream is a route with its URL parsed.
+type upstream struct {
+	UpstreamRoute
+	url *url.URL
+}
+
+// router picks the upstream of a request: the first route that matches,
+// then the default upstream, if any.
+type router struct {
+	routes   []*upstream
+	fallback *upstream
+}
+
+func newRouter(config *CaptureConfig) (*router, error) {
+	r := &router{}
+	names := map[string]bool{}
+
+	for i, route := range config.Upstreams {
+		if route.Host == "" && route.Prefix == "" {
+			return nil, fmt.Errorf("upstream %d: host or prefix is required", i+1)
+		}
+
+		if route.Prefix != "" && !strings.HasPrefix(route.Prefix, "/") {
+			return nil, fmt.Errorf("upstream %d: prefix %q must start with /", i+1, route.Prefix)
+		}
+
+		if route.Output != "" && route.Name == "" {
+			return nil, fmt.Errorf("upstream %d: a name is required with an output", i+1)
+		}
+
+		if route.Name != "" {
+			if names[route.Name] {
+				return nil, fmt.Errorf("upstream %d: duplicate name %q", i+1, route.Name)
+			}
+
+			names[route.Name] = true
+		}
+
+		u, err := parseUpstreamURL(route.URL)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %d: %w", i+1, err)
+		}
+
+		r.routes = append(r.routes, &upstream{UpstreamRoute: route, url: u})
+	}
+
+	if raw := strings.TrimSpace(config.Upstream); raw != "" {
+		// It would take every request the routes leave.
+		if config.Forward {
+			return nil, fmt.Errorf("a default upstream cannot be used in forward mode")
+		}
+
+		u, err := parseUpstreamURL(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		r.fallback = &upstream{UpstreamRoute: UpstreamRoute{URL: raw}, url: u}
+	}
+
+	if len(r.routes) == 0 && r.fallback == nil && !config.Forward {
+		return nil, fmt.Errorf("upstream is empty")
+	}
+
+	return r, nil
+}
+
+func parseUpstreamURL(raw string) (*url.URL, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, fmt.Errorf("upstream is empty")
+	}
+
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream URL: %w", err)
+	}
+
+	return u, nil
+}
+
+func (r *router) match(req *http.Request) *upstream {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, route := range r.routes {
+		if route.Host != "" && !strings.EqualFold(route.Host, host) {
+			continue
+		}
+
+		if route.Prefix != "" && !hasPathPrefix(req.URL.Path, route.Prefix) {
+			continue
+		}
+
+		return route
+	}
+
+	return r.fallback
+}
+
+// hasPathPrefix matches whole segments: /api matches /api and /api/users,
+// not /apix.
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/") || prefix == ""
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadUpstreams(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "upstreams.yaml")
+		config := "upstreams:\n  - name: users\n    prefix: /api/users\n    url: http://users.internal\n    output: users.json\n  - host: admin.example.com\n    url: http://admin.internal\n"
+		if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		routes, err := LoadUpstreams(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(routes) != 2 || routes[0].Output != "users.json" || routes[1].Host != "admin.example.com" {
+			t.Errorf("unexpected routes: %+v", routes)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "upstreams.yaml")
+		if err := os.WriteFile(path, []byte("upstreams: []\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadUpstreams(path); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestRouter(t *testing.T) {
+	config := &CaptureConfig{
+		Upstream: "http://default.internal",
+		Upstreams: []UpstreamRoute{
+			{Name: "admin-api", Host: "admin.example.com", Prefix: "/api", URL: "http://admin-api.internal"},
+			{Name: "admin", Host: "Admin.Example.com", URL: "http://admin.internal"},
+			{Name: "users", Prefix: "/api/users/", URL: "http://users.internal"},
+		},
+	}
+
+	router, err := newRouter(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		host string
+		path string
+		want string
+	}{
+		{"admin.example.com:8443", "/api/users", "admin-api"},
+		{"admin.example.com", "/dashboard", "admin"},
+		{"api.example.com", "/api/users", "users"},
+		{"api.example.com", "/api/users/1", "users"},
+		{"api.example.com", "/api/usersx", ""},
+		{"api.example.com", "/", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = tt.host
+
+			up := router.match(req)
+			if up == nil || up.Name != tt.want {
+				t.Fatalf("expected %q, got %+v", tt.want, up)
+			}
+
+			if tt.want == "" && up.URL != "http://default.internal" {
+				t.Errorf("expected the default upstream, got %s", up.URL)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, routes := range [][]UpstreamRoute{
+			{{URL: "http://a"}},
+			{{Prefix: "api", URL: "http://a"}},
+			{{Prefix: "/a", URL: "http://a", Output: "a.json"}},
+			{{Name: "a", Prefix: "/a", URL: "http://a"}, {Name: "a", Prefix: "/b", URL: "http://b"}},
+			{{Prefix: "/a"}},
+		} {
+			if _, err := newRouter(&CaptureConfig{Upstreams: routes}); err == nil {
+				t.Errorf("expected an error for %+v", routes)
+			}
+		}
+	})
+}
+
+func TestCaptureUpstreams(t *testing.T) {
+	backend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name)
+		}))
+	}
+
+	users, admin, fallback := backend("users"), backend("admin"), backend("default")
+	defer users.Close()
+	defer admin.Close()
+	defer fallback.Close()
+
+	dir := t.TempDir()
+	config := &CaptureConfig{
+		Upstream:   fallback.URL,
+		OutputFile: filepath.Join(dir, "traffic.json"),
+		Upstreams: []UpstreamRoute{
+			{Name: "admin", Host: "admin.example.com", URL: admin.URL},
+			{Name: "users", Prefix: "/users", URL: users.URL, Output: filepath.Join(dir, "users.json")},
+		},
+	}
+
+	file, err := openCaptureFile(config.OutputFile, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{config: config, writer: bufio.NewWriter(file), file: file, metrics: newMetrics()}
+	if err := rec.openOutputs(); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newHandler(config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	for _, tt := range []struct{ host, path, want string }{
+		{"", "/users/1", "users"},
+		{"admin.example.com", "/users/1", "admin"},
+		{"", "/orders", "default"},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, proxy.URL+tt.path, nil)
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if string(body) != tt.want {
+			t.Errorf("%s%s: expected the %s upstream, got %q", tt.host, tt.path, tt.want, body)
+		}
+	}
+
+	if err := rec.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(data)
+	}
+
+	usersFile := read("users.json")
+	if !strings.Contains(usersFile, "replayer_format") || !strings.Contains(usersFile, `"upstream":"`+users.URL+`","tag":"users"`) {
+		t.Errorf("expected the users entry in its own file, got %s", usersFile)
+	}
+
+	main := read("traffic.json")
+	if strings.Contains(main, `"tag":"users"`) || !strings.Contains(main, `"tag":"admin"`) || !strings.Contains(main, `"upstream":"`+fallback.URL+`"`) {
+		t.Errorf("expected the other entries in the main file, got %s", main)
+	}
+}
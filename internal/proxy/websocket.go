@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/websocket"
+)
+
+// tapWebSocket wraps the upgraded backend connection so the frames the
+// reverse proxy copies in both directions are decoded on the side. The
+// session is recorded as one entry when the connection closes, with the
+// messages up to the stream limit.
+func tapWebSocket(resp *http.Response, rec *recorder) error {
+	backend, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return fmt.Errorf("upgraded response body is not writable")
+	}
+
+	entry := newEntry(resp)
+
+	// The reverse proxy closes the backend after its handler has returned,
+	// so the session is in flight until it is recorded.
+	rec.inflight.Add(1)
+
+	tap := &wsTap{ReadWriteCloser: backend, start: time.Now(), limit: sessionLimit(rec.config)}
+	tap.server = tap.decode(models.DirectionServer)
+	tap.client = tap.decode(models.DirectionClient)
+	tap.done = func(messages []models.WebSocketMessage, truncated bool) {
+		entry.WebSocket = messages
+		entry.WebSocketTruncated = truncated
+		entry.LatencyMs = time.Since(entry.Timestamp).Milliseconds()
+		if err := rec.record(entry); err != nil {
+			log.Printf("Failed to record websocket session: %v\n", err)
+		}
+
+		rec.inflight.Done()
+	}
+
+	resp.Body = tap
+	return nil
+}
+
+type wsTap struct {
+	io.ReadWriteCloser
+	start time.Time
+
+	server, client *io.PipeWriter
+	wg             sync.WaitGroup
+
+	// limit caps the bytes of the recorded messages; 0 keeps them all.
+	// Messages beyond it are dropped whole and the session is truncated.
+	limit int64
+
+	mu        sync.Mutex
+	messages  []models.WebSocketMessage
+	size      int64
+	truncated bool
+
+	once sync.Once
+	done func([]models.WebSocketMessage, bool)
+}
+
+// decode starts a goroutine that parses the frames written to the returned
+// pipe. After a parse error the rest of the stream is drained so the proxy
+// is never blocked.
+func (t *wsTap) decode(direction string) *io.PipeWriter {
+	pr, pw := io.Pipe()
+	t.wg.Add(1)
+
+	go func() {
+		defer t.wg.Done()
+
+		reader := websocket.NewMessageReader(pr)
+		for {
+			opcode, payload, err := reader.Next()
+			if err != nil {
+				_, _ = io.Copy(io.Discard, pr)
+				return
+			}
+
+			msg, ok := websocket.ToMessage(direction, opcode, payload, time.Since(t.start).Milliseconds())
+			if !ok {
+				continue
+			}
+
+			t.mu.Lock()
+			if t.truncated || (t.limit > 0 && t.size+int64(len(msg.Data)) > t.limit) {
+				t.truncated = true
+			} else {
+				t.messages = append(t.messages, msg)
+				t.size += int64(len(msg.Data))
+			}
+			t.mu.Unlock()
+		}
+	}()
+
+	return pw
+}
+
+// Read receives server frames from the upstream.
+func (t *wsTap) Read(p []byte) (int, error) {
+	n, err := t.ReadWriteCloser.Read(p)
+	if n > 0 {
+		_, _ = t.server.Write(p[:n])
+	}
+
+	return n, err
+}
+
+// Write forwards client frames to the upstream.
+func (t *wsTap) Write(p []byte) (int, error) {
+	_, _ = t.client.Write(p)
+	return t.ReadWriteCloser.Write(p)
+}
+
+func (t *wsTap) Close() error {
+	err := t.ReadWriteCloser.Close()
+
+	t.once.Do(func() {
+		_ = t.server.Close()
+		_ = t.client.Close()
+		t.wg.Wait()
+
+		t.mu.Lock()
+		messages, truncated := t.messages, t.truncated
+		t.mu.Unlock()
+
+		sort.SliceStable(messages, func(i, j int) bool { return messages[i].OffsetMs < messages[j].OffsetMs })
+
+		t.done(messages, truncated)
+	})
+
+	return err
+}
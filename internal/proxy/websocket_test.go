@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/websocket"
+)
+
+func echoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		for {
+			opcode, payload, err := conn.ReadMessage()
+			if err != nil || opcode == websocket.OpClose {
+				return
+			}
+
+			if err := conn.WriteMessage(opcode, payload); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func TestWebSocketCapture(t *testing.T) {
+	upstream := echoServer()
+	defer upstream.Close()
+
+	var buf bytes.Buffer
+	rec := &recorder{config: &CaptureConfig{Upstream: upstream.URL}, writer: bufio.NewWriter(&buf)}
+
+	handler, err := newHandler(rec.config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	conn, _, err := websocket.Dial("ws://"+strings.TrimPrefix(proxy.URL, "http://")+"/ws", nil, 5*time.Second, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, msg := range []string{"hello", `{"n":1}`} {
+		if err := conn.WriteMessage(websocket.OpText, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, payload, err := conn.ReadMessage(); err != nil || string(payload) != msg {
+			t.Fatalf("unexpected echo %q: %v", payload, err)
+		}
+	}
+
+	_ = conn.Close()
+
+	var line []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		rec.mu.Lock()
+		line = append([]byte(nil), buf.Bytes()...)
+		rec.mu.Unlock()
+
+		if len(line) > 0 {
+			break
+		}
+	}
+
+	var entry CapturedEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		t.Fatalf("expected a recorded session, got %q: %v", line, err)
+	}
+
+	if entry.Status != http.StatusSwitchingProtocols || entry.Path != "/ws" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	var got []string
+	for _, m := range entry.WebSocket {
+		// Whether the upstream's closing frame is seen before the client
+		// disconnects depends on timing.
+		if m.Direction == models.DirectionServer && m.Type == models.MessageClose {
+			continue
+		}
+
+		got = append(got, m.Direction+":"+m.Type+":"+m.Data)
+	}
+
+	want := []string{
+		models.DirectionClient + ":text:hello",
+		models.DirectionServer + ":text:hello",
+		models.DirectionClient + `:text:{"n":1}`,
+		models.DirectionServer + `:text:{"n":1}`,
+		models.DirectionClient + ":close:1000",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected messages:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestWebSocketCaptureLimit(t *testing.T) {
+	upstream := echoServer()
+	defer upstream.Close()
+
+	var buf bytes.Buffer
+	rec := &recorder{config: &CaptureConfig{Upstream: upstream.URL, MaxStreamSize: 10}, writer: bufio.NewWriter(&buf)}
+
+	handler, err := newHandler(rec.config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	conn, _, err := websocket.Dial("ws://"+strings.TrimPrefix(proxy.URL, "http://")+"/ws", nil, 5*time.Second, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The echoes of the first message fill the limit; the second goes
+	// through but is not recorded.
+	for _, msg := range []string{"hello", "world"} {
+		if err := conn.WriteMessage(websocket.OpText, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, payload, err := conn.ReadMessage(); err != nil || string(payload) != msg {
+			t.Fatalf("unexpected echo %q: %v", payload, err)
+		}
+	}
+
+	_ = conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for rec.metrics.captured.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the session to be recorded")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	var entry CapturedEntry
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if !entry.WebSocketTruncated || len(entry.WebSocket) != 2 {
+		t.Fatalf("expected the session truncated after 2 messages, got %v %+v", entry.WebSocketTruncated, entry.WebSocket)
+	}
+
+	for _, m := range entry.WebSocket {
+		if m.Data != "hello" {
+			t.Errorf("unexpected message %+v", m)
+		}
+	}
+}
+
+func TestWebSocketCaptureCompression(t *testing.T) {
+	// The upstream compresses its messages whenever the client offers
+	// permessage-deflate.
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate") {
+			conn, err := websocket.Upgrade(w, r)
+			if err != nil {
+				return
+			}
+
+			_ = conn.WriteMessage(websocket.OpText, []byte("hello"))
+			_ = conn.Close()
+			return
+		}
+
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		var compressed bytes.Buffer
+		fw, _ := flate.NewWriter(&compressed, flate.BestSpeed)
+		_, _ = fw.Write([]byte("hello"))
+		_ = fw.Flush()
+		payload := bytes.TrimSuffix(compressed.Bytes(), []byte{0x00, 0x00, 0xff, 0xff})
+
+		_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + websocket.AcceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n" +
+			"Sec-WebSocket-Extensions: permessage-deflate\r\n\r\n")
+		_, _ = brw.Write(append([]byte{0xc1, byte(len(payload))}, payload...))
+		_ = brw.Flush()
+	}))
+	defer upstream.Close()
+
+	var buf bytes.Buffer
+	rec := &recorder{config: &CaptureConfig{Upstream: upstream.URL}, writer: bufio.NewWriter(&buf)}
+
+	handler, err := newHandler(rec.config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	header := http.Header{"Sec-WebSocket-Extensions": {"permessage-deflate; client_max_window_bits"}}
+	conn, resp, err := websocket.Dial("ws://"+strings.TrimPrefix(proxy.URL, "http://")+"/ws", header, 5*time.Second, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); ext != "" {
+		t.Errorf("expected no extension to be negotiated, got %q", ext)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, payload, err := conn.ReadMessage(); err != nil || string(payload) != "hello" {
+		t.Fatalf("unexpected message %q: %v", payload, err)
+	}
+
+	_ = conn.Close()
+
+	var line []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		rec.mu.Lock()
+		line = append([]byte(nil), buf.Bytes()...)
+		rec.mu.Unlock()
+
+		if len(line) > 0 {
+			break
+		}
+	}
+
+	var entry CapturedEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		t.Fatalf("expected a recorded session, got %q: %v", line, err)
+	}
+
+	if len(entry.WebSocket) == 0 || entry.WebSocket[0].Direction != models.DirectionServer || entry.WebSocket[0].Data != "hello" {
+		t.Errorf("expected the uncompressed message to be recorded, got %+v", entry.WebSocket)
+	}
+}
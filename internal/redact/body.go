@@ -0,0 +1,207 @@
+package redact
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+)
+
+// maxDecodedSize bounds a decompressed body.
+const maxDecodedSize = 64 << 20
+
+// parseJSONPath splits a path such as $.user.email or items.*.card into
+// segments. * matches every key of an object or element of an array.
+func parseJSONPath(path string) ([]string, error) {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if trimmed == "" {
+		return nil, fmt.Errorf("invalid JSON path %q", path)
+	}
+
+	segments := strings.Split(trimmed, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("invalid JSON path %q: empty segment", path)
+		}
+	}
+
+	return segments, nil
+}
+
+// Body redacts a raw body. JSON bodies have the configured paths masked and
+// the detectors applied to every string, and other text is scanned as is.
+// Binary bodies can't be scanned and are replaced with a pseudonym.
+func (r *Redactor) Body(body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil || decoder.More() {
+		if !utf8.Valid(body) {
+			return []byte(r.Pseudonym("body", string(body)))
+		}
+
+		return []byte(r.Text(string(body)))
+	}
+
+	changed := false
+	for _, path := range r.paths {
+		doc = r.maskPath(doc, path, &changed)
+	}
+
+	doc = r.scan(doc, &changed)
+	if !changed {
+		return body
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return body
+	}
+
+	return out
+}
+
+// encodedBody redacts a body sent with the Content-Encoding in headers.
+// Compressed bodies are scanned decoded and, when anything changed, kept
+// decoded with the encoding dropped from headers. Bodies that can't be
+// decoded are replaced with a pseudonym.
+func (r *Redactor) encodedBody(body []byte, headers map[string][]string) []byte {
+	encoding := headerValue(headers, "Content-Encoding")
+	if len(body) == 0 || encoding == "" {
+		return r.Body(body)
+	}
+
+	decoded, err := decodeContent(body, encoding)
+	if err != nil {
+		dropEncoding(headers)
+		return []byte(r.Pseudonym("body", string(body)))
+	}
+
+	redacted := r.Body(decoded)
+	if bytes.Equal(redacted, decoded) {
+		return body
+	}
+
+	dropEncoding(headers)
+	return redacted
+}
+
+// decodeContent undoes the codings of a Content-Encoding value, last
+// applied first.
+func decodeContent(body []byte, encoding string) ([]byte, error) {
+	codings := strings.Split(encoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		var reader io.Reader
+		switch coding := strings.ToLower(strings.TrimSpace(codings[i])); coding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			gz, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress body: %w", err)
+			}
+
+			reader = gz
+		case "deflate":
+			// deflate is meant to be zlib wrapped, but some servers send it raw.
+			zr, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				reader = flate.NewReader(bytes.NewReader(body))
+			} else {
+				reader = zr
+			}
+		case "br":
+			reader = brotli.NewReader(bytes.NewReader(body))
+		default:
+			return nil, fmt.Errorf("unsupported content encoding %q", coding)
+		}
+
+		out, err := io.ReadAll(io.LimitReader(reader, maxDecodedSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress body: %w", err)
+		}
+
+		if len(out) > maxDecodedSize {
+			return nil, fmt.Errorf("decompressed body exceeds %d bytes", maxDecodedSize)
+		}
+
+		body = out
+	}
+
+	return body, nil
+}
+
+func headerValue(headers map[string][]string, name string) string {
+	for key, values := range headers {
+		if strings.EqualFold(key, name) {
+			return strings.Join(values, ",")
+		}
+	}
+
+	return ""
+}
+
+// dropEncoding removes the headers that described the original encoded
+// body.
+func dropEncoding(headers map[string][]string) {
+	for key := range headers {
+		if strings.EqualFold(key, "Content-Encoding") || strings.EqualFold(key, "Content-Length") {
+			delete(headers, key)
+		}
+	}
+}
+
+func (r *Redactor) maskPath(node any, path []string, changed *bool) any {
+	if len(path) == 0 {
+		*changed = true
+		return r.Pseudonym("json", fmt.Sprint(node))
+	}
+
+	switch v := node.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if path[0] == "*" || path[0] == key {
+				v[key] = r.maskPath(child, path[1:], changed)
+			}
+		}
+	case []any:
+		for i, child := range v {
+			if path[0] == "*" || path[0] == fmt.Sprint(i) {
+				v[i] = r.maskPath(child, path[1:], changed)
+			}
+		}
+	}
+
+	return node
+}
+
+func (r *Redactor) scan(node any, changed *bool) any {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, child := range v {
+			v[key] = r.scan(child, changed)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = r.scan(child, changed)
+		}
+	case string:
+		if redacted := r.Text(v); redacted != v {
+			*changed = true
+			return redacted
+		}
+	}
+
+	return node
+}
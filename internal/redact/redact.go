@@ -0,0 +1,275 @@
+// Package redact removes credentials and personal data from traffic before
+// it is written to disk or uploaded. Values are replaced with keyed HMAC
+// pseudonyms, so the same input always maps to the same fake value and
+// requests can still be correlated.
+package redact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kx0101/replayer/internal/grpc"
+	"github.com/kx0101/replayer/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// SecretEnv holds the HMAC key when the config doesn't set one.
+const SecretEnv = "REPLAYER_REDACT_SECRET"
+
+// Config lists what to redact. Omitted headers and detectors fall back to
+// the defaults; an explicit empty list disables them.
+type Config struct {
+	Headers   []string `yaml:"headers"`
+	JSONPaths []string `yaml:"json_paths"`
+	Detectors []string `yaml:"detectors"`
+	Secret    string   `yaml:"secret"`
+}
+
+var (
+	defaultHeaders   = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token"}
+	defaultDetectors = []string{DetectorEmail, DetectorCard, DetectorJWT}
+)
+
+// LoadConfig reads a YAML redaction config. An empty path returns the
+// defaults.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path != "" {
+		data, err := os.ReadFile(filepath.Clean(path)) // #nosec G304 -- config path comes from CLI flags
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redaction config: %w", err)
+		}
+
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse redaction config: %w", err)
+		}
+	}
+
+	if cfg.Headers == nil {
+		cfg.Headers = defaultHeaders
+	}
+
+	if cfg.Detectors == nil {
+		cfg.Detectors = defaultDetectors
+	}
+
+	return cfg, nil
+}
+
+// Redactor applies a Config to entries and results.
+type Redactor struct {
+	headers   map[string]bool
+	paths     [][]string
+	detectors []detector
+	key       []byte
+}
+
+// New builds a Redactor. Without a secret in the config or in
+// REPLAYER_REDACT_SECRET a random key is used, so pseudonyms are only
+// consistent within one run.
+func New(cfg *Config) (*Redactor, error) {
+	r := &Redactor{headers: make(map[string]bool)}
+
+	for _, name := range cfg.Headers {
+		r.headers[http.CanonicalHeaderKey(name)] = true
+	}
+
+	for _, path := range cfg.JSONPaths {
+		segments, err := parseJSONPath(path)
+		if err != nil {
+			return nil, err
+		}
+
+		r.paths = append(r.paths, segments)
+	}
+
+	for _, name := range cfg.Detectors {
+		d, ok := detectors[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown detector %q (use email, card or jwt)", name)
+		}
+
+		r.detectors = append(r.detectors, d)
+	}
+
+	secret := cfg.Secret
+	if secret == "" {
+		secret = os.Getenv(SecretEnv)
+	}
+
+	if secret != "" {
+		r.key = []byte(secret)
+	} else {
+		r.key = make([]byte, 32)
+		if _, err := rand.Read(r.key); err != nil {
+			return nil, fmt.Errorf("failed to generate redaction key: %w", err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Warning: %s not set, pseudonyms are only consistent within this run\n", SecretEnv)
+	}
+
+	return r, nil
+}
+
+// Load is LoadConfig followed by New.
+func Load(path string) (*Redactor, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(cfg)
+}
+
+// Entry redacts an entry in place: denied headers, the path and query,
+// and both bodies. Bodies are only re-encoded when something changed, and
+// compressed bodies that changed are stored decompressed.
+func (r *Redactor) Entry(entry *models.LogEntry) {
+	entry.Path = r.Text(entry.Path)
+	entry.Headers = r.Headers(entry.Headers)
+	entry.ResponseHeaders = r.Headers(entry.ResponseHeaders)
+	entry.Trailers = r.Headers(entry.Trailers)
+
+	// gRPC bodies are length prefixed protobuf; rewriting strings inside
+	// them would corrupt the messages.
+	if !grpc.IsGRPC(http.Header(entry.Headers)) {
+		body, responseBody := entry.DecodedBody(), entry.DecodedResponseBody()
+		redactedBody, redactedResponse := r.encodedBody(body, entry.Headers), r.encodedBody(responseBody, entry.ResponseHeaders)
+		if !bytes.Equal(body, redactedBody) || !bytes.Equal(responseBody, redactedResponse) {
+			entry.SetBodies(redactedBody, redactedResponse)
+		}
+	}
+
+	if entry.GRPC != nil {
+		entry.GRPC = &models.GRPCStatus{Code: entry.GRPC.Code, Message: r.Text(entry.GRPC.Message)}
+	}
+
+	if len(entry.WebSocket) > 0 {
+		messages := make([]models.WebSocketMessage, len(entry.WebSocket))
+		for i, msg := range entry.WebSocket {
+			if msg.Type == models.MessageText {
+				msg.Data = string(r.Body([]byte(msg.Data)))
+			}
+
+			messages[i] = msg
+		}
+
+		entry.WebSocket = messages
+	}
+}
+
+// Result redacts a replay result in place, including the replayed response
+// bodies and body diffs.
+func (r *Redactor) Result(result *models.MultiEnvResult) {
+	r.Entry(&result.Request)
+
+	responses := make(map[string]models.ReplayResult, len(result.Responses))
+	for target, response := range result.Responses {
+		if response.Body != nil {
+			body := string(r.Body([]byte(*response.Body)))
+			response.Body = &body
+		}
+
+		if response.Error != nil {
+			msg := r.Text(*response.Error)
+			response.Error = &msg
+		}
+
+		responses[target] = response
+	}
+
+	result.Responses = responses
+
+	if result.Diff != nil && len(result.Diff.BodyDiffs) > 0 {
+		diff := *result.Diff
+		diff.BodyDiffs = make(map[string]string, len(result.Diff.BodyDiffs))
+		for target, body := range result.Diff.BodyDiffs {
+			diff.BodyDiffs[target] = string(r.Body([]byte(body)))
+		}
+
+		result.Diff = &diff
+	}
+}
+
+// Headers returns a copy of headers with denied values pseudonymized and
+// the detectors applied to the rest.
+func (r *Redactor) Headers(headers map[string][]string) map[string][]string {
+	if headers == nil {
+		return nil
+	}
+
+	redacted := make(map[string][]string, len(headers))
+	for name, values := range headers {
+		canonical := http.CanonicalHeaderKey(name)
+		out := make([]string, len(values))
+
+		for i, value := range values {
+			switch {
+			case !r.headers[canonical]:
+				out[i] = r.Text(value)
+			case canonical == "Cookie":
+				out[i] = r.cookies(value, false)
+			case canonical == "Set-Cookie":
+				out[i] = r.cookies(value, true)
+			default:
+				out[i] = r.credential(value)
+			}
+		}
+
+		redacted[name] = out
+	}
+
+	return redacted
+}
+
+// credential keeps the auth scheme of values like "Bearer <token>".
+func (r *Redactor) credential(value string) string {
+	if scheme, token, ok := strings.Cut(value, " "); ok && !strings.ContainsAny(scheme, "=;,") {
+		return scheme + " " + r.Pseudonym("header", token)
+	}
+
+	return r.Pseudonym("header", value)
+}
+
+// cookies pseudonymizes cookie values but keeps their names. For
+// Set-Cookie only the first pair is the cookie; attributes are kept.
+func (r *Redactor) cookies(value string, setCookie bool) string {
+	parts := strings.Split(value, ";")
+	for i, part := range parts {
+		if setCookie && i > 0 {
+			break
+		}
+
+		name, val, ok := strings.Cut(part, "=")
+		if !ok {
+			parts[i] = r.Pseudonym("cookie", part)
+			continue
+		}
+
+		parts[i] = name + "=" + r.Pseudonym("cookie", val)
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Pseudonym returns the consistent replacement for a value of the given
+// kind.
+func (r *Redactor) Pseudonym(kind, value string) string {
+	return "redacted-" + r.digest(kind, value)[:16]
+}
+
+func (r *Redactor) digest(kind, value string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,192 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/grpc"
+	"github.com/kx0101/replayer/internal/models"
+)
+
+var (
+	grpcTransportsOnce sync.Once
+	grpcTransports     map[bool]http.RoundTripper
+)
+
+// grpcTransport returns the shared HTTP/2 transport, so calls to a target
+// reuse one connection like HTTP requests do.
+func grpcTransport(useTLS bool) http.RoundTripper {
+	grpcTransportsOnce.Do(func() {
+		grpcTransports = map[bool]http.RoundTripper{
+			false: grpc.NewTransport(false, nil),
+			true:  grpc.NewTransport(true, nil),
+		}
+	})
+
+	return grpcTransports[useTLS]
+}
+
+// grpcError is the body of a failed call, so a code or message change is
+// reported as a body diff.
+type grpcError struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// loadRegistry loads the --proto-descriptor set, if any.
+func loadRegistry(args *cli.CliArgs) (*grpc.Registry, error) {
+	if args.ProtoDescriptor == "" {
+		return nil, nil
+	}
+
+	return grpc.LoadDescriptorSet(args.ProtoDescriptor)
+}
+
+// replayGRPC sends a recorded unary call. With a registry the response
+// message is decoded into JSON, and requests recorded as JSON are encoded;
+// otherwise messages are passed through base64 encoded.
+func replayGRPC(index int, entry models.LogEntry, target string, args *cli.CliArgs, registry *grpc.Registry) models.ReplayResult {
+	body, err := grpcRequestBody(entry, registry)
+	if err != nil {
+		return WrapError(index, err, 0)
+	}
+
+	useTLS := args.TLSCert != "" && args.TLSKey != ""
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+
+	ctx := context.Background()
+	if args.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(args.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s://%s%s", scheme, target, entry.Path), bytes.NewReader(body))
+	if err != nil {
+		return WrapError(index, err, 0)
+	}
+
+	applyHeaders(req.Header, grpcHeaders(entry.Headers), args)
+	req.Header.Set("Content-Type", grpc.ContentType)
+	req.Header.Set("Te", "trailers")
+
+	if host := recordedHost(entry); args.PreserveHost && host != "" {
+		req.Host = host
+	}
+
+	start := time.Now()
+	resp, err := grpcTransport(useTLS).RoundTrip(req) //#nosec G704 -- Target URLs are user-configured replay targets, SSRF is intentional
+	if err != nil {
+		return WrapError(index, err, time.Since(start).Milliseconds())
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	respBody, err := io.ReadAll(resp.Body)
+	latency := time.Since(start).Milliseconds()
+	if err != nil {
+		return WrapError(index, err, latency)
+	}
+
+	status := resp.StatusCode
+	result := string(respBody)
+
+	if code, message, ok := grpc.Status(resp.Header, resp.Trailer); ok {
+		status = grpc.HTTPStatus(code)
+		if result, err = grpcResponseBody(entry.Path, code, message, respBody, resp.Header.Get("Grpc-Encoding"), registry); err != nil {
+			return WrapError(index, err, latency)
+		}
+	}
+
+	return models.ReplayResult{
+		Index:     index,
+		Status:    &status,
+		LatencyMs: normalizeLatency(latency),
+		Body:      &result,
+	}
+}
+
+// grpcRequestBody returns the framed request message. Bodies that are JSON
+// rather than frames are encoded with the descriptor set.
+func grpcRequestBody(entry models.LogEntry, registry *grpc.Registry) ([]byte, error) {
+	body := entry.DecodedBody()
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return body, nil
+	}
+
+	if registry == nil {
+		return nil, fmt.Errorf("--proto-descriptor is required to replay a JSON gRPC request")
+	}
+
+	method, err := registry.Method(entry.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	wire, err := registry.FromJSON(method.Input(), trimmed)
+	if err != nil {
+		return nil, err
+	}
+
+	return grpc.EncodeFrame(wire), nil
+}
+
+func grpcResponseBody(path string, code int, message string, body []byte, encoding string, registry *grpc.Registry) (string, error) {
+	if code != grpc.CodeOK {
+		out, err := json.Marshal(grpcError{Code: grpc.CodeName(code), Message: message})
+		return string(out), err
+	}
+
+	frames, err := grpc.DecodeFrames(body, encoding)
+	if err != nil {
+		return "", err
+	}
+
+	if len(frames) != 1 {
+		return "", fmt.Errorf("expected one response message for a unary call, got %d", len(frames))
+	}
+
+	if registry == nil {
+		return base64.StdEncoding.EncodeToString(frames[0]), nil
+	}
+
+	method, err := registry.Method(path)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := registry.ToJSON(method.Output(), frames[0])
+	return string(out), err
+}
+
+// grpcHeaders drops the recorded headers that HTTP/2 or the call itself
+// sets.
+func grpcHeaders(recorded map[string][]string) map[string][]string {
+	headers := make(map[string][]string, len(recorded))
+	for k, v := range recorded {
+		switch strings.ToLower(k) {
+		case "connection", "content-length", "te":
+			continue
+		}
+
+		headers[k] = v
+	}
+
+	return headers
+}
@@ -3,118 +3,231 @@ package replay
 import (
 	"bytes"
 	"crypto/sha256"
-	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/graphql"
+	"github.com/kx0101/replayer/internal/grpc"
 	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/route"
+	"github.com/kx0101/replayer/internal/websocket"
 )
 
 const latencyBucketMs int64 = 5
 
-func Run(entries []models.LogEntry, args *cli.CliArgs) []models.MultiEnvResult {
-	semaphore := make(chan struct{}, args.Concurrency)
-	client := &http.Client{Timeout: time.Duration(args.Timeout) * time.Millisecond}
+func Run(entries []models.LogEntry, args *cli.CliArgs) ([]models.MultiEnvResult, error) {
+	r, err := newRunner(args)
+	if err != nil {
+		return nil, err
+	}
+	defer r.stop()
 
 	results := make([]models.MultiEnvResult, len(entries))
 
-	var rateLimiter <-chan time.Time
-	if args.RateLimit > 0 {
-		ticker := time.NewTicker(time.Second / time.Duration(args.RateLimit))
-		defer ticker.Stop()
-		rateLimiter = ticker.C
-	}
-
 	var pBar *ProgressBar
 	if args.ProgressBar && !args.OutputJSON {
 		pBar = NewProgressBar(len(entries))
 	}
 
-	var volatileConfig *VolatileConfig
-	if args.IgnoreVolatile {
-		volatileConfig = ConfigFromFlags(args.IgnoreFields, args.IgnorePatterns)
+	for i, entry := range entries {
+		results[i] = r.replay(i, entry)
+
+		if pBar != nil {
+			pBar.Increment()
+		}
 	}
 
-	targets := append([]string{}, args.Targets...)
-	sort.Strings(targets)
+	if pBar != nil {
+		pBar.Finish()
+	}
 
-	for i, entry := range entries {
-		if rateLimiter != nil {
-			<-rateLimiter
-		}
+	return results, nil
+}
 
-		responses := make(map[string]models.ReplayResult, len(targets))
-		resCh := make(chan struct {
-			target string
-			res    models.ReplayResult
-		}, len(targets))
-
-		var wg sync.WaitGroup
-		for _, target := range targets {
-			wg.Add(1)
-			semaphore <- struct{}{}
-
-			go func(target string) {
-				defer wg.Done()
-				defer func() { <-semaphore }()
-
-				res := ReplaySingle(i, entry, client, target, args)
-				resCh <- struct {
-					target string
-					res    models.ReplayResult
-				}{target, res}
-			}(target)
-		}
+// RunStream replays entries as they arrive until the channel is closed,
+// calling onResult after each one, and returns every result.
+func RunStream(entries <-chan models.LogEntry, args *cli.CliArgs, onResult func(models.MultiEnvResult)) ([]models.MultiEnvResult, error) {
+	r, err := newRunner(args)
+	if err != nil {
+		return nil, err
+	}
+	defer r.stop()
 
-		wg.Wait()
-		close(resCh)
+	var results []models.MultiEnvResult
+	for entry := range entries {
+		result := r.replay(len(results), entry)
+		results = append(results, result)
 
-		for r := range resCh {
-			responses[r.target] = r.res
+		if onResult != nil {
+			onResult(result)
 		}
+	}
 
-		result := models.MultiEnvResult{
-			Index:     i,
-			Request:   entry,
-			RequestID: Fingerprint(entry),
-			Responses: responses,
-		}
+	return results, nil
+}
 
-		if args.Compare && len(targets) > 1 {
-			result.Diff = CompareResponsesDeterministic(
-				responses,
-				targets,
-				volatileConfig,
-				args.ShowVolatileDiffs,
-			)
-		}
+type runner struct {
+	args           *cli.CliArgs
+	client         *http.Client
+	semaphore      chan struct{}
+	targets        []string
+	volatileConfig *VolatileConfig
+	routes         *route.Templater
+	registry       *grpc.Registry
+	rateLimiter    <-chan time.Time
+	stop           func()
+}
+
+func newRunner(args *cli.CliArgs) (*runner, error) {
+	registry, err := loadRegistry(args)
+	if err != nil {
+		return nil, err
+	}
 
-		results[i] = result
+	r := &runner{
+		args:      args,
+		client:    &http.Client{Timeout: time.Duration(args.Timeout) * time.Millisecond},
+		semaphore: make(chan struct{}, args.Concurrency),
+		registry:  registry,
+		stop:      func() {},
+	}
 
-		if pBar != nil {
-			pBar.Increment()
-		}
+	if args.RateLimit > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(args.RateLimit))
+		r.rateLimiter = ticker.C
+		r.stop = ticker.Stop
+	}
 
-		if args.Delay > 0 {
-			time.Sleep(time.Duration(args.Delay) * time.Millisecond)
+	if args.IgnoreVolatile {
+		r.volatileConfig = ConfigFromFlags(args.IgnoreFields, args.IgnorePatterns)
+	}
+
+	routes, err := route.New(args.Routes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ignoring route patterns: %v\n", err)
+	}
+
+	r.routes = routes
+	r.targets = append([]string{}, args.Targets...)
+	sort.Strings(r.targets)
+
+	return r, nil
+}
+
+func (r *runner) replay(i int, entry models.LogEntry) models.MultiEnvResult {
+	if r.rateLimiter != nil {
+		<-r.rateLimiter
+	}
+
+	responses := make(map[string]models.ReplayResult, len(r.targets))
+	resCh := make(chan struct {
+		target string
+		res    models.ReplayResult
+	}, len(r.targets))
+
+	var wg sync.WaitGroup
+	for _, target := range r.targets {
+		wg.Add(1)
+		r.semaphore <- struct{}{}
+
+		go func(target string) {
+			defer wg.Done()
+			defer func() { <-r.semaphore }()
+
+			res := replaySingle(i, entry, r.client, target, r.args, r.registry)
+			resCh <- struct {
+				target string
+				res    models.ReplayResult
+			}{target, res}
+		}(target)
+	}
+
+	wg.Wait()
+	close(resCh)
+
+	for res := range resCh {
+		responses[res.target] = res.res
+	}
+
+	result := models.MultiEnvResult{
+		Index:     i,
+		Request:   entry,
+		RequestID: Fingerprint(entry),
+		Route:     r.routes.EntryKey(entry),
+		Responses: responses,
+	}
+
+	if r.args.Compare && len(r.targets) > 1 {
+		compared := responses
+		if op, ok := graphql.FromEntry(entry); ok {
+			compared = normalizeGraphQL(op, responses)
 		}
+
+		result.Diff = CompareResponsesDeterministic(
+			compared,
+			r.targets,
+			r.volatileConfig,
+			r.args.ShowVolatileDiffs,
+		)
 	}
 
-	if pBar != nil {
-		pBar.Finish()
+	if r.args.Delay > 0 {
+		time.Sleep(time.Duration(r.args.Delay) * time.Millisecond)
+	}
+
+	return result
+}
+
+// normalizeGraphQL returns the responses with GraphQL bodies normalized for
+// comparison. The results keep the bodies as received.
+func normalizeGraphQL(op *graphql.Operation, responses map[string]models.ReplayResult) map[string]models.ReplayResult {
+	normalized := make(map[string]models.ReplayResult, len(responses))
+	for target, res := range responses {
+		if res.Body != nil {
+			if body, ok := op.NormalizeResponse(*res.Body); ok {
+				res.Body = &body
+			}
+		}
+
+		normalized[target] = res
 	}
 
-	return results
+	return normalized
 }
 
+// ReplaySingle sends one entry to target, loading --proto-descriptor for
+// the call; Run and RunStream load it once for all of their entries.
 func ReplaySingle(index int, entry models.LogEntry, client *http.Client, target string, args *cli.CliArgs) models.ReplayResult {
+	registry, err := loadRegistry(args)
+	if err != nil {
+		return WrapError(index, err, 0)
+	}
+
+	return replaySingle(index, entry, client, target, args, registry)
+}
+
+func replaySingle(index int, entry models.LogEntry, client *http.Client, target string, args *cli.CliArgs, registry *grpc.Registry) models.ReplayResult {
+	// A partial body would be a different request.
+	if entry.BodyTruncated {
+		return WrapError(index, fmt.Errorf("request body was truncated at capture (%d of %d bytes recorded)", len(entry.DecodedBody()), entry.BodySize), 0)
+	}
+
+	if len(entry.WebSocket) > 0 || websocket.IsUpgrade(http.Header(entry.Headers)) {
+		return replayWebSocket(index, entry, target, args)
+	}
+
+	if grpc.IsGRPC(http.Header(entry.Headers)) {
+		return replayGRPC(index, entry, target, args, registry)
+	}
+
 	req, err := BuildRequest(entry, target, args)
 	if err != nil {
 		return WrapError(index, err, 0)
@@ -145,12 +258,7 @@ func BuildRequest(entry models.LogEntry, target string, args *cli.CliArgs) (*htt
 	url := fmt.Sprintf("%s://%s%s", scheme, target, entry.Path)
 
 	var r io.Reader
-	if entry.Body != "" && entry.Body != "null" {
-		b, err := base64.StdEncoding.DecodeString(entry.Body)
-		if err != nil {
-			b = []byte(entry.Body)
-		}
-
+	if b := entry.DecodedBody(); b != nil {
 		r = bytes.NewReader(b)
 	}
 
@@ -159,40 +267,76 @@ func BuildRequest(entry models.LogEntry, target string, args *cli.CliArgs) (*htt
 		return nil, err
 	}
 
-	headerKeys := make([]string, 0, len(entry.Headers))
-	for k := range entry.Headers {
-		headerKeys = append(headerKeys, k)
+	applyHeaders(req.Header, entry.Headers, args)
+
+	if host := recordedHost(entry); args.PreserveHost && host != "" {
+		req.Host = host
+	}
+
+	// Trailers are only sent with a chunked body.
+	if len(entry.Trailers) > 0 && r != nil {
+		req.Trailer = http.Header{}
+		for k, v := range entry.Trailers {
+			req.Trailer[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+		}
+
+		req.ContentLength = -1
+	}
+
+	if r != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", "go-http-replayer/1.0")
+	}
+
+	return req, nil
+}
+
+// recordedHost is the Host the client sent: captured entries keep it apart,
+// imported logs as a header.
+func recordedHost(entry models.LogEntry) string {
+	if entry.Host != "" {
+		return entry.Host
+	}
+
+	return http.Header(entry.Headers).Get("Host")
+}
+
+// legacyBodyHeader is the header older capture proxies stored the request
+// body in. Files captured before it was removed still carry it.
+const legacyBodyHeader = "X-Original-Body-Buffer"
+
+// applyHeaders copies the recorded headers in a stable order, then the
+// auth and custom headers from the command line.
+func applyHeaders(header http.Header, recorded map[string][]string, args *cli.CliArgs) {
+	headerKeys := make([]string, 0, len(recorded))
+	for k := range recorded {
+		if http.CanonicalHeaderKey(k) != legacyBodyHeader {
+			headerKeys = append(headerKeys, k)
+		}
 	}
 	sort.Strings(headerKeys)
 
 	for _, k := range headerKeys {
-		values := append([]string{}, entry.Headers[k]...)
+		values := append([]string{}, recorded[k]...)
 		sort.Strings(values)
 		for _, v := range values {
-			req.Header.Add(k, v)
+			header.Add(k, v)
 		}
 	}
 
 	if args.AuthHeader != "" {
-		req.Header.Set("Authorization", args.AuthHeader)
+		header.Set("Authorization", args.AuthHeader)
 	}
 
 	for _, h := range args.Headers {
 		parts := strings.SplitN(h, ":", 2)
 		if len(parts) == 2 {
-			req.Header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+			header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
 		}
 	}
-
-	if r != nil && req.Header.Get("Content-Type") == "" {
-		req.Header.Set("Content-Type", "application/json")
-	}
-
-	if req.Header.Get("User-Agent") == "" {
-		req.Header.Set("User-Agent", "go-http-replayer/1.0")
-	}
-
-	return req, nil
 }
 
 func doRequest(client *http.Client, req *http.Request) ([]byte, int, int64, error) {
@@ -229,6 +373,13 @@ func Fingerprint(entry models.LogEntry) string {
 	h.Write([]byte(entry.Path))
 	h.Write([]byte(entry.Body))
 
+	for _, msg := range entry.WebSocket {
+		if msg.Direction == models.DirectionClient {
+			h.Write([]byte(msg.Type))
+			h.Write([]byte(msg.Data))
+		}
+	}
+
 	keys := make([]string, 0, len(entry.Headers))
 	for k := range entry.Headers {
 		keys = append(keys, k)
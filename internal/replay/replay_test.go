@@ -5,13 +5,30 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/grpc"
+	"github.com/kx0101/replayer/internal/grpc/grpctest"
 	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/websocket"
 )
 
+func run(t *testing.T, entries []models.LogEntry, args *cli.CliArgs) []models.MultiEnvResult {
+	t.Helper()
+
+	results, err := Run(entries, args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return results
+}
+
 func TestRun(t *testing.T) {
 	t.Run("single target success", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -28,7 +45,7 @@ func TestRun(t *testing.T) {
 		entries := []models.LogEntry{{Method: "GET", Path: "/", Headers: map[string][]string{}}}
 		args := &cli.CliArgs{Targets: []string{server.Listener.Addr().String()}, Concurrency: 1, Timeout: 5000}
 
-		results := Run(entries, args)
+		results := run(t, entries, args)
 		if len(results) != 1 {
 			t.Fatalf("expected 1 result, got %d", len(results))
 		}
@@ -68,7 +85,7 @@ func TestRun(t *testing.T) {
 			Compare:     true,
 		}
 
-		results := Run(entries, args)
+		results := run(t, entries, args)
 		if len(results) != 1 {
 			t.Fatalf("expected 1 result, got %d", len(results))
 		}
@@ -94,7 +111,7 @@ func TestRun(t *testing.T) {
 		args := &cli.CliArgs{Targets: []string{server.Listener.Addr().String()}, Concurrency: 1, Timeout: 5000, RateLimit: 2}
 
 		start := time.Now()
-		Run(entries, args)
+		run(t, entries, args)
 		if time.Since(start) < 1*time.Second {
 			t.Error("expected rate limiting to slow requests")
 		}
@@ -120,7 +137,7 @@ func TestRun(t *testing.T) {
 
 		args := &cli.CliArgs{Targets: []string{server.Listener.Addr().String()}, Concurrency: 5, Timeout: 5000}
 
-		Run(entries, args)
+		run(t, entries, args)
 
 		if max > 5 {
 			t.Errorf("expected max concurrency 5, got %d", max)
@@ -140,7 +157,7 @@ func TestRun(t *testing.T) {
 		args := &cli.CliArgs{Targets: []string{server.Listener.Addr().String()}, Concurrency: 1, Timeout: 5000, Delay: 200}
 
 		start := time.Now()
-		Run(entries, args)
+		run(t, entries, args)
 
 		if time.Since(start) < 200*time.Millisecond {
 			t.Error("expected delay between requests")
@@ -148,6 +165,36 @@ func TestRun(t *testing.T) {
 	})
 }
 
+func TestRunStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	entries := make(chan models.LogEntry, 2)
+	entries <- models.LogEntry{Method: "GET", Path: "/a"}
+	entries <- models.LogEntry{Method: "GET", Path: "/b"}
+	close(entries)
+
+	args := &cli.CliArgs{Targets: []string{server.Listener.Addr().String()}, Concurrency: 1, Timeout: 5000}
+
+	var seen []int
+	results, err := RunStream(entries, args, func(result models.MultiEnvResult) {
+		seen = append(seen, result.Index)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(results) != 2 || len(seen) != 2 || seen[1] != 1 {
+		t.Fatalf("expected 2 streamed results, got %d (%v)", len(results), seen)
+	}
+
+	if results[1].Request.Path != "/b" || results[1].Route != "GET /b" || *results[1].Responses[server.Listener.Addr().String()].Status != http.StatusAccepted {
+		t.Errorf("unexpected result: %+v", results[1])
+	}
+}
+
 func TestReplaySingle(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -191,6 +238,32 @@ func TestReplaySingle(t *testing.T) {
 			t.Fatalf("expected %q, got %q", payload, bodyReceived)
 		}
 	})
+
+	t.Run("truncated body", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+		}))
+		defer server.Close()
+
+		entry := models.LogEntry{
+			Method:        "POST",
+			Path:          "/",
+			Body:          `{"a":`,
+			BodyEncoding:  models.BodyEncodingText,
+			BodyTruncated: true,
+			BodySize:      7,
+		}
+
+		res := ReplaySingle(0, entry, &http.Client{Timeout: 5 * time.Second}, server.Listener.Addr().String(), &cli.CliArgs{})
+		if res.Error == nil || !strings.Contains(*res.Error, "truncated at capture (5 of 7 bytes recorded)") {
+			t.Errorf("expected a truncated body error, got %+v", res)
+		}
+
+		if calls.Load() != 0 {
+			t.Error("expected the partial body not to be sent")
+		}
+	})
 }
 
 func TestBuildRequest(t *testing.T) {
@@ -213,3 +286,285 @@ func TestBuildRequest(t *testing.T) {
 		t.Error("expected Content-Type application/json")
 	}
 }
+
+func TestReplayWebSocket(t *testing.T) {
+	newServer := func(transform func(string) string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Sec-WebSocket-Protocol") != "" || r.Header.Get("Authorization") != "Bearer t" {
+				http.Error(w, "unexpected headers", http.StatusBadRequest)
+				return
+			}
+
+			conn, err := websocket.Upgrade(w, r)
+			if err != nil {
+				return
+			}
+
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			for {
+				opcode, payload, err := conn.ReadMessage()
+				if err != nil || opcode == websocket.OpClose {
+					return
+				}
+
+				if err := conn.WriteMessage(opcode, []byte(transform(string(payload)))); err != nil {
+					return
+				}
+			}
+		}))
+	}
+
+	echo := newServer(func(s string) string { return s })
+	defer echo.Close()
+
+	stamped := newServer(func(s string) string {
+		return strings.Replace(s, `"timestamp":1`, `"timestamp":2`, 1)
+	})
+	defer stamped.Close()
+
+	entry := models.LogEntry{
+		Method:  "GET",
+		Path:    "/ws",
+		Status:  http.StatusSwitchingProtocols,
+		Headers: map[string][]string{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Protocol": {"chat"}},
+		WebSocket: []models.WebSocketMessage{
+			{Direction: models.DirectionClient, Type: models.MessageText, Data: "hello"},
+			{Direction: models.DirectionServer, Type: models.MessageText, Data: "hello"},
+			{Direction: models.DirectionClient, Type: models.MessageText, Data: `{"n":1,"timestamp":1}`},
+			{Direction: models.DirectionServer, Type: models.MessageText, Data: `{"n":1,"timestamp":1}`},
+			{Direction: models.DirectionClient, Type: models.MessageClose, Data: "1000"},
+		},
+	}
+
+	args := &cli.CliArgs{
+		Targets:     []string{echo.Listener.Addr().String(), stamped.Listener.Addr().String()},
+		Concurrency: 2,
+		Timeout:     5000,
+		AuthHeader:  "Bearer t",
+		Compare:     true,
+	}
+
+	t.Run("transcript", func(t *testing.T) {
+		res := ReplaySingle(0, entry, nil, echo.Listener.Addr().String(), args)
+		if res.Error != nil {
+			t.Fatalf("unexpected error: %s", *res.Error)
+		}
+
+		want := `[{"type":"text","data":"hello"},{"type":"text","data":{"n":1,"timestamp":1}}]`
+		if *res.Status != http.StatusSwitchingProtocols || *res.Body != want {
+			t.Errorf("unexpected result: %d %s", *res.Status, *res.Body)
+		}
+	})
+
+	t.Run("compare", func(t *testing.T) {
+		results := run(t, []models.LogEntry{entry}, args)
+		if results[0].Diff == nil || !results[0].Diff.BodyMismatch {
+			t.Fatalf("expected a body diff, got %+v", results[0].Diff)
+		}
+
+		volatile := *args
+		volatile.IgnoreVolatile = true
+
+		results = run(t, []models.LogEntry{entry}, &volatile)
+		if results[0].Diff != nil {
+			t.Errorf("expected the timestamp to be ignored, got %+v", results[0].Diff)
+		}
+	})
+
+	t.Run("fingerprint", func(t *testing.T) {
+		other := entry
+		other.WebSocket = append([]models.WebSocketMessage{{Direction: models.DirectionClient, Type: models.MessageText, Data: "bye"}}, entry.WebSocket...)
+
+		if Fingerprint(entry) == Fingerprint(other) {
+			t.Error("expected client messages to change the fingerprint")
+		}
+	})
+}
+
+func TestReplayGRPC(t *testing.T) {
+	hello := httptest.NewServer(grpctest.Handler("Hello"))
+	defer hello.Close()
+
+	hi := httptest.NewServer(grpctest.Handler("Hi"))
+	defer hi.Close()
+
+	descriptor := filepath.Join(t.TempDir(), "greeter.protoset")
+	if err := grpctest.WriteDescriptorSet(descriptor); err != nil {
+		t.Fatal(err)
+	}
+
+	// HelloRequest{name: "ada"} on the wire.
+	call := func(name string) models.LogEntry {
+		msg := append([]byte{0x0A, byte(len(name))}, name...)
+		return models.LogEntry{
+			Method:       "POST",
+			Path:         grpctest.SayHelloPath,
+			Headers:      map[string][]string{"Content-Type": {"application/grpc"}, "Te": {"trailers"}},
+			Body:         base64.StdEncoding.EncodeToString(grpc.EncodeFrame(msg)),
+			BodyEncoding: models.BodyEncodingBase64,
+		}
+	}
+
+	args := &cli.CliArgs{Timeout: 5000, ProtoDescriptor: descriptor}
+
+	t.Run("decoded response", func(t *testing.T) {
+		res := ReplaySingle(0, call("ada"), nil, hello.Listener.Addr().String(), args)
+		if res.Error != nil {
+			t.Fatalf("unexpected error: %s", *res.Error)
+		}
+
+		if *res.Status != http.StatusOK || !strings.HasPrefix(*res.Body, `{"message":"Hello, ada","timestamp":"`) {
+			t.Errorf("unexpected result: %d %s", *res.Status, *res.Body)
+		}
+	})
+
+	t.Run("status codes", func(t *testing.T) {
+		res := ReplaySingle(0, call(""), nil, hello.Listener.Addr().String(), args)
+		if res.Error != nil {
+			t.Fatalf("unexpected error: %s", *res.Error)
+		}
+
+		if *res.Status != http.StatusBadRequest || *res.Body != `{"code":"INVALID_ARGUMENT","message":"name is required"}` {
+			t.Errorf("unexpected result: %d %s", *res.Status, *res.Body)
+		}
+	})
+
+	t.Run("json request", func(t *testing.T) {
+		entry := call("")
+		entry.Body = `{"name":"grace"}`
+		entry.BodyEncoding = models.BodyEncodingText
+
+		res := ReplaySingle(0, entry, nil, hello.Listener.Addr().String(), args)
+		if res.Error != nil || !strings.Contains(*res.Body, "Hello, grace") {
+			t.Errorf("unexpected result: %+v", res)
+		}
+
+		if res := ReplaySingle(0, entry, nil, hello.Listener.Addr().String(), &cli.CliArgs{Timeout: 5000}); res.Error == nil {
+			t.Error("expected error without a descriptor set")
+		}
+	})
+
+	t.Run("compare", func(t *testing.T) {
+		compare := *args
+		compare.Targets = []string{hello.Listener.Addr().String(), hi.Listener.Addr().String()}
+		compare.Concurrency = 2
+		compare.Compare = true
+		compare.IgnoreVolatile = true
+
+		results := run(t, []models.LogEntry{call("ada")}, &compare)
+		if results[0].Diff == nil || !results[0].Diff.BodyMismatch || results[0].Diff.VolatileOnly {
+			t.Fatalf("expected a body diff, got %+v", results[0].Diff)
+		}
+
+		// The same server under two names, so only the timestamps differ.
+		addr := hello.Listener.Addr().String()
+		compare.Targets = []string{addr, strings.Replace(addr, "127.0.0.1", "localhost", 1)}
+
+		results = run(t, []models.LogEntry{call("ada")}, &compare)
+		if results[0].Diff != nil {
+			t.Errorf("expected the timestamp to be ignored, got %+v", results[0].Diff)
+		}
+	})
+
+	t.Run("invalid descriptor", func(t *testing.T) {
+		invalid := *args
+		invalid.ProtoDescriptor = filepath.Join(t.TempDir(), "missing.protoset")
+
+		if _, err := Run([]models.LogEntry{call("ada")}, &invalid); err == nil {
+			t.Error("expected the run to fail")
+		}
+	})
+}
+
+func TestReplayGraphQL(t *testing.T) {
+	server := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, body)
+		}))
+	}
+
+	a := server(`{"data":{"user":{"id":"1","name":"Ada"}},"errors":[{"message":"b","locations":[{"line":1,"column":2}]},{"message":"a"}],"extensions":{"cost":3}}`)
+	defer a.Close()
+	b := server(`{"extensions":{"cost":7},"errors":[{"message":"a"},{"message":"b","locations":[{"line":9,"column":9}]}],"data":{"user":{"name":"Ada","id":"1"}}}`)
+	defer b.Close()
+	c := server(`{"data":{"user":{"id":"1","name":"Grace"}}}`)
+	defer c.Close()
+
+	entry := models.LogEntry{
+		Method:  "POST",
+		Path:    "/graphql",
+		Headers: map[string][]string{"Content-Type": {"application/json"}},
+		Body:    base64.StdEncoding.EncodeToString([]byte(`{"query":"query GetUser { user(id: 1) { id name } }"}`)),
+	}
+
+	args := &cli.CliArgs{Concurrency: 2, Timeout: 5000, Compare: true}
+
+	t.Run("equivalent responses", func(t *testing.T) {
+		args := *args
+		args.Targets = []string{a.Listener.Addr().String(), b.Listener.Addr().String()}
+
+		results := run(t, []models.LogEntry{entry}, &args)
+		if results[0].Diff != nil {
+			t.Errorf("expected no diff, got %+v", results[0].Diff)
+		}
+
+		if results[0].Route != "POST /graphql query GetUser" {
+			t.Errorf("expected the operation in the route, got %q", results[0].Route)
+		}
+
+		if body := *results[0].Responses[args.Targets[1]].Body; !strings.Contains(body, `"cost":7`) {
+			t.Errorf("expected the body as received, got %s", body)
+		}
+	})
+
+	t.Run("different data", func(t *testing.T) {
+		args := *args
+		args.Targets = []string{a.Listener.Addr().String(), c.Listener.Addr().String()}
+
+		results := run(t, []models.LogEntry{entry}, &args)
+		if results[0].Diff == nil || !results[0].Diff.BodyMismatch {
+			t.Errorf("expected a body diff, got %+v", results[0].Diff)
+		}
+	})
+}
+
+func TestBuildRequestCaptured(t *testing.T) {
+	entry := models.LogEntry{
+		Method:   "POST",
+		Path:     "/upload?id=7",
+		Body:     base64.StdEncoding.EncodeToString([]byte(`{"ok":1}`)),
+		Headers:  map[string][]string{"X-Original-Body-Buffer": {"eyJvayI6MX0="}, "X-Tenant": {"acme"}},
+		Host:     "api.example.com",
+		Trailers: map[string][]string{"X-Checksum": {"abc"}},
+	}
+
+	req, err := BuildRequest(entry, "localhost:8080", &cli.CliArgs{PreserveHost: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Host != "api.example.com" || req.URL.RequestURI() != "/upload?id=7" {
+		t.Errorf("unexpected request %s %s", req.Host, req.URL)
+	}
+
+	if req.Header.Get("X-Original-Body-Buffer") != "" || req.Header.Get("X-Tenant") != "acme" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+
+	if req.Trailer.Get("X-Checksum") != "abc" || req.ContentLength != -1 {
+		t.Errorf("expected a chunked body with trailers, got %v", req.Trailer)
+	}
+
+	req, err = BuildRequest(entry, "localhost:8080", &cli.CliArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Host != "localhost:8080" {
+		t.Errorf("expected the target host, got %q", req.Host)
+	}
+}
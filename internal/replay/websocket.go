@@ -0,0 +1,118 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/websocket"
+)
+
+// wsResponseMessage is one server message in the transcript used as the
+// replay body. JSON payloads are embedded so volatile fields can be ignored.
+type wsResponseMessage struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// replayWebSocket opens a session against the target, sends the recorded
+// client messages in order and reads one server message for every recorded
+// one. The server messages become the body of the result.
+func replayWebSocket(index int, entry models.LogEntry, target string, args *cli.CliArgs) models.ReplayResult {
+	scheme := "ws"
+	if args.TLSCert != "" && args.TLSKey != "" {
+		scheme = "wss"
+	}
+
+	timeout := time.Duration(args.Timeout) * time.Millisecond
+	start := time.Now()
+
+	conn, resp, err := websocket.Dial(fmt.Sprintf("%s://%s%s", scheme, target, entry.Path), handshakeHeaders(entry, args), timeout, nil)
+	if err != nil {
+		return WrapError(index, err, time.Since(start).Milliseconds())
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	received := []wsResponseMessage{}
+	for _, msg := range entry.WebSocket {
+		if msg.Direction == models.DirectionClient {
+			opcode, payload := websocket.FromMessage(msg)
+			if err := conn.WriteMessage(opcode, payload); err != nil {
+				break
+			}
+
+			continue
+		}
+
+		if timeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+
+		opcode, payload, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		if m, ok := websocket.ToMessage(models.DirectionServer, opcode, payload, 0); ok {
+			received = append(received, responseMessage(m))
+		}
+
+		if opcode == websocket.OpClose {
+			break
+		}
+	}
+
+	body, err := json.Marshal(received)
+	if err != nil {
+		return WrapError(index, err, time.Since(start).Milliseconds())
+	}
+
+	status := resp.StatusCode
+	bodyStr := string(body)
+
+	return models.ReplayResult{
+		Index:     index,
+		Status:    &status,
+		LatencyMs: normalizeLatency(time.Since(start).Milliseconds()),
+		Body:      &bodyStr,
+	}
+}
+
+func responseMessage(m models.WebSocketMessage) wsResponseMessage {
+	if m.Type == models.MessageText && json.Valid([]byte(m.Data)) {
+		return wsResponseMessage{Type: m.Type, Data: json.RawMessage(m.Data)}
+	}
+
+	return wsResponseMessage{Type: m.Type, Data: m.Data}
+}
+
+// handshakeHeaders returns the recorded headers without the ones the
+// handshake sets itself.
+func handshakeHeaders(entry models.LogEntry, args *cli.CliArgs) http.Header {
+	recorded := make(map[string][]string, len(entry.Headers))
+	for k, v := range entry.Headers {
+		switch canonical := http.CanonicalHeaderKey(k); {
+		case canonical == "Connection", canonical == "Upgrade", canonical == "Content-Length",
+			strings.HasPrefix(canonical, "Sec-Websocket-"):
+			continue
+		}
+
+		recorded[k] = v
+	}
+
+	header := http.Header{}
+	applyHeaders(header, recorded, args)
+
+	if header.Get("User-Agent") == "" {
+		header.Set("User-Agent", "go-http-replayer/1.0")
+	}
+
+	return header
+}
@@ -0,0 +1,175 @@
+// Package route groups request paths into route templates such as
+// GET /users/{id}, so traffic to the same endpoint can be aggregated.
+package route
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kx0101/replayer/internal/graphql"
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// Placeholder replaces path segments that look like identifiers.
+const Placeholder = "{id}"
+
+var (
+	numericRegex = regexp.MustCompile(`^\d+$`)
+	uuidRegex    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	// hashRegex matches hex digests and object IDs of 16 characters or more.
+	hashRegex = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// Templater turns a request into its route key. User patterns are tried in
+// order before the automatic identifier detection.
+type Templater struct {
+	patterns []pattern
+}
+
+type pattern struct {
+	method   string
+	segments []string
+	// rest is set when the pattern ends in *, matching any remaining segments.
+	rest     bool
+	template string
+}
+
+// New compiles user route patterns such as /users/{userId}/posts/{slug},
+// optionally prefixed by a method ("GET /search/*"). A {name} segment
+// matches any single segment and a trailing * matches the rest of the path.
+func New(patterns []string) (*Templater, error) {
+	t := &Templater{}
+
+	for _, src := range patterns {
+		p := pattern{}
+		path := strings.TrimSpace(src)
+		if method, rest, ok := strings.Cut(path, " "); ok {
+			p.method = strings.ToUpper(method)
+			path = strings.TrimSpace(rest)
+		}
+
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid route pattern %q: path must start with /", src)
+		}
+
+		p.template = path
+		p.segments = splitPath(path)
+		if n := len(p.segments); n > 0 && p.segments[n-1] == "*" {
+			p.segments = p.segments[:n-1]
+			p.rest = true
+		}
+
+		for _, segment := range p.segments {
+			if strings.Contains(segment, "*") {
+				return nil, fmt.Errorf("invalid route pattern %q: * is only allowed as the last segment", src)
+			}
+		}
+
+		t.patterns = append(t.patterns, p)
+	}
+
+	return t, nil
+}
+
+// Key returns the route key, "METHOD /template", for a request. The query
+// string is ignored.
+func (t *Templater) Key(method, path string) string {
+	return strings.ToUpper(method) + " " + t.Template(method, path)
+}
+
+// EntryKey returns the route key of an entry. GraphQL requests are told
+// apart by their operation, e.g. "POST /graphql query GetUser".
+func (t *Templater) EntryKey(entry models.LogEntry) string {
+	key := t.Key(entry.Method, entry.Path)
+	if op, ok := graphql.FromEntry(entry); ok {
+		key += " " + op.Key()
+	}
+
+	return key
+}
+
+// Template returns the route template for a request path.
+func (t *Templater) Template(method, path string) string {
+	if idx := strings.IndexAny(path, "?#"); idx >= 0 {
+		path = path[:idx]
+	}
+
+	segments := splitPath(path)
+
+	if t != nil {
+		for _, p := range t.patterns {
+			if p.matches(method, segments) {
+				return p.template
+			}
+		}
+	}
+
+	if len(segments) == 0 {
+		return "/"
+	}
+
+	templated := make([]string, len(segments))
+	for i, segment := range segments {
+		if isIdentifier(segment) {
+			templated[i] = Placeholder
+		} else {
+			templated[i] = segment
+		}
+	}
+
+	return "/" + strings.Join(templated, "/")
+}
+
+// Of returns the route key recorded on a result, templating the request
+// automatically for results written before routes were recorded.
+func Of(result models.MultiEnvResult) string {
+	if result.Route != "" {
+		return result.Route
+	}
+
+	var t *Templater
+	return t.EntryKey(result.Request)
+}
+
+func (p pattern) matches(method string, segments []string) bool {
+	if p.method != "" && !strings.EqualFold(p.method, method) {
+		return false
+	}
+
+	if len(segments) < len(p.segments) || (!p.rest && len(segments) != len(p.segments)) {
+		return false
+	}
+
+	for i, want := range p.segments {
+		if strings.HasPrefix(want, "{") && strings.HasSuffix(want, "}") {
+			continue
+		}
+
+		if want != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func splitPath(path string) []string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return segments
+}
+
+func isIdentifier(segment string) bool {
+	if numericRegex.MatchString(segment) || uuidRegex.MatchString(segment) {
+		return true
+	}
+
+	// Require a digit so long hex-looking words are kept.
+	return hashRegex.MatchString(segment) && strings.ContainsAny(segment, "0123456789")
+}
@@ -0,0 +1,77 @@
+package route
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+func TestTemplate(t *testing.T) {
+	templater, err := New([]string{
+		"/users/{userId}/posts/{slug}",
+		"GET /search/*",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		method, path, want string
+	}{
+		{"GET", "/users/123", "GET /users/{id}"},
+		{"delete", "/users/123?force=true", "DELETE /users/{id}"},
+		{"GET", "/orders/550e8400-e29b-41d4-a716-446655440000/items/7", "GET /orders/{id}/items/{id}"},
+		{"GET", "/blobs/d41d8cd98f00b204e9800998ecf8427e", "GET /blobs/{id}"},
+		{"GET", "/objects/507f1f77bcf86cd799439011", "GET /objects/{id}"},
+		{"GET", "/words/deadbeefdeadbeef", "GET /words/deadbeefdeadbeef"},
+		{"GET", "/v2/health", "GET /v2/health"},
+		{"GET", "/users/42/posts/hello-world", "GET /users/{userId}/posts/{slug}"},
+		{"GET", "/users/42/posts", "GET /users/{id}/posts"},
+		{"GET", "/search/books/by/author", "GET /search/*"},
+		{"POST", "/search/books", "POST /search/books"},
+		{"GET", "", "GET /"},
+	}
+
+	for _, tt := range tests {
+		if got := templater.Key(tt.method, tt.path); got != tt.want {
+			t.Errorf("%s %s: expected %q, got %q", tt.method, tt.path, tt.want, got)
+		}
+	}
+
+	for _, invalid := range []string{"users/{id}", "/files/*/raw"} {
+		if _, err := New([]string{invalid}); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestOf(t *testing.T) {
+	recorded := models.MultiEnvResult{Route: "GET /users/{userId}", Request: models.LogEntry{Method: "GET", Path: "/users/1"}}
+	if got := Of(recorded); got != "GET /users/{userId}" {
+		t.Errorf("expected recorded route, got %q", got)
+	}
+
+	legacy := models.MultiEnvResult{Request: models.LogEntry{Method: "PUT", Path: "/users/1"}}
+	if got := Of(legacy); got != "PUT /users/{id}" {
+		t.Errorf("expected templated route, got %q", got)
+	}
+}
+
+func TestEntryKey(t *testing.T) {
+	templater, err := New(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body := base64.StdEncoding.EncodeToString([]byte(`{"query":"query GetUser($id: ID!) { user(id: $id) { id } }","variables":{"id":1}}`))
+	graphql := models.LogEntry{Method: "POST", Path: "/graphql", Body: body}
+	if got := templater.EntryKey(graphql); got != "POST /graphql query GetUser" {
+		t.Errorf("expected operation in key, got %q", got)
+	}
+
+	rest := models.LogEntry{Method: "GET", Path: "/users/1"}
+	if got := templater.EntryKey(rest); got != "GET /users/{id}" {
+		t.Errorf("expected plain route, got %q", got)
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/kx0101/replayer/internal/graphql"
 	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/route"
 )
 
 func EvaluateRules(config *RulesConfig, current *ReplayRunData, baseline *ReplayRunData) *RuleEvaluationResult {
@@ -36,11 +38,20 @@ func EvaluateRules(config *RulesConfig, current *ReplayRunData, baseline *Replay
 		}
 	}
 
+	if rules.Errors != nil {
+		failures := evaluateErrorRule(rules.Errors, current.Results, "global")
+		result.Failures = append(result.Failures, failures...)
+	}
+
 	for _, endpointRule := range rules.EndpointRules {
 		failures := evaluateEndpointRule(&endpointRule, current, baseline)
 		result.Failures = append(result.Failures, failures...)
 	}
 
+	if rules.PerRoute != nil {
+		result.Failures = append(result.Failures, evaluatePerRoute(rules.PerRoute, current, baseline)...)
+	}
+
 	sort.Slice(result.Failures, func(i, j int) bool {
 		if result.Failures[i].Scope != result.Failures[j].Scope {
 			return result.Failures[i].Scope < result.Failures[j].Scope
@@ -199,50 +210,164 @@ func getLatencyMetric(stats models.LatencyStats, metric string) int64 {
 	}
 }
 
+func evaluateErrorRule(rule *ErrorRule, results []models.MultiEnvResult, scope string) []RuleFailure {
+	if len(results) == 0 {
+		return nil
+	}
+
+	count := 0
+	affectedRequests := []int{}
+
+	for _, result := range results {
+		if requestFailed(result) {
+			count++
+			affectedRequests = append(affectedRequests, result.Index)
+		}
+	}
+
+	percent := float64(count) / float64(len(results)) * 100
+	if percent > rule.MaxPercent {
+		return []RuleFailure{{
+			Rule:    "errors",
+			Scope:   scope,
+			Message: fmt.Sprintf("Error rate of %.2f%% (%d of %d requests) exceeds threshold of %.2f%%", percent, count, len(results), rule.MaxPercent),
+			Details: map[string]any{
+				"count":             count,
+				"requests":          len(results),
+				"error_percent":     percent,
+				"threshold_percent": rule.MaxPercent,
+				"affected_requests": affectedRequests,
+			},
+		}}
+	}
+
+	return nil
+}
+
+func requestFailed(result models.MultiEnvResult) bool {
+	for _, response := range result.Responses {
+		if response.Status == nil || *response.Status >= 400 {
+			return true
+		}
+	}
+
+	return false
+}
+
 func evaluateEndpointRule(rule *EndpointRule, current, baseline *ReplayRunData) []RuleFailure {
-	matchingResults := filterResultsByEndpoint(current.Results, rule.Path, rule.Method)
+	matchingResults := filterResultsByEndpoint(current.Results, rule)
 
 	if len(matchingResults) == 0 {
 		return nil
 	}
 
-	scope := fmt.Sprintf("endpoint:%s", rule.Path)
+	target := rule.Path
+	if rule.Route != "" {
+		target = rule.Route
+	}
+
+	if rule.Operation != "" {
+		target = strings.TrimSpace(target + " " + rule.Operation)
+	}
+
+	scope := fmt.Sprintf("endpoint:%s", target)
 	if rule.Method != "" {
-		scope = fmt.Sprintf("endpoint:%s %s", rule.Method, rule.Path)
+		scope = fmt.Sprintf("endpoint:%s %s", rule.Method, target)
+	}
+
+	var baselineResults []models.MultiEnvResult
+	if baseline != nil {
+		baselineResults = filterResultsByEndpoint(baseline.Results, rule)
+	}
+
+	return evaluateScopedRules(RouteRules{
+		Latency:        rule.Latency,
+		StatusMismatch: rule.StatusMismatch,
+		BodyDiff:       rule.BodyDiff,
+		Errors:         rule.Errors,
+	}, matchingResults, baselineResults, scope)
+}
+
+// evaluatePerRoute applies the same rules to every route of the run, each
+// compared with the baseline results of that route.
+func evaluatePerRoute(rules *RouteRules, current, baseline *ReplayRunData) []RuleFailure {
+	currentByRoute := groupByRoute(current.Results)
+
+	var baselineByRoute map[string][]models.MultiEnvResult
+	if baseline != nil {
+		baselineByRoute = groupByRoute(baseline.Results)
 	}
 
+	keys := make([]string, 0, len(currentByRoute))
+	for key := range currentByRoute {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var failures []RuleFailure
+	for _, key := range keys {
+		failures = append(failures, evaluateScopedRules(*rules, currentByRoute[key], baselineByRoute[key], "route:"+key)...)
+	}
+
+	return failures
+}
+
+func evaluateScopedRules(rules RouteRules, results, baselineResults []models.MultiEnvResult, scope string) []RuleFailure {
 	var failures []RuleFailure
 
-	if rule.StatusMismatch != nil {
-		failures = append(failures, evaluateStatusMismatchRule(rule.StatusMismatch, matchingResults, scope)...)
+	if rules.StatusMismatch != nil {
+		failures = append(failures, evaluateStatusMismatchRule(rules.StatusMismatch, results, scope)...)
+	}
+
+	if rules.BodyDiff != nil {
+		failures = append(failures, evaluateBodyDiffRule(rules.BodyDiff, results, scope)...)
 	}
 
-	if rule.Latency != nil && baseline != nil {
-		currentLatency := calculateEndpointLatency(matchingResults)
+	if rules.Errors != nil {
+		failures = append(failures, evaluateErrorRule(rules.Errors, results, scope)...)
+	}
 
-		baselineMatchingResults := filterResultsByEndpoint(baseline.Results, rule.Path, rule.Method)
-		if len(baselineMatchingResults) > 0 {
-			baselineLatency := calculateEndpointLatency(baselineMatchingResults)
+	if rules.Latency != nil && len(baselineResults) > 0 {
+		currentLatency := calculateEndpointLatency(results)
+		baselineLatency := calculateEndpointLatency(baselineResults)
 
-			failure := evaluateLatencyRule(rule.Latency, currentLatency, baselineLatency, scope)
-			if failure != nil {
-				failures = append(failures, *failure)
-			}
+		failure := evaluateLatencyRule(rules.Latency, currentLatency, baselineLatency, scope)
+		if failure != nil {
+			failures = append(failures, *failure)
 		}
 	}
 
 	return failures
 }
 
-func filterResultsByEndpoint(results []models.MultiEnvResult, path, method string) []models.MultiEnvResult {
+func groupByRoute(results []models.MultiEnvResult) map[string][]models.MultiEnvResult {
+	grouped := make(map[string][]models.MultiEnvResult)
+	for _, result := range results {
+		key := route.Of(result)
+		grouped[key] = append(grouped[key], result)
+	}
+
+	return grouped
+}
+
+func filterResultsByEndpoint(results []models.MultiEnvResult, rule *EndpointRule) []models.MultiEnvResult {
 	var filtered []models.MultiEnvResult
 
 	for _, result := range results {
-		if !strings.HasPrefix(result.Request.Path, path) {
+		if rule.Route != "" {
+			if !matchRoute(route.Of(result), rule.Route) {
+				continue
+			}
+		} else if !strings.HasPrefix(result.Request.Path, rule.Path) {
 			continue
 		}
 
-		if method != "" && result.Request.Method != method {
+		if rule.Operation != "" && !matchOperation(result.Request, rule.Operation) {
+			continue
+		}
+
+		if rule.Method != "" && result.Request.Method != rule.Method {
 			continue
 		}
 
@@ -252,6 +377,30 @@ func filterResultsByEndpoint(results []models.MultiEnvResult, path, method strin
 	return filtered
 }
 
+// matchRoute compares a "METHOD /template" route key with a rule route,
+// which may leave out the method. Templates have no spaces, so a rule for
+// a GraphQL endpoint also matches the "METHOD /template operation" keys of
+// its operations.
+func matchRoute(key, want string) bool {
+	if key == want || strings.HasPrefix(key, want+" ") {
+		return true
+	}
+
+	_, template, _ := strings.Cut(key, " ")
+	return template == want || strings.HasPrefix(template, want+" ")
+}
+
+// matchOperation reports whether a request runs the GraphQL operation
+// given by name or by type and name.
+func matchOperation(entry models.LogEntry, want string) bool {
+	op, ok := graphql.FromEntry(entry)
+	if !ok {
+		return false
+	}
+
+	return op.Name == want || op.Key() == want
+}
+
 func calculateEndpointLatency(results []models.MultiEnvResult) models.LatencyStats {
 	if len(results) == 0 {
 		return models.LatencyStats{}
@@ -281,6 +430,42 @@ func ReadFileSafe(path string) ([]byte, error) {
 	return os.ReadFile(cleanPath)
 }
 
+// BaselineFromEntries turns recorded traffic into baseline results, so
+// latency rules compare replayed latencies with the upstream latencies the
+// capture proxy measured. Exchanges that did not complete or had faults
+// injected are left out, their latency says little about the upstream.
+// Results are keyed with routes, as the replayed ones are.
+func BaselineFromEntries(entries []models.LogEntry, routes *route.Templater) *ReplayRunData {
+	var results []models.MultiEnvResult
+	var latencies []int64
+
+	for i, entry := range entries {
+		if entry.Error != "" || entry.Fault != nil {
+			continue
+		}
+
+		status := entry.Status
+		latency := entry.UpstreamLatencyMs()
+		latencies = append(latencies, latency)
+		results = append(results, models.MultiEnvResult{
+			Index:   i,
+			Request: entry,
+			Route:   routes.EntryKey(entry),
+			Responses: map[string]models.ReplayResult{
+				"recorded": {Index: i, Status: &status, LatencyMs: latency},
+			},
+		})
+	}
+
+	return &ReplayRunData{
+		Results: results,
+		Summary: models.Summary{
+			TotalRequests: len(results),
+			Latency:       models.CalculateLatencyStats(latencies),
+		},
+	}
+}
+
 func LoadBaselineFile(path string) (*ReplayRunData, error) {
 	data, err := ReadFileSafe(path)
 	if err != nil {
@@ -0,0 +1,172 @@
+package rules
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/route"
+)
+
+func routeResult(index int, method, path string, status int, latency int64, diff *models.ResponseDiff) models.MultiEnvResult {
+	return models.MultiEnvResult{
+		Index:   index,
+		Request: models.LogEntry{Method: method, Path: path},
+		Responses: map[string]models.ReplayResult{
+			"staging": {Status: &status, LatencyMs: latency},
+		},
+		Diff: diff,
+	}
+}
+
+func TestEvaluateRules_PerRoute(t *testing.T) {
+	mismatch := &models.ResponseDiff{StatusMismatch: true}
+	current := &ReplayRunData{Results: []models.MultiEnvResult{
+		routeResult(0, "GET", "/users/1", 200, 100, nil),
+		routeResult(1, "GET", "/users/2", 500, 120, nil),
+		routeResult(2, "GET", "/orders/9", 200, 40, mismatch),
+		routeResult(3, "GET", "/orders/10", 200, 42, nil),
+	}}
+	baseline := &ReplayRunData{Results: []models.MultiEnvResult{
+		routeResult(0, "GET", "/users/3", 200, 50, nil),
+		routeResult(1, "GET", "/orders/4", 200, 40, nil),
+	}}
+
+	config := &RulesConfig{Rules: &Rules{
+		PerRoute: &RouteRules{
+			Latency:        &LatencyRule{Metric: "max", RegressionPercent: 50},
+			StatusMismatch: &StatusMismatchRule{Max: 0},
+			Errors:         &ErrorRule{MaxPercent: 10},
+		},
+	}}
+
+	result := EvaluateRules(config, current, baseline)
+	if result.Passed {
+		t.Fatal("expected per-route rules to fail")
+	}
+
+	got := map[string]bool{}
+	for _, failure := range result.Failures {
+		got[failure.Scope+" "+failure.Rule] = true
+	}
+
+	want := []string{
+		"route:GET /orders/{id} status_mismatch",
+		"route:GET /users/{id} errors",
+		"route:GET /users/{id} latency",
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for _, key := range want {
+		if !got[key] {
+			t.Errorf("missing failure %q in %v", key, got)
+		}
+	}
+}
+
+func TestEvaluateRules_EndpointRoute(t *testing.T) {
+	current := &ReplayRunData{Results: []models.MultiEnvResult{
+		routeResult(0, "GET", "/users/1", 200, 10, nil),
+		routeResult(1, "DELETE", "/users/2", 404, 10, nil),
+		routeResult(2, "GET", "/users/1/posts", 500, 10, nil),
+	}}
+
+	config := &RulesConfig{Rules: &Rules{EndpointRules: []EndpointRule{
+		{Route: "/users/{id}", Errors: &ErrorRule{MaxPercent: 40}},
+		{Route: "GET /users/{id}", Errors: &ErrorRule{MaxPercent: 0}},
+	}}}
+
+	result := EvaluateRules(config, current, nil)
+	if len(result.Failures) != 1 || result.Failures[0].Scope != "endpoint:/users/{id}" {
+		t.Fatalf("expected only the method-less route rule to fail, got %+v", result.Failures)
+	}
+
+	if count := result.Failures[0].Details["count"]; count != 1 {
+		t.Errorf("expected 1 failed request, got %v", count)
+	}
+}
+
+func TestEvaluateRules_EndpointOperation(t *testing.T) {
+	graphqlResult := func(index int, query string, status int) models.MultiEnvResult {
+		result := routeResult(index, "POST", "/graphql", status, 10, nil)
+		result.Request.Body = base64.StdEncoding.EncodeToString([]byte(`{"query":"` + query + `"}`))
+		return result
+	}
+
+	current := &ReplayRunData{Results: []models.MultiEnvResult{
+		graphqlResult(0, "query GetUser { user { id } }", 200),
+		graphqlResult(1, "mutation CreateUser { createUser { id } }", 500),
+		graphqlResult(2, "query ListUsers { users { id } }", 200),
+	}}
+
+	config := &RulesConfig{Rules: &Rules{EndpointRules: []EndpointRule{
+		{Operation: "GetUser", Errors: &ErrorRule{MaxPercent: 0}},
+		{Operation: "mutation CreateUser", Errors: &ErrorRule{MaxPercent: 0}},
+		{Route: "POST /graphql", Errors: &ErrorRule{MaxPercent: 50}},
+		{Route: "POST /graphql query ListUsers", Errors: &ErrorRule{MaxPercent: 0}},
+	}}}
+
+	result := EvaluateRules(config, current, nil)
+	if len(result.Failures) != 1 || result.Failures[0].Scope != "endpoint:mutation CreateUser" {
+		t.Fatalf("expected only the CreateUser rule to fail, got %+v", result.Failures)
+	}
+}
+
+func TestBaselineFromEntries(t *testing.T) {
+	entries := []models.LogEntry{
+		{Method: "GET", Path: "/users/1", Status: 200, LatencyMs: 90, Timing: &models.Timing{UpstreamMs: 40}},
+		{Method: "GET", Path: "/users/2", Status: 200, LatencyMs: 60},
+		{Method: "GET", Path: "/users/3", Status: 499, LatencyMs: 30000, Error: "client aborted"},
+		{Method: "GET", Path: "/users/4", Status: 200, LatencyMs: 2000, Fault: &models.Fault{DelayMs: 1950}},
+	}
+
+	baseline := BaselineFromEntries(entries, nil)
+	if baseline.Summary.Latency.Max != 60 || baseline.Summary.Latency.Min != 40 {
+		t.Errorf("expected the upstream latencies, got %+v", baseline.Summary.Latency)
+	}
+
+	current := &ReplayRunData{Results: []models.MultiEnvResult{
+		routeResult(0, "GET", "/users/3", 200, 100, nil),
+	}}
+
+	config := &RulesConfig{Rules: &Rules{PerRoute: &RouteRules{
+		Latency: &LatencyRule{Metric: "max", RegressionPercent: 50},
+	}}}
+
+	result := EvaluateRules(config, current, baseline)
+	if len(result.Failures) != 1 || result.Failures[0].Scope != "route:GET /users/{id}" {
+		t.Errorf("expected a latency regression against the capture, got %+v", result.Failures)
+	}
+}
+
+func TestBaselineFromEntries_RoutePatterns(t *testing.T) {
+	routes, err := route.New([]string{"/shops/{shop}/items"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseline := BaselineFromEntries([]models.LogEntry{
+		{Method: "GET", Path: "/shops/acme/items", Status: 200, LatencyMs: 50},
+		{Method: "GET", Path: "/shops/globex/items", Status: 200, LatencyMs: 60},
+	}, routes)
+
+	if baseline.Results[0].Route != "GET /shops/{shop}/items" {
+		t.Errorf("expected the route pattern to key the baseline, got %q", baseline.Results[0].Route)
+	}
+
+	replayed := routeResult(0, "GET", "/shops/initech/items", 200, 200, nil)
+	replayed.Route = routes.EntryKey(replayed.Request)
+	current := &ReplayRunData{Results: []models.MultiEnvResult{replayed}}
+
+	config := &RulesConfig{Rules: &Rules{PerRoute: &RouteRules{
+		Latency: &LatencyRule{Metric: "max", RegressionPercent: 50},
+	}}}
+
+	result := EvaluateRules(config, current, baseline)
+	if len(result.Failures) != 1 || result.Failures[0].Scope != "route:GET /shops/{shop}/items" {
+		t.Errorf("expected a latency regression on the user-defined route, got %+v", result.Failures)
+	}
+}
@@ -33,9 +33,17 @@ func validateRules(config *RulesConfig) error {
 		}
 	}
 
+	if err := validateErrorRule(rules.Errors); err != nil {
+		return fmt.Errorf("global errors rule: %w", err)
+	}
+
 	for i, endpoint := range rules.EndpointRules {
-		if endpoint.Path == "" {
-			return fmt.Errorf("endpoint_rules[%d]: path is required", i)
+		if endpoint.Path == "" && endpoint.Route == "" && endpoint.Operation == "" {
+			return fmt.Errorf("endpoint_rules[%d]: path, route or operation is required", i)
+		}
+
+		if endpoint.Path != "" && endpoint.Route != "" {
+			return fmt.Errorf("endpoint_rules[%d]: path and route are mutually exclusive", i)
 		}
 
 		if endpoint.Latency != nil {
@@ -43,6 +51,34 @@ func validateRules(config *RulesConfig) error {
 				return fmt.Errorf("endpoint_rules[%d].latency: %w", i, err)
 			}
 		}
+
+		if err := validateErrorRule(endpoint.Errors); err != nil {
+			return fmt.Errorf("endpoint_rules[%d].errors: %w", i, err)
+		}
+	}
+
+	if perRoute := rules.PerRoute; perRoute != nil {
+		if perRoute.Latency != nil {
+			if err := validateLatencyRule(perRoute.Latency); err != nil {
+				return fmt.Errorf("per_route.latency: %w", err)
+			}
+		}
+
+		if err := validateErrorRule(perRoute.Errors); err != nil {
+			return fmt.Errorf("per_route.errors: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func validateErrorRule(rule *ErrorRule) error {
+	if rule == nil {
+		return nil
+	}
+
+	if rule.MaxPercent < 0 || rule.MaxPercent > 100 {
+		return fmt.Errorf("max_percent must be between 0 and 100: %.2f", rule.MaxPercent)
 	}
 
 	return nil
@@ -377,3 +377,79 @@ func TestParseRulesFile_EmptyFile(t *testing.T) {
 		t.Fatal("Expected Rules to be non-nil")
 	}
 }
+
+func TestParseRulesFile_RouteRules(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		t.Helper()
+
+		filePath := filepath.Join(t.TempDir(), "rules.yaml")
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+
+		return filePath
+	}
+
+	config, err := ParseRulesFile(write(t, `rules:
+  errors:
+    max_percent: 5
+  endpoint_rules:
+    - route: GET /users/{id}
+      body_diff:
+        allowed: false
+  per_route:
+    errors:
+      max_percent: 1
+    latency:
+      metric: p95
+      regression_percent: 25
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if config.Rules.Errors.MaxPercent != 5 || config.Rules.EndpointRules[0].Route != "GET /users/{id}" {
+		t.Errorf("unexpected rules: %+v", config.Rules)
+	}
+
+	if config.Rules.PerRoute == nil || config.Rules.PerRoute.Latency.Metric != "p95" {
+		t.Errorf("expected per_route rules, got %+v", config.Rules.PerRoute)
+	}
+
+	invalid := []string{
+		"rules:\n  endpoint_rules:\n    - path: /a\n      route: /a\n",
+		"rules:\n  per_route:\n    errors:\n      max_percent: 150\n",
+		"rules:\n  per_route:\n    latency:\n      metric: p42\n",
+	}
+
+	for _, content := range invalid {
+		if _, err := ParseRulesFile(write(t, content)); err == nil {
+			t.Errorf("expected error for %q", content)
+		}
+	}
+}
+
+func TestParseRulesFile_EndpointRuleOperation(t *testing.T) {
+	yamlContent := `rules:
+  endpoint_rules:
+    - operation: mutation CreateUser
+      errors:
+        max_percent: 0
+`
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "rules.yaml")
+
+	if err := os.WriteFile(filePath, []byte(yamlContent), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	config, err := ParseRulesFile(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if got := config.Rules.EndpointRules[0].Operation; got != "mutation CreateUser" {
+		t.Errorf("Expected operation 'mutation CreateUser', got %q", got)
+	}
+}
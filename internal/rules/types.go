@@ -12,7 +12,9 @@ type Rules struct {
 	StatusMismatch *StatusMismatchRule `yaml:"status_mismatch,omitempty"`
 	BodyDiff       *BodyDiffRule       `yaml:"body_diff,omitempty"`
 	Latency        *LatencyRule        `yaml:"latency,omitempty"`
+	Errors         *ErrorRule          `yaml:"errors,omitempty"`
 	EndpointRules  []EndpointRule      `yaml:"endpoint_rules,omitempty"`
+	PerRoute       *RouteRules         `yaml:"per_route,omitempty"`
 }
 
 type StatusMismatchRule struct {
@@ -29,11 +31,32 @@ type LatencyRule struct {
 	RegressionPercent float64 `yaml:"regression_percent"`
 }
 
+// ErrorRule limits the share of requests where a target failed (a status
+// of 400 or more, or no response).
+type ErrorRule struct {
+	MaxPercent float64 `yaml:"max_percent"`
+}
+
+// EndpointRule applies to requests whose path starts with Path or whose
+// route template equals Route, optionally narrowed to a GraphQL Operation
+// given by name ("GetUser") or type and name ("mutation CreateUser").
 type EndpointRule struct {
-	Path           string              `yaml:"path"`
+	Path           string              `yaml:"path,omitempty"`
+	Route          string              `yaml:"route,omitempty"`
+	Operation      string              `yaml:"operation,omitempty"`
 	Method         string              `yaml:"method,omitempty"`
 	Latency        *LatencyRule        `yaml:"latency,omitempty"`
 	StatusMismatch *StatusMismatchRule `yaml:"status_mismatch,omitempty"`
+	BodyDiff       *BodyDiffRule       `yaml:"body_diff,omitempty"`
+	Errors         *ErrorRule          `yaml:"errors,omitempty"`
+}
+
+// RouteRules are evaluated separately for every route in the run.
+type RouteRules struct {
+	Latency        *LatencyRule        `yaml:"latency,omitempty"`
+	StatusMismatch *StatusMismatchRule `yaml:"status_mismatch,omitempty"`
+	BodyDiff       *BodyDiffRule       `yaml:"body_diff,omitempty"`
+	Errors         *ErrorRule          `yaml:"errors,omitempty"`
 }
 
 type RuleEvaluationResult struct {
@@ -0,0 +1,125 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/route"
+)
+
+// Stats describes the traffic in a set of entries.
+type Stats struct {
+	Entries  int            `json:"entries"`
+	First    *time.Time     `json:"first,omitempty"`
+	Last     *time.Time     `json:"last,omitempty"`
+	Methods  map[string]int `json:"methods"`
+	Statuses map[string]int `json:"statuses"`
+	Routes   map[string]int `json:"routes"`
+}
+
+// ComputeStats counts methods, statuses and routes and finds the time
+// range. Entries without a status are counted as "none".
+func ComputeStats(entries []models.LogEntry, templater *route.Templater) Stats {
+	stats := Stats{
+		Entries:  len(entries),
+		Methods:  make(map[string]int),
+		Statuses: make(map[string]int),
+		Routes:   make(map[string]int),
+	}
+
+	for _, entry := range entries {
+		stats.Methods[entry.Method]++
+		stats.Routes[templater.EntryKey(entry)]++
+
+		status := "none"
+		if entry.Status > 0 {
+			status = strconv.Itoa(entry.Status)
+		}
+
+		stats.Statuses[status]++
+
+		if entry.Timestamp.IsZero() {
+			continue
+		}
+
+		ts := entry.Timestamp
+		if stats.First == nil || ts.Before(*stats.First) {
+			stats.First = &ts
+		}
+
+		if stats.Last == nil || ts.After(*stats.Last) {
+			stats.Last = &ts
+		}
+	}
+
+	return stats
+}
+
+func runStats(args *cli.ToolArgs, w io.Writer) error {
+	templater, err := route.New(args.Routes)
+	if err != nil {
+		return err
+	}
+
+	entries, err := readInputs(args.Inputs)
+	if err != nil {
+		return err
+	}
+
+	stats := ComputeStats(entries, templater)
+	if args.JSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
+	}
+
+	printStats(w, stats)
+	return nil
+}
+
+func printStats(w io.Writer, stats Stats) {
+	fmt.Fprintf(w, "Entries: %d\n", stats.Entries)
+	if stats.First != nil {
+		fmt.Fprintf(w, "Time range: %s - %s (%s)\n",
+			stats.First.Format(time.RFC3339), stats.Last.Format(time.RFC3339), stats.Last.Sub(*stats.First))
+	} else {
+		fmt.Fprintln(w, "Time range: no timestamps")
+	}
+
+	printDistribution(w, "Methods", stats.Methods, stats.Entries)
+	printDistribution(w, "Statuses", stats.Statuses, stats.Entries)
+	printDistribution(w, "Routes", stats.Routes, stats.Entries)
+}
+
+// printDistribution prints counts sorted by frequency, then by name.
+func printDistribution(w io.Writer, title string, counts map[string]int, total int) {
+	if len(counts) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(counts))
+	width := 0
+	for key := range counts {
+		keys = append(keys, key)
+		width = max(width, len(key))
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %-*s %8d %6.1f%%\n", width, key, counts[key], float64(counts[key])*100/float64(total))
+	}
+}
@@ -0,0 +1,320 @@
+// Package toolkit implements the traffic file subcommands (stats, dedupe,
+// split, merge, slice and validate) over JSON Lines LogEntry files.
+package toolkit
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/filter"
+	"github.com/kx0101/replayer/internal/importer"
+	"github.com/kx0101/replayer/internal/input"
+	"github.com/kx0101/replayer/internal/models"
+	"github.com/kx0101/replayer/internal/replay"
+	"github.com/kx0101/replayer/internal/route"
+)
+
+// ErrInvalidEntries is returned by validate when a file has malformed lines.
+var ErrInvalidEntries = errors.New("invalid entries found")
+
+// Run executes a toolkit subcommand.
+func Run(args *cli.ToolArgs) error {
+	switch args.Command {
+	case "stats":
+		return runStats(args, os.Stdout)
+	case "dedupe":
+		return runDedupe(args)
+	case "split":
+		return runSplit(args)
+	case "merge":
+		return runMerge(args)
+	case "slice":
+		return runSlice(args)
+	case "validate":
+		return runValidate(args, os.Stdout)
+	default:
+		return fmt.Errorf("unknown command: %s", args.Command)
+	}
+}
+
+func runDedupe(args *cli.ToolArgs) error {
+	entries, err := readInputs(args.Inputs)
+	if err != nil {
+		return err
+	}
+
+	unique := Dedupe(entries)
+	if err := writeOutput(args.OutputFile, args.Command, unique); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Kept %d of %d entries, removed %d duplicates\n", len(unique), len(entries), len(entries)-len(unique))
+	return nil
+}
+
+// Dedupe keeps the first entry for every request fingerprint.
+func Dedupe(entries []models.LogEntry) []models.LogEntry {
+	seen := make(map[string]bool, len(entries))
+	unique := make([]models.LogEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		fp := dedupeKey(entry)
+		if seen[fp] {
+			continue
+		}
+
+		seen[fp] = true
+		unique = append(unique, entry)
+	}
+
+	return unique
+}
+
+// dedupeKey is the fingerprint of the entry with its body stored base64
+// encoded, so duplicates match whatever their body_encoding. Fingerprints
+// themselves are request IDs, and stay as they were.
+func dedupeKey(entry models.LogEntry) string {
+	entry.Body = base64.StdEncoding.EncodeToString(entry.DecodedBody())
+	entry.BodyEncoding = ""
+	return replay.Fingerprint(entry)
+}
+
+func runMerge(args *cli.ToolArgs) error {
+	entries, err := readInputs(args.Inputs)
+	if err != nil {
+		return err
+	}
+
+	if err := writeOutput(args.OutputFile, args.Command, Merge(entries)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Merged %d entries from %d inputs\n", len(entries), len(args.Inputs))
+	return nil
+}
+
+// Merge orders entries by timestamp. Entries with equal timestamps keep
+// their input order.
+func Merge(entries []models.LogEntry) []models.LogEntry {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	return entries
+}
+
+func runSlice(args *cli.ToolArgs) error {
+	window, err := TimeWindow(args.From, args.To)
+	if err != nil {
+		return err
+	}
+
+	entries, err := readInputs(args.Inputs)
+	if err != nil {
+		return err
+	}
+
+	var sliced []models.LogEntry
+	for i := range entries {
+		if window.Match(&entries[i]) {
+			sliced = append(sliced, entries[i])
+		}
+	}
+
+	if err := writeOutput(args.OutputFile, args.Command, sliced); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Kept %d of %d entries\n", len(sliced), len(entries))
+	return nil
+}
+
+// TimeWindow builds a filter for from <= time < to. Either bound may be
+// empty and both accept the same values as time in filter expressions.
+func TimeWindow(from, to string) (*filter.Expr, error) {
+	var clauses []string
+	if from != "" {
+		clauses = append(clauses, "time >= "+strconv.Quote(from))
+	}
+
+	if to != "" {
+		clauses = append(clauses, "time < "+strconv.Quote(to))
+	}
+
+	if len(clauses) == 0 {
+		return nil, fmt.Errorf("a time window needs a start or an end")
+	}
+
+	return filter.Parse(strings.Join(clauses, " && "))
+}
+
+func runSplit(args *cli.ToolArgs) error {
+	templater, err := route.New(args.Routes)
+	if err != nil {
+		return err
+	}
+
+	entries, err := readInputs(args.Inputs)
+	if err != nil {
+		return err
+	}
+
+	key := func(e models.LogEntry) string { return routeFileName(templater.EntryKey(e)) }
+	if args.By == "time" {
+		key = func(e models.LogEntry) string { return timeFileName(e.Timestamp, args.Interval) }
+	}
+
+	groups := make(map[string][]models.LogEntry)
+	for _, entry := range entries {
+		name := key(entry)
+		groups[name] = append(groups[name], entry)
+	}
+
+	if err := os.MkdirAll(args.OutputDir, 0750); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(args.OutputDir, name)
+		if err := writeOutput(path, args.Command, groups[name]); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "%6d  %s\n", len(groups[name]), path)
+	}
+
+	return nil
+}
+
+var unsafeNameRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// routeFileName turns "GET /users/{id}" into GET_users_id.jsonl.
+func routeFileName(key string) string {
+	name := strings.Trim(unsafeNameRegex.ReplaceAllString(key, "_"), "_")
+	if !strings.Contains(name, "_") {
+		name += "_root"
+	}
+
+	return name + ".jsonl"
+}
+
+// timeFileName names the UTC window a timestamp falls in.
+func timeFileName(ts time.Time, interval time.Duration) string {
+	if ts.IsZero() {
+		return "no-timestamp.jsonl"
+	}
+
+	return ts.UTC().Truncate(interval).Format("20060102T150405Z") + ".jsonl"
+}
+
+// readInputs reads every entry from the given files, globs or directories,
+// in order. Malformed lines are reported and skipped; use validate to
+// check a file.
+func readInputs(inputs []string) ([]models.LogEntry, error) {
+	var entries []models.LogEntry
+	for _, pattern := range inputs {
+		paths, err := input.ExpandPaths(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range paths {
+			err := scanFile(path, func(lineNum int, line []byte) error {
+				if _, ok, err := models.ParseFileHeader(line); ok {
+					return err
+				}
+
+				var entry models.LogEntry
+				if err := json.Unmarshal(line, &entry); err != nil {
+					fmt.Fprintf(os.Stderr, "Skipping %s:%d: %v\n", path, lineNum, err)
+					return nil
+				}
+
+				entries = append(entries, entry)
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// scanFile calls fn for every non-blank line of a possibly compressed file.
+func scanFile(path string, fn func(lineNum int, line []byte) error) error {
+	file, err := input.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close file: %v\n", err)
+		}
+	}()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), input.MaxLineSize)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		if err := fn(lineNum, line); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read line %d: %w", lineNum+1, err)
+	}
+
+	return nil
+}
+
+func writeOutput(path, source string, entries []models.LogEntry) error {
+	if path == "" {
+		return importer.WriteFile(os.Stdout, source, entries)
+	}
+
+	file, err := os.Create(filepath.Clean(path)) // #nosec G304 -- output path comes from CLI flags
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	w := bufio.NewWriter(file)
+	if err := importer.WriteFile(w, source, entries); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,261 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/importer"
+	"github.com/kx0101/replayer/internal/models"
+)
+
+func writeEntries(t *testing.T, dir, name string, entries ...models.LogEntry) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := importer.WriteEntries(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func at(minute int) time.Time {
+	return time.Date(2024, 12, 10, 14, minute, 0, 0, time.UTC)
+}
+
+func TestStats(t *testing.T) {
+	dir := t.TempDir()
+	path := writeEntries(t, dir, "a.jsonl",
+		models.LogEntry{Method: "GET", Path: "/users/1", Status: 200, Timestamp: at(30)},
+		models.LogEntry{Method: "GET", Path: "/users/2?x=1", Status: 404, Timestamp: at(10)},
+		models.LogEntry{Method: "POST", Path: "/users", Timestamp: at(20)},
+	)
+
+	var out bytes.Buffer
+	if err := runStats(&cli.ToolArgs{Inputs: []string{path}}, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	text := out.String()
+	for _, want := range []string{
+		"Entries: 3",
+		"2024-12-10T14:10:00Z - 2024-12-10T14:30:00Z (20m0s)",
+		"GET /users/{id}",
+		"none",
+		"66.7%",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected output to contain %q:\n%s", want, text)
+		}
+	}
+
+	stats := ComputeStats(nil, nil)
+	if stats.Entries != 0 || stats.First != nil {
+		t.Errorf("unexpected empty stats: %+v", stats)
+	}
+}
+
+func TestDedupeMergeSlice(t *testing.T) {
+	dir := t.TempDir()
+	first := writeEntries(t, dir, "a.jsonl",
+		models.LogEntry{Method: "GET", Path: "/a", Timestamp: at(1)},
+		models.LogEntry{Method: "GET", Path: "/c", Timestamp: at(3)},
+	)
+	second := writeEntries(t, dir, "b.jsonl",
+		models.LogEntry{Method: "GET", Path: "/b", Timestamp: at(2)},
+		models.LogEntry{Method: "GET", Path: "/a", Timestamp: at(4)},
+	)
+
+	t.Run("merge", func(t *testing.T) {
+		out := filepath.Join(dir, "merged.jsonl")
+		if err := Run(&cli.ToolArgs{Command: "merge", Inputs: []string{first, second}, OutputFile: out}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		problems, checked, err := Validate(out)
+		if err != nil || len(problems) != 0 || checked != 4 {
+			t.Errorf("expected a valid file with a header, got %v %d %v", problems, checked, err)
+		}
+
+		entries, err := readInputs([]string{out})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := paths(entries); got != "/a /b /c /a" {
+			t.Errorf("unexpected order: %s", got)
+		}
+	})
+
+	t.Run("dedupe", func(t *testing.T) {
+		out := filepath.Join(dir, "unique.jsonl")
+		if err := Run(&cli.ToolArgs{Command: "dedupe", Inputs: []string{filepath.Join(dir, "[ab].jsonl")}, OutputFile: out}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		entries, err := readInputs([]string{out})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := paths(entries); got != "/a /c /b" {
+			t.Errorf("unexpected entries: %s", got)
+		}
+
+		// The same body stored as text and as base64.
+		encoded := []models.LogEntry{
+			{Method: "POST", Path: "/orders", Body: `{"id":1}`, BodyEncoding: models.BodyEncodingText},
+			{Method: "POST", Path: "/orders", Body: "eyJpZCI6MX0="},
+		}
+
+		if unique := Dedupe(encoded); len(unique) != 1 {
+			t.Errorf("expected bodies to be compared decoded, got %d entries", len(unique))
+		}
+	})
+
+	t.Run("slice", func(t *testing.T) {
+		out := filepath.Join(dir, "window.jsonl")
+		args := &cli.ToolArgs{Command: "slice", Inputs: []string{first, second}, OutputFile: out,
+			From: "2024-12-10T14:02:00Z", To: "2024-12-10T14:04:00Z"}
+		if err := Run(args); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		entries, err := readInputs([]string{out})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := paths(entries); got != "/c /b" {
+			t.Errorf("unexpected entries: %s", got)
+		}
+
+		if _, err := TimeWindow("yesterday", ""); err == nil {
+			t.Error("expected error for an invalid time")
+		}
+	})
+}
+
+func TestSplit(t *testing.T) {
+	dir := t.TempDir()
+	path := writeEntries(t, dir, "in.jsonl",
+		models.LogEntry{Method: "GET", Path: "/users/1", Timestamp: at(5)},
+		models.LogEntry{Method: "GET", Path: "/users/2", Timestamp: time.Date(2024, 12, 10, 15, 5, 0, 0, time.UTC)},
+		models.LogEntry{Method: "GET", Path: "/"},
+	)
+
+	t.Run("by route", func(t *testing.T) {
+		out := filepath.Join(dir, "routes")
+		if err := Run(&cli.ToolArgs{Command: "split", By: "route", Inputs: []string{path}, OutputDir: out}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assertFiles(t, out, map[string]int{"GET_users_id.jsonl": 2, "GET_root.jsonl": 1})
+	})
+
+	t.Run("by time", func(t *testing.T) {
+		out := filepath.Join(dir, "hours")
+		args := &cli.ToolArgs{Command: "split", By: "time", Interval: time.Hour, Inputs: []string{path}, OutputDir: out}
+		if err := Run(args); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assertFiles(t, out, map[string]int{
+			"20241210T140000Z.jsonl": 1,
+			"20241210T150000Z.jsonl": 1,
+			"no-timestamp.jsonl":     1,
+		})
+	})
+}
+
+func TestValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.jsonl")
+	content := strings.Join([]string{
+		`{"method":"GET","path":"/ok","status":200}`,
+		``,
+		`{"method":"GET","path":"/broken"`,
+		`{"method":"","path":"/x"}`,
+		`{"method":"GET","path":"relative"}`,
+		`{"method":"GET","path":"/x","status":42}`,
+		`[1,2]`,
+		`{"replayer_format":1,"created_at":"2024-12-10T14:00:00Z"}`,
+		`{"method":"GET","path":"/x","body":"not base64!","body_encoding":"base64"}`,
+		`{"method":"GET","path":"/x","body_encoding":"hex"}`,
+	}, "\n")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err := runValidate(&cli.ToolArgs{Inputs: []string{path}}, &out)
+	if !errors.Is(err, ErrInvalidEntries) {
+		t.Fatalf("expected ErrInvalidEntries, got %v", err)
+	}
+
+	text := out.String()
+	for _, want := range []string{
+		path + ":3: invalid JSON",
+		path + ":4: missing method",
+		path + ":5: path \"relative\" does not start with /",
+		path + ":6: invalid status 42",
+		path + ":7: not a JSON object",
+		path + ":8: header record must be the first line",
+		path + ":9: body is not valid base64",
+		path + ":10: unknown body_encoding \"hex\"",
+		"8 entries checked, 8 invalid",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected output to contain %q:\n%s", want, text)
+		}
+	}
+
+	good := writeEntries(t, t.TempDir(), "good.jsonl", models.LogEntry{Method: "GET", Path: "/"})
+	if err := runValidate(&cli.ToolArgs{Inputs: []string{good}}, &bytes.Buffer{}); err != nil {
+		t.Errorf("unexpected error for a valid file: %v", err)
+	}
+}
+
+func paths(entries []models.LogEntry) string {
+	var parts []string
+	for _, e := range entries {
+		parts = append(parts, e.Path)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func assertFiles(t *testing.T, dir string, want map[string]int) {
+	t.Helper()
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != len(want) {
+		t.Errorf("expected %d files, got %d", len(want), len(files))
+	}
+
+	for name, count := range want {
+		entries, err := readInputs([]string{filepath.Join(dir, name)})
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if len(entries) != count {
+			t.Errorf("%s: expected %d entries, got %d", name, count, len(entries))
+		}
+	}
+}
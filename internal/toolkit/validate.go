@@ -0,0 +1,133 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kx0101/replayer/internal/cli"
+	"github.com/kx0101/replayer/internal/input"
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// Problem is a malformed line found by Validate.
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// Validate checks every line of a file and returns the problems found and
+// the number of lines checked.
+func Validate(path string) ([]Problem, int, error) {
+	var problems []Problem
+	checked := 0
+
+	first := true
+	err := scanFile(path, func(lineNum int, line []byte) error {
+		if header, ok, err := models.ParseFileHeader(line); ok {
+			if err != nil {
+				problems = append(problems, Problem{File: path, Line: lineNum, Message: err.Error()})
+			} else if !first {
+				problems = append(problems, Problem{File: path, Line: lineNum, Message: "header record must be the first line"})
+			} else if header.Start != nil && header.End != nil && header.End.Before(*header.Start) {
+				problems = append(problems, Problem{File: path, Line: lineNum, Message: "header time range ends before it starts"})
+			}
+
+			first = false
+			return nil
+		}
+
+		first = false
+		checked++
+		if msg := validateLine(line); msg != "" {
+			problems = append(problems, Problem{File: path, Line: lineNum, Message: msg})
+		}
+
+		return nil
+	})
+
+	return problems, checked, err
+}
+
+func validateLine(line []byte) string {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return "not a JSON object"
+	}
+
+	var entry models.LogEntry
+	if err := json.Unmarshal(trimmed, &entry); err != nil {
+		return fmt.Sprintf("invalid JSON: %v", err)
+	}
+
+	switch {
+	case entry.Method == "":
+		return "missing method"
+	case strings.ContainsAny(entry.Method, " \t/"):
+		return fmt.Sprintf("invalid method %q", entry.Method)
+	case entry.Path == "":
+		return "missing path"
+	case !strings.HasPrefix(entry.Path, "/"):
+		return fmt.Sprintf("path %q does not start with /", entry.Path)
+	case entry.Status != 0 && (entry.Status < 100 || entry.Status > 599):
+		return fmt.Sprintf("invalid status %d", entry.Status)
+	case entry.LatencyMs < 0:
+		return fmt.Sprintf("negative latency %d", entry.LatencyMs)
+	}
+
+	switch entry.BodyEncoding {
+	case "", models.BodyEncodingText:
+	case models.BodyEncodingBase64:
+		if _, err := base64.StdEncoding.DecodeString(entry.Body); err != nil {
+			return "body is not valid base64"
+		}
+
+		if _, err := base64.StdEncoding.DecodeString(entry.ResponseBody); err != nil {
+			return "response_body is not valid base64"
+		}
+	default:
+		return fmt.Sprintf("unknown body_encoding %q", entry.BodyEncoding)
+	}
+
+	return ""
+}
+
+func runValidate(args *cli.ToolArgs, w io.Writer) error {
+	total, invalid := 0, 0
+
+	for _, pattern := range args.Inputs {
+		paths, err := input.ExpandPaths(pattern)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			problems, checked, err := Validate(path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+
+			for _, p := range problems {
+				fmt.Fprintln(w, p)
+			}
+
+			total += checked
+			invalid += len(problems)
+		}
+	}
+
+	fmt.Fprintf(w, "%d entries checked, %d invalid\n", total, invalid)
+	if invalid > 0 {
+		return ErrInvalidEntries
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+// ToMessage converts a data or close message into its recorded form. Ping
+// and pong frames are not recorded.
+func ToMessage(direction string, opcode byte, payload []byte, offsetMs int64) (models.WebSocketMessage, bool) {
+	switch opcode {
+	case OpText:
+		return models.NewWebSocketMessage(direction, models.MessageText, payload, offsetMs), true
+	case OpBinary:
+		return models.NewWebSocketMessage(direction, models.MessageBinary, payload, offsetMs), true
+	case OpClose:
+		data := ""
+		if len(payload) >= 2 {
+			data = strconv.Itoa(int(binary.BigEndian.Uint16(payload)))
+			if len(payload) > 2 {
+				data += " " + string(payload[2:])
+			}
+		}
+
+		return models.NewWebSocketMessage(direction, models.MessageClose, []byte(data), offsetMs), true
+	default:
+		return models.WebSocketMessage{}, false
+	}
+}
+
+// FromMessage returns the opcode and payload to send for a recorded message.
+func FromMessage(m models.WebSocketMessage) (byte, []byte) {
+	switch m.Type {
+	case models.MessageBinary:
+		return OpBinary, m.Payload()
+	case models.MessageClose:
+		codeText, reason, _ := strings.Cut(m.Data, " ")
+		code, err := strconv.Atoi(codeText)
+		if err != nil {
+			return OpClose, nil
+		}
+
+		payload := binary.BigEndian.AppendUint16(nil, uint16(code)) // #nosec G115 -- close codes are 16 bit
+		return OpClose, append(payload, reason...)
+	default:
+		return OpText, m.Payload()
+	}
+}
@@ -0,0 +1,399 @@
+// Package websocket implements the parts of RFC 6455 needed to capture and
+// replay WebSocket sessions: the opening handshake, and reading and writing
+// frames and messages.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1" // #nosec G505 -- SHA-1 is mandated by RFC 6455 for Sec-WebSocket-Accept
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Opcodes defined by RFC 6455.
+const (
+	OpContinuation byte = 0x0
+	OpText         byte = 0x1
+	OpBinary       byte = 0x2
+	OpClose        byte = 0x8
+	OpPing         byte = 0x9
+	OpPong         byte = 0xA
+)
+
+// maxFrameSize bounds a single frame payload so a corrupt length can't
+// exhaust memory.
+const maxFrameSize = 64 << 20
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Frame is a single WebSocket frame with its payload unmasked.
+type Frame struct {
+	Fin     bool
+	Opcode  byte
+	Payload []byte
+}
+
+// IsUpgrade reports whether the headers request a WebSocket upgrade.
+func IsUpgrade(headers http.Header) bool {
+	return headerContains(headers, "Connection", "upgrade") && headerContains(headers, "Upgrade", "websocket")
+}
+
+func headerContains(headers http.Header, name, token string) bool {
+	for _, value := range headers.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// AcceptKey computes the Sec-WebSocket-Accept value for a client key.
+func AcceptKey(key string) string {
+	h := sha1.New() // #nosec G401 -- required by RFC 6455
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// ReadFrame reads one frame, unmasking client frames.
+func ReadFrame(r io.Reader) (Frame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return Frame{}, err
+	}
+
+	f := Frame{Fin: head[0]&0x80 != 0, Opcode: head[0] & 0x0F}
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return Frame{}, err
+		}
+
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return Frame{}, err
+		}
+
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if length > maxFrameSize {
+		return Frame{}, fmt.Errorf("websocket frame of %d bytes exceeds the %d byte limit", length, maxFrameSize)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return Frame{}, err
+		}
+	}
+
+	f.Payload = make([]byte, length)
+	if _, err := io.ReadFull(r, f.Payload); err != nil {
+		return Frame{}, err
+	}
+
+	if masked {
+		for i := range f.Payload {
+			f.Payload[i] ^= mask[i%4]
+		}
+	}
+
+	return f, nil
+}
+
+// WriteFrame writes one frame. Clients must mask every frame they send.
+func WriteFrame(w io.Writer, f Frame, mask bool) error {
+	var buf []byte
+
+	first := f.Opcode & 0x0F
+	if f.Fin {
+		first |= 0x80
+	}
+
+	buf = append(buf, first)
+
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+
+	length := len(f.Payload)
+	switch {
+	case length < 126:
+		buf = append(buf, maskBit|byte(length))
+	case length <= 0xFFFF:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(length))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(length))
+	}
+
+	payload := f.Payload
+	if mask {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+
+		buf = append(buf, key[:]...)
+		payload = make([]byte, length)
+		for i, b := range f.Payload {
+			payload[i] = b ^ key[i%4]
+		}
+	}
+
+	if _, err := w.Write(append(buf, payload...)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MessageReader assembles fragmented frames into messages. Control frames
+// are returned as they arrive.
+type MessageReader struct {
+	r        io.Reader
+	opcode   byte
+	fragment []byte
+}
+
+// NewMessageReader reads messages from a raw frame stream.
+func NewMessageReader(r io.Reader) *MessageReader {
+	return &MessageReader{r: r}
+}
+
+// Next returns the opcode and payload of the next complete message.
+func (m *MessageReader) Next() (byte, []byte, error) {
+	for {
+		f, err := ReadFrame(m.r)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if f.Opcode >= OpClose {
+			return f.Opcode, f.Payload, nil
+		}
+
+		if f.Opcode != OpContinuation {
+			m.opcode = f.Opcode
+			m.fragment = m.fragment[:0]
+		}
+
+		m.fragment = append(m.fragment, f.Payload...)
+		if f.Fin {
+			return m.opcode, append([]byte(nil), m.fragment...), nil
+		}
+	}
+}
+
+// Conn is a WebSocket connection. Client connections mask the frames they
+// send.
+type Conn struct {
+	conn    net.Conn
+	reader  *MessageReader
+	client  bool
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// Dial opens a client connection to rawURL (ws:// or wss://) and completes
+// the opening handshake with the given extra headers.
+func Dial(rawURL string, header http.Header, timeout time.Duration, tlsConfig *tls.Config) (*Conn, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "wss" {
+			host += ":443"
+		} else {
+			host += ":80"
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = dialer.Dial("tcp", host)
+	case "wss":
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, tlsConfig)
+	default:
+		return nil, nil, fmt.Errorf("unsupported websocket scheme %q", u.Scheme)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rawKey [16]byte
+	if _, err := rand.Read(rawKey[:]); err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	key := base64.StdEncoding.EncodeToString(rawKey[:])
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Host:       u.Host,
+	}
+
+	for name, values := range header {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+
+	if timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("failed to send websocket handshake: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("failed to read websocket handshake: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		_ = conn.Close()
+		return nil, resp, fmt.Errorf("websocket handshake failed with status %d", resp.StatusCode)
+	}
+
+	if resp.Header.Get("Sec-WebSocket-Accept") != AcceptKey(key) {
+		_ = conn.Close()
+		return nil, resp, errors.New("websocket handshake returned an invalid Sec-WebSocket-Accept")
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	return &Conn{conn: conn, reader: NewMessageReader(br), client: true}, resp, nil
+}
+
+// Upgrade completes the server side of the handshake on an HTTP handler.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if !IsUpgrade(r.Header) || r.Header.Get("Sec-WebSocket-Key") == "" {
+		http.Error(w, "not a websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n"
+
+	if _, err := brw.WriteString(response); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if err := brw.Flush(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, reader: NewMessageReader(brw.Reader)}, nil
+}
+
+// ReadMessage returns the next data or control message. Pings are answered
+// automatically and not returned.
+func (c *Conn) ReadMessage() (byte, []byte, error) {
+	for {
+		opcode, payload, err := c.reader.Next()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case OpPing:
+			if err := c.WriteMessage(OpPong, payload); err != nil {
+				return 0, nil, err
+			}
+		case OpPong:
+		default:
+			return opcode, payload, nil
+		}
+	}
+}
+
+// WriteMessage sends a single unfragmented message.
+func (c *Conn) WriteMessage(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if opcode == OpClose {
+		c.closed = true
+	}
+
+	return WriteFrame(c.conn, Frame{Fin: true, Opcode: opcode, Payload: payload}, c.client)
+}
+
+// SetReadDeadline sets the deadline for the next ReadMessage.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// Close sends a normal closure frame, unless one was already sent, and
+// closes the connection.
+func (c *Conn) Close() error {
+	c.writeMu.Lock()
+	closed := c.closed
+	c.writeMu.Unlock()
+
+	if !closed {
+		_ = c.WriteMessage(OpClose, []byte{0x03, 0xE8})
+	}
+
+	return c.conn.Close()
+}
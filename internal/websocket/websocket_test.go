@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kx0101/replayer/internal/models"
+)
+
+func TestFrames(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		for _, size := range []int{0, 5, 300, 70000} {
+			for _, mask := range []bool{false, true} {
+				payload := bytes.Repeat([]byte("x"), size)
+
+				var buf bytes.Buffer
+				if err := WriteFrame(&buf, Frame{Fin: true, Opcode: OpBinary, Payload: payload}, mask); err != nil {
+					t.Fatal(err)
+				}
+
+				f, err := ReadFrame(&buf)
+				if err != nil {
+					t.Fatalf("size %d mask %v: %v", size, mask, err)
+				}
+
+				if !f.Fin || f.Opcode != OpBinary || !bytes.Equal(f.Payload, payload) {
+					t.Errorf("size %d mask %v: unexpected frame", size, mask)
+				}
+			}
+		}
+	})
+
+	t.Run("fragmented message", func(t *testing.T) {
+		var buf bytes.Buffer
+		_ = WriteFrame(&buf, Frame{Opcode: OpText, Payload: []byte("hel")}, true)
+		_ = WriteFrame(&buf, Frame{Fin: true, Opcode: OpPing, Payload: []byte("p")}, true)
+		_ = WriteFrame(&buf, Frame{Fin: true, Opcode: OpContinuation, Payload: []byte("lo")}, true)
+
+		reader := NewMessageReader(&buf)
+
+		opcode, payload, err := reader.Next()
+		if err != nil || opcode != OpPing || string(payload) != "p" {
+			t.Fatalf("expected the ping first, got %d %q %v", opcode, payload, err)
+		}
+
+		opcode, payload, err = reader.Next()
+		if err != nil || opcode != OpText || string(payload) != "hello" {
+			t.Fatalf("expected the assembled message, got %d %q %v", opcode, payload, err)
+		}
+	})
+
+	t.Run("oversized frame", func(t *testing.T) {
+		head := []byte{0x82, 127, 0xFF, 0, 0, 0, 0, 0, 0, 0}
+		if _, err := ReadFrame(bytes.NewReader(head)); err == nil {
+			t.Error("expected error for an oversized frame")
+		}
+	})
+}
+
+func TestMessages(t *testing.T) {
+	closeMsg, ok := ToMessage(models.DirectionClient, OpClose, append([]byte{0x03, 0xE8}, "bye"...), 12)
+	if !ok || closeMsg.Type != models.MessageClose || closeMsg.Data != "1000 bye" || closeMsg.OffsetMs != 12 {
+		t.Fatalf("unexpected close message: %+v", closeMsg)
+	}
+
+	opcode, payload := FromMessage(closeMsg)
+	if opcode != OpClose || !bytes.Equal(payload, append([]byte{0x03, 0xE8}, "bye"...)) {
+		t.Errorf("unexpected close payload: %v", payload)
+	}
+
+	binary, _ := ToMessage(models.DirectionServer, OpBinary, []byte{0, 1, 2}, 0)
+	if binary.Data != "AAEC" {
+		t.Errorf("expected base64 data, got %q", binary.Data)
+	}
+
+	if opcode, payload := FromMessage(binary); opcode != OpBinary || !bytes.Equal(payload, []byte{0, 1, 2}) {
+		t.Errorf("unexpected binary payload: %d %v", opcode, payload)
+	}
+
+	if _, ok := ToMessage(models.DirectionServer, OpPong, nil, 0); ok {
+		t.Error("expected pongs not to be recorded")
+	}
+}
+
+func TestDialUpgrade(t *testing.T) {
+	var gotHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get("X-Test")
+
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		for {
+			opcode, payload, err := conn.ReadMessage()
+			if err != nil || opcode == OpClose {
+				return
+			}
+
+			if err := conn.WriteMessage(opcode, payload); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	url := "ws://" + strings.TrimPrefix(server.URL, "http://") + "/echo"
+	conn, resp, err := Dial(url, http.Header{"X-Test": {"yes"}}, 5*time.Second, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols || gotHeader != "yes" {
+		t.Errorf("unexpected handshake: %d %q", resp.StatusCode, gotHeader)
+	}
+
+	if err := conn.WriteMessage(OpText, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	opcode, payload, err := conn.ReadMessage()
+	if err != nil || opcode != OpText || string(payload) != "hi" {
+		t.Errorf("unexpected echo: %d %q %v", opcode, payload, err)
+	}
+
+	if _, _, err := Dial(server.URL, nil, time.Second, nil); err == nil {
+		t.Error("expected error for an http URL")
+	}
+}